@@ -93,6 +93,8 @@ var tmplFunctions = template.FuncMap{
 			return template.HTML("ast.Bool")
 		case ast.Filesystem:
 			return template.HTML("ast.Filesystem")
+		case ast.List:
+			return template.HTML("ast.List")
 		default:
 			return template.HTML(strconv.Quote(string(kind)))
 		}
@@ -12,29 +12,41 @@ import (
 	"github.com/openllb/hlb/parser/ast"
 )
 
+// SchemaVersion is the version of the documentation's JSON schema. It is
+// incremented whenever a field is renamed or removed, or its meaning changes,
+// so that consumers can detect output they don't understand.
+const SchemaVersion = 1
+
 // Documentation contains all the builtin functions defined for HLB.
 type Documentation struct {
-	Builtins []Builtin
+	SchemaVersion int       `json:"SchemaVersion"`
+	Builtins      []Builtin `json:"Builtins"`
 }
 
+// Builtin contains the builtin functions of a kind, sorted by name.
 type Builtin struct {
-	Type  string
-	Funcs []*Func
+	Type  string  `json:"Type"`
+	Funcs []*Func `json:"Funcs"`
 }
 
+// Func documents a builtin function, along with the options that can be
+// passed to it.
 type Func struct {
-	Doc     string
-	Type    string
-	Name    string
-	Params  []Field
-	Options []*Func
+	Doc     string  `json:"Doc"`
+	Type    string  `json:"Type"`
+	Name    string  `json:"Name"`
+	Params  []Field `json:"Params"`
+	Effects []Field `json:"Effects"`
+	Return  string  `json:"Return"`
+	Options []*Func `json:"Options"`
 }
 
+// Field documents a parameter or a side effect of a builtin function.
 type Field struct {
-	Doc      string
-	Variadic bool
-	Type     string
-	Name     string
+	Doc      string `json:"Doc"`
+	Variadic bool   `json:"Variadic"`
+	Type     string `json:"Type"`
+	Name     string `json:"Name"`
 }
 
 func GenerateDocumentation(ctx context.Context, r io.Reader) (*Documentation, error) {
@@ -83,38 +95,7 @@ func GenerateDocumentation(ctx context.Context, r io.Reader) (*Documentation, er
 		}
 
 		if fd.Sig.Params != nil {
-			for _, param := range fd.Sig.Params.Fields() {
-				var (
-					fieldType string
-					fieldName string
-				)
-
-				if param.Type != nil {
-					fieldType = param.Type.String()
-				}
-
-				if param.Name != nil {
-					fieldName = param.Name.String()
-				}
-
-				field := Field{
-					Variadic: param.Modifier != nil && param.Modifier.Variadic != nil,
-					Type:     fieldType,
-					Name:     fieldName,
-				}
-
-				if group != nil {
-					for _, dparam := range group.Params {
-						if dparam.Name != fieldName {
-							continue
-						}
-
-						field.Doc = dparam.Description
-					}
-				}
-
-				fields = append(fields, field)
-			}
+			fields = documentFields(group, fd.Sig.Params.Fields())
 		}
 
 		funcDoc := &Func{
@@ -123,8 +104,13 @@ func GenerateDocumentation(ctx context.Context, r io.Reader) (*Documentation, er
 			Params: fields,
 		}
 
+		if fd.Sig.Effects != nil && fd.Sig.Effects.Effects != nil {
+			funcDoc.Effects = documentFields(group, fd.Sig.Effects.Effects.Fields())
+		}
+
 		if group != nil {
 			funcDoc.Doc = strings.TrimSpace(group.Doc)
+			funcDoc.Return = strings.TrimSpace(group.Return.Description)
 		}
 
 		if fd.Kind().Primary() == ast.Option {
@@ -145,9 +131,9 @@ func GenerateDocumentation(ctx context.Context, r io.Reader) (*Documentation, er
 		}
 	}
 
-	var doc Documentation
+	doc := Documentation{SchemaVersion: SchemaVersion}
 
-	for _, kind := range []string{"fs", "string"} {
+	for _, kind := range []string{"fs", "string", "pipeline"} {
 		funcs := funcsByKind[kind]
 		for _, fun := range funcs {
 			fun := fun
@@ -171,3 +157,42 @@ func GenerateDocumentation(ctx context.Context, r io.Reader) (*Documentation, er
 
 	return &doc, nil
 }
+
+// documentFields documents the fields of a signature with the descriptions of
+// the doxygen params of the same name.
+func documentFields(group *doxygen.Group, params []*ast.Field) []Field {
+	var fields []Field
+	for _, param := range params {
+		var (
+			fieldType string
+			fieldName string
+		)
+
+		if param.Type != nil {
+			fieldType = param.Type.String()
+		}
+
+		if param.Name != nil {
+			fieldName = param.Name.String()
+		}
+
+		field := Field{
+			Variadic: param.Modifier != nil && param.Modifier.Variadic != nil,
+			Type:     fieldType,
+			Name:     fieldName,
+		}
+
+		if group != nil {
+			for _, dparam := range group.Params {
+				if dparam.Name != fieldName {
+					continue
+				}
+
+				field.Doc = dparam.Description
+			}
+		}
+
+		fields = append(fields, field)
+	}
+	return fields
+}
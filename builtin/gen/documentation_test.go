@@ -0,0 +1,120 @@
+package gen
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/lithammer/dedent"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateDocumentation(t *testing.T) {
+	t.Parallel()
+
+	doc, err := GenerateDocumentation(context.Background(), strings.NewReader(strings.TrimSpace(dedent.Dedent(`
+	# Pushes the filesystem to a registry.
+	#
+	# @param ref a distribution reference.
+	# @return the filesystem.
+	fs dockerPush(string ref) binds (string digest)
+
+	# Disables the cache.
+	#
+	# @return an option to disable the cache.
+	option::dockerPush noCache()
+
+	# Concatenates strings.
+	#
+	# @param values the strings to concatenate.
+	# @return the concatenated string.
+	string concat(variadic string values)
+	`))+"\n"))
+	require.NoError(t, err)
+
+	dt, err := json.Marshal(doc)
+	require.NoError(t, err)
+	require.JSONEq(t, `{
+		"SchemaVersion": 1,
+		"Builtins": [{
+			"Type": "fs",
+			"Funcs": [{
+				"Doc": "Pushes the filesystem to a registry.",
+				"Type": "fs",
+				"Name": "dockerPush",
+				"Params": [{"Doc": "a distribution reference.", "Variadic": false, "Type": "string", "Name": "ref"}],
+				"Effects": [{"Doc": "", "Variadic": false, "Type": "string", "Name": "digest"}],
+				"Return": "the filesystem.",
+				"Options": [{
+					"Doc": "Disables the cache.",
+					"Type": "option::dockerPush",
+					"Name": "noCache",
+					"Params": null,
+					"Effects": null,
+					"Return": "an option to disable the cache.",
+					"Options": null
+				}]
+			}]
+		}, {
+			"Type": "string",
+			"Funcs": [{
+				"Doc": "Concatenates strings.",
+				"Type": "string",
+				"Name": "concat",
+				"Params": [{"Doc": "the strings to concatenate.", "Variadic": true, "Type": "string", "Name": "values"}],
+				"Effects": null,
+				"Return": "the concatenated string.",
+				"Options": null
+			}]
+		}, {
+			"Type": "pipeline",
+			"Funcs": null
+		}]
+	}`, string(dt))
+}
+
+func TestDocumentationSchema(t *testing.T) {
+	t.Parallel()
+
+	f, err := os.Open("../../language/builtin.hlb")
+	require.NoError(t, err)
+	defer f.Close()
+
+	doc, err := GenerateDocumentation(context.Background(), f)
+	require.NoError(t, err)
+
+	dt, err := json.Marshal(doc)
+	require.NoError(t, err)
+
+	// The generated JSON must only have the fields of the schema.
+	dec := json.NewDecoder(bytes.NewReader(dt))
+	dec.DisallowUnknownFields()
+
+	var actual Documentation
+	err = dec.Decode(&actual)
+	require.NoError(t, err)
+	require.Equal(t, SchemaVersion, actual.SchemaVersion)
+
+	var kinds []string
+	for _, builtin := range actual.Builtins {
+		kinds = append(kinds, builtin.Type)
+		require.NotEmpty(t, builtin.Funcs, builtin.Type)
+		for _, fun := range builtin.Funcs {
+			require.Equal(t, builtin.Type, fun.Type)
+			require.NotEmpty(t, fun.Name)
+			require.NotEmpty(t, fun.Doc, fun.Name)
+			for _, param := range fun.Params {
+				require.NotEmpty(t, param.Name, fun.Name)
+				require.NotEmpty(t, param.Type, fun.Name)
+			}
+			for _, opt := range fun.Options {
+				require.True(t, strings.HasPrefix(opt.Type, "option::"), opt.Name)
+				require.NotEmpty(t, opt.Name)
+			}
+		}
+	}
+	require.Equal(t, []string{"fs", "string", "pipeline"}, kinds)
+}
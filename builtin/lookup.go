@@ -55,7 +55,22 @@ var (
 						Params: []*ast.Field{
 							ast.NewField(ast.String, "source", false),
 						},
-						Effects: []*ast.Field{},
+						Effects: []*ast.Field{
+							ast.NewField(ast.String, "entrypoint", false),
+							ast.NewField(ast.String, "env", false),
+							ast.NewField(ast.String, "labels", false),
+						},
+					},
+					"fromDockerfile": {
+						Params: []*ast.Field{
+							ast.NewField(ast.Filesystem, "context", false),
+							ast.NewField(ast.String, "filename", false),
+						},
+						Effects: []*ast.Field{
+							ast.NewField(ast.String, "entrypoint", false),
+							ast.NewField(ast.String, "env", false),
+							ast.NewField(ast.String, "labels", false),
+						},
 					},
 					"shell": {
 						Params: []*ast.Field{
@@ -109,6 +124,13 @@ var (
 						},
 						Effects: []*ast.Field{},
 					},
+					"chmod": {
+						Params: []*ast.Field{
+							ast.NewField(ast.String, "path", false),
+							ast.NewField(ast.Int, "filemode", false),
+						},
+						Effects: []*ast.Field{},
+					},
 					"copy": {
 						Params: []*ast.Field{
 							ast.NewField(ast.Filesystem, "input", false),
@@ -117,12 +139,34 @@ var (
 						},
 						Effects: []*ast.Field{},
 					},
+					"archive": {
+						Params: []*ast.Field{
+							ast.NewField(ast.Filesystem, "input", false),
+							ast.NewField(ast.String, "src", false),
+							ast.NewField(ast.String, "destTar", false),
+						},
+						Effects: []*ast.Field{},
+					},
+					"copyURL": {
+						Params: []*ast.Field{
+							ast.NewField(ast.String, "url", false),
+							ast.NewField(ast.String, "dst", false),
+						},
+						Effects: []*ast.Field{},
+					},
 					"merge": {
 						Params: []*ast.Field{
 							ast.NewField(ast.Filesystem, "inputs", true),
 						},
 						Effects: []*ast.Field{},
 					},
+					"mergeInput": {
+						Params: []*ast.Field{
+							ast.NewField(ast.Filesystem, "input", false),
+							ast.NewField(ast.String, "subpath", false),
+						},
+						Effects: []*ast.Field{},
+					},
 					"diff": {
 						Params: []*ast.Field{
 							ast.NewField(ast.Filesystem, "base", false),
@@ -187,6 +231,13 @@ var (
 						},
 						Effects: []*ast.Field{},
 					},
+					"annotation": {
+						Params: []*ast.Field{
+							ast.NewField(ast.String, "key", false),
+							ast.NewField(ast.String, "value", false),
+						},
+						Effects: []*ast.Field{},
+					},
 					"expose": {
 						Params: []*ast.Field{
 							ast.NewField(ast.String, "ports", true),
@@ -205,6 +256,39 @@ var (
 						},
 						Effects: []*ast.Field{},
 					},
+					"healthcheck": {
+						Params: []*ast.Field{
+							ast.NewField(ast.String, "args", true),
+						},
+						Effects: []*ast.Field{},
+					},
+				},
+			},
+			ast.List: {
+				Func: map[string]FuncLookup{
+					"split": {
+						Params: []*ast.Field{
+							ast.NewField(ast.String, "sep", false),
+							ast.NewField(ast.String, "text", false),
+						},
+						Effects: []*ast.Field{},
+					},
+				},
+			},
+			"option::archive": {
+				Func: map[string]FuncLookup{
+					"gzip": {
+						Params:  []*ast.Field{},
+						Effects: []*ast.Field{},
+					},
+				},
+			},
+			"option::chmod": {
+				Func: map[string]FuncLookup{
+					"allowWildcard": {
+						Params:  []*ast.Field{},
+						Effects: []*ast.Field{},
+					},
 				},
 			},
 			"option::copy": {
@@ -213,6 +297,10 @@ var (
 						Params:  []*ast.Field{},
 						Effects: []*ast.Field{},
 					},
+					"noDereference": {
+						Params:  []*ast.Field{},
+						Effects: []*ast.Field{},
+					},
 					"contentsOnly": {
 						Params:  []*ast.Field{},
 						Effects: []*ast.Field{},
@@ -251,6 +339,10 @@ var (
 						},
 						Effects: []*ast.Field{},
 					},
+					"preserveTimestamps": {
+						Params:  []*ast.Field{},
+						Effects: []*ast.Field{},
+					},
 					"includePatterns": {
 						Params: []*ast.Field{
 							ast.NewField(ast.String, "pattern", true),
@@ -263,6 +355,49 @@ var (
 						},
 						Effects: []*ast.Field{},
 					},
+					"gitignore": {
+						Params:  []*ast.Field{},
+						Effects: []*ast.Field{},
+					},
+					"platform": {
+						Params: []*ast.Field{
+							ast.NewField(ast.String, "os", false),
+							ast.NewField(ast.String, "arch", false),
+						},
+						Effects: []*ast.Field{},
+					},
+				},
+			},
+			"option::copyURL": {
+				Func: map[string]FuncLookup{
+					"checksum": {
+						Params: []*ast.Field{
+							ast.NewField(ast.String, "digest", false),
+						},
+						Effects: []*ast.Field{},
+					},
+					"chmod": {
+						Params: []*ast.Field{
+							ast.NewField(ast.Int, "filemode", false),
+						},
+						Effects: []*ast.Field{},
+					},
+				},
+			},
+			"option::dockerLoad": {
+				Func: map[string]FuncLookup{
+					"cacheImport": {
+						Params: []*ast.Field{
+							ast.NewField(ast.String, "spec", false),
+						},
+						Effects: []*ast.Field{},
+					},
+					"cacheExport": {
+						Params: []*ast.Field{
+							ast.NewField(ast.String, "spec", false),
+						},
+						Effects: []*ast.Field{},
+					},
 				},
 			},
 			"option::dockerPush": {
@@ -271,6 +406,106 @@ var (
 						Params:  []*ast.Field{},
 						Effects: []*ast.Field{},
 					},
+					"authFrom": {
+						Params: []*ast.Field{
+							ast.NewField(ast.String, "source", false),
+						},
+						Effects: []*ast.Field{},
+					},
+					"cacheImport": {
+						Params: []*ast.Field{
+							ast.NewField(ast.String, "spec", false),
+						},
+						Effects: []*ast.Field{},
+					},
+					"cacheExport": {
+						Params: []*ast.Field{
+							ast.NewField(ast.String, "spec", false),
+						},
+						Effects: []*ast.Field{},
+					},
+				},
+			},
+			"option::download": {
+				Func: map[string]FuncLookup{
+					"cacheImport": {
+						Params: []*ast.Field{
+							ast.NewField(ast.String, "spec", false),
+						},
+						Effects: []*ast.Field{},
+					},
+					"cacheExport": {
+						Params: []*ast.Field{
+							ast.NewField(ast.String, "spec", false),
+						},
+						Effects: []*ast.Field{},
+					},
+				},
+			},
+			"option::downloadDockerTarball": {
+				Func: map[string]FuncLookup{
+					"checksum": {
+						Params: []*ast.Field{
+							ast.NewField(ast.String, "digest", false),
+						},
+						Effects: []*ast.Field{},
+					},
+					"cacheImport": {
+						Params: []*ast.Field{
+							ast.NewField(ast.String, "spec", false),
+						},
+						Effects: []*ast.Field{},
+					},
+					"cacheExport": {
+						Params: []*ast.Field{
+							ast.NewField(ast.String, "spec", false),
+						},
+						Effects: []*ast.Field{},
+					},
+				},
+			},
+			"option::downloadOCITarball": {
+				Func: map[string]FuncLookup{
+					"checksum": {
+						Params: []*ast.Field{
+							ast.NewField(ast.String, "digest", false),
+						},
+						Effects: []*ast.Field{},
+					},
+					"cacheImport": {
+						Params: []*ast.Field{
+							ast.NewField(ast.String, "spec", false),
+						},
+						Effects: []*ast.Field{},
+					},
+					"cacheExport": {
+						Params: []*ast.Field{
+							ast.NewField(ast.String, "spec", false),
+						},
+						Effects: []*ast.Field{},
+					},
+				},
+			},
+			"option::downloadTarball": {
+				Func: map[string]FuncLookup{
+					"checksum": {
+						Params: []*ast.Field{
+							ast.NewField(ast.String, "digest", false),
+						},
+						Effects: []*ast.Field{},
+					},
+					"cacheImport": {
+						Params: []*ast.Field{
+							ast.NewField(ast.String, "spec", false),
+						},
+						Effects: []*ast.Field{},
+					},
+					"cacheExport": {
+						Params: []*ast.Field{
+							ast.NewField(ast.String, "spec", false),
+						},
+						Effects: []*ast.Field{},
+					},
 				},
 			},
 			"option::forward": {
@@ -295,6 +530,23 @@ var (
 					},
 				},
 			},
+			"option::fromDockerfile": {
+				Func: map[string]FuncLookup{
+					"target": {
+						Params: []*ast.Field{
+							ast.NewField(ast.String, "stage", false),
+						},
+						Effects: []*ast.Field{},
+					},
+					"buildArg": {
+						Params: []*ast.Field{
+							ast.NewField(ast.String, "key", false),
+							ast.NewField(ast.String, "value", false),
+						},
+						Effects: []*ast.Field{},
+					},
+				},
+			},
 			"option::frontend": {
 				Func: map[string]FuncLookup{
 					"input": {
@@ -311,6 +563,19 @@ var (
 						},
 						Effects: []*ast.Field{},
 					},
+					"target": {
+						Params: []*ast.Field{
+							ast.NewField(ast.String, "name", false),
+						},
+						Effects: []*ast.Field{},
+					},
+					"buildArg": {
+						Params: []*ast.Field{
+							ast.NewField(ast.String, "key", false),
+							ast.NewField(ast.String, "value", false),
+						},
+						Effects: []*ast.Field{},
+					},
 				},
 			},
 			"option::git": {
@@ -319,6 +584,40 @@ var (
 						Params:  []*ast.Field{},
 						Effects: []*ast.Field{},
 					},
+					"subdir": {
+						Params: []*ast.Field{
+							ast.NewField(ast.String, "path", false),
+						},
+						Effects: []*ast.Field{},
+					},
+				},
+			},
+			"option::healthcheck": {
+				Func: map[string]FuncLookup{
+					"interval": {
+						Params: []*ast.Field{
+							ast.NewField(ast.String, "duration", false),
+						},
+						Effects: []*ast.Field{},
+					},
+					"timeout": {
+						Params: []*ast.Field{
+							ast.NewField(ast.String, "duration", false),
+						},
+						Effects: []*ast.Field{},
+					},
+					"startPeriod": {
+						Params: []*ast.Field{
+							ast.NewField(ast.String, "duration", false),
+						},
+						Effects: []*ast.Field{},
+					},
+					"retries": {
+						Params: []*ast.Field{
+							ast.NewField(ast.Int, "count", false),
+						},
+						Effects: []*ast.Field{},
+					},
 				},
 			},
 			"option::http": {
@@ -349,6 +648,16 @@ var (
 						Params:  []*ast.Field{},
 						Effects: []*ast.Field{},
 					},
+					"noResolve": {
+						Params:  []*ast.Field{},
+						Effects: []*ast.Field{},
+					},
+					"authFrom": {
+						Params: []*ast.Field{
+							ast.NewField(ast.String, "source", false),
+						},
+						Effects: []*ast.Field{},
+					},
 					"platform": {
 						Params: []*ast.Field{
 							ast.NewField(ast.String, "os", false),
@@ -457,6 +766,10 @@ var (
 						},
 						Effects: []*ast.Field{},
 					},
+					"contentsOnly": {
+						Params:  []*ast.Field{},
+						Effects: []*ast.Field{},
+					},
 					"cache": {
 						Params: []*ast.Field{
 							ast.NewField(ast.String, "cacheid", false),
@@ -464,6 +777,12 @@ var (
 						},
 						Effects: []*ast.Field{},
 					},
+					"lockfile": {
+						Params: []*ast.Field{
+							ast.NewField(ast.String, "path", false),
+						},
+						Effects: []*ast.Field{},
+					},
 				},
 			},
 			"option::rm": {
@@ -503,6 +822,16 @@ var (
 						},
 						Effects: []*ast.Field{},
 					},
+					"ensureDir": {
+						Params:  []*ast.Field{},
+						Effects: []*ast.Field{},
+					},
+					"timeout": {
+						Params: []*ast.Field{
+							ast.NewField(ast.String, "duration", false),
+						},
+						Effects: []*ast.Field{},
+					},
 					"ignoreCache": {
 						Params:  []*ast.Field{},
 						Effects: []*ast.Field{},
@@ -519,10 +848,28 @@ var (
 						},
 						Effects: []*ast.Field{},
 					},
+					"ulimit": {
+						Params: []*ast.Field{
+							ast.NewField(ast.String, "name", false),
+							ast.NewField(ast.Int, "soft", false),
+							ast.NewField(ast.Int, "hard", false),
+						},
+						Effects: []*ast.Field{},
+					},
+					"cgroupParent": {
+						Params: []*ast.Field{
+							ast.NewField(ast.String, "name", false),
+						},
+						Effects: []*ast.Field{},
+					},
 					"shlex": {
 						Params:  []*ast.Field{},
 						Effects: []*ast.Field{},
 					},
+					"useEntrypoint": {
+						Params:  []*ast.Field{},
+						Effects: []*ast.Field{},
+					},
 					"host": {
 						Params: []*ast.Field{
 							ast.NewField(ast.String, "hostname", false),
@@ -530,6 +877,24 @@ var (
 						},
 						Effects: []*ast.Field{},
 					},
+					"hostname": {
+						Params: []*ast.Field{
+							ast.NewField(ast.String, "name", false),
+						},
+						Effects: []*ast.Field{},
+					},
+					"stdin": {
+						Params: []*ast.Field{
+							ast.NewField(ast.String, "content", false),
+						},
+						Effects: []*ast.Field{},
+					},
+					"stdinFile": {
+						Params: []*ast.Field{
+							ast.NewField(ast.String, "localPath", false),
+						},
+						Effects: []*ast.Field{},
+					},
 					"ssh": {
 						Params:  []*ast.Field{},
 						Effects: []*ast.Field{},
@@ -557,6 +922,21 @@ var (
 							ast.NewField(ast.Filesystem, "target", false),
 						},
 					},
+					"mountFiles": {
+						Params: []*ast.Field{
+							ast.NewField(ast.Filesystem, "input", false),
+							ast.NewField(ast.String, "mountPoint", false),
+						},
+						Effects: []*ast.Field{},
+					},
+					"cacheDir": {
+						Params: []*ast.Field{
+							ast.NewField(ast.String, "cacheid", false),
+							ast.NewField(ast.String, "mountPoint", false),
+							ast.NewField(ast.String, "sharingmode", false),
+						},
+						Effects: []*ast.Field{},
+					},
 				},
 			},
 			"option::secret": {
@@ -692,12 +1072,68 @@ var (
 							ast.NewField(ast.String, "index", false),
 						},
 					},
+					"readFile": {
+						Params: []*ast.Field{
+							ast.NewField(ast.String, "localPath", false),
+						},
+						Effects: []*ast.Field{},
+					},
 					"template": {
 						Params: []*ast.Field{
 							ast.NewField(ast.String, "text", false),
 						},
 						Effects: []*ast.Field{},
 					},
+					"toLower": {
+						Params:  []*ast.Field{},
+						Effects: []*ast.Field{},
+					},
+					"toUpper": {
+						Params:  []*ast.Field{},
+						Effects: []*ast.Field{},
+					},
+					"trimSpace": {
+						Params:  []*ast.Field{},
+						Effects: []*ast.Field{},
+					},
+					"trimPrefix": {
+						Params: []*ast.Field{
+							ast.NewField(ast.String, "prefix", false),
+						},
+						Effects: []*ast.Field{},
+					},
+					"trimSuffix": {
+						Params: []*ast.Field{
+							ast.NewField(ast.String, "suffix", false),
+						},
+						Effects: []*ast.Field{},
+					},
+					"replace": {
+						Params: []*ast.Field{
+							ast.NewField(ast.String, "old", false),
+							ast.NewField(ast.String, "new", false),
+						},
+						Effects: []*ast.Field{},
+					},
+					"sha256": {
+						Params:  []*ast.Field{},
+						Effects: []*ast.Field{},
+					},
+					"base64encode": {
+						Params:  []*ast.Field{},
+						Effects: []*ast.Field{},
+					},
+					"base64decode": {
+						Params:  []*ast.Field{},
+						Effects: []*ast.Field{},
+					},
+					"join": {
+						Params: []*ast.Field{
+							ast.NewField(ast.String, "sep", false),
+							ast.NewField(ast.List, "values", false),
+						},
+						Effects: []*ast.Field{},
+					},
 				},
 			},
 		},
@@ -710,6 +1146,10 @@ fs scratch()
 
 # An OCI image&#39;s filesystem.
 #
+# When the image is resolved, its reference and the digest it resolved to are
+# recorded as the org.opencontainers.image.base.name and
+# org.opencontainers.image.base.digest annotations of images exported from it.
+#
 # @param ref a docker registry reference. if not fully qualified, it will be 
 # expanded the same as the docker CLI.
 # @return a filesystem of the image.
@@ -721,6 +1161,22 @@ fs image(string ref)
 # @return an option to resolve the image&#39;s OCI image config.
 option::image resolve()
 
+# Skips resolving the OCI Image Config, so the image&#39;s environment, working
+# directory, and entrypoint are not inherited. The image is still pulled when
+# the filesystem is solved, but compiling it needs no registry access.
+#
+# @return an option to skip resolving the image&#39;s OCI image config.
+option::image noResolve()
+
+# Selects the credentials for the image&#39;s registry, instead of the credential
+# store and helpers configured in the local Docker config.
+#
+# @param source either &#34;helper:&lt;name&gt;&#34; to use the credential helper
+# docker-credential-&lt;name&gt;, or &#34;token:&lt;path&gt;&#34; to use the registry token in a
+# local file.
+# @return an option to select the credentials to pull the image with.
+option::image authFrom(string source)
+
 # Specifies the desired platform for a multi-platform docker image.
 #
 # @return an option to specify the platform for an OCI image config.
@@ -764,6 +1220,13 @@ fs git(string remote, string ref)
 # @return the option to keep the &#34;.git&#34; directory.
 option::git keepGitDir()
 
+# Checks out only a subdirectory of the git repository, so the filesystem
+# contains the files of the subdirectory at its root.
+#
+# @param path the path of the subdirectory in the git repository.
+# @return the option to check out a subdirectory.
+option::git subdir(string path)
+
 # A filesystem with the files synced up from a file or directory on the local
 # system.
 #
@@ -785,12 +1248,14 @@ option::local includePatterns(variadic string pattern)
 # @return an option to sync files that don&#39;t match any pattern.
 option::local excludePatterns(variadic string pattern)
 
-# Generates a filesystem using an external frontend.
+# Generates a filesystem using an external frontend. The entrypoint, env and
+# labels of the image config returned by the frontend can be bound as JSON
+# strings.
 #
 # @param frontend a filesystem with an executable that runs a BuildKit gateway
 # GRPC client over stdio.
 # @return a filesystem generated by the external frontend.
-fs frontend(string source)
+fs frontend(string source) binds (string entrypoint, string env, string labels)
 
 # Provide an input filesystem to the external frontend. Read the documentation
 # for the frontend to see what it will accept.
@@ -808,8 +1273,52 @@ option::frontend input(string key, fs value)
 # @return an option to provide a key value pair to the external frontend.
 option::frontend opt(string key, string value)
 
+# Builds a target of the external frontend, such as a stage of a Dockerfile.
+# This is the same as opt &#34;target&#34; with the name.
+#
+# @param name the name of the target to build.
+# @return an option to build the named target.
+option::frontend target(string name)
+
+# Sets a build argument of the external frontend, like the --build-arg flag
+# of docker build. This is the same as opt with the key prefixed by
+# &#34;build-arg:&#34;.
+#
+# @param key the name of the build argument.
+# @param value the value of the build argument.
+# @return an option to set a build argument.
+option::frontend buildArg(string key, string value)
+
+# Generates a filesystem by building a Dockerfile with the BuildKit Dockerfile
+# frontend. Like frontend, the entrypoint, env and labels of the image config
+# of the built stage can be bound as JSON strings.
+#
+# @param context the build context, which the Dockerfile is also read from.
+# @param filename the path of the Dockerfile in the build context.
+# @return the filesystem of the built stage.
+fs fromDockerfile(fs context, string filename) binds (string entrypoint, string env, string labels)
+
+# Builds a stage of the Dockerfile instead of the last stage.
+#
+# @param stage the name of the stage to build.
+# @return an option to build the named stage.
+option::fromDockerfile target(string stage)
+
+# Sets a build argument of the Dockerfile, like the --build-arg flag of
+# docker build.
+#
+# @param key the name of the build argument.
+# @param value the value of the build argument.
+# @return an option to set a build argument.
+option::fromDockerfile buildArg(string key, string value)
+
 # Sets the current shell command to use when executing subsequent &#34;run&#34;
-# methods. By default, this is [&#34;sh&#34;, &#34;-c&#34;].
+# methods. By default, this is [&#34;/bin/sh&#34;, &#34;-c&#34;].
+#
+# The shell only prefixes &#34;run&#34; statements with exactly one arg, unless they
+# use &#34;shlex&#34;. When exported as a Docker image, it is also the shell for the
+# shell form commands of Dockerfiles built on top of the image. Without any
+# args, the default shell is restored.
 #
 # @param arg the list of args used to prefix &#34;run&#34; statements.
 # @return the filesystem with a new default shell.
@@ -819,7 +1328,8 @@ fs shell(variadic string arg)
 #
 # If no arguments are given, it will execute the current args set on the
 # filesystem.
-# If exactly one arg is given it will be wrapped with /bin/sh -c &#39;arg&#39;.
+# If exactly one arg is given it will be wrapped with the current shell, which
+# is /bin/sh -c &#39;arg&#39; by default.
 # If more than one arg is given, it will be executed directly, without a shell.
 #
 # @param arg are optional arguments to execute.
@@ -850,6 +1360,22 @@ option::run dir(string path)
 # @return an option to set the current user.
 option::run user(string name)
 
+# Creates the working directory before the run command executes, so the
+# command doesn&#39;t fail when it doesn&#39;t exist yet. When a user is set for the
+# run, the directory is owned by that user, and the directory in the HOME
+# environment variable is created as well.
+#
+# @return an option to create the working directory before the command executes.
+option::run ensureDir()
+
+# Cancels the run command if it doesn&#39;t finish within the duration. BuildKit
+# can&#39;t time out a single command, so the timeout applies to solving the
+# entire filesystem the run command is part of.
+#
+# @param duration the maximum time to solve, for example &#34;30s&#34; or &#34;1m30s&#34;.
+# @return an option to cancel the run command after the duration.
+option::run timeout(string duration)
+
 # Ignore any previously cached results for the run command.
 #
 # @return an option to ignore existing cache for the run command.
@@ -875,12 +1401,35 @@ option::run network(string networkmode)
 # - insecure: enables all capabilities.
 option::run security(string securitymode)
 
+# Sets a resource limit for the duration of the run command, like &#34;ulimit&#34; in
+# a shell.
+#
+# @param name the resource to limit, such as &#34;nofile&#34; or &#34;nproc&#34;.
+# @param soft the soft limit, which must not exceed the hard limit.
+# @param hard the hard limit.
+# @return an option to set a resource limit of the container.
+option::run ulimit(string name, int soft, int hard)
+
+# Sets the parent cgroup of the container for the duration of the run command.
+# The cgroup is only honored by workers that manage cgroups.
+#
+# @param name the path of the parent cgroup.
+# @return an option to set the parent cgroup of the container.
+option::run cgroupParent(string name)
+
 # Attempt to lex the single-argument shell command provided to &#34;run&#34;
 # to determine if a &#34;/bin/sh -c &#39;...&#39;&#34; wrapper needs to be added.
 #
 # @return an option to attempt to optimize the command execution remoiving the /bin/sh -c &#34;...&#34; wrapper when possible.
 option::run shlex()
 
+# Appends the args of the run command to the entrypoint of the image, like the
+# args of &#34;docker run&#34;. The args are never wrapped with &#34;/bin/sh -c&#34;, but a
+# single arg is still split when combined with &#34;shlex&#34;.
+#
+# @return an option to run the command with the entrypoint of the image.
+option::run useEntrypoint()
+
 # Adds a host entry to /etc/hosts for the duration of the run command.
 #
 # @param hostname the host name of the entry, may include spaces to delimit
@@ -888,6 +1437,29 @@ option::run shlex()
 # @param address the IP of the entry.
 option::run host(string hostname, string address)
 
+# Sets the hostname of the container for the duration of the run command. By
+# default, BuildKit assigns a generated hostname.
+#
+# @param name the hostname of the container.
+# @return an option to set the hostname of the container.
+option::run hostname(string name)
+
+# Writes the content to the stdin of the run command. The command is run by
+# &#34;/bin/sh&#34; with its stdin redirected from a file mounted with the content, so
+# the filesystem must have a shell.
+#
+# @param content the content to write to stdin.
+# @return an option to write content to the stdin of the run command.
+option::run stdin(string content)
+
+# Writes the content of a local file to the stdin of the run command. The
+# command is run by &#34;/bin/sh&#34; with its stdin redirected from a file mounted
+# with the content, so the filesystem must have a shell.
+#
+# @param localPath the path to the local file, relative to the module.
+# @return an option to write a local file to the stdin of the run command.
+option::run stdinFile(string localPath)
+
 # Mounts a SSH socket for the duration of the run command. By default, it will
 # try to use the SSH socket found from $SSH_AUTH_SOCK. Otherwise, an option
 # &#34;localPath&#34; can be provided to specify a filepath to a SSH auth socket or
@@ -941,6 +1513,31 @@ option::run secret(string localPath, string mountPoint)
 # @return an option to mount an additional filesystem.
 option::run mount(fs input, string mountPoint) binds (fs target)
 
+# Attaches a small read-only filesystem generated at codegen time for the
+# duration of the run command, such as a scratch filesystem populated with
+# &#34;mkfile&#34;. Unlike &#34;mount&#34;, the mount is always read-only and never produces an
+# output, so the files don&#39;t leak into the resulting filesystem and the run
+# command&#39;s cache is only invalidated when the files change.
+#
+# @param input the filesystem containing the generated files.
+# @param mountPoint the directory where the files are attached.
+# @return an option to mount generated files.
+option::run mountFiles(fs input, string mountPoint)
+
+# Mounts a persistent cache directory for the duration of the run command,
+# without a filesystem to seed it. It is a shorthand for mounting scratch with
+# the &#34;cache&#34; option.
+#
+# @param cacheid the unique ID to identify the cache.
+# @param mountPoint the directory where the cache is mounted.
+# @param sharingmode the sharing mode of the cache, must be one of the
+# following:
+# - shared: can be used concurrently by multiple writers.
+# - private: creates a new mount if there are multiple writers.
+# - locked: pauses additional writers until the first one releases the mount.
+# @return an option to mount a cache directory.
+option::run cacheDir(string cacheid, string mountPoint, string sharingmode)
+
 # Sets the target directory to mount the SSH agent socket. By default, it is
 # mounted to &#34;/run/buildkit/ssh_agent.${N}&#34;, where N is the index of the 
 # socket. If $SSH_AUTH_SOCK is not set, it will set SSH_AUTH_SOCK to the
@@ -1027,6 +1624,16 @@ option::mount tmpfs()
 # @return an option to mount a specific path from the input filesystem.
 option::mount sourcePath(string path)
 
+# Mount only the contents of the input filesystem. When the input filesystem
+# is from http, the downloaded file itself is mounted at the mountpoint
+# instead of a directory containing it. The file is expected to be named after
+# the URL, so use the &#34;filename&#34; option if the server names it otherwise.
+# Other filesystems, such as those from git, already have their contents at
+# the root.
+#
+# @return an option to mount only the contents of the input filesystem.
+option::mount contentsOnly()
+
 # Cache a snapshot of the mount after the run command has executed. A cacheid
 # must be provided to uniquely identify the cache mount.
 #
@@ -1040,6 +1647,15 @@ option::mount sourcePath(string path)
 # be aliased, and then pushed as an image, so that there it can be a stable
 # snapshot, or updated externally.
 #
+# The input filesystem of the mount seeds the cache the first time it is used,
+# such as a package cache from an image layer. Later runs reuse the cache as
+# left by the previous run, and a different input starts a separate cache.
+#
+# Cache mounts cannot be limited in size individually. They are evicted by
+# BuildKit&#39;s garbage collector in least recently used order once the daemon&#39;s
+# storage limit is reached, which is configured with &#34;keepBytes&#34; in the gc
+# policies of buildkitd.toml.
+#
 # @param cacheid the unique ID to identify the cache.
 # @param sharingmode the sharing mode of the cache, must be one of the
 # following:
@@ -1049,6 +1665,15 @@ option::mount sourcePath(string path)
 # @return an option to cache a mount.
 option::mount cache(string cacheid, string sharingmode)
 
+# Keys the cache of the mount by the content of a lockfile, such as go.sum or
+# package-lock.json. The sha256 digest of the file is appended to the cache ID,
+# so the cache is only shared among builds with identical dependencies. It
+# must be used together with the &#34;cache&#34; option.
+#
+# @param path the path of the lockfile, relative to the current module.
+# @return an option to key a cache mount by a lockfile.
+option::mount lockfile(string path)
+
 # Sets an environment key pair for all subsequent calls in this filesystem
 # block.
 #
@@ -1129,6 +1754,22 @@ option::rm allowNotFound()
 # @return an option to allow wildcards in the path to remove.
 option::rm allowWildcard()
 
+# Changes the permissions of a path in the current filesystem. If the path is
+# a directory, only the permissions of the directory are changed, not of the
+# files within it. A path that doesn&#39;t exist is left as is.
+#
+# @param path the path to change the permissions of.
+# @param filemode the new permissions of the path.
+# @return a filesystem with the permissions of the path changed.
+fs chmod(string path, int filemode)
+
+# Allows wildcards in the last element of the path to change the permissions
+# of.
+#
+# @return an option to allow wildcards in the path to change the permissions
+# of.
+option::chmod allowWildcard()
+
 # Copies a file from an input filesystem into the current filesystem.
 #
 # @param input the filesystem to copy from.
@@ -1142,6 +1783,13 @@ fs copy(fs input, string src, string dst)
 # @return an option to follow symlinks and copy their targets.
 option::copy followSymlinks()
 
+# Copy symlinks in the input filesystem as symlinks instead of dereferencing
+# them. This is the default, but can be used to override a &#34;followSymlinks&#34;
+# from an earlier option.
+#
+# @return an option to preserve symlinks instead of copying their targets.
+option::copy noDereference()
+
 # If the &#34;src&#34; path is a directory, only the contents of the directory is
 # copied to the destination.
 #
@@ -1187,6 +1835,13 @@ option::copy chmod(int filemode)
 # @return an option to set the created time of the copy path.
 option::copy createdTime(string created)
 
+# Keeps the modified times of the source files on the copy path. This is the
+# default, but can be used to override a &#34;createdTime&#34; from an earlier option,
+# as the last of the two options takes effect.
+#
+# @return an option to preserve the modified times of the copied files.
+option::copy preserveTimestamps()
+
 # Copy only files that match any of the included patterns. If source path is
 # for a file, then include patterns are ignored.
 #
@@ -1201,15 +1856,87 @@ option::copy includePatterns(variadic string pattern)
 # @return an option to copy files that don&#39;t match any pattern.
 option::copy excludePatterns(variadic string pattern)
 
+# Copy only files that are not ignored by the .gitignore files of the source,
+# both those nested within the source path and those in its parent
+# directories. Rules in deeper ignore files take precedence, as they do in git.
+# The ignore files are read from the host, so the source must be a filesystem
+# created by &#34;local&#34; without further changes. Rules for directories only, which
+# end in a slash, also exclude files of the same name.
+#
+# @return an option to copy files that aren&#39;t ignored by git.
+option::copy gitignore()
+
+# Declares the platform that the copied content is built for, such as the
+# target of a cross-compiled binary. The copy fails if it differs from the
+# platform of the current filesystem, and the platform is recorded in the
+# image history.
+#
+# @param os operating system name, eg &#34;linux&#34;
+# @param arch architecture name with an optional variant, eg &#34;amd64&#34; or &#34;arm/v7&#34;
+# @return an option to check the platform of the copied content.
+option::copy platform(string os, string arch)
+
+# Writes a tar archive of a path of an input filesystem as a file in the
+# current filesystem. The archive is created by running tar in a busybox image
+# with the input mounted, so the input is built along with the filesystem.
+#
+# @param input the filesystem to archive from.
+# @param src the path from the input filesystem. If it is a directory, the
+# archive contains the contents of the directory.
+# @param destTar the path in the current filesystem to write the archive to.
+# @return a filesystem with the archive written to the destination.
+fs archive(fs input, string src, string destTar)
+
+# Compresses the archive with gzip.
+#
+# @return an option to gzip the archive.
+option::archive gzip()
+
+# Copies a single file retrieved from a HTTP URL into the current filesystem.
+# This is a shorthand for copying the file from a &#34;http&#34; filesystem.
+#
+# @param url a fully-qualified URL to send a HTTP GET request.
+# @param dst the path in the current filesystem.
+# @return a filesystem with the downloaded HTTP resource copied to the
+# destination.
+fs copyURL(string url, string dst)
+
+# Verifies the checksum of the retrieved file against a digest.
+#
+# @param digest a checksum in the form of an OCI digest.
+# https://github.com/opencontainers/image-spec/blob/master/descriptor.md#digests
+# @return an option to verify the checksum of the file.
+option::copyURL checksum(string digest)
+
+# Modifies the permissions of the retrieved file.
+#
+# @param filemode the new permissions of the file.
+# @return an option to chmod the file.
+option::copyURL chmod(int filemode)
+
 # Merges one or more input filesystems into the current filesystem.
 #
+# Experimental, only available with the --experimental flag.
+#
 # @param input filesystems to merge.
 # @return merged filesystem with union of the current filesystem and inputs.
 fs merge(variadic fs inputs)
 
+# A filesystem with only a path of the input filesystem, at the same path. Use
+# it to merge only the selected paths of each input.
+#
+# Experimental, only available with the --experimental flag.
+#
+# @param input the filesystem to select the path from.
+# @param subpath the path to select from the input.
+# @return a filesystem with only the path of the input.
+fs mergeInput(fs input, string subpath)
+
 # Returns the differences between the current filesystem and the filesystem
 # provided as an argument.
 #
+# Experimental, only available with the --experimental flag.
+#
 # @param base filesystem to use as diff base
 # @return differences from base
 fs diff(fs base)
@@ -1232,6 +1959,35 @@ fs dockerPush(string ref) binds (string digest)
 # @return an option to compress image as eStargz before pushing.
 option::dockerPush stargz()
 
+# Selects the credentials for the image&#39;s registry, instead of the credential
+# store and helpers configured in the local Docker config.
+#
+# @param source either &#34;helper:&lt;name&gt;&#34; to use the credential helper
+# docker-credential-&lt;name&gt;, or &#34;token:&lt;path&gt;&#34; to use the registry token in a
+# local file.
+# @return an option to select the credentials to push the image with.
+option::dockerPush authFrom(string source)
+
+# Imports build cache from a cache backend when solving the output, like the
+# --cache-from flag of docker buildx build. The spec is a comma separated list
+# of key=value pairs such as &#34;type=registry,ref=docker.io/org/app:buildcache&#34;,
+# or just a ref to import a registry cache. Inline caches are imported from
+# their image with the registry type.
+#
+# @param spec the type and attributes of the cache backend.
+# @return an option to import build cache.
+option::dockerPush cacheImport(string spec)
+
+# Exports the build cache of the output to a cache backend, like the
+# --cache-to flag of docker buildx build. The spec is a comma separated list
+# of key=value pairs such as
+# &#34;type=registry,ref=docker.io/org/app:buildcache,mode=max&#34;, or just a ref to
+# export a registry cache. Local caches are not supported.
+#
+# @param spec the type and attributes of the cache backend.
+# @return an option to export build cache.
+option::dockerPush cacheExport(string spec)
+
 # Loads the filesystem as a Docker image to the docker client found in your
 # environment.
 #
@@ -1240,18 +1996,86 @@ option::dockerPush stargz()
 # environment.
 fs dockerLoad(string ref)
 
+# Imports build cache from a cache backend when solving the output, like the
+# --cache-from flag of docker buildx build. The spec is a comma separated list
+# of key=value pairs such as &#34;type=registry,ref=docker.io/org/app:buildcache&#34;,
+# or just a ref to import a registry cache. Inline caches are imported from
+# their image with the registry type.
+#
+# @param spec the type and attributes of the cache backend.
+# @return an option to import build cache.
+option::dockerLoad cacheImport(string spec)
+
+# Exports the build cache of the output to a cache backend, like the
+# --cache-to flag of docker buildx build. The spec is a comma separated list
+# of key=value pairs such as
+# &#34;type=registry,ref=docker.io/org/app:buildcache,mode=max&#34;, or just a ref to
+# export a registry cache. Local caches are not supported.
+#
+# @param spec the type and attributes of the cache backend.
+# @return an option to export build cache.
+option::dockerLoad cacheExport(string spec)
+
 # Downloads the filesystem to a local path.
 #
 # @param localPath the destination filepath for the filesystem contents.
 # @return an option to download a filesystem to the local system.
 fs download(string localPath)
 
+# Imports build cache from a cache backend when solving the output, like the
+# --cache-from flag of docker buildx build. The spec is a comma separated list
+# of key=value pairs such as &#34;type=registry,ref=docker.io/org/app:buildcache&#34;,
+# or just a ref to import a registry cache. Inline caches are imported from
+# their image with the registry type.
+#
+# @param spec the type and attributes of the cache backend.
+# @return an option to import build cache.
+option::download cacheImport(string spec)
+
+# Exports the build cache of the output to a cache backend, like the
+# --cache-to flag of docker buildx build. The spec is a comma separated list
+# of key=value pairs such as
+# &#34;type=registry,ref=docker.io/org/app:buildcache,mode=max&#34;, or just a ref to
+# export a registry cache. Local caches are not supported.
+#
+# @param spec the type and attributes of the cache backend.
+# @return an option to export build cache.
+option::download cacheExport(string spec)
+
 # Downloads the filesystem as a tarball to a local path.
 #
 # @param localPath the destination filepath for the tarball.
 # @return an option to download a filesystem to the local system as a tarball.
 fs downloadTarball(string localPath)
 
+# Verifies the checksum of the downloaded tarball against a digest after it is
+# exported, failing the build on a mismatch.
+#
+# @param digest a checksum in the form of an OCI digest.
+# https://github.com/opencontainers/image-spec/blob/master/descriptor.md#digests
+# @return an option to verify the checksum of the tarball.
+option::downloadTarball checksum(string digest)
+
+# Imports build cache from a cache backend when solving the output, like the
+# --cache-from flag of docker buildx build. The spec is a comma separated list
+# of key=value pairs such as &#34;type=registry,ref=docker.io/org/app:buildcache&#34;,
+# or just a ref to import a registry cache. Inline caches are imported from
+# their image with the registry type.
+#
+# @param spec the type and attributes of the cache backend.
+# @return an option to import build cache.
+option::downloadTarball cacheImport(string spec)
+
+# Exports the build cache of the output to a cache backend, like the
+# --cache-to flag of docker buildx build. The spec is a comma separated list
+# of key=value pairs such as
+# &#34;type=registry,ref=docker.io/org/app:buildcache,mode=max&#34;, or just a ref to
+# export a registry cache. Local caches are not supported.
+#
+# @param spec the type and attributes of the cache backend.
+# @return an option to export build cache.
+option::downloadTarball cacheExport(string spec)
+
 # Downloads the filesystem as a OCI filesystem bundle to a local path.
 # See: https://github.com/opencontainers/runtime-spec/blob/master/bundle.md
 #
@@ -1260,6 +2084,34 @@ fs downloadTarball(string localPath)
 # filesystem bundle.
 fs downloadOCITarball(string localPath)
 
+# Verifies the checksum of the downloaded tarball against a digest after it is
+# exported, failing the build on a mismatch.
+#
+# @param digest a checksum in the form of an OCI digest.
+# https://github.com/opencontainers/image-spec/blob/master/descriptor.md#digests
+# @return an option to verify the checksum of the tarball.
+option::downloadOCITarball checksum(string digest)
+
+# Imports build cache from a cache backend when solving the output, like the
+# --cache-from flag of docker buildx build. The spec is a comma separated list
+# of key=value pairs such as &#34;type=registry,ref=docker.io/org/app:buildcache&#34;,
+# or just a ref to import a registry cache. Inline caches are imported from
+# their image with the registry type.
+#
+# @param spec the type and attributes of the cache backend.
+# @return an option to import build cache.
+option::downloadOCITarball cacheImport(string spec)
+
+# Exports the build cache of the output to a cache backend, like the
+# --cache-to flag of docker buildx build. The spec is a comma separated list
+# of key=value pairs such as
+# &#34;type=registry,ref=docker.io/org/app:buildcache,mode=max&#34;, or just a ref to
+# export a registry cache. Local caches are not supported.
+#
+# @param spec the type and attributes of the cache backend.
+# @return an option to export build cache.
+option::downloadOCITarball cacheExport(string spec)
+
 # Downloads the filesystem as a Docker image tarball to a local path.
 # The tarball is able to be loaded into a docker engine via &#34;docker load&#34;.
 # See: https://docs.docker.com/engine/reference/commandline/save/
@@ -1271,6 +2123,34 @@ fs downloadOCITarball(string localPath)
 # image tarball.
 fs downloadDockerTarball(string localPath, string ref)
 
+# Verifies the checksum of the downloaded tarball against a digest after it is
+# exported, failing the build on a mismatch.
+#
+# @param digest a checksum in the form of an OCI digest.
+# https://github.com/opencontainers/image-spec/blob/master/descriptor.md#digests
+# @return an option to verify the checksum of the tarball.
+option::downloadDockerTarball checksum(string digest)
+
+# Imports build cache from a cache backend when solving the output, like the
+# --cache-from flag of docker buildx build. The spec is a comma separated list
+# of key=value pairs such as &#34;type=registry,ref=docker.io/org/app:buildcache&#34;,
+# or just a ref to import a registry cache. Inline caches are imported from
+# their image with the registry type.
+#
+# @param spec the type and attributes of the cache backend.
+# @return an option to import build cache.
+option::downloadDockerTarball cacheImport(string spec)
+
+# Exports the build cache of the output to a cache backend, like the
+# --cache-to flag of docker buildx build. The spec is a comma separated list
+# of key=value pairs such as
+# &#34;type=registry,ref=docker.io/org/app:buildcache,mode=max&#34;, or just a ref to
+# export a registry cache. Local caches are not supported.
+#
+# @param spec the type and attributes of the cache backend.
+# @return an option to export build cache.
+option::downloadDockerTarball cacheExport(string spec)
+
 # Defines a list of arguments to use as the command to execute when the
 # container starts.
 #
@@ -1291,12 +2171,21 @@ fs cmd(variadic string args)
 # @return a filesystem with a metadata key pair set.
 fs label(string key, string value)
 
+# Sets an OCI annotation on the image manifest. Unlike labels, annotations are
+# not part of the image config and are only applied when the image is exported.
+#
+# @param key the annotation key.
+# @param value the annotation value.
+# @return a filesystem with an annotation key pair set.
+fs annotation(string key, string value)
+
 # Exposes a set of network ports at runtime. The default is TCP if the protocol
 # is not specified.
 #
 # This metadata is only useful when exporting as a Docker image.
 #
-# @param ports the set of ports to expose.
+# @param ports the set of ports to expose, such as &#34;8080&#34;, &#34;8080/tcp&#34; or
+# &#34;53/udp&#34;.
 # @return the filesystem with exposed ports set.
 fs expose(variadic string ports)
 
@@ -1321,6 +2210,47 @@ fs volumes(variadic string mountpoints)
 # @return the filesystem with the stop signal set.
 fs stopSignal(string signal)
 
+# Sets the command that is run inside the container to check that it is still
+# working, like the HEALTHCHECK instruction of a Dockerfile.
+#
+# A single arg is run with the default shell, while multiple args are run
+# directly as a command and its arguments. Without any args, the healthcheck
+# inherited from the base image is disabled.
+#
+# This metadata is only useful when exporting as a Docker image.
+#
+# @param args the command to check the health of the container.
+# @return the filesystem with the healthcheck set.
+fs healthcheck(variadic string args)
+
+# Sets the time to wait between healthchecks, starting after the container
+# has started. Defaults to 30s.
+#
+# @param duration the time between healthchecks, for example &#34;30s&#34; or &#34;1m&#34;.
+# @return an option to set the healthcheck interval.
+option::healthcheck interval(string duration)
+
+# Sets the time a single healthcheck can run before it is considered to have
+# failed. Defaults to 30s.
+#
+# @param duration the timeout of a healthcheck, for example &#34;10s&#34;.
+# @return an option to set the healthcheck timeout.
+option::healthcheck timeout(string duration)
+
+# Sets the time the container is given to start, during which failed
+# healthchecks are not counted towards the retries. Defaults to 0s.
+#
+# @param duration the start period of the container, for example &#34;5s&#34;.
+# @return an option to set the healthcheck start period.
+option::healthcheck startPeriod(string duration)
+
+# Sets the number of consecutive failed healthchecks before the container is
+# considered unhealthy. Defaults to 3.
+#
+# @param count the number of retries.
+# @return an option to set the healthcheck retries.
+option::healthcheck retries(int count)
+
 # A format specifier that is interpolated with values.
 #
 # @param formatString the format specifier.
@@ -1357,7 +2287,7 @@ string localOs()
 #
 # @param command a command to execute.
 # @param args optional arguments to the command.
-# @return the string output from the command.
+# @return the string output from the command, without trailing newlines.
 string localRun(string command, variadic string args)
 
 # If the command returns a non-zero status code ignore
@@ -1398,6 +2328,13 @@ string manifest(string ref) binds (string digest, string config, string index)
 # @param arch architecture name, eg &#34;amd64&#34;
 option::manifest platform(string os, string arch)
 
+# Reads a file from the client&#39;s local filesystem. The file is read when the
+# module is compiled, so it isn&#39;t synced to BuildKit.
+#
+# @param localPath a path to a file relative to the module.
+# @return the contents of the file, without leading and trailing whitespace.
+string readFile(string localPath)
+
 # Process text as a Go text template.
 # For template syntax documentation see:
 #   https://golang.org/pkg/text/template/
@@ -1406,6 +2343,77 @@ option::manifest platform(string os, string arch)
 # @return the text resulting from the processed template.
 string template(string text)
 
+# Converts the current string to lower case.
+#
+# @return the current string in lower case.
+string toLower()
+
+# Converts the current string to upper case.
+#
+# @return the current string in upper case.
+string toUpper()
+
+# Removes the leading and trailing white space of the current string.
+#
+# @return the current string without leading and trailing white space.
+string trimSpace()
+
+# Removes a prefix from the current string. If the current string doesn&#39;t
+# start with the prefix, it is unchanged.
+#
+# @param prefix the prefix to remove.
+# @return the current string without the prefix.
+string trimPrefix(string prefix)
+
+# Removes a suffix from the current string. If the current string doesn&#39;t end
+# with the suffix, it is unchanged.
+#
+# @param suffix the suffix to remove.
+# @return the current string without the suffix.
+string trimSuffix(string suffix)
+
+# Replaces every occurrence of a substring in the current string.
+#
+# @param old the substring to replace.
+# @param new the replacement for each occurrence of the substring.
+# @return the current string with the substring replaced.
+string replace(string old, string new)
+
+# Computes the SHA256 digest of the current string, such as to pin the
+# checksum of a download.
+#
+# @return the hex encoded SHA256 digest of the current string.
+string sha256()
+
+# Encodes the current string with standard base64 encoding.
+#
+# @return the current string encoded as base64.
+string base64encode()
+
+# Decodes the current string from standard base64 encoding. Fails if the
+# current string is not valid base64.
+#
+# @return the decoded current string.
+string base64decode()
+
+# Joins a list of strings into a single string.
+#
+# @param sep the separator placed between the strings.
+# @param values the strings to join.
+# @return the strings joined by the separator.
+string join(string sep, list values)
+
+# Splits text into the list of substrings between each separator. If the
+# separator is empty, text is split around each run of white space instead.
+#
+# A list passed as the last argument of a function that takes a variadic
+# string, such as run, is spread into its arguments.
+#
+# @param sep the separator between the substrings.
+# @param text the text to split.
+# @return the list of substrings.
+list split(string sep, string text)
+
 # Add a string field with provided name to be available
 # inside the template.
 #
@@ -1417,6 +2425,11 @@ option::template stringField(string name, string value)
 # Executes pipeline or filesystem target(s). Multiple targets specified within
 # a stage is executed in parallel. 
 #
+# Stages are named by the functions they call. A later stage can use the
+# output of an earlier one by calling the same function, such as mounting it
+# into a run. Identical filesystems are only solved once, so the earlier
+# stage&#39;s output is reused instead of being built again.
+#
 # @param pipelines the targets to run in parallel.
 # @return a pipeline that returns when all its targets have finished.
 pipeline stage(variadic pipeline pipelines)
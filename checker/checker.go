@@ -8,6 +8,7 @@ package checker
 import (
 	"fmt"
 	"sort"
+	"time"
 
 	"github.com/openllb/hlb/diagnostic"
 	"github.com/openllb/hlb/errdefs"
@@ -21,12 +22,26 @@ func SemanticPass(mod *ast.Module) error {
 	return c.SemanticPass(mod)
 }
 
+// CheckOption is optional configuration for Check.
+type CheckOption func(*checker)
+
+// WithExperimental allows calling experimental builtins.
+func WithExperimental() CheckOption {
+	return func(c *checker) {
+		c.experimental = true
+	}
+}
+
 // Check fills in semantic data in the module and check for semantic errors.
 //
 // References that refer to imported identifiers are checked with
 // CheckReferences after imports have been resolved.
-func Check(mod *ast.Module) error {
-	return new(checker).Check(mod)
+func Check(mod *ast.Module, opts ...CheckOption) error {
+	c := new(checker)
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c.Check(mod)
 }
 
 // CheckReferences checks for semantic errors for references. Imported modules
@@ -40,9 +55,10 @@ func CheckReferences(mod *ast.Module, name string) error {
 }
 
 type checker struct {
-	checkRefs bool
-	errs      []error
-	dups      map[string][]ast.Node
+	checkRefs    bool
+	experimental bool
+	errs         []error
+	dups         map[string][]ast.Node
 }
 
 func (c *checker) SemanticPass(mod *ast.Module) error {
@@ -55,7 +71,46 @@ func (c *checker) SemanticPass(mod *ast.Module) error {
 	// defined.
 	mod.Scope = ast.NewScope(GlobalScope, ast.ModuleScope, mod)
 
+	// Included files are merged into the module, so their declarations are
+	// registered in the same scope and collide like any other duplicate.
+	files := mod.Files()
+	for _, file := range files {
+		file.Scope = mod.Scope
+	}
+
 	// (1) Build lexical scopes and memoize semantic data into the CST.
+	for _, file := range files {
+		c.declare(file)
+	}
+
+	// Binds must be handled in a second pass to ensure all bindable identifiers
+	// are registered in the scope (i.e. added to the symbol table).
+	for _, file := range files {
+		c.checkBinds(file)
+	}
+
+	if len(c.dups) > 0 {
+		var nodes []ast.Node
+		for _, dups := range c.dups {
+			nodes = append(nodes, dups[0])
+		}
+		// Sort by line number of the first definition of the identifier.
+		sort.SliceStable(nodes, func(i, j int) bool {
+			return nodes[i].Position().Line < nodes[j].Position().Line
+		})
+		for _, node := range nodes {
+			c.err(errdefs.WithDuplicates(c.dups[node.String()]))
+		}
+	}
+	if len(c.errs) > 0 {
+		return &diagnostic.Error{Diagnostics: c.errs}
+	}
+	return nil
+}
+
+// declare registers the declarations of a file in its module scope and
+// constructs the lexical scopes of its functions.
+func (c *checker) declare(mod *ast.Module) {
 	ast.Match(mod, ast.MatchOpts{},
 		// Register imports identifiers.
 		func(id *ast.ImportDecl) {
@@ -140,41 +195,39 @@ func (c *checker) SemanticPass(mod *ast.Module) error {
 			lit.Body.Type = lit.Type
 		},
 	)
-
-	// Binds must be handled in a second pass to ensure all bindable identifiers
-	// are registered in the scope (i.e. added to the symbol table).
-	c.checkBinds(mod)
-
-	if len(c.dups) > 0 {
-		var nodes []ast.Node
-		for _, dups := range c.dups {
-			nodes = append(nodes, dups[0])
-		}
-		// Sort by line number of the first definition of the identifier.
-		sort.SliceStable(nodes, func(i, j int) bool {
-			return nodes[i].Position().Line < nodes[j].Position().Line
-		})
-		for _, node := range nodes {
-			c.err(errdefs.WithDuplicates(c.dups[node.String()]))
-		}
-	}
-	if len(c.errs) > 0 {
-		return &diagnostic.Error{Diagnostics: c.errs}
-	}
-	return nil
 }
 
 func (c *checker) checkBinds(mod *ast.Module) {
+	var (
+		uses      = optionFuncUses(mod)
+		ambiguous = make(map[*ast.BlockStmt][]optionFuncUse)
+	)
 	ast.Match(mod, ast.MatchOpts{},
+		// BindClause rule (4): option functions have the closure of the
+		// function they are used in.
+		func(fd *ast.FuncDecl) {
+			if fd.Body == nil || fd.Kind().Primary() != ast.Option {
+				return
+			}
+			closures := uses[fd.Sig.Name.Text]
+			switch len(closures) {
+			case 0:
+			case 1:
+				fd.Body.Closure = closures[0].closure
+			default:
+				ambiguous[fd.Body] = closures
+			}
+		},
 		// BindClause rule (2): `with` provides access to parent closure.
 		func(fd *ast.FuncDecl, _ *ast.WithClause, block *ast.BlockStmt) {
 			block.Closure = fd
 		},
 		// Register bind clauses in the parent function body.
-		// There are 3 primary rules for binds listed below.
+		// There are 4 primary rules for binds listed below.
 		// 1. Option blocks do not have a closure for bindings.
 		// 2. `with` provides access to parent closure.
 		// 3. Binds are only allowed with a closure.
+		// 4. Option functions used by exactly one `with` have its closure.
 		func(block *ast.BlockStmt, call *ast.CallStmt, binds *ast.BindClause) {
 			// BindClause rule (3): Binds are only allowed with a closure.
 			if block.Closure == nil {
@@ -189,16 +242,75 @@ func (c *checker) checkBinds(mod *ast.Module) {
 		},
 		// Binds without closure should error.
 		func(block *ast.BlockStmt, binds *ast.BindClause) {
-			if binds.Closure == nil {
-				c.err(errdefs.WithNoBindClosure(binds.As, block.Type))
+			if binds.Closure != nil {
+				return
 			}
+			if closures, ok := ambiguous[block]; ok {
+				var uses []ast.Node
+				for _, use := range closures {
+					uses = append(uses, use.ie)
+				}
+				c.err(errdefs.WithAmbiguousBindClosure(binds.As, uses))
+				return
+			}
+			c.err(errdefs.WithNoBindClosure(binds.As, block.Type))
 		},
 	)
 }
 
+type optionFuncUse struct {
+	closure *ast.FuncDecl
+	ie      *ast.IdentExpr
+}
+
+// optionFuncUses returns the uses of option functions in `with` clauses of
+// non-option functions, keyed by the name of the option function.
+func optionFuncUses(mod *ast.Module) map[string][]optionFuncUse {
+	uses := make(map[string][]optionFuncUse)
+	ast.Match(mod, ast.MatchOpts{},
+		func(fd *ast.FuncDecl, with *ast.WithClause) {
+			if fd.Kind().Primary() == ast.Option {
+				return
+			}
+
+			var ies []*ast.IdentExpr
+			switch {
+			case with.Expr.CallExpr != nil:
+				ies = append(ies, with.Expr.CallExpr.Name)
+			case with.Expr.FuncLit != nil:
+				for _, stmt := range with.Expr.FuncLit.Body.Stmts() {
+					if stmt.Call != nil {
+						ies = append(ies, stmt.Call.Name)
+					}
+				}
+			}
+
+			for _, ie := range ies {
+				if ie.Reference != nil {
+					continue
+				}
+				uses[ie.Ident.Text] = append(uses[ie.Ident.Text], optionFuncUse{fd, ie})
+			}
+		},
+	)
+	return uses
+}
+
 func (c *checker) Check(mod *ast.Module) error {
 	// Second pass over the CST.
 	// (2) Type checking and other semantic checks.
+	for _, file := range mod.Files() {
+		c.checkDecls(file)
+	}
+	c.checkRecursion(mod)
+	if len(c.errs) > 0 {
+		return &diagnostic.Error{Diagnostics: c.errs}
+	}
+
+	return nil
+}
+
+func (c *checker) checkDecls(mod *ast.Module) {
 	ast.Match(mod, ast.MatchOpts{},
 		func(id *ast.ImportDecl) {
 			kset := ast.NewKindSet(ast.String, ast.Filesystem)
@@ -244,16 +356,105 @@ func (c *checker) Check(mod *ast.Module) error {
 			}
 		},
 	)
-	if len(c.errs) > 0 {
-		return &diagnostic.Error{Diagnostics: c.errs}
+}
+
+// callEdge is a call from one function to another within the same module.
+type callEdge struct {
+	call   *ast.IdentExpr
+	callee *ast.FuncDecl
+}
+
+// checkRecursion reports cycles in the call graph of the module's functions,
+// including those of its included files.
+// HLB has no conditionals to end a recursion, so every cycle would generate
+// code forever. Calls to imported functions are not followed because a cycle
+// through them would require the imports themselves to be cyclic.
+func (c *checker) checkRecursion(mod *ast.Module) {
+	var (
+		fds   []*ast.FuncDecl
+		edges = make(map[*ast.FuncDecl][]callEdge)
+	)
+	addEdge := func(fd *ast.FuncDecl, block *ast.BlockStmt, ie *ast.IdentExpr) {
+		if block.Scope == nil || ie == nil || ie.Ident == nil || ie.Reference != nil {
+			return
+		}
+		obj := block.Scope.Lookup(ie.Ident.Text)
+		if obj == nil {
+			return
+		}
+		if callee, ok := obj.Node.(*ast.FuncDecl); ok {
+			edges[fd] = append(edges[fd], callEdge{ie, callee})
+		}
+	}
+	for _, file := range mod.Files() {
+		ast.Match(file, ast.MatchOpts{},
+			func(fd *ast.FuncDecl) {
+				fds = append(fds, fd)
+			},
+			func(fd *ast.FuncDecl, block *ast.BlockStmt, call *ast.CallStmt) {
+				addEdge(fd, block, call.Name)
+			},
+			func(fd *ast.FuncDecl, block *ast.BlockStmt, call *ast.CallExpr) {
+				addEdge(fd, block, call.Name)
+			},
+		)
 	}
 
-	return nil
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	var (
+		state = make(map[*ast.FuncDecl]int)
+		stack []callEdge
+		visit func(fd *ast.FuncDecl)
+	)
+	visit = func(fd *ast.FuncDecl) {
+		state[fd] = visiting
+		for _, edge := range edges[fd] {
+			switch state[edge.callee] {
+			case unvisited:
+				stack = append(stack, edge)
+				visit(edge.callee)
+				stack = stack[:len(stack)-1]
+			case visiting:
+				// The callee is on the stack, so the calls made since it was
+				// entered form a cycle.
+				start := len(stack)
+				for start > 0 && stack[start-1].callee != edge.callee {
+					start--
+				}
+				var calls []ast.Node
+				for _, e := range stack[start:] {
+					calls = append(calls, e.call)
+				}
+				calls = append(calls, edge.call)
+				c.err(errdefs.WithRecursiveCall(calls))
+			}
+		}
+		state[fd] = visited
+	}
+	for _, fd := range fds {
+		if state[fd] == unvisited {
+			visit(fd)
+		}
+	}
 }
 
 func (c *checker) CheckReferences(mod *ast.Module, name string) error {
 	// Third pass over the CST.
 	// 3. After imports have resolved, semantic checks of imported identifiers.
+	for _, file := range mod.Files() {
+		c.checkReferences(file, name)
+	}
+	if len(c.errs) > 0 {
+		return &diagnostic.Error{Diagnostics: c.errs}
+	}
+	return nil
+}
+
+func (c *checker) checkReferences(mod *ast.Module, name string) {
 	ast.Match(mod, ast.MatchOpts{},
 		func(id *ast.ImportDecl) {
 			kset := ast.NewKindSet(ast.String, ast.Filesystem)
@@ -287,10 +488,6 @@ func (c *checker) CheckReferences(mod *ast.Module, name string) error {
 		},
 	)
 	c.checkBinds(mod)
-	if len(c.errs) > 0 {
-		return &diagnostic.Error{Diagnostics: c.errs}
-	}
-	return nil
 }
 
 func (c *checker) checkNestedCallExpr(scope *ast.Scope, ie *ast.IdentExpr, args []*ast.Expr, signature []ast.Kind, with *ast.WithClause, call *ast.CallExpr, name string) error {
@@ -310,7 +507,9 @@ func (c *checker) checkNestedCallExpr(scope *ast.Scope, ie *ast.IdentExpr, args
 	}
 
 	var kset *ast.KindSet
-	if index < 0 {
+	if index < 0 && inListLit(args, call) {
+		kset = ast.NewKindSet(ast.String)
+	} else if index < 0 {
 		// If its not within args, check with clause.
 		if with == nil || with.Expr == nil || with.Expr.CallExpr != call || ie.Reference != nil {
 			return errdefs.WithInternalErrorf(call, "expected to find %q in %q", call.Name, args)
@@ -441,13 +640,22 @@ func (c *checker) checkCall(scope *ast.Scope, kset *ast.KindSet, ie *ast.IdentEx
 	}
 
 	for i, arg := range args {
-		kind := params[i].Type.Kind
-		err := c.checkExpr(scope, ast.NewKindSet(kind), arg)
+		params[i], err = c.checkArg(scope, signature, params[i], i, arg)
 		if err != nil {
 			return nil, err
 		}
 	}
 
+	err = c.checkExperimental(scope, ie)
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.checkLiteralArgs(scope, ie, args)
+	if err != nil {
+		return nil, err
+	}
+
 	if with != nil {
 		// Inherit the secondary type from the calling function name.
 		kind := ast.Kind(fmt.Sprintf("%s::%s", ast.Option, ie.Ident))
@@ -460,6 +668,31 @@ func (c *checker) checkCall(scope *ast.Scope, kset *ast.KindSet, ie *ast.IdentEx
 	return params, nil
 }
 
+// checkArg checks the i-th argument of a call against the field it is passed
+// to, and returns the field with the kind of the argument. Lists are spread
+// into the arguments of a variadic string field.
+func (c *checker) checkArg(scope *ast.Scope, signature []*ast.Field, field *ast.Field, i int, arg *ast.Expr) (*ast.Field, error) {
+	if !isVariadicString(signature, i) {
+		return field, c.checkExpr(scope, ast.NewKindSet(field.Kind()), arg)
+	}
+
+	kind := ast.String
+	if arg.ListLit != nil {
+		kind = ast.List
+	}
+	err := c.checkExpr(scope, ast.NewKindSet(kind), arg)
+	if err != nil && kind == ast.String && c.checkExpr(scope, ast.NewKindSet(ast.List), arg) == nil {
+		kind, err = ast.List, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if kind == ast.List {
+		return ast.NewField(ast.List, field.Name.Text, false), nil
+	}
+	return field, nil
+}
+
 func (c *checker) checkExpr(scope *ast.Scope, kset *ast.KindSet, expr *ast.Expr) error {
 	if kset.Has(ast.Pipeline) {
 		kset = ast.NewKindSet(append(
@@ -488,12 +721,28 @@ func (c *checker) checkExpr(scope *ast.Scope, kset *ast.KindSet, expr *ast.Expr)
 			return err
 		}
 		return nil
+	case expr.ListLit != nil:
+		return c.checkListLit(scope, kset, expr.ListLit)
 	case expr.CallExpr != nil:
 		return c.checkCallExpr(scope, kset, expr.CallExpr)
 	}
 	return errdefs.WithInternalErrorf(expr, "invalid expr")
 }
 
+func (c *checker) checkListLit(scope *ast.Scope, kset *ast.KindSet, lit *ast.ListLit) error {
+	err := c.checkType(lit, kset, ast.List)
+	if err != nil {
+		return err
+	}
+	for _, elem := range lit.Elements() {
+		err = c.checkExpr(scope, ast.NewKindSet(ast.String), elem)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (c *checker) checkFuncLit(kset *ast.KindSet, lit *ast.FuncLit) error {
 	err := c.checkType(lit.Type, kset, lit.Type.Kind)
 	if err != nil {
@@ -530,6 +779,67 @@ func (c *checker) checkBasicLit(scope *ast.Scope, kind ast.Kind, lit *ast.BasicL
 	return nil
 }
 
+// literalArgCheckers validate the string literals passed to builtins that
+// parse their args when called, so malformed literals are reported by the
+// checker instead of failing in codegen.
+var literalArgCheckers = map[string]func(lit *ast.BasicLit, value string) error{
+	"createdTime": func(lit *ast.BasicLit, value string) error {
+		_, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return errdefs.WithInvalidTimestamp(lit, value)
+		}
+		return nil
+	},
+}
+
+func (c *checker) checkLiteralArgs(scope *ast.Scope, ie *ast.IdentExpr, args []*ast.Expr) error {
+	check, ok := literalArgCheckers[ie.Ident.Text]
+	if !ok || ie.Reference != nil {
+		return nil
+	}
+
+	// Only builtins parse their args, user functions can shadow their names.
+	obj := scope.Lookup(ie.Ident.Text)
+	if obj == nil {
+		return nil
+	}
+	if _, ok := obj.Node.(*ast.BuiltinDecl); !ok {
+		return nil
+	}
+
+	for _, arg := range args {
+		if arg.BasicLit == nil {
+			continue
+		}
+		value, ok := literalString(arg.BasicLit)
+		if !ok {
+			continue
+		}
+		err := check(arg.BasicLit, value)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// literalString returns the value of a string literal, or false if its value
+// is only known when evaluated.
+func literalString(lit *ast.BasicLit) (string, bool) {
+	switch {
+	case lit.Str != nil:
+		for _, f := range lit.Str.Fragments {
+			if f.Interpolated != nil || f.Escaped != nil {
+				return "", false
+			}
+		}
+		return lit.Str.Unquoted(), true
+	case lit.RawString != nil:
+		return lit.RawString.Text, true
+	}
+	return "", false
+}
+
 func (c *checker) checkStringFragments(scope *ast.Scope, fragments []*ast.StringFragment) error {
 	kset := ast.NewKindSet(ast.String, ast.Int, ast.Bool)
 	for _, f := range fragments {
@@ -757,6 +1067,31 @@ func (c *checker) lookupBuiltin(node ast.Node, kset *ast.KindSet, bd *ast.Builti
 	return fd, nil
 }
 
+// inListLit returns whether call is an element of a list literal in args.
+func inListLit(args []*ast.Expr, call *ast.CallExpr) bool {
+	for _, arg := range args {
+		if arg.ListLit == nil {
+			continue
+		}
+		for _, elem := range arg.ListLit.Elements() {
+			if elem.CallExpr == call {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isVariadicString returns whether the i-th argument of a call is passed to a
+// variadic string field of the signature.
+func isVariadicString(fields []*ast.Field, i int) bool {
+	if len(fields) == 0 || i < len(fields)-1 {
+		return false
+	}
+	last := fields[len(fields)-1]
+	return last.Modifier != nil && last.Modifier.Variadic != nil && last.Kind() == ast.String
+}
+
 func extendSignatureWithVariadic(fields []*ast.Field, args []*ast.Expr) []*ast.Field {
 	if len(fields) == 0 {
 		return fields
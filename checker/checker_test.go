@@ -189,6 +189,34 @@ func TestChecker_Check(t *testing.T) {
 				ast.Search(mod, "duplicate", ast.WithSkip(1)),
 			})
 		},
+	}, {
+		"errors with duplicate import names",
+		`
+		import util from "./a.hlb"
+		import util from "./b.hlb"
+
+		fs default() {
+			util.build
+		}
+		`,
+		func(mod *ast.Module) error {
+			return errdefs.WithDuplicates([]ast.Node{
+				ast.Search(mod, "util"),
+				ast.Search(mod, "util", ast.WithSkip(1)),
+			})
+		},
+	}, {
+		"distinct import names",
+		`
+		import a from "./a.hlb"
+		import b from "./b.hlb"
+
+		fs default() {
+			a.build
+			b.build
+		}
+		`,
+		nil,
 	}, {
 		"errors with function and alias name collisions",
 		`
@@ -341,6 +369,98 @@ func TestChecker_Check(t *testing.T) {
 				errdefs.Defined(ast.Search(builtin.Module, "image")),
 			)
 		},
+	}, {
+		"errors when option is unknown",
+		`
+		fs default() {
+			image "alpine"
+			run "echo unknown" with option {
+				unknownOption
+			}
+		}
+		`,
+		func(mod *ast.Module) error {
+			return errdefs.WithUndefinedIdent(
+				ast.Search(mod, "unknownOption"),
+				nil,
+			)
+		},
+	}, {
+		"errors when option belongs to another builtin",
+		`
+		fs default() {
+			image "alpine"
+			run "echo copy" with option {
+				createDestPath
+			}
+		}
+		`,
+		func(mod *ast.Module) error {
+			return errdefs.WithWrongType(
+				ast.Search(mod, "createDestPath"),
+				[]ast.Kind{"option::run"},
+				"option::copy",
+				errdefs.Defined(ast.Search(builtin.Module, "createDestPath")),
+			)
+		},
+	}, {
+		"no error when createdTime is RFC3339",
+		`
+		fs default() {
+			scratch
+			mkfile "/foo" 0o644 "foo" with option {
+				createdTime "2020-04-28T18:09:41Z"
+			}
+			copy scratch "/" "/bar" with option {
+				createdTime ` + "`2020-04-28T18:09:41+02:00`" + `
+			}
+		}
+		`,
+		nil,
+	}, {
+		"errors when createdTime is not RFC3339",
+		`
+		fs default() {
+			scratch
+			mkdir "/foo" 0o755 with option {
+				createdTime "2020-04-28 18:09"
+			}
+		}
+		`,
+		func(mod *ast.Module) error {
+			return errdefs.WithInvalidTimestamp(
+				ast.Search(mod, `"2020-04-28 18:09"`),
+				"2020-04-28 18:09",
+			)
+		},
+	}, {
+		"no error when createdTime is interpolated",
+		`
+		fs default() {
+			scratch
+			mkdir "/foo" 0o755 with option {
+				createdTime "${created}"
+			}
+		}
+
+		string created() {
+			localEnv "CREATED"
+		}
+		`,
+		nil,
+	}, {
+		"errors when calling experimental builtin",
+		`
+		fs default() {
+			image "alpine"
+			diff scratch
+		}
+		`,
+		func(mod *ast.Module) error {
+			return errdefs.WithExperimental(
+				ast.Search(mod, "diff"),
+			)
+		},
 	}, {
 		"no error when input doesn't end with newline",
 		`# comment\nfs default() {\n  scratch\n}\n# comment`,
@@ -437,6 +557,51 @@ func TestChecker_Check(t *testing.T) {
 				ast.Search(mod, "option::run"),
 			)
 		},
+	}, {
+		"binds inside an option function used in a with clause",
+		`
+		option::run foo() {
+			mount scratch "/out" as bar
+		}
+
+		fs build() {
+			image "alpine"
+			run "touch /out/foo" with foo
+		}
+
+		fs default() {
+			bar
+		}
+		`,
+		nil,
+	}, {
+		"errors when binding inside an option function used in multiple closures",
+		`
+		option::run foo() {
+			mount scratch "/out" as bar
+		}
+
+		fs build() {
+			image "alpine"
+			run "touch /out/foo" with foo
+		}
+
+		fs test() {
+			image "alpine"
+			run "touch /out/bar" with option {
+				foo
+			}
+		}
+		`,
+		func(mod *ast.Module) error {
+			return errdefs.WithAmbiguousBindClosure(
+				ast.Search(mod, "as"),
+				[]ast.Node{
+					ast.Search(mod, "foo", ast.WithSkip(1)),
+					ast.Search(mod, "foo", ast.WithSkip(2)),
+				},
+			)
+		},
 	}, {
 		"errors when binding inside an argument expression",
 		`
@@ -456,6 +621,144 @@ func TestChecker_Check(t *testing.T) {
 				ast.Search(mod, "option::run"),
 			)
 		},
+	}, {
+		"errors with self-recursive function",
+		`
+		fs default() {
+			scratch
+			default
+		}
+		`,
+		func(mod *ast.Module) error {
+			return errdefs.WithRecursiveCall([]ast.Node{
+				ast.Search(mod, "default", ast.WithSkip(1)),
+			})
+		},
+	}, {
+		"errors with recursive function cycle",
+		`
+		fs foo() {
+			bar
+		}
+
+		fs bar() {
+			image "alpine"
+			copy foo "/" "/"
+		}
+		`,
+		func(mod *ast.Module) error {
+			return errdefs.WithRecursiveCall([]ast.Node{
+				ast.Search(mod, "bar"),
+				ast.Search(mod, "foo", ast.WithSkip(1)),
+			})
+		},
+	}, {
+		"calls to the same function are not recursive",
+		`
+		fs default() {
+			scratch
+			copy foo "/" "/a"
+			copy foo "/" "/b"
+		}
+
+		fs foo() {
+			scratch
+		}
+		`,
+		nil,
+	}, {
+		"lists are spread into variadic string args",
+		`
+		fs default() {
+			image "alpine"
+			run "echo" ["a", string { format "b" }]
+			run split(" ", "echo a b")
+			run list { split "," "echo,a" }
+			echo ["a", "b"]
+		}
+
+		fs echo(list words) {
+			run "echo" words
+			env "WORDS" string { join " " words }
+		}
+		`,
+		nil,
+	}, {
+		"errors when list is passed to a string arg",
+		`
+		fs default() {
+			image "alpine"
+			env "WORDS" ["a", "b"]
+		}
+		`,
+		func(mod *ast.Module) error {
+			return errdefs.WithWrongType(
+				ast.Search(mod, `["a", "b"]`),
+				[]ast.Kind{ast.String},
+				ast.List,
+			)
+		},
+	}, {
+		"errors when list element is not a string",
+		`
+		fs default() {
+			image "alpine"
+			run ["echo", 1]
+		}
+		`,
+		func(mod *ast.Module) error {
+			return errdefs.WithWrongType(
+				ast.Search(mod, "1"),
+				[]ast.Kind{ast.String},
+				ast.Int,
+			)
+		},
+	}, {
+		"frontend with options",
+		`
+		fs default() {
+			frontend "docker/dockerfile" with option {
+				input "context" fs { local "." }
+				target "build"
+				buildArg "GO_VERSION" "1.22"
+			}
+		}
+		`,
+		nil,
+	}, {
+		"fromDockerfile with options",
+		`
+		fs default() {
+			fromDockerfile fs { local "." } "Dockerfile" with option {
+				target "build"
+				buildArg "GO_VERSION" "1.22"
+			}
+		}
+		`,
+		nil,
+	}, {
+		"dockerPush with cache options",
+		`
+		fs default() {
+			image "busybox"
+			dockerPush "openllb/hlb" with option {
+				cacheImport "openllb/hlb:buildcache"
+				cacheExport "type=registry,ref=openllb/hlb:buildcache,mode=max"
+			}
+		}
+		`,
+		nil,
+	}, {
+		"downloadTarball with checksum",
+		`
+		fs default() {
+			scratch
+			downloadTarball "out.tar" with option {
+				checksum "sha256:b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9"
+			}
+		}
+		`,
+		nil,
 	}, {
 		"run with options",
 		`
@@ -493,6 +796,29 @@ func TestChecker_Check(t *testing.T) {
 	}
 }
 
+func TestChecker_CheckExperimental(t *testing.T) {
+	t.Parallel()
+
+	ctx := filebuffer.WithBuffers(context.Background(), builtin.Buffers())
+	ctx = ast.WithModules(ctx, builtin.Modules())
+
+	in := strings.NewReader(dedent.Dedent(`
+	fs default() {
+		image "alpine"
+		merge scratch
+		diff scratch
+	}
+	`))
+	mod, err := parser.Parse(ctx, in)
+	require.NoError(t, err)
+
+	err = SemanticPass(mod)
+	require.NoError(t, err)
+
+	err = Check(mod, WithExperimental())
+	require.NoError(t, err)
+}
+
 func validateError(t *testing.T, ctx context.Context, expected, actual error, name string) {
 	switch {
 	case expected == nil:
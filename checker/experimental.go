@@ -0,0 +1,33 @@
+package checker
+
+import (
+	"github.com/openllb/hlb/errdefs"
+	"github.com/openllb/hlb/parser/ast"
+)
+
+// experimentalBuiltins are the builtins whose behavior may still change, so
+// they may only be called when experimental builtins are allowed.
+var experimentalBuiltins = map[string]struct{}{
+	"merge":      {},
+	"mergeInput": {},
+	"diff":       {},
+}
+
+func (c *checker) checkExperimental(scope *ast.Scope, ie *ast.IdentExpr) error {
+	if c.experimental || ie.Reference != nil {
+		return nil
+	}
+	if _, ok := experimentalBuiltins[ie.Ident.Text]; !ok {
+		return nil
+	}
+
+	// Only calls that resolve to the builtins are gated.
+	obj := scope.Lookup(ie.Ident.Text)
+	if obj == nil {
+		return nil
+	}
+	if _, ok := obj.Node.(*ast.BuiltinDecl); !ok {
+		return nil
+	}
+	return errdefs.WithExperimental(ie.Ident)
+}
@@ -18,15 +18,15 @@ import (
 //
 // If addr is empty, an attempt is made to connect to docker engine's embedded
 // BuildKit which supports a subset of the exporters and special `moby`
-// exporter.
-func Client(ctx context.Context, addr string) (*client.Client, context.Context, error) {
+// exporter, and opts are ignored.
+func Client(ctx context.Context, addr string, opts ...client.ClientOpt) (*client.Client, context.Context, error) {
 	// Attempt to connect to a healthy docker engine.
 	dockerCli, auth, err := NewDockerCli(ctx)
 
 	// If addr is empty, connect to BuildKit using connection helpers.
 	if addr != "" {
 		ctx = codegen.WithDockerAPI(ctx, dockerCli.Client(), auth, err, false)
-		cln, err := solver.BuildkitClient(ctx, addr)
+		cln, err := solver.BuildkitClient(ctx, addr, opts...)
 		return cln, ctx, err
 	}
 
@@ -1,12 +1,16 @@
 package command
 
 import (
+	"context"
 	"io"
 	"os"
 	"path/filepath"
+	"time"
 
 	_ "github.com/moby/buildkit/client/connhelper/dockercontainer"
 	_ "github.com/moby/buildkit/client/connhelper/kubepod"
+	"github.com/openllb/hlb/codegen"
+	"github.com/openllb/hlb/pkg/imageutil"
 	cli "github.com/urfave/cli/v2"
 )
 
@@ -23,6 +27,51 @@ func App() *cli.App {
 				"BUILDKIT_HOST",
 			},
 		},
+		&cli.StringFlag{
+			Name:  "tlscacert",
+			Usage: "CA certificate to verify the buildkitd server with, instead of the system's certificates",
+		},
+		&cli.StringFlag{
+			Name:  "tlscert",
+			Usage: "client certificate to authenticate to buildkitd with mutual TLS",
+		},
+		&cli.StringFlag{
+			Name:  "tlskey",
+			Usage: "client key to authenticate to buildkitd with mutual TLS",
+		},
+		&cli.StringFlag{
+			Name:  "tlsservername",
+			Usage: "server name to verify the buildkitd certificate with, defaults to the host of the address",
+		},
+		&cli.BoolFlag{
+			Name:    "prefer-local",
+			Usage:   "resolve images from the local cache when present, pulling only the missing ones",
+			EnvVars: []string{"HLB_PREFER_LOCAL"},
+		},
+		&cli.BoolFlag{
+			Name:    "experimental",
+			Usage:   "allow calling experimental builtins, whose behavior may change",
+			EnvVars: []string{"HLB_EXPERIMENTAL"},
+		},
+		&cli.StringSliceFlag{
+			Name:    "insecure-registry",
+			Usage:   "allow a registry host[:port] to be used over HTTP or with an unverified certificate",
+			EnvVars: []string{"HLB_INSECURE_REGISTRY"},
+		},
+		&cli.BoolFlag{
+			Name:    "image-resolve-cache",
+			Usage:   "cache resolved image configs on disk to speed up repeated builds",
+			EnvVars: []string{"HLB_IMAGE_RESOLVE_CACHE"},
+		},
+		&cli.BoolFlag{
+			Name:  "no-image-resolve-cache",
+			Usage: "disable the on-disk cache of resolved image configs",
+		},
+		&cli.DurationFlag{
+			Name:  "image-resolve-cache-ttl",
+			Usage: "set how long resolved image configs are cached on disk",
+			Value: time.Hour,
+		},
 	}
 
 	app.Commands = []*cli.Command{
@@ -30,12 +79,34 @@ func App() *cli.App {
 		runCommand,
 		formatCommand,
 		lintCommand,
+		inspectCommand,
+		treeCommand,
 		moduleCommand,
 		langserverCommand,
+		replCommand,
 	}
 	return app
 }
 
+// withImageResolveCache caches the image configs resolved by the image
+// resolver of the context on disk, if enabled by the global flags.
+func withImageResolveCache(ctx context.Context, c *cli.Context) (context.Context, error) {
+	if !c.Bool("image-resolve-cache") || c.Bool("no-image-resolve-cache") {
+		return ctx, nil
+	}
+
+	resolver := codegen.ImageResolver(ctx)
+	if resolver == nil {
+		return ctx, nil
+	}
+
+	dir, err := imageutil.DefaultResolveCacheDir()
+	if err != nil {
+		return ctx, err
+	}
+	return codegen.WithImageResolver(ctx, imageutil.NewResolveCache(resolver, dir, c.Duration("image-resolve-cache-ttl"))), nil
+}
+
 func collectReaders(c *cli.Context) (rs []io.Reader, cleanup func() error, err error) {
 	cleanup = func() error { return nil }
 
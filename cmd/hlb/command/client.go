@@ -0,0 +1,75 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"github.com/moby/buildkit/client"
+	"github.com/openllb/hlb"
+	cli "github.com/urfave/cli/v2"
+)
+
+// TLSInfo is the configuration to connect to a remote BuildKit daemon with
+// TLS, where each certificate and key is a file path.
+type TLSInfo struct {
+	CACert     string
+	Cert       string
+	Key        string
+	ServerName string
+}
+
+// ClientOpts returns the options to connect to the BuildKit daemon at addr
+// with TLS. If there is no CA certificate, the daemon is verified with the
+// system's certificate pool, and if there is no client certificate, the
+// connection is without mutual TLS.
+func (info TLSInfo) ClientOpts(addr string) ([]client.ClientOpt, error) {
+	if info == (TLSInfo{}) {
+		return nil, nil
+	}
+	if addr == "" {
+		return nil, fmt.Errorf("TLS requires a buildkitd address")
+	}
+	if (info.Cert == "") != (info.Key == "") {
+		return nil, fmt.Errorf("TLS client certificate and key must be specified together")
+	}
+
+	serverName := info.ServerName
+	if serverName == "" {
+		uri, err := url.Parse(addr)
+		if err != nil {
+			return nil, err
+		}
+		serverName = uri.Hostname()
+	}
+
+	var opts []client.ClientOpt
+	if info.CACert != "" {
+		opts = append(opts, client.WithServerConfig(serverName, info.CACert))
+	} else {
+		opts = append(opts, client.WithServerConfigSystem(serverName))
+	}
+	if info.Cert != "" {
+		opts = append(opts, client.WithCredentials(info.Cert, info.Key))
+	}
+	return opts, nil
+}
+
+// newClient returns a BuildKit client for the address and TLS configuration
+// of the global flags.
+func newClient(ctx context.Context, c *cli.Context) (*client.Client, context.Context, error) {
+	opts, err := clientOpts(c)
+	if err != nil {
+		return nil, ctx, err
+	}
+	return hlb.Client(ctx, c.String("addr"), opts...)
+}
+
+func clientOpts(c *cli.Context) ([]client.ClientOpt, error) {
+	return TLSInfo{
+		CACert:     c.String("tlscacert"),
+		Cert:       c.String("tlscert"),
+		Key:        c.String("tlskey"),
+		ServerName: c.String("tlsservername"),
+	}.ClientOpts(c.String("addr"))
+}
@@ -0,0 +1,153 @@
+package command
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"flag"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/moby/buildkit/client"
+	"github.com/stretchr/testify/require"
+	cli "github.com/urfave/cli/v2"
+)
+
+func TestClientOpts(t *testing.T) {
+	dir := t.TempDir()
+	caCert, cert, key := writeTestCertificate(t, dir)
+
+	type testCase struct {
+		name     string
+		args     []string
+		host     string
+		expected []client.ClientOpt
+		hasErr   bool
+	}
+
+	for _, tc := range []testCase{{
+		"no tls",
+		[]string{"--addr", "tcp://buildkitd:1234"},
+		"",
+		nil,
+		false,
+	}, {
+		"mutual tls",
+		[]string{"--addr", "tcp://buildkitd:1234", "--tlscacert", caCert, "--tlscert", cert, "--tlskey", key},
+		"",
+		[]client.ClientOpt{
+			client.WithServerConfig("buildkitd", caCert),
+			client.WithCredentials(cert, key),
+		},
+		false,
+	}, {
+		"server name",
+		[]string{"--addr", "tcp://10.0.0.1:1234", "--tlscacert", caCert, "--tlsservername", "buildkitd"},
+		"",
+		[]client.ClientOpt{
+			client.WithServerConfig("buildkitd", caCert),
+		},
+		false,
+	}, {
+		"system certificates",
+		[]string{"--addr", "tcp://buildkitd:1234", "--tlscert", cert, "--tlskey", key},
+		"",
+		[]client.ClientOpt{
+			client.WithServerConfigSystem("buildkitd"),
+			client.WithCredentials(cert, key),
+		},
+		false,
+	}, {
+		"address from environment",
+		[]string{"--tlscacert", caCert},
+		"tcp://buildkitd:1234",
+		[]client.ClientOpt{
+			client.WithServerConfig("buildkitd", caCert),
+		},
+		false,
+	}, {
+		"certificate without key",
+		[]string{"--addr", "tcp://buildkitd:1234", "--tlscert", cert},
+		"",
+		nil,
+		true,
+	}, {
+		"tls without address",
+		[]string{"--tlscacert", caCert},
+		"",
+		nil,
+		true,
+	}} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			// Environment variables are read when the flags are applied.
+			t.Setenv("BUILDKIT_HOST", tc.host)
+
+			app := App()
+			set := flag.NewFlagSet(app.Name, flag.ContinueOnError)
+			for _, f := range app.Flags {
+				err := f.Apply(set)
+				require.NoError(t, err)
+			}
+			err := set.Parse(tc.args)
+			require.NoError(t, err)
+
+			opts, err := clientOpts(cli.NewContext(app, set, nil))
+			if tc.hasErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, opts)
+
+			// The TLS configuration is loaded when the client is created, before
+			// connecting to buildkitd.
+			if opts != nil {
+				cln, err := client.New(context.Background(), set.Lookup("addr").Value.String(), opts...)
+				require.NoError(t, err)
+				require.NoError(t, cln.Close())
+			}
+		})
+	}
+}
+
+// writeTestCertificate writes a self-signed certificate and its key to dir,
+// which is used both as the CA and client certificate.
+func writeTestCertificate(t *testing.T, dir string) (caCert, cert, key string) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "buildkitd"},
+		DNSNames:              []string{"buildkitd"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &priv.PublicKey, priv)
+	require.NoError(t, err)
+
+	keyDer, err := x509.MarshalECPrivateKey(priv)
+	require.NoError(t, err)
+
+	cert = filepath.Join(dir, "cert.pem")
+	err = os.WriteFile(cert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)
+	require.NoError(t, err)
+
+	key = filepath.Join(dir, "key.pem")
+	err = os.WriteFile(key, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0o600)
+	require.NoError(t, err)
+
+	return cert, cert, key
+}
@@ -1,14 +1,16 @@
 package command
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"os"
+	"strings"
 
 	"github.com/alecthomas/participle/v2/lexer"
 	"github.com/openllb/hlb/parser"
+	"github.com/pmezard/go-difflib/difflib"
 	cli "github.com/urfave/cli/v2"
 )
 
@@ -23,6 +25,11 @@ var formatCommand = &cli.Command{
 			Aliases: []string{"w"},
 			Usage:   "write result to (source) file instead of stdout",
 		},
+		&cli.BoolFlag{
+			Name:    "diff",
+			Aliases: []string{"d"},
+			Usage:   "display diffs of the changes formatting makes instead of the formatted programs",
+		},
 	},
 	Action: func(c *cli.Context) error {
 		rs, cleanup, err := collectReaders(c)
@@ -38,41 +45,94 @@ var formatCommand = &cli.Command{
 
 		return Format(Context(), rs, FormatInfo{
 			Write: c.Bool("write"),
+			Diff:  c.Bool("diff"),
 		})
 	},
 }
 
 type FormatInfo struct {
 	Write bool
+
+	// Diff prints a unified diff of the changes formatting makes to each
+	// program instead of the formatted programs.
+	Diff bool
+
+	Stdout io.Writer
 }
 
 func Format(ctx context.Context, rs []io.Reader, info FormatInfo) error {
-	mods, err := parser.ParseMultiple(ctx, rs)
+	if info.Stdout == nil {
+		info.Stdout = os.Stdout
+	}
+
+	// Keep the sources to diff them against the formatted programs.
+	srcs := make([]*bytes.Buffer, len(rs))
+	named := make([]io.Reader, len(rs))
+	for i, r := range rs {
+		srcs[i] = new(bytes.Buffer)
+		named[i] = &parser.NamedReader{
+			Reader: io.TeeReader(r, srcs[i]),
+			Value:  lexer.NameOfReader(r),
+		}
+	}
+
+	mods, err := parser.ParseMultiple(ctx, named)
 	if err != nil {
 		return err
 	}
 
-	if info.Write {
-		for i, mod := range mods {
-			filename := lexer.NameOfReader(rs[i])
+	for i, mod := range mods {
+		filename := lexer.NameOfReader(named[i])
+		formatted := mod.String()
+		if !info.Write && !info.Diff {
+			fmt.Fprintf(info.Stdout, "%s", formatted)
+			continue
+		}
+
+		src := srcs[i].String()
+		if formatted == src {
+			continue
+		}
+
+		if info.Diff {
+			diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+				A:        splitLines(src),
+				B:        splitLines(formatted),
+				FromFile: filename + ".orig",
+				ToFile:   filename,
+				Context:  3,
+			})
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(info.Stdout, "%s", diff)
+		}
+
+		if info.Write {
 			if filename == "" {
 				return fmt.Errorf("Unable to write, file name unavailable")
 			}
-			info, err := os.Stat(filename)
+			fi, err := os.Stat(filename)
 			if err != nil {
 				return err
 			}
 
-			err = ioutil.WriteFile(filename, []byte(mod.String()), info.Mode())
+			err = os.WriteFile(filename, []byte(formatted), fi.Mode())
 			if err != nil {
 				return err
 			}
 		}
-	} else {
-		for _, mod := range mods {
-			fmt.Printf("%s", mod)
-		}
 	}
 
 	return nil
 }
+
+// splitLines splits s after each newline, unlike difflib.SplitLines which
+// adds an empty line after the trailing newline.
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
@@ -0,0 +1,91 @@
+package command
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/openllb/hlb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatGolden(t *testing.T) {
+	t.Parallel()
+
+	filenames, err := filepath.Glob(filepath.Join("testdata", "format", "*.hlb"))
+	require.NoError(t, err)
+	require.NotEmpty(t, filenames)
+
+	for _, filename := range filenames {
+		filename := filename
+		t.Run(filepath.Base(filename), func(t *testing.T) {
+			t.Parallel()
+
+			golden, err := os.ReadFile(strings.TrimSuffix(filename, ".hlb") + ".golden")
+			require.NoError(t, err)
+
+			f, err := os.Open(filename)
+			require.NoError(t, err)
+			defer f.Close()
+
+			formatted := format(t, f)
+			require.Equal(t, string(golden), formatted)
+
+			// Formatting is idempotent.
+			require.Equal(t, formatted, format(t, strings.NewReader(formatted)))
+		})
+	}
+}
+
+func TestFormatDiff(t *testing.T) {
+	t.Parallel()
+
+	ctx := hlb.WithDefaultContext(context.Background(), nil)
+	dir := t.TempDir()
+	unformatted := filepath.Join(dir, "unformatted.hlb")
+	formatted := filepath.Join(dir, "formatted.hlb")
+	err := os.WriteFile(unformatted, []byte("fs default() {\n    scratch\n}\n"), 0o644)
+	require.NoError(t, err)
+	err = os.WriteFile(formatted, []byte("fs default() {\n\tscratch\n}\n"), 0o644)
+	require.NoError(t, err)
+
+	var rs []io.Reader
+	for _, filename := range []string{unformatted, formatted} {
+		f, err := os.Open(filename)
+		require.NoError(t, err)
+		defer f.Close()
+		rs = append(rs, f)
+	}
+
+	// Only files that change are diffed, and neither is rewritten.
+	var stdout bytes.Buffer
+	err = Format(ctx, rs, FormatInfo{Diff: true, Stdout: &stdout})
+	require.NoError(t, err)
+	require.Equal(t, strings.Join([]string{
+		"--- " + unformatted + ".orig",
+		"+++ " + unformatted,
+		"@@ -1,3 +1,3 @@",
+		" fs default() {",
+		"-    scratch",
+		"+\tscratch",
+		" }",
+		"",
+	}, "\n"), stdout.String())
+
+	dt, err := os.ReadFile(unformatted)
+	require.NoError(t, err)
+	require.Equal(t, "fs default() {\n    scratch\n}\n", string(dt))
+}
+
+func format(t *testing.T, r io.Reader) string {
+	ctx := hlb.WithDefaultContext(context.Background(), nil)
+
+	var stdout bytes.Buffer
+	err := Format(ctx, []io.Reader{r}, FormatInfo{Stdout: &stdout})
+	require.NoError(t, err)
+	return stdout.String()
+}
@@ -0,0 +1,226 @@
+package command
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/moby/buildkit/client"
+	"github.com/openllb/hlb"
+	"github.com/openllb/hlb/codegen"
+	"github.com/openllb/hlb/errdefs"
+	"github.com/openllb/hlb/parser"
+	"github.com/openllb/hlb/parser/ast"
+	"github.com/openllb/hlb/pkg/filebuffer"
+	"github.com/openllb/hlb/solver"
+	cli "github.com/urfave/cli/v2"
+)
+
+var inspectCommand = &cli.Command{
+	Name:      "inspect",
+	Usage:     "prints the image config of a target without solving it",
+	ArgsUsage: "<uri> [target]",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:    "backtrace",
+			Usage:   "print out the backtrace when encountering an error",
+			EnvVars: []string{"HLB_BACKTRACE"},
+		},
+		labelFlag,
+		buildEnvFlag,
+	},
+	Action: func(c *cli.Context) error {
+		if c.NArg() > 2 {
+			_ = cli.ShowCommandHelp(c, c.Command.Name)
+			return fmt.Errorf("requires at most 2 args but got %d", c.NArg())
+		}
+
+		uri := codegen.DefaultFilename
+		if c.NArg() > 0 {
+			uri = c.Args().Get(0)
+		}
+
+		target := "default"
+		if c.NArg() > 1 {
+			target = c.Args().Get(1)
+		}
+
+		cln, ctx, err := newClient(Context(), c)
+		if err != nil {
+			return err
+		}
+		ctx = hlb.WithDefaultContext(ctx, cln)
+		ctx = codegen.WithPreferLocal(ctx, c.Bool("prefer-local"))
+		ctx = codegen.WithExperimental(ctx, c.Bool("experimental"))
+		ctx = codegen.WithInsecureRegistries(ctx, c.StringSlice("insecure-registry"))
+		ctx, err = withImageResolveCache(ctx, c)
+		if err != nil {
+			return err
+		}
+
+		return Inspect(ctx, cln, uri, InspectInfo{
+			Target:    target,
+			Backtrace: c.Bool("backtrace"),
+			Labels:    c.StringSlice("label"),
+			BuildEnv:  c.StringSlice("build-env"),
+		})
+	},
+}
+
+type InspectInfo struct {
+	Target    string
+	Backtrace bool
+
+	// Labels and BuildEnv are key=value pairs that override the labels and
+	// environment set by the module, as they would on export.
+	Labels   []string
+	BuildEnv []string
+
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+
+	// Reader overrides the module read from uri.
+	Reader io.Reader
+}
+
+func Inspect(ctx context.Context, cln *client.Client, uri string, info InspectInfo) (err error) {
+	if info.Target == "" {
+		info.Target = "default"
+	}
+	if info.Stdin == nil {
+		info.Stdin = os.Stdin
+	}
+	if info.Stdout == nil {
+		info.Stdout = os.Stdout
+	}
+	if info.Stderr == nil {
+		info.Stderr = os.Stderr
+	}
+
+	ctx, err = withImageOverrides(ctx, info.Labels, info.BuildEnv)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err == nil {
+			return
+		}
+		numErrs := DisplayError(ctx, info.Stderr, err, info.Backtrace)
+		err = errdefs.WithAbort(err, numErrs)
+	}()
+
+	var mod *ast.Module
+	if info.Reader == nil {
+		mod, err = ParseModuleURI(ctx, cln, info.Stdin, uri)
+	} else {
+		mod, err = parser.Parse(ctx, info.Reader, filebuffer.WithEphemeral())
+	}
+	if err != nil {
+		return err
+	}
+
+	image, err := hlb.Inspect(ctx, cln, info.Stderr, mod, codegen.Target{Name: info.Target})
+	if err != nil {
+		return err
+	}
+
+	return printImageSpec(info.Stdout, image)
+}
+
+// printImageSpec writes the image config in a readable form, omitting fields
+// that are unset.
+func printImageSpec(w io.Writer, image *solver.ImageSpec) error {
+	var b strings.Builder
+	field := func(name, value string) {
+		if value != "" {
+			fmt.Fprintf(&b, "%s: %s\n", name, value)
+		}
+	}
+	list := func(name string, values []string) {
+		if len(values) == 0 {
+			return
+		}
+		fmt.Fprintf(&b, "%s:\n", name)
+		for _, value := range values {
+			fmt.Fprintf(&b, "  %s\n", value)
+		}
+	}
+	args := func(name string, values []string) error {
+		if len(values) == 0 {
+			return nil
+		}
+		dt, err := json.Marshal(values)
+		if err != nil {
+			return err
+		}
+		field(name, string(dt))
+		return nil
+	}
+
+	if image.OS != "" || image.Architecture != "" {
+		platform := image.OS + "/" + image.Architecture
+		if image.Variant != "" {
+			platform += "/" + image.Variant
+		}
+		field("Platform", platform)
+	}
+	field("User", image.Config.User)
+	field("WorkingDir", image.Config.WorkingDir)
+	err := args("Entrypoint", image.Config.Entrypoint)
+	if err != nil {
+		return err
+	}
+	err = args("Cmd", image.Config.Cmd)
+	if err != nil {
+		return err
+	}
+	field("StopSignal", image.Config.StopSignal)
+	list("Env", image.Config.Env)
+
+	var labels []string
+	for key, value := range image.Config.Labels {
+		labels = append(labels, key+"="+value)
+	}
+	sort.Strings(labels)
+	list("Labels", labels)
+
+	var annotations []string
+	for key, value := range image.Annotations {
+		annotations = append(annotations, key+"="+value)
+	}
+	sort.Strings(annotations)
+	list("Annotations", annotations)
+
+	var ports []string
+	for port := range image.Config.ExposedPorts {
+		ports = append(ports, port)
+	}
+	sort.Strings(ports)
+	list("ExposedPorts", ports)
+
+	var volumes []string
+	for volume := range image.Config.Volumes {
+		volumes = append(volumes, volume)
+	}
+	sort.Strings(volumes)
+	list("Volumes", volumes)
+
+	var history []string
+	for _, h := range image.History {
+		createdBy := h.CreatedBy
+		if h.EmptyLayer {
+			createdBy += " (empty layer)"
+		}
+		history = append(history, createdBy)
+	}
+	list("History", history)
+
+	_, err = io.WriteString(w, b.String())
+	return err
+}
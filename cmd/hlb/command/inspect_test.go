@@ -0,0 +1,115 @@
+package command
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lithammer/dedent"
+	"github.com/openllb/hlb"
+	"github.com/openllb/hlb/codegen"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInspect(t *testing.T) {
+	t.Parallel()
+
+	ctx := hlb.WithDefaultContext(context.Background(), nil)
+
+	var stdout, stderr bytes.Buffer
+	err := Inspect(ctx, nil, "", InspectInfo{
+		Target: "app",
+		Stdout: &stdout,
+		Stderr: &stderr,
+		Reader: strings.NewReader(dedent.Dedent(`
+		fs app() {
+			scratch
+			env "PATH" "/usr/bin"
+			entrypoint "/app" "--serve"
+			label "org.opencontainers.image.title" "app"
+			label "maintainer" "openllb"
+			annotation "org.opencontainers.image.source" "https://github.com/openllb/hlb"
+			expose "8080"
+		}
+		`)),
+	})
+	require.NoError(t, err, stderr.String())
+	require.Equal(t, dedent.Dedent(`
+	Entrypoint: ["/app","--serve"]
+	Env:
+	  PATH=/usr/bin
+	Labels:
+	  maintainer=openllb
+	  org.opencontainers.image.title=app
+	Annotations:
+	  org.opencontainers.image.source=https://github.com/openllb/hlb
+	ExposedPorts:
+	  8080/tcp
+	History:
+	  ENTRYPOINT ["/app" "--serve"] (empty layer)
+	  LABEL org.opencontainers.image.title=app maintainer=openllb (empty layer)
+	`)[1:], stdout.String())
+}
+
+func TestInspectNoOutput(t *testing.T) {
+	t.Parallel()
+
+	ctx := hlb.WithDefaultContext(context.Background(), nil)
+
+	report := codegen.NewReport()
+	ctx = codegen.WithReport(ctx, report)
+
+	// Inspecting must skip the outputs of the target, which would otherwise
+	// be pushed and downloaded during codegen.
+	out := filepath.Join(t.TempDir(), "out")
+	var stdout, stderr bytes.Buffer
+	err := Inspect(ctx, nil, "", InspectInfo{
+		Stdout: &stdout,
+		Stderr: &stderr,
+		Reader: strings.NewReader(dedent.Dedent(fmt.Sprintf(`
+		fs default() {
+			scratch
+			label "maintainer" "openllb"
+			download %q
+			dockerPush "openllb/app"
+		}
+		`, out))),
+	})
+	require.NoError(t, err, stderr.String())
+	require.Contains(t, stdout.String(), "maintainer=openllb")
+	require.Empty(t, report.Artifacts())
+	require.NoDirExists(t, out)
+}
+
+func TestInspectOverrides(t *testing.T) {
+	t.Parallel()
+
+	ctx := hlb.WithDefaultContext(context.Background(), nil)
+
+	var stdout, stderr bytes.Buffer
+	err := Inspect(ctx, nil, "", InspectInfo{
+		Labels:   []string{"maintainer=ci"},
+		BuildEnv: []string{"VERSION=1.2.3"},
+		Stdout:   &stdout,
+		Stderr:   &stderr,
+		Reader: strings.NewReader(dedent.Dedent(`
+		fs default() {
+			scratch
+			env "VERSION" "dev"
+			label "maintainer" "openllb"
+		}
+		`)),
+	})
+	require.NoError(t, err, stderr.String())
+	require.Equal(t, dedent.Dedent(`
+	Env:
+	  VERSION=1.2.3
+	Labels:
+	  maintainer=ci
+	History:
+	  LABEL maintainer=openllb (empty layer)
+	`)[1:], stdout.String())
+}
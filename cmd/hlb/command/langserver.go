@@ -4,14 +4,14 @@ import (
 	"log"
 	"os"
 
-	"github.com/openllb/hlb"
 	"github.com/openllb/hlb/rpc/langserver"
 	cli "github.com/urfave/cli/v2"
 )
 
 var langserverCommand = &cli.Command{
-	Name:  "langserver",
-	Usage: "run hlb language server over stdio",
+	Name:    "langserver",
+	Aliases: []string{"lsp"},
+	Usage:   "run hlb language server over stdio",
 	Flags: []cli.Flag{
 		&cli.StringFlag{
 			Name:  "logfile",
@@ -27,7 +27,7 @@ var langserverCommand = &cli.Command{
 		defer f.Close()
 		log.SetOutput(f)
 
-		cln, ctx, err := hlb.Client(Context(), c.String("addr"))
+		cln, ctx, err := newClient(Context(), c)
 		if err != nil {
 			return err
 		}
@@ -11,9 +11,11 @@ import (
 	"github.com/moby/buildkit/client"
 	"github.com/openllb/hlb"
 	"github.com/openllb/hlb/checker"
+	"github.com/openllb/hlb/codegen"
 	"github.com/openllb/hlb/diagnostic"
 	"github.com/openllb/hlb/errdefs"
 	"github.com/openllb/hlb/linter"
+	"github.com/openllb/hlb/parser"
 	cli "github.com/urfave/cli/v2"
 )
 
@@ -26,6 +28,10 @@ var lintCommand = &cli.Command{
 			Name:  "fix",
 			Usage: "write module with lint errors fixed and formatted to source file",
 		},
+		&cli.BoolFlag{
+			Name:  "strict",
+			Usage: "treat lint warnings, such as leftover breakpoints, as errors",
+		},
 	},
 	Action: func(c *cli.Context) error {
 		uri, err := GetURI(c)
@@ -33,20 +39,23 @@ var lintCommand = &cli.Command{
 			return err
 		}
 
-		cln, ctx, err := hlb.Client(Context(), c.String("addr"))
+		cln, ctx, err := newClient(Context(), c)
 		if err != nil {
 			return err
 		}
 		ctx = hlb.WithDefaultContext(ctx, cln)
+		ctx = codegen.WithExperimental(ctx, c.Bool("experimental"))
 
 		return Lint(ctx, cln, uri, LintInfo{
-			Fix: c.Bool("fix"),
+			Fix:    c.Bool("fix"),
+			Strict: c.Bool("strict"),
 		})
 	},
 }
 
 type LintInfo struct {
 	Fix    bool
+	Strict bool
 	Stdin  io.Reader
 	Stderr io.Writer
 }
@@ -64,46 +73,71 @@ func Lint(ctx context.Context, cln *client.Client, uri string, info LintInfo) er
 		return err
 	}
 
+	err = parser.ResolveIncludes(ctx, mod)
+	if err != nil {
+		return err
+	}
+
 	err = checker.SemanticPass(mod)
 	if err != nil {
 		return err
 	}
 
-	err = linter.Lint(ctx, mod)
+	lintOpts := []linter.LintOption{linter.WithUnusedFuncs()}
+	if info.Fix {
+		lintOpts = append(lintOpts, linter.WithFix())
+	}
+
+	err = linter.Lint(ctx, mod, lintOpts...)
 	if err != nil {
 		spans := diagnostic.Spans(err)
+		numErrs, numWarnings := 0, 0
 		for _, span := range spans {
-			if !info.Fix {
+			warning := errdefs.IsWarning(span)
+			if warning {
+				numWarnings++
+			} else {
+				numErrs++
+			}
+
+			// Warnings are fixed too when they carry a fixed module, such as
+			// unused functions that can be removed.
+			var em *errdefs.ErrModule
+			if !info.Fix || !errors.As(span, &em) {
 				fmt.Fprintln(info.Stderr, span.Pretty(ctx))
 				continue
 			}
 
-			var em *errdefs.ErrModule
-			if errors.As(span, &em) {
-				filename := em.Module.Pos.Filename
-				info, err := os.Stat(filename)
-				if err != nil {
-					return err
-				}
-
-				err = ioutil.WriteFile(filename, []byte(em.Module.String()), info.Mode())
-				if err != nil {
-					return err
-				}
+			filename := em.Module.Pos.Filename
+			fi, err := os.Stat(filename)
+			if err != nil {
+				return err
+			}
+
+			err = ioutil.WriteFile(filename, []byte(em.Module.String()), fi.Mode())
+			if err != nil {
+				return err
 			}
 		}
 		if info.Fix {
 			return nil
 		}
 
-		color := diagnostic.Color(ctx)
-		fmt.Fprint(info.Stderr, color.Sprintf(
-			color.Bold("\nRun %s to automatically fix lint errors.\n"),
-			color.Green(fmt.Sprintf("`hlb lint --fix %s`", mod.Pos.Filename)),
-		))
+		if numErrs > 0 {
+			color := diagnostic.Color(ctx)
+			fmt.Fprint(info.Stderr, color.Sprintf(
+				color.Bold("\nRun %s to automatically fix lint errors.\n"),
+				color.Green(fmt.Sprintf("`hlb lint --fix %s`", mod.Pos.Filename)),
+			))
+		}
 
-		return errdefs.WithAbort(err, len(spans))
+		if info.Strict {
+			numErrs += numWarnings
+		}
+		if numErrs > 0 {
+			return errdefs.WithAbort(err, numErrs)
+		}
 	}
 
-	return checker.Check(mod)
+	return checker.Check(mod, codegen.CheckOptions(ctx)...)
 }
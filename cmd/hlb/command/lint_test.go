@@ -0,0 +1,50 @@
+package command
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/openllb/hlb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLintFix(t *testing.T) {
+	t.Parallel()
+
+	ctx := hlb.WithDefaultContext(context.Background(), nil)
+
+	dt, err := os.ReadFile(filepath.Join("testdata", "lint", "unused.hlb"))
+	require.NoError(t, err)
+	golden, err := os.ReadFile(filepath.Join("testdata", "lint", "unused.golden"))
+	require.NoError(t, err)
+
+	filename := filepath.Join(t.TempDir(), "unused.hlb")
+	err = os.WriteFile(filename, dt, 0o644)
+	require.NoError(t, err)
+
+	// Without fixing, unused functions are only warnings.
+	var stderr bytes.Buffer
+	err = Lint(ctx, nil, filename, LintInfo{Stderr: &stderr})
+	require.NoError(t, err)
+	require.Contains(t, stderr.String(), "function `cached` is unused")
+	require.Contains(t, stderr.String(), "function `tagged` is unused")
+	require.Contains(t, stderr.String(), "function `test` is unused")
+
+	dt, err = os.ReadFile(filename)
+	require.NoError(t, err)
+	require.NotEqual(t, string(golden), string(dt))
+
+	// Fixing removes the functions that cannot be run as targets.
+	stderr.Reset()
+	err = Lint(ctx, nil, filename, LintInfo{Fix: true, Stderr: &stderr})
+	require.NoError(t, err)
+	require.Contains(t, stderr.String(), "function `test` is unused")
+	require.NotContains(t, stderr.String(), "function `cached` is unused")
+
+	dt, err = os.ReadFile(filename)
+	require.NoError(t, err)
+	require.Equal(t, string(golden), string(dt))
+}
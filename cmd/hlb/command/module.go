@@ -51,11 +51,18 @@ var moduleVendorCommand = &cli.Command{
 			return err
 		}
 
-		cln, ctx, err := hlb.Client(Context(), c.String("addr"))
+		cln, ctx, err := newClient(Context(), c)
 		if err != nil {
 			return err
 		}
 		ctx = hlb.WithDefaultContext(ctx, cln)
+		ctx = codegen.WithPreferLocal(ctx, c.Bool("prefer-local"))
+		ctx = codegen.WithExperimental(ctx, c.Bool("experimental"))
+		ctx = codegen.WithInsecureRegistries(ctx, c.StringSlice("insecure-registry"))
+		ctx, err = withImageResolveCache(ctx, c)
+		if err != nil {
+			return err
+		}
 
 		return Vendor(ctx, cln, uri, VendorInfo{
 			Targets: c.StringSlice("target"),
@@ -74,11 +81,18 @@ var moduleTidyCommand = &cli.Command{
 			return err
 		}
 
-		cln, ctx, err := hlb.Client(Context(), c.String("addr"))
+		cln, ctx, err := newClient(Context(), c)
 		if err != nil {
 			return err
 		}
 		ctx = hlb.WithDefaultContext(ctx, cln)
+		ctx = codegen.WithPreferLocal(ctx, c.Bool("prefer-local"))
+		ctx = codegen.WithExperimental(ctx, c.Bool("experimental"))
+		ctx = codegen.WithInsecureRegistries(ctx, c.StringSlice("insecure-registry"))
+		ctx, err = withImageResolveCache(ctx, c)
+		if err != nil {
+			return err
+		}
 
 		return Vendor(ctx, cln, uri, VendorInfo{
 			Tidy: true,
@@ -102,11 +116,18 @@ var moduleTreeCommand = &cli.Command{
 			return err
 		}
 
-		cln, ctx, err := hlb.Client(Context(), c.String("addr"))
+		cln, ctx, err := newClient(Context(), c)
 		if err != nil {
 			return err
 		}
 		ctx = hlb.WithDefaultContext(ctx, cln)
+		ctx = codegen.WithPreferLocal(ctx, c.Bool("prefer-local"))
+		ctx = codegen.WithExperimental(ctx, c.Bool("experimental"))
+		ctx = codegen.WithInsecureRegistries(ctx, c.StringSlice("insecure-registry"))
+		ctx, err = withImageResolveCache(ctx, c)
+		if err != nil {
+			return err
+		}
 
 		return Tree(ctx, cln, uri, TreeInfo{
 			Long: c.Bool("long"),
@@ -154,6 +175,11 @@ func Vendor(ctx context.Context, cln *client.Client, uri string, info VendorInfo
 		}
 	}
 
+	err = parser.ResolveIncludes(ctx, mod)
+	if err != nil {
+		return err
+	}
+
 	err = checker.SemanticPass(mod)
 	if err != nil {
 		return err
@@ -161,7 +187,7 @@ func Vendor(ctx context.Context, cln *client.Client, uri string, info VendorInfo
 
 	_ = linter.Lint(ctx, mod)
 
-	err = checker.Check(mod)
+	err = checker.Check(mod, codegen.CheckOptions(ctx)...)
 	if err != nil {
 		return err
 	}
@@ -269,6 +295,11 @@ func Tree(ctx context.Context, cln *client.Client, uri string, info TreeInfo) (e
 		return err
 	}
 
+	err = parser.ResolveIncludes(ctx, mod)
+	if err != nil {
+		return err
+	}
+
 	err = checker.SemanticPass(mod)
 	if err != nil {
 		return err
@@ -276,7 +307,7 @@ func Tree(ctx context.Context, cln *client.Client, uri string, info TreeInfo) (e
 
 	_ = linter.Lint(ctx, mod)
 
-	err = checker.Check(mod)
+	err = checker.Check(mod, codegen.CheckOptions(ctx)...)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,350 @@
+package command
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/chzyer/readline"
+	"github.com/moby/buildkit/client"
+	"github.com/openllb/hlb"
+	"github.com/openllb/hlb/builtin"
+	"github.com/openllb/hlb/checker"
+	"github.com/openllb/hlb/codegen"
+	"github.com/openllb/hlb/diagnostic"
+	"github.com/openllb/hlb/linter"
+	"github.com/openllb/hlb/parser"
+	"github.com/openllb/hlb/parser/ast"
+	"github.com/openllb/hlb/pkg/filebuffer"
+	cli "github.com/urfave/cli/v2"
+	"github.com/xlab/treeprint"
+)
+
+var replCommand = &cli.Command{
+	Name:  "repl",
+	Usage: "interactively evaluates declarations and statements",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:    "backtrace",
+			Usage:   "print out the backtrace when encountering an error",
+			EnvVars: []string{"HLB_BACKTRACE"},
+		},
+	},
+	Action: func(c *cli.Context) error {
+		cln, ctx, err := newClient(Context(), c)
+		if err != nil {
+			return err
+		}
+		ctx = hlb.WithDefaultContext(ctx, cln)
+		ctx = codegen.WithPreferLocal(ctx, c.Bool("prefer-local"))
+		ctx = codegen.WithExperimental(ctx, c.Bool("experimental"))
+		ctx = codegen.WithInsecureRegistries(ctx, c.StringSlice("insecure-registry"))
+		ctx, err = withImageResolveCache(ctx, c)
+		if err != nil {
+			return err
+		}
+
+		return REPL(ctx, cln, REPLInfo{
+			Backtrace: c.Bool("backtrace"),
+		})
+	},
+}
+
+type REPLInfo struct {
+	Backtrace bool
+
+	Stdin  io.ReadCloser
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+const (
+	replPrompt         = "hlb> "
+	replContinuePrompt = "...  "
+
+	// replTarget is the name of the function that statements are evaluated
+	// in, which is unlikely to collide with the functions declared by users.
+	replTarget = "_repl"
+)
+
+// declRegexp matches the start of declarations, which are the signature of a
+// function, an import or an export.
+var declRegexp = regexp.MustCompile(`^\s*(import|export|include)\b|^\s*[\w:]+\s+[\w:]+\s*\(`)
+
+// REPL reads declarations and statements line by line. Declarations are kept
+// in the module that later lines are evaluated in, and statements are
+// evaluated as the body of a function to print their value.
+//
+// Lines are read until their braces are balanced, so blocks can span multiple
+// lines. Outputs of statements, like pushes and downloads, are skipped.
+func REPL(ctx context.Context, cln *client.Client, info REPLInfo) error {
+	if info.Stdin == nil {
+		info.Stdin = os.Stdin
+	}
+	if info.Stdout == nil {
+		info.Stdout = os.Stdout
+	}
+	if info.Stderr == nil {
+		info.Stderr = os.Stderr
+	}
+
+	l, err := readline.NewEx(&readline.Config{
+		Prompt: replPrompt,
+		Stdin:  info.Stdin,
+		Stdout: info.Stdout,
+		Stderr: info.Stderr,
+	})
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+
+	ctx = codegen.WithNoOutput(ctx, true)
+	r := &repl{ctx: ctx, cln: cln, info: info}
+
+	var lines []string
+	for {
+		if len(lines) == 0 {
+			l.SetPrompt(replPrompt)
+		} else {
+			l.SetPrompt(replContinuePrompt)
+		}
+
+		line, err := l.Readline()
+		if err != nil {
+			if errors.Is(err, readline.ErrInterrupt) || errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+
+		lines = append(lines, line)
+		input := strings.Join(lines, "\n")
+		if unclosedBraces(input) {
+			continue
+		}
+		lines = nil
+
+		switch strings.TrimSpace(input) {
+		case "":
+			continue
+		case "exit":
+			return nil
+		}
+
+		err = r.eval(input)
+		if err != nil {
+			DisplayError(ctx, info.Stderr, err, info.Backtrace)
+		}
+	}
+}
+
+type repl struct {
+	ctx  context.Context
+	cln  *client.Client
+	info REPLInfo
+
+	// decls are the declarations accepted so far.
+	decls []string
+}
+
+func (r *repl) eval(input string) error {
+	if declRegexp.MatchString(input) {
+		return r.declare(input)
+	}
+
+	kind, err := r.statementKind(input)
+	if err != nil {
+		return err
+	}
+
+	src := fmt.Sprintf("%s %s() {\n%s\n}", kind, replTarget, input)
+	r.lint(src)
+
+	mod, err := r.parse(src)
+	if err != nil {
+		return err
+	}
+
+	// Only the new statement is linted, otherwise the warnings of earlier
+	// declarations would repeat on every line.
+	val, err := hlb.Evaluate(r.ctx, r.cln, io.Discard, mod, codegen.Target{Name: replTarget})
+	if err != nil {
+		return err
+	}
+	return r.print(kind, val)
+}
+
+// declare keeps the declarations of input for later lines if they are valid.
+func (r *repl) declare(input string) error {
+	r.lint(input)
+
+	mod, err := r.parse(input)
+	if err != nil {
+		return err
+	}
+
+	err = checker.SemanticPass(mod)
+	if err != nil {
+		return err
+	}
+
+	err = checker.Check(mod, codegen.CheckOptions(r.ctx)...)
+	if err != nil {
+		return err
+	}
+
+	r.decls = append(r.decls, input)
+	return nil
+}
+
+// statementKind returns the kind of the function that the statements of input
+// are evaluated in, which is the kind of the first function called.
+func (r *repl) statementKind(input string) (ast.Kind, error) {
+	mod, err := r.parse(fmt.Sprintf("fs %s() {\n%s\n}", replTarget, input))
+	if err != nil {
+		return ast.None, err
+	}
+
+	var name *ast.IdentExpr
+	for _, decl := range mod.Decls {
+		if decl.Func == nil || decl.Func.Sig.Name.Text != replTarget {
+			continue
+		}
+		for _, stmt := range decl.Func.Body.List {
+			if stmt.Call != nil {
+				name = stmt.Call.Name
+				break
+			}
+		}
+	}
+	// Functions of imported modules are only resolved when they are called,
+	// so they default to filesystems.
+	if name == nil || name.Reference != nil {
+		return ast.Filesystem, nil
+	}
+
+	err = checker.SemanticPass(mod)
+	if err != nil {
+		return ast.None, err
+	}
+
+	obj, ok := mod.Scope.Objects[name.Ident.Text]
+	if ok {
+		return obj.Kind, nil
+	}
+
+	for _, kind := range []ast.Kind{ast.Filesystem, ast.String, ast.Int, ast.Bool, ast.List, ast.Pipeline} {
+		if _, ok := builtin.Lookup.ByKind[kind].Func[name.Ident.Text]; ok {
+			return kind, nil
+		}
+	}
+	return ast.Filesystem, nil
+}
+
+// lint prints the lint warnings of src alone, without the declarations
+// accepted so far. Syntax errors are left to be reported by parse.
+func (r *repl) lint(src string) {
+	mod, err := parser.Parse(r.ctx, strings.NewReader(src+"\n"), filebuffer.WithEphemeral())
+	if err != nil {
+		return
+	}
+
+	// The linter resolves identifiers through the scopes of the semantic
+	// pass. Its errors are left to be reported by parse too.
+	_ = checker.SemanticPass(mod)
+
+	err = linter.Lint(r.ctx, mod)
+	for _, span := range diagnostic.Spans(err) {
+		fmt.Fprintln(r.info.Stderr, span.Pretty(r.ctx))
+	}
+}
+
+// unclosedBraces returns true if input has more opening braces than closing
+// ones. Braces inside string literals, heredocs and comments are skipped.
+func unclosedBraces(input string) bool {
+	l, err := ast.Lexer.Lex("", strings.NewReader(input))
+	if err != nil {
+		return false
+	}
+
+	symbols := ast.Lexer.Symbols()
+	depth := 0
+	for {
+		token, err := l.Next()
+		if err != nil {
+			return false
+		}
+		if token.EOF() {
+			break
+		}
+		switch token.Type {
+		// Interpolations in strings are also closed by a BlockEnd.
+		case symbols["Block"], symbols["Interpolated"]:
+			depth++
+		case symbols["BlockEnd"]:
+			depth--
+		}
+	}
+	return depth > 0
+}
+
+// parse parses the declarations accepted so far followed by src.
+func (r *repl) parse(src string) (*ast.Module, error) {
+	decls := append(append([]string{}, r.decls...), src)
+	return parser.Parse(r.ctx, strings.NewReader(strings.Join(decls, "\n")+"\n"), filebuffer.WithEphemeral())
+}
+
+func (r *repl) print(kind ast.Kind, val codegen.Value) error {
+	var value string
+	switch kind {
+	case ast.String:
+		str, err := val.String()
+		if err != nil {
+			return err
+		}
+		value = strconv.Quote(str)
+	case ast.Int:
+		i, err := val.Int()
+		if err != nil {
+			return err
+		}
+		value = strconv.Itoa(i)
+	case ast.Bool:
+		str, err := val.String()
+		if err != nil {
+			return err
+		}
+		value = str
+	case ast.List:
+		list, err := val.List()
+		if err != nil {
+			return err
+		}
+		quoted := make([]string, len(list))
+		for i, str := range list {
+			quoted[i] = strconv.Quote(str)
+		}
+		value = fmt.Sprintf("[%s]", strings.Join(quoted, ", "))
+	default:
+		req, err := val.Request()
+		if err != nil {
+			return err
+		}
+
+		tree := treeprint.New()
+		err = req.Tree(tree)
+		if err != nil {
+			return err
+		}
+		value = strings.TrimSuffix(tree.String(), "\n")
+	}
+
+	_, err := fmt.Fprintf(r.info.Stdout, "(%s) %s\n", kind, value)
+	return err
+}
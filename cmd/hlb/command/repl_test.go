@@ -0,0 +1,97 @@
+package command
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/lithammer/dedent"
+	"github.com/openllb/hlb"
+	"github.com/openllb/hlb/codegen"
+	"github.com/stretchr/testify/require"
+)
+
+func TestREPL(t *testing.T) {
+	t.Parallel()
+
+	ctx := hlb.WithDefaultContext(context.Background(), nil)
+
+	var stdout, stderr bytes.Buffer
+	err := REPL(ctx, nil, REPLInfo{
+		Stdin: io.NopCloser(strings.NewReader(strings.TrimSpace(dedent.Dedent(`
+		string greet(string name) {
+			format "hello %s" name
+		}
+		greet "world"
+		scratch; mkfile "/foo" 0o644 "foo"
+		undefined "world"
+		greet "again"
+		split "," "a,b"
+		format "{%s" "}"
+		`)) + "\n")),
+		Stdout: &stdout,
+		Stderr: &stderr,
+	})
+	require.NoError(t, err, stderr.String())
+
+	// The declarations are kept for later lines, even after a line fails.
+	require.Equal(t, strings.Join([]string{
+		`(string) "hello world"`,
+		"(fs) .",
+		"└── [file]  " + mkfileAction("/foo"),
+		`(string) "hello again"`,
+		`(list) ["a", "b"]`,
+		`(string) "{}"`,
+		"",
+	}, "\n"), stdout.String())
+	require.Contains(t, stderr.String(), "`undefined` is undefined or not in scope")
+}
+
+func TestREPLNoOutput(t *testing.T) {
+	t.Parallel()
+
+	ctx := hlb.WithDefaultContext(context.Background(), nil)
+
+	report := codegen.NewReport()
+	ctx = codegen.WithReport(ctx, report)
+
+	var stdout, stderr bytes.Buffer
+	err := REPL(ctx, nil, REPLInfo{
+		Stdin:  io.NopCloser(strings.NewReader(`scratch; dockerPush "openllb/app"` + "\n")),
+		Stdout: &stdout,
+		Stderr: &stderr,
+	})
+	require.NoError(t, err, stderr.String())
+	require.Equal(t, "(fs) .\n", stdout.String(), stderr.String())
+	require.Empty(t, report.Artifacts())
+}
+
+func TestREPLLint(t *testing.T) {
+	t.Parallel()
+
+	ctx := hlb.WithDefaultContext(context.Background(), nil)
+
+	var stdout, stderr bytes.Buffer
+	err := REPL(ctx, nil, REPLInfo{
+		Stdin: io.NopCloser(strings.NewReader(strings.TrimSpace(dedent.Dedent(`
+		string greet(string name, string unused) {
+			format "hello %s" name
+		}
+		greet "world" "a"
+		greet "again" "b"
+		`)) + "\n")),
+		Stdout: &stdout,
+		Stderr: &stderr,
+	})
+	require.NoError(t, err, stderr.String())
+	require.Equal(t, strings.Join([]string{
+		`(string) "hello world"`,
+		`(string) "hello again"`,
+		"",
+	}, "\n"), stdout.String())
+
+	// Declarations are only linted when they are declared.
+	require.Equal(t, 1, strings.Count(stderr.String(), "`unused`"), stderr.String())
+}
@@ -7,10 +7,13 @@ import (
 	"io"
 	"os"
 	"strings"
+	"sync"
 
+	"github.com/containerd/containerd/platforms"
 	"github.com/mattn/go-isatty"
 	"github.com/moby/buildkit/client"
 	solvererrdefs "github.com/moby/buildkit/solver/errdefs"
+	"github.com/moby/buildkit/util/entitlements"
 	specs "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/openllb/hlb"
 	"github.com/openllb/hlb/codegen"
@@ -40,6 +43,10 @@ var runCommand = &cli.Command{
 			Usage:   "specify target filesystem to solve",
 			Value:   cli.NewStringSlice("default"),
 		},
+		&cli.BoolFlag{
+			Name:  "target-all",
+			Usage: "build the default target and every exported target that takes no arguments, reporting the failures of each",
+		},
 		&cli.BoolFlag{
 			Name:  "debug",
 			Usage: "attach a debugger",
@@ -48,6 +55,11 @@ var runCommand = &cli.Command{
 			Name:  "dap",
 			Usage: "set debugger fronted to DAP over stdio",
 		},
+		&cli.StringFlag{
+			Name:    "debug-dap-log",
+			Usage:   "trace the messages of the DAP debugger to a file",
+			EnvVars: []string{"HLB_DEBUG_DAP_LOG"},
+		},
 		&cli.BoolFlag{
 			Name:  "tree",
 			Usage: "print out the request tree without solving",
@@ -62,9 +74,31 @@ var runCommand = &cli.Command{
 			Usage:   "print out the backtrace when encountering an error",
 			EnvVars: []string{"HLB_BACKTRACE"},
 		},
-		&cli.StringFlag{
+		&cli.StringSliceFlag{
 			Name:  "platform",
-			Usage: "set default platform for image resolution",
+			Usage: "set default platform for image resolution, repeat or separate with commas to build every target for each platform as a multi-platform image",
+		},
+		&cli.StringFlag{
+			Name:  "report",
+			Usage: "print a report of the produced artifacts after the run (json)",
+		},
+		&cli.BoolFlag{
+			Name:  "no-output",
+			Usage: "solve the targets without downloading, loading or pushing any outputs",
+		},
+		&cli.BoolFlag{
+			Name:  "export-cache-summary",
+			Usage: "print whether each op was cached or computed by source location after the run",
+		},
+		labelFlag,
+		buildEnvFlag,
+		&cli.StringSliceFlag{
+			Name:  "allow",
+			Usage: "only allow the listed entitlements to be requested (network.host, security.insecure)",
+		},
+		&cli.BoolFlag{
+			Name:  "watch",
+			Usage: "rebuild whenever the module or a local source it reads changes",
 		},
 	},
 	Action: func(c *cli.Context) error {
@@ -73,31 +107,89 @@ var runCommand = &cli.Command{
 			return err
 		}
 
-		cln, ctx, err := hlb.Client(Context(), c.String("addr"))
+		cln, ctx, err := newClient(Context(), c)
 		if err != nil {
 			return err
 		}
 		ctx = hlb.WithDefaultContext(ctx, cln)
+		ctx = codegen.WithPreferLocal(ctx, c.Bool("prefer-local"))
+		ctx = codegen.WithExperimental(ctx, c.Bool("experimental"))
+		ctx = codegen.WithInsecureRegistries(ctx, c.StringSlice("insecure-registry"))
+		ctx, err = withImageResolveCache(ctx, c)
+		if err != nil {
+			return err
+		}
 
 		var controlDebugger ControlDebugger
 		if c.Bool("debug") && !c.Bool("dap") {
 			controlDebugger = ControlDebuggerTUI(os.Stdin, os.Stdout, os.Stderr)
 		}
 
-		return Run(ctx, cln, uri, RunInfo{
+		var dapLog io.Writer
+		if c.IsSet("debug-dap-log") {
+			f, err := os.OpenFile(c.String("debug-dap-log"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			dapLog = f
+		}
+
+		if c.Bool("target-all") {
+			if c.IsSet("target") {
+				return fmt.Errorf("--target-all cannot be used with --target")
+			}
+			if c.Bool("debug") || c.Bool("dap") {
+				return fmt.Errorf("--target-all cannot be used with --debug or --dap")
+			}
+		}
+
+		info := RunInfo{
 			Tree:            c.Bool("tree"),
 			Targets:         c.StringSlice("target"),
+			TargetAll:       c.Bool("target-all"),
 			LLB:             c.Bool("llb"),
 			Backtrace:       c.Bool("backtrace"),
 			LogOutput:       c.String("log-output"),
-			DefaultPlatform: c.String("platform"),
+			Platforms:       c.StringSlice("platform"),
+			Report:          c.String("report"),
+			CacheSummary:    c.Bool("export-cache-summary"),
+			NoOutput:        c.Bool("no-output"),
+			Labels:          c.StringSlice("label"),
+			BuildEnv:        c.StringSlice("build-env"),
 			Debug:           c.Bool("debug"),
 			DAP:             c.Bool("dap"),
+			DAPLog:          dapLog,
 			ControlDebugger: controlDebugger,
-		})
+		}
+		if c.IsSet("allow") {
+			info.Allow = c.StringSlice("allow")
+			if info.Allow == nil {
+				info.Allow = []string{}
+			}
+		}
+
+		if c.Bool("watch") {
+			if info.Debug || info.DAP || info.Tree {
+				return fmt.Errorf("--watch cannot be used with --debug, --dap or --tree")
+			}
+			return Watch(ctx, cln, uri, info)
+		}
+		return Run(ctx, cln, uri, info)
 	},
 }
 
+var (
+	labelFlag = &cli.StringSliceFlag{
+		Name:  "label",
+		Usage: "set a label on exported images, overriding the module (key=value)",
+	}
+	buildEnvFlag = &cli.StringSliceFlag{
+		Name:  "build-env",
+		Usage: "set an environment variable on exported images, overriding the module (key=value)",
+	}
+)
+
 func GetURI(c *cli.Context) (uri string, err error) {
 	uri = codegen.DefaultFilename
 	if c.NArg() > 1 {
@@ -131,14 +223,56 @@ func ControlDebuggerTUI(stdin io.Reader, stdout, stderr io.Writer) ControlDebugg
 }
 
 type RunInfo struct {
-	DAP             bool
-	Tree            bool
-	Backtrace       bool
-	Targets         []string
-	LLB             bool
-	LogOutput       string
-	LogPrefixes     []string
-	DefaultPlatform string // format: osname/osarch
+	DAP bool
+
+	// DAPLog is where the DAP server traces the messages it receives and
+	// sends. They are discarded when nil, so they never corrupt the DAP
+	// stream over stdio.
+	DAPLog io.Writer
+
+	Tree      bool
+	Backtrace bool
+	Targets   []string
+	LLB       bool
+
+	// TargetAll builds the default and exported targets of the module
+	// instead of Targets. A failing target doesn't stop the others, and the
+	// failures of all targets are returned together.
+	TargetAll bool
+
+	LogOutput   string
+	LogPrefixes []string
+
+	// Platforms are the default platforms for image resolution, in the format
+	// osname/osarch. When there are multiple platforms, every target is built
+	// for each platform in parallel.
+	Platforms []string
+
+	// DefaultPlatform is the default platform for image resolution, in the
+	// format osname/osarch.
+	//
+	// Deprecated: Use Platforms instead, which takes precedence when set.
+	DefaultPlatform string
+
+	// Allow restricts the entitlements the program may request when non-nil.
+	Allow []string
+
+	// Labels and BuildEnv are key=value pairs set on the config of exported
+	// images, overriding the labels and environment set by the module.
+	Labels   []string
+	BuildEnv []string
+
+	// Report is the format of the report of produced artifacts printed to
+	// stdout after a successful run. Only "json" is supported.
+	Report string
+
+	// CacheSummary prints the cache status of each op grouped by the source
+	// location that produced it to stderr after a successful run.
+	CacheSummary bool
+
+	// NoOutput solves the targets without exporting anything, which verifies
+	// that they build without producing artifacts.
+	NoOutput bool
 
 	Stdin  io.Reader
 	Stderr io.Writer
@@ -155,6 +289,98 @@ type RunInfo struct {
 	Arch    string
 }
 
+// parsePlatforms parses platforms in the format osname/osarch. Each value may
+// also be a comma separated list of platforms.
+func parsePlatforms(values []string) ([]specs.Platform, error) {
+	var platforms []specs.Platform
+	for _, value := range values {
+		for _, platform := range strings.Split(value, ",") {
+			platformParts := strings.SplitN(platform, "/", 2)
+			if len(platformParts) < 2 {
+				return nil, fmt.Errorf("Invalid platform specified: %s", platform)
+			}
+			platforms = append(platforms, specs.Platform{OS: platformParts[0], Architecture: platformParts[1]})
+		}
+	}
+	return platforms, nil
+}
+
+// runTargets returns the targets to build. When there are multiple platforms,
+// every target is built for each of them.
+func runTargets(names []string, platforms []specs.Platform) []codegen.Target {
+	var targets []codegen.Target
+	for _, name := range names {
+		if len(platforms) < 2 {
+			targets = append(targets, codegen.Target{Name: name})
+			continue
+		}
+		for i := range platforms {
+			targets = append(targets, codegen.Target{Name: name, Platform: &platforms[i]})
+		}
+	}
+	return targets
+}
+
+// targetErrors collects the failures of targets that are solved together, in
+// the order of the targets.
+type targetErrors struct {
+	mu   sync.Mutex
+	errs []error
+}
+
+func (te *targetErrors) set(i int, target codegen.Target, err error) {
+	name := target.Name
+	if target.Platform != nil {
+		name = fmt.Sprintf("%s (%s)", name, platforms.Format(*target.Platform))
+	}
+
+	te.mu.Lock()
+	defer te.mu.Unlock()
+	te.errs[i] = fmt.Errorf("target %s: %w", name, err)
+}
+
+// Err returns the failures of every target joined together, or nil if all of
+// them succeeded.
+func (te *targetErrors) Err() error {
+	te.mu.Lock()
+	defer te.mu.Unlock()
+	return errors.Join(te.errs...)
+}
+
+// targetRequest is the solve request of a target that records its failure
+// instead of returning it, so that the targets solved in parallel with it
+// aren't canceled.
+type targetRequest struct {
+	solver.Request
+	i      int
+	target codegen.Target
+	errs   *targetErrors
+}
+
+func (r *targetRequest) Solve(ctx context.Context, cln *client.Client, mw *solver.MultiWriter, opts ...solver.SolveOption) error {
+	err := r.Request.Solve(ctx, cln, mw, opts...)
+	if err != nil {
+		r.errs.set(r.i, r.target, err)
+	}
+	return nil
+}
+
+// allTargetsRequest composes the requests of targets into one request that
+// solves all of them, even if some fail. Targets that failed to compile are
+// recorded as failed without being solved.
+func allTargetsRequest(targets []codegen.Target, requests []solver.Request, compileErrs []error) (solver.Request, *targetErrors) {
+	errs := &targetErrors{errs: make([]error, len(requests))}
+	var reqs []solver.Request
+	for i, req := range requests {
+		if compileErrs[i] != nil {
+			errs.set(i, targets[i], compileErrs[i])
+			continue
+		}
+		reqs = append(reqs, &targetRequest{Request: req, i: i, target: targets[i], errs: errs})
+	}
+	return solver.Parallel(reqs...), errs
+}
+
 func Run(ctx context.Context, cln *client.Client, uri string, info RunInfo) (err error) {
 	if len(info.Targets) == 0 {
 		info.Targets = []string{"default"}
@@ -176,12 +402,58 @@ func Run(ctx context.Context, cln *client.Client, uri string, info RunInfo) (err
 	}
 	ctx = local.WithOs(ctx, info.Os)
 	ctx = local.WithArch(ctx, info.Arch)
-	if info.DefaultPlatform != "" {
-		platformParts := strings.SplitN(info.DefaultPlatform, "/", 2)
-		if len(platformParts) < 2 {
-			return fmt.Errorf("Invalid platform specified: %s", info.DefaultPlatform)
+	values := info.Platforms
+	if len(values) == 0 && info.DefaultPlatform != "" {
+		values = []string{info.DefaultPlatform}
+	}
+	platforms, err := parsePlatforms(values)
+	if err != nil {
+		return err
+	}
+	if len(platforms) == 1 {
+		ctx = codegen.WithDefaultPlatform(ctx, platforms[0])
+	}
+	if info.Allow != nil {
+		var allowed []entitlements.Entitlement
+		for _, allow := range info.Allow {
+			if allow == "" {
+				continue
+			}
+			e, err := entitlements.Parse(allow)
+			if err != nil {
+				return err
+			}
+			allowed = append(allowed, e)
+		}
+		ctx = codegen.WithAllowedEntitlements(ctx, allowed...)
+	}
+
+	ctx = codegen.WithNoOutput(ctx, info.NoOutput || info.Tree)
+
+	ctx, err = withImageOverrides(ctx, info.Labels, info.BuildEnv)
+	if err != nil {
+		return err
+	}
+
+	// A report may already be collected by the caller, like watch does to
+	// find the paths a run reads and writes.
+	var report *codegen.Report
+	switch info.Report {
+	case "":
+	case "json":
+		report = codegen.GetReport(ctx)
+		if report == nil {
+			report = codegen.NewReport()
+			ctx = codegen.WithReport(ctx, report)
 		}
-		ctx = codegen.WithDefaultPlatform(ctx, specs.Platform{OS: platformParts[0], Architecture: platformParts[1]})
+	default:
+		return fmt.Errorf("unrecognized report format %q", info.Report)
+	}
+
+	var cacheSummary *solver.CacheSummary
+	if info.CacheSummary {
+		cacheSummary = solver.NewCacheSummary()
+		ctx = solver.WithCacheSummary(ctx, cacheSummary)
 	}
 
 	var progressOpts []solver.ProgressOption
@@ -191,9 +463,9 @@ func Run(ctx context.Context, cln *client.Client, uri string, info RunInfo) (err
 			logPrefixes = append(logPrefixes, pfx)
 		}
 	}
-	if len(logPrefixes) == 0 && info.DefaultPlatform != "" {
+	if len(logPrefixes) == 0 && len(platforms) == 1 {
 		// Use the default platform as the log prefix by default.
-		logPrefixes = append(logPrefixes, info.DefaultPlatform)
+		logPrefixes = append(logPrefixes, fmt.Sprintf("%s/%s", platforms[0].OS, platforms[0].Architecture))
 	}
 	progressOpts = append(progressOpts, solver.WithLogPrefix(logPrefixes...))
 
@@ -262,10 +534,13 @@ func Run(ctx context.Context, cln *client.Client, uri string, info RunInfo) (err
 		return err
 	}
 
-	var targets []codegen.Target
-	for _, target := range info.Targets {
-		targets = append(targets, codegen.Target{Name: target})
+	if info.TargetAll {
+		info.Targets = codegen.ExportedTargets(mod)
+		if len(info.Targets) == 0 {
+			return fmt.Errorf("no default or exported targets to build")
+		}
 	}
+	targets := runTargets(info.Targets, platforms)
 
 	g, ctx := errgroup.WithContext(ctx)
 
@@ -283,12 +558,27 @@ func Run(ctx context.Context, cln *client.Client, uri string, info RunInfo) (err
 	}
 	if info.DAP {
 		g.Go(func() error {
-			s := dapserver.New(dbgr)
+			s := dapserver.New(dbgr, dapserver.WithLog(info.DAPLog))
 			return s.Listen(ctx, dapReader, info.Stdin, info.Stdout)
 		})
 	}
 
-	solveReq, err := hlb.Compile(ctx, cln, info.Stderr, mod, targets)
+	var (
+		solveReq   solver.Request
+		targetErrs *targetErrors
+	)
+	if info.TargetAll {
+		var (
+			requests    []solver.Request
+			compileErrs []error
+		)
+		requests, compileErrs, err = hlb.CompileRequests(ctx, cln, info.Stderr, mod, targets)
+		if err == nil {
+			solveReq, targetErrs = allTargetsRequest(targets, requests, compileErrs)
+		}
+	} else {
+		solveReq, err = hlb.Compile(ctx, cln, info.Stderr, mod, targets)
+	}
 	if err != nil {
 		perr := p.Wait()
 		// Ignore early exits from the debugger.
@@ -317,6 +607,9 @@ func Run(ctx context.Context, cln *client.Client, uri string, info RunInfo) (err
 		}
 
 		fmt.Println(tree)
+		if targetErrs != nil {
+			return targetErrs.Err()
+		}
 		return nil
 	}
 
@@ -335,10 +628,77 @@ func Run(ctx context.Context, cln *client.Client, uri string, info RunInfo) (err
 	if errors.Is(err, codegen.ErrDebugExit) {
 		return nil
 	}
-	return err
+	if err != nil {
+		return err
+	}
+	if targetErrs != nil {
+		err = targetErrs.Err()
+		if err != nil {
+			return err
+		}
+	}
+
+	if cacheSummary != nil {
+		err = cacheSummary.Print(info.Stderr)
+		if err != nil {
+			return err
+		}
+	}
+	if report != nil {
+		return report.WriteJSON(info.Stdout)
+	}
+	return nil
+}
+
+func withImageOverrides(ctx context.Context, labels, buildEnv []string) (context.Context, error) {
+	if len(labels) == 0 && len(buildEnv) == 0 {
+		return ctx, nil
+	}
+
+	var (
+		overrides codegen.ImageOverrides
+		err       error
+	)
+	overrides.Labels, err = parseKeyValues("label", labels)
+	if err != nil {
+		return ctx, err
+	}
+	overrides.Env, err = parseKeyValues("build-env", buildEnv)
+	if err != nil {
+		return ctx, err
+	}
+	return codegen.WithImageOverrides(ctx, overrides), nil
+}
+
+func parseKeyValues(flag string, kvs []string) (map[string]string, error) {
+	if len(kvs) == 0 {
+		return nil, nil
+	}
+	m := make(map[string]string, len(kvs))
+	for _, kv := range kvs {
+		key, value, ok := strings.Cut(kv, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid --%s %q, expected key=value", flag, kv)
+		}
+		m[key] = value
+	}
+	return m, nil
 }
 
 func DisplayError(ctx context.Context, w io.Writer, err error, printBacktrace bool) (numErrs int) {
+	// The failures of targets built together are displayed one by one.
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		for _, err := range joined.Unwrap() {
+			n := DisplayError(ctx, w, err, printBacktrace)
+			if n == 0 {
+				fmt.Fprintln(w, err)
+				n = 1
+			}
+			numErrs += n
+		}
+		return numErrs
+	}
+
 	spans := diagnostic.SourcesToSpans(ctx, solvererrdefs.Sources(err), err)
 	if len(spans) > 0 {
 		diagnostic.DisplayError(ctx, w, spans, err, printBacktrace)
@@ -0,0 +1,153 @@
+package command
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/moby/buildkit/client"
+	specs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/openllb/hlb/codegen"
+	"github.com/openllb/hlb/solver"
+	"github.com/stretchr/testify/require"
+	"github.com/xlab/treeprint"
+)
+
+func TestParseKeyValues(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		name     string
+		kvs      []string
+		expected map[string]string
+		err      string
+	}{{
+		"empty",
+		nil,
+		nil,
+		"",
+	}, {
+		"key values",
+		[]string{"maintainer=ci", "url=https://example.com/?a=b", "empty="},
+		map[string]string{
+			"maintainer": "ci",
+			"url":        "https://example.com/?a=b",
+			"empty":      "",
+		},
+		"",
+	}, {
+		"later values override earlier ones",
+		[]string{"version=1", "version=2"},
+		map[string]string{"version": "2"},
+		"",
+	}, {
+		"missing value",
+		[]string{"maintainer"},
+		nil,
+		`invalid --label "maintainer", expected key=value`,
+	}, {
+		"missing key",
+		[]string{"=ci"},
+		nil,
+		`invalid --label "=ci", expected key=value`,
+	}} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			m, err := parseKeyValues("label", tc.kvs)
+			if tc.err != "" {
+				require.EqualError(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, m)
+		})
+	}
+}
+
+func TestParsePlatforms(t *testing.T) {
+	t.Parallel()
+
+	amd64 := specs.Platform{OS: "linux", Architecture: "amd64"}
+	arm64 := specs.Platform{OS: "linux", Architecture: "arm64"}
+	for _, tc := range []struct {
+		name     string
+		values   []string
+		expected []specs.Platform
+		err      string
+	}{{
+		"empty",
+		nil,
+		nil,
+		"",
+	}, {
+		"repeated",
+		[]string{"linux/amd64", "linux/arm64"},
+		[]specs.Platform{amd64, arm64},
+		"",
+	}, {
+		"comma separated",
+		[]string{"linux/amd64,linux/arm64"},
+		[]specs.Platform{amd64, arm64},
+		"",
+	}, {
+		"missing arch",
+		[]string{"linux/amd64,linux"},
+		nil,
+		"Invalid platform specified: linux",
+	}} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			platforms, err := parsePlatforms(tc.values)
+			if tc.err != "" {
+				require.EqualError(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, platforms)
+		})
+	}
+}
+
+type funcRequest func(ctx context.Context) error
+
+func (r funcRequest) Solve(ctx context.Context, cln *client.Client, mw *solver.MultiWriter, opts ...solver.SolveOption) error {
+	return r(ctx)
+}
+
+func (r funcRequest) Tree(tree treeprint.Tree) error {
+	return nil
+}
+
+func TestAllTargetsRequest(t *testing.T) {
+	t.Parallel()
+
+	failed := make(chan struct{})
+	var built []string
+	req, errs := allTargetsRequest(
+		[]codegen.Target{{Name: "build"}, {Name: "test"}, {Name: "lint"}},
+		[]solver.Request{
+			funcRequest(func(ctx context.Context) error {
+				defer close(failed)
+				built = append(built, "build")
+				return errors.New("solve error")
+			}),
+			funcRequest(func(ctx context.Context) error {
+				// The failure of the other target doesn't cancel this one.
+				<-failed
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				built = append(built, "test")
+				return errors.New("test failed")
+			}),
+			nil,
+		},
+		[]error{nil, nil, errors.New("compile error")},
+	)
+
+	// Targets that failed to compile aren't solved.
+	err := req.Solve(context.Background(), nil, nil)
+	require.NoError(t, err)
+	require.Equal(t, []string{"build", "test"}, built)
+	require.EqualError(t, errs.Err(), "target build: solve error\ntarget test: test failed\ntarget lint: compile error")
+}
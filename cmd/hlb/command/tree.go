@@ -0,0 +1,132 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/moby/buildkit/client"
+	"github.com/openllb/hlb"
+	"github.com/openllb/hlb/codegen"
+	"github.com/openllb/hlb/errdefs"
+	"github.com/openllb/hlb/parser"
+	"github.com/openllb/hlb/parser/ast"
+	"github.com/openllb/hlb/pkg/filebuffer"
+	cli "github.com/urfave/cli/v2"
+	"github.com/xlab/treeprint"
+)
+
+var treeCommand = &cli.Command{
+	Name:      "tree",
+	Usage:     "prints the request tree of targets without solving them",
+	ArgsUsage: "<uri> [target...]",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:    "backtrace",
+			Usage:   "print out the backtrace when encountering an error",
+			EnvVars: []string{"HLB_BACKTRACE"},
+		},
+	},
+	Action: func(c *cli.Context) error {
+		uri := codegen.DefaultFilename
+		if c.NArg() > 0 {
+			uri = c.Args().Get(0)
+		}
+
+		var targets []string
+		if c.NArg() > 1 {
+			targets = c.Args().Slice()[1:]
+		}
+
+		cln, ctx, err := newClient(Context(), c)
+		if err != nil {
+			return err
+		}
+		ctx = hlb.WithDefaultContext(ctx, cln)
+		ctx = codegen.WithPreferLocal(ctx, c.Bool("prefer-local"))
+		ctx = codegen.WithExperimental(ctx, c.Bool("experimental"))
+		ctx = codegen.WithInsecureRegistries(ctx, c.StringSlice("insecure-registry"))
+		ctx, err = withImageResolveCache(ctx, c)
+		if err != nil {
+			return err
+		}
+
+		return RequestTree(ctx, cln, uri, RequestTreeInfo{
+			Targets:   targets,
+			Backtrace: c.Bool("backtrace"),
+		})
+	},
+}
+
+type RequestTreeInfo struct {
+	Targets   []string
+	Backtrace bool
+
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+
+	// Reader overrides the module read from uri.
+	Reader io.Reader
+}
+
+// RequestTree prints the sequential and parallel structure of the solve requests
+// composed for the targets, with the definition of each request as a leaf.
+func RequestTree(ctx context.Context, cln *client.Client, uri string, info RequestTreeInfo) (err error) {
+	if len(info.Targets) == 0 {
+		info.Targets = []string{"default"}
+	}
+	if info.Stdin == nil {
+		info.Stdin = os.Stdin
+	}
+	if info.Stdout == nil {
+		info.Stdout = os.Stdout
+	}
+	if info.Stderr == nil {
+		info.Stderr = os.Stderr
+	}
+
+	defer func() {
+		if err == nil {
+			return
+		}
+		numErrs := DisplayError(ctx, info.Stderr, err, info.Backtrace)
+		err = errdefs.WithAbort(err, numErrs)
+	}()
+
+	var mod *ast.Module
+	if info.Reader == nil {
+		mod, err = ParseModuleURI(ctx, cln, info.Stdin, uri)
+	} else {
+		mod, err = parser.Parse(ctx, info.Reader, filebuffer.WithEphemeral())
+	}
+	if err != nil {
+		return err
+	}
+
+	var targets []codegen.Target
+	for _, target := range info.Targets {
+		targets = append(targets, codegen.Target{Name: target})
+	}
+
+	// Printing the tree must not push or download the outputs of the targets
+	// during codegen.
+	ctx = codegen.WithNoOutput(ctx, true)
+
+	solveReq, err := hlb.Compile(ctx, cln, info.Stderr, mod, targets)
+	if err != nil {
+		return err
+	}
+
+	tree := treeprint.New()
+	if solveReq != nil {
+		err = solveReq.Tree(tree)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = fmt.Fprint(info.Stdout, tree)
+	return err
+}
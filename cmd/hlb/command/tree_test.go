@@ -0,0 +1,85 @@
+package command
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lithammer/dedent"
+	"github.com/openllb/hlb"
+	"github.com/openllb/hlb/codegen"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestTree(t *testing.T) {
+	t.Parallel()
+
+	ctx := hlb.WithDefaultContext(context.Background(), nil)
+
+	var stdout, stderr bytes.Buffer
+	err := RequestTree(ctx, nil, "", RequestTreeInfo{
+		Stdout: &stdout,
+		Stderr: &stderr,
+		Reader: strings.NewReader(dedent.Dedent(`
+		pipeline default() {
+			stage foo bar
+			stage baz
+		}
+
+		fs foo() { scratch; mkfile "/foo" 0o644 "foo"; }
+
+		fs bar() { scratch; mkfile "/bar" 0o644 "bar"; }
+
+		fs baz() { scratch; mkfile "/baz" 0o644 "baz"; }
+		`)),
+	})
+	require.NoError(t, err, stderr.String())
+	// The tree is rendered by treeprint, which indents nested branches with
+	// non-breaking spaces.
+	require.Equal(t, strings.Join([]string{
+		".",
+		"└── sequential",
+		"    ├── parallel",
+		"    │\u00a0\u00a0 ├── [file]  " + mkfileAction("/foo"),
+		"    │\u00a0\u00a0 └── [file]  " + mkfileAction("/bar"),
+		"    └── [file]  " + mkfileAction("/baz"),
+		"",
+	}, "\n"), stdout.String())
+}
+
+func mkfileAction(path string) string {
+	return `actions:<input:-1 secondaryInput:-1 mkfile:<path:"` + path + `" mode:420 data:"` + path[1:] + `" timestamp:-1 > > `
+}
+
+func TestRequestTreeNoOutput(t *testing.T) {
+	t.Parallel()
+
+	ctx := hlb.WithDefaultContext(context.Background(), nil)
+
+	report := codegen.NewReport()
+	ctx = codegen.WithReport(ctx, report)
+
+	// Printing the tree must skip the outputs of the target, which would
+	// otherwise be pushed and downloaded during codegen.
+	out := filepath.Join(t.TempDir(), "out")
+	var stdout, stderr bytes.Buffer
+	err := RequestTree(ctx, nil, "", RequestTreeInfo{
+		Stdout: &stdout,
+		Stderr: &stderr,
+		Reader: strings.NewReader(dedent.Dedent(fmt.Sprintf(`
+		fs default() {
+			scratch
+			mkfile "/foo" 0o644 "foo"
+			download %q
+			dockerPush "openllb/foo"
+		}
+		`, out))),
+	})
+	require.NoError(t, err, stderr.String())
+	require.Contains(t, stdout.String(), "mkfile")
+	require.Empty(t, report.Artifacts())
+	require.NoDirExists(t, out)
+}
@@ -1,17 +1,193 @@
 package command
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"os"
+	"runtime/debug"
+	"strings"
+	"time"
 
+	"github.com/moby/buildkit/client"
+	gateway "github.com/moby/buildkit/frontend/gateway/client"
+	"github.com/moby/buildkit/solver/pb"
+	"github.com/moby/buildkit/util/apicaps"
 	"github.com/openllb/hlb"
 	cli "github.com/urfave/cli/v2"
 )
 
+// buildkitModule is the module of the BuildKit client hlb is built against.
+const buildkitModule = "github.com/moby/buildkit"
+
 var versionCommand = &cli.Command{
 	Name:  "version",
-	Usage: "prints hlb tool version",
+	Usage: "prints hlb tool version and the BuildKit versions it is compatible with",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "client",
+			Usage: "only print the versions hlb is built with, without connecting to BuildKit",
+		},
+		&cli.DurationFlag{
+			Name:  "timeout",
+			Usage: "how long to wait for the BuildKit daemon to respond",
+			Value: 5 * time.Second,
+		},
+	},
 	Action: func(c *cli.Context) error {
-		fmt.Println(hlb.Version)
-		return nil
+		ctx := Context()
+
+		info := VersionInfo{
+			Timeout: c.Duration("timeout"),
+		}
+
+		var cln *client.Client
+		if !c.Bool("client") {
+			var err error
+			cln, ctx, err = newClient(ctx, c)
+			if err != nil {
+				cln, info.ConnectErr = nil, err
+			}
+		}
+
+		return Version(ctx, cln, info)
 	},
 }
+
+type VersionInfo struct {
+	// Timeout bounds the time spent querying the BuildKit daemon.
+	Timeout time.Duration
+
+	// ConnectErr is the reason a client for the BuildKit daemon couldn't be
+	// created, which is reported in place of its version.
+	ConnectErr error
+
+	Stdout io.Writer
+}
+
+// VersionReport describes the versions of hlb, the BuildKit client it is built
+// against, and the BuildKit daemon it is connected to.
+type VersionReport struct {
+	Version       string
+	ClientVersion string
+
+	// Daemon is nil if the BuildKit daemon is unreachable, in which case
+	// DaemonErr is the reason.
+	Daemon    *client.BuildkitVersion
+	DaemonErr error
+
+	// Capabilities maps the LLB ops that depend on the daemon's version to
+	// whether they are supported.
+	Capabilities map[string]bool
+}
+
+// capabilities are the LLB ops reported by the version command, keyed by the
+// name of the hlb builtin that needs them.
+var capabilities = []struct {
+	Name string
+	ID   apicaps.CapID
+}{
+	{"merge", pb.CapMergeOp},
+	{"diff", pb.CapDiffOp},
+}
+
+// Version prints the version of hlb and the BuildKit client it is built
+// against. If cln is not nil, it also prints the version of the BuildKit
+// daemon and which of the ops hlb depends on it supports.
+func Version(ctx context.Context, cln *client.Client, info VersionInfo) error {
+	if info.Stdout == nil {
+		info.Stdout = os.Stdout
+	}
+
+	report := VersionReport{
+		Version:       hlb.Version,
+		ClientVersion: ClientVersion(),
+	}
+	switch {
+	case info.ConnectErr != nil:
+		report.DaemonErr = info.ConnectErr
+	case cln != nil:
+		if info.Timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, info.Timeout)
+			defer cancel()
+		}
+		report.Daemon, report.Capabilities, report.DaemonErr = daemonVersion(ctx, cln)
+	}
+	return WriteVersion(info.Stdout, report, cln != nil || info.ConnectErr != nil)
+}
+
+// ClientVersion returns the version of the BuildKit client module hlb is built
+// against.
+func ClientVersion() string {
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	for _, dep := range bi.Deps {
+		if dep.Path != buildkitModule {
+			continue
+		}
+		if dep.Replace != nil {
+			dep = dep.Replace
+		}
+		return dep.Version
+	}
+	return "unknown"
+}
+
+// WriteVersion renders the report to w. The daemon is only rendered if it was
+// queried.
+func WriteVersion(w io.Writer, report VersionReport, queried bool) error {
+	lines := []string{
+		fmt.Sprintf("hlb:              %s", report.Version),
+		fmt.Sprintf("BuildKit client:  %s", report.ClientVersion),
+	}
+	if queried {
+		switch {
+		case report.DaemonErr != nil:
+			lines = append(lines, fmt.Sprintf("BuildKit daemon:  unreachable: %s", report.DaemonErr))
+		case report.Daemon != nil:
+			daemon := report.Daemon.Version
+			if report.Daemon.Revision != "" {
+				daemon = fmt.Sprintf("%s (%s)", daemon, report.Daemon.Revision)
+			}
+			lines = append(lines, fmt.Sprintf("BuildKit daemon:  %s", daemon))
+
+			var caps []string
+			for _, c := range capabilities {
+				supported := "unsupported"
+				if report.Capabilities[c.Name] {
+					supported = "supported"
+				}
+				caps = append(caps, fmt.Sprintf("%s %s", c.Name, supported))
+			}
+			lines = append(lines, fmt.Sprintf("Capabilities:     %s", strings.Join(caps, ", ")))
+		}
+	}
+
+	_, err := fmt.Fprintln(w, strings.Join(lines, "\n"))
+	return err
+}
+
+// daemonVersion queries the version of the BuildKit daemon, and the LLB caps
+// it supports through an empty gateway build.
+func daemonVersion(ctx context.Context, cln *client.Client) (*client.BuildkitVersion, map[string]bool, error) {
+	info, err := cln.Info(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	supported := make(map[string]bool)
+	_, err = cln.Build(ctx, client.SolveOpt{}, "", func(ctx context.Context, c gateway.Client) (*gateway.Result, error) {
+		caps := c.BuildOpts().LLBCaps
+		for _, c := range capabilities {
+			supported[c.Name] = caps.Supports(c.ID) == nil
+		}
+		return gateway.NewResult(), nil
+	}, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &info.BuildkitVersion, supported, nil
+}
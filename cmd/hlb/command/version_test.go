@@ -0,0 +1,84 @@
+package command
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/moby/buildkit/client"
+	"github.com/openllb/hlb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVersion(t *testing.T) {
+	t.Parallel()
+
+	var stdout bytes.Buffer
+	err := Version(context.Background(), nil, VersionInfo{
+		Stdout: &stdout,
+	})
+	require.NoError(t, err)
+	require.Equal(t, strings.Join([]string{
+		"hlb:              " + hlb.Version,
+		"BuildKit client:  " + ClientVersion(),
+		"",
+	}, "\n"), stdout.String())
+	require.NotEqual(t, "unknown", ClientVersion())
+}
+
+func TestWriteVersion(t *testing.T) {
+	t.Parallel()
+
+	type testCase struct {
+		name     string
+		report   VersionReport
+		queried  bool
+		expected []string
+	}
+
+	for _, tc := range []testCase{{
+		"offline",
+		VersionReport{Version: "0.3", ClientVersion: "v0.15.0"},
+		false,
+		[]string{
+			"hlb:              0.3",
+			"BuildKit client:  v0.15.0",
+		},
+	}, {
+		"unreachable daemon",
+		VersionReport{Version: "0.3", ClientVersion: "v0.15.0", DaemonErr: errors.New("connection refused")},
+		true,
+		[]string{
+			"hlb:              0.3",
+			"BuildKit client:  v0.15.0",
+			"BuildKit daemon:  unreachable: connection refused",
+		},
+	}, {
+		"daemon",
+		VersionReport{
+			Version:       "0.3",
+			ClientVersion: "v0.15.0",
+			Daemon:        &client.BuildkitVersion{Version: "v0.9.3", Revision: "8d2625494a6a3d413e3d875a2ff7dd9b1ed1b1a9"},
+			Capabilities:  map[string]bool{"merge": false, "diff": false},
+		},
+		true,
+		[]string{
+			"hlb:              0.3",
+			"BuildKit client:  v0.15.0",
+			"BuildKit daemon:  v0.9.3 (8d2625494a6a3d413e3d875a2ff7dd9b1ed1b1a9)",
+			"Capabilities:     merge unsupported, diff unsupported",
+		},
+	}} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var stdout bytes.Buffer
+			err := WriteVersion(&stdout, tc.report, tc.queried)
+			require.NoError(t, err)
+			require.Equal(t, strings.Join(tc.expected, "\n")+"\n", stdout.String())
+		})
+	}
+}
@@ -0,0 +1,357 @@
+package command
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/moby/buildkit/client"
+	"github.com/openllb/hlb/codegen"
+)
+
+// watchDebounce is how long file changes must settle before a rebuild starts,
+// so that editors writing multiple files only trigger a single rebuild.
+const watchDebounce = 250 * time.Millisecond
+
+// Watch runs the hlb program and runs it again whenever the module or a local
+// source read by the last run changes. The BuildKit client is shared between
+// runs so unchanged vertices are solved from cache, and an in-flight run is
+// cancelled as soon as a new change arrives.
+func Watch(ctx context.Context, cln *client.Client, uri string, info RunInfo) error {
+	if info.Stderr == nil {
+		info.Stderr = os.Stderr
+	}
+
+	_, err := os.Stat(uri)
+	if err != nil {
+		return fmt.Errorf("cannot watch %q: %w", uri, err)
+	}
+
+	module, err := filepath.Abs(uri)
+	if err != nil {
+		return err
+	}
+
+	w, err := newWatcher()
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	err = w.set([]string{module}, nil)
+	if err != nil {
+		return err
+	}
+
+	numBuilds := 0
+	return watchLoop(ctx, w.changes, watchDebounce, func(ctx context.Context) {
+		if numBuilds > 0 {
+			fmt.Fprintf(info.Stderr, "change detected in %s, rebuilding\n", uri)
+		}
+		numBuilds++
+
+		report := codegen.NewReport()
+		w.track(report)
+
+		err := Run(codegen.WithReport(ctx, report), cln, uri, info)
+		if err != nil && !errors.Is(err, context.Canceled) {
+			fmt.Fprintln(info.Stderr, err)
+		}
+
+		sources, exports := reportPaths(report)
+		sources = append([]string{module}, sources...)
+		if err != nil {
+			// A run that failed may not have read all of its sources yet, so
+			// the paths of the previous run stay watched.
+			prevSources, prevExports := w.paths()
+			sources = append(sources, prevSources...)
+			exports = append(exports, prevExports...)
+		}
+
+		err = w.set(sources, exports)
+		if err != nil {
+			fmt.Fprintln(info.Stderr, err)
+		}
+	})
+}
+
+// reportPaths returns the local sources read by a run and the absolute paths
+// it exported to.
+func reportPaths(report *codegen.Report) (sources, exports []string) {
+	for _, artifact := range report.Artifacts() {
+		if artifact.Path == "" {
+			continue
+		}
+		path, err := filepath.Abs(artifact.Path)
+		if err != nil {
+			continue
+		}
+		exports = append(exports, path)
+	}
+	return report.Sources(), exports
+}
+
+// watchLoop calls build immediately and then again every time changes settle
+// for the debounce duration. The previous build's context is cancelled and
+// waited on before the next build starts.
+func watchLoop(ctx context.Context, changes <-chan string, debounce time.Duration, build func(context.Context)) error {
+	var (
+		cancel context.CancelFunc
+		done   chan struct{}
+	)
+	start := func() {
+		var buildCtx context.Context
+		buildCtx, cancel = context.WithCancel(ctx)
+		done = make(chan struct{})
+		go func(done chan struct{}) {
+			defer close(done)
+			build(buildCtx)
+		}(done)
+	}
+	stop := func() {
+		cancel()
+		<-done
+	}
+
+	start()
+	defer func() {
+		stop()
+	}()
+
+	var settled <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case _, ok := <-changes:
+			if !ok {
+				return nil
+			}
+			settled = time.After(debounce)
+		case <-settled:
+			settled = nil
+			stop()
+			start()
+		}
+	}
+}
+
+// watcher sends the names of changed files among the module files and local
+// sources of a run. Changes under the paths a run exports to are ignored, so
+// that downloading into a watched directory doesn't trigger another run.
+type watcher struct {
+	fsw     *fsnotify.Watcher
+	changes chan string
+	done    chan struct{}
+
+	mu      sync.Mutex
+	sources []string
+	exports []string
+	report  *codegen.Report
+	dirs    map[string]struct{}
+}
+
+func newWatcher() (*watcher, error) {
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	w := &watcher{
+		fsw:     fsw,
+		changes: make(chan string),
+		done:    make(chan struct{}),
+		dirs:    make(map[string]struct{}),
+	}
+	go w.run()
+	return w, nil
+}
+
+func (w *watcher) run() {
+	defer close(w.changes)
+	for {
+		select {
+		case event, ok := <-w.fsw.Events:
+			if !ok {
+				return
+			}
+			if event.Op == fsnotify.Chmod || !w.watches(event.Name) {
+				continue
+			}
+			if event.Op&fsnotify.Create != 0 {
+				fi, err := os.Stat(event.Name)
+				if err == nil && fi.IsDir() {
+					_ = w.addDir(event.Name)
+				}
+			}
+			select {
+			case w.changes <- event.Name:
+			case <-w.done:
+				return
+			}
+		case _, ok := <-w.fsw.Errors:
+			if !ok {
+				return
+			}
+		}
+	}
+}
+
+// track ignores the paths exported by the run of the report while it is in
+// flight, before they are known to set.
+func (w *watcher) track(report *codegen.Report) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.report = report
+}
+
+// paths returns the watched sources and the ignored exports.
+func (w *watcher) paths() (sources, exports []string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.sources, w.exports
+}
+
+// set watches the sources, which are files or directories watched
+// recursively, and ignores changes under the exports.
+func (w *watcher) set(sources, exports []string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.sources, w.exports = dedupPaths(sources), dedupPaths(exports)
+	w.report = nil
+
+	dirs := make(map[string]struct{})
+	for _, source := range w.sources {
+		fi, err := os.Stat(source)
+		if err != nil || !fi.IsDir() {
+			// Files are watched through their directory, so that editors
+			// replacing them on save are noticed.
+			dirs[filepath.Dir(source)] = struct{}{}
+			continue
+		}
+
+		err = w.walkDirs(source, func(dir string) error {
+			dirs[dir] = struct{}{}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	for dir := range w.dirs {
+		if _, ok := dirs[dir]; !ok {
+			_ = w.fsw.Remove(dir)
+			delete(w.dirs, dir)
+		}
+	}
+	for dir := range dirs {
+		if _, ok := w.dirs[dir]; ok {
+			continue
+		}
+		err := w.fsw.Add(dir)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if err == nil {
+			w.dirs[dir] = struct{}{}
+		}
+	}
+	return nil
+}
+
+// addDir watches a directory created under a source.
+func (w *watcher) addDir(root string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.walkDirs(root, func(dir string) error {
+		if _, ok := w.dirs[dir]; ok {
+			return nil
+		}
+		err := w.fsw.Add(dir)
+		if err != nil {
+			return err
+		}
+		w.dirs[dir] = struct{}{}
+		return nil
+	})
+}
+
+// walkDirs calls fn for root and the directories under it, skipping .git
+// directories and exports.
+func (w *watcher) walkDirs(root string, fn func(dir string) error) error {
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !info.IsDir() {
+			return nil
+		}
+
+		if path != root && info.Name() == ".git" {
+			return filepath.SkipDir
+		}
+
+		if underAny(path, w.exports) {
+			return filepath.SkipDir
+		}
+
+		return fn(path)
+	})
+}
+
+// watches returns whether a change to path should trigger a rebuild.
+func (w *watcher) watches(path string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if underAny(path, w.exports) {
+		return false
+	}
+	if w.report != nil {
+		_, exports := reportPaths(w.report)
+		if underAny(path, exports) {
+			return false
+		}
+	}
+	return underAny(path, w.sources)
+}
+
+func (w *watcher) Close() error {
+	close(w.done)
+	return w.fsw.Close()
+}
+
+// underAny returns whether path is one of the roots or is under one of them.
+func underAny(path string, roots []string) bool {
+	for _, root := range roots {
+		if path == root || strings.HasPrefix(path, root+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+func dedupPaths(paths []string) []string {
+	var (
+		deduped []string
+		seen    = make(map[string]struct{})
+	)
+	for _, path := range paths {
+		if _, ok := seen[path]; ok {
+			continue
+		}
+		seen[path] = struct{}{}
+		deduped = append(deduped, path)
+	}
+	return deduped
+}
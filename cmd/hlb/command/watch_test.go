@@ -0,0 +1,159 @@
+package command
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatchLoop(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var (
+		changes = make(chan string)
+		builds  = make(chan context.Context, 3)
+		done    = make(chan error)
+	)
+	go func() {
+		done <- watchLoop(ctx, changes, 10*time.Millisecond, func(ctx context.Context) {
+			builds <- ctx
+			<-ctx.Done()
+		})
+	}()
+
+	first := receive(t, builds)
+
+	// Changes in quick succession are debounced into a single rebuild.
+	changes <- "build.hlb"
+	changes <- "build.hlb"
+
+	second := receive(t, builds)
+	require.ErrorIs(t, first.Err(), context.Canceled)
+	require.NoError(t, second.Err())
+
+	cancel()
+	require.NoError(t, <-done)
+	require.ErrorIs(t, second.Err(), context.Canceled)
+	require.Empty(t, builds)
+}
+
+func TestWatchChanges(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	err := os.Mkdir(filepath.Join(dir, "src"), 0o755)
+	require.NoError(t, err)
+
+	w := newTestWatcher(t, []string{filepath.Join(dir, "src")}, nil)
+
+	filename := filepath.Join(dir, "src", "main.go")
+	err = os.WriteFile(filename, []byte("package main"), 0o644)
+	require.NoError(t, err)
+
+	require.Equal(t, filename, receive(t, w.changes))
+}
+
+func TestWatchIgnoresExports(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		name   string
+		export string
+		write  string
+	}{{
+		// download "./out"
+		"directory",
+		"out",
+		filepath.Join("out", "hello"),
+	}, {
+		// downloadTarball "./x.tgz"
+		"tarball",
+		"x.tgz",
+		"x.tgz",
+	}} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			// The module reads the whole directory it exports into, like
+			// local ".".
+			dir := t.TempDir()
+			module := filepath.Join(dir, "build.hlb")
+			err := os.WriteFile(module, []byte("fs default() {}"), 0o644)
+			require.NoError(t, err)
+
+			w := newTestWatcher(t, []string{module, dir}, []string{filepath.Join(dir, tc.export)})
+
+			err = os.MkdirAll(filepath.Dir(filepath.Join(dir, tc.write)), 0o755)
+			require.NoError(t, err)
+			err = os.WriteFile(filepath.Join(dir, tc.write), []byte("hello"), 0o644)
+			require.NoError(t, err)
+
+			// Events are delivered in order, so the export would be received
+			// first if it wasn't ignored.
+			err = os.WriteFile(module, []byte("fs default() { scratch; }"), 0o644)
+			require.NoError(t, err)
+
+			require.Equal(t, module, receive(t, w.changes))
+		})
+	}
+}
+
+func TestWatchSourceOutsideModule(t *testing.T) {
+	t.Parallel()
+
+	// local "../src"
+	root := t.TempDir()
+	for _, dir := range []string{"module", "src"} {
+		err := os.Mkdir(filepath.Join(root, dir), 0o755)
+		require.NoError(t, err)
+	}
+	module := filepath.Join(root, "module", "build.hlb")
+	err := os.WriteFile(module, []byte("fs default() {}"), 0o644)
+	require.NoError(t, err)
+
+	w := newTestWatcher(t, []string{module, filepath.Join(root, "src")}, nil)
+
+	// Directories created in a source are watched too.
+	err = os.Mkdir(filepath.Join(root, "src", "pkg"), 0o755)
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(root, "src", "pkg"), receive(t, w.changes))
+
+	filename := filepath.Join(root, "src", "pkg", "main.go")
+	err = os.WriteFile(filename, []byte("package main"), 0o644)
+	require.NoError(t, err)
+	require.Equal(t, filename, receive(t, w.changes))
+}
+
+func newTestWatcher(t *testing.T, sources, exports []string) *watcher {
+	t.Helper()
+
+	w, err := newWatcher()
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		w.Close()
+	})
+
+	err = w.set(sources, exports)
+	require.NoError(t, err)
+	return w
+}
+
+func receive[T any](t *testing.T, ch <-chan T) T {
+	t.Helper()
+	select {
+	case v := <-ch:
+		return v
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for value")
+	}
+	var zero T
+	return zero
+}
@@ -16,6 +16,8 @@ var Callables = map[ast.Kind]map[string]interface{}{
 		"git":                   Git{},
 		"local":                 Local{},
 		"frontend":              Frontend{},
+		"fromDockerfile":        FromDockerfile{},
+		"shell":                 Shell{},
 		"run":                   Run{},
 		"env":                   Env{},
 		"dir":                   Dir{},
@@ -23,15 +25,21 @@ var Callables = map[ast.Kind]map[string]interface{}{
 		"mkdir":                 Mkdir{},
 		"mkfile":                Mkfile{},
 		"rm":                    Rm{},
+		"chmod":                 ChmodPath{},
 		"copy":                  Copy{},
+		"archive":               Archive{},
+		"copyURL":               CopyURL{},
 		"merge":                 Merge{},
+		"mergeInput":            MergeInput{},
 		"diff":                  Diff{},
 		"entrypoint":            Entrypoint{},
 		"cmd":                   Cmd{},
 		"label":                 Label{},
+		"annotation":            Annotation{},
 		"expose":                Expose{},
 		"volumes":               Volumes{},
 		"stopSignal":            StopSignal{},
+		"healthcheck":           Healthcheck{},
 		"dockerPush":            DockerPush{},
 		"dockerLoad":            DockerLoad{},
 		"download":              Download{},
@@ -40,22 +48,38 @@ var Callables = map[ast.Kind]map[string]interface{}{
 		"downloadDockerTarball": DownloadDockerTarball{},
 	},
 	ast.String: {
-		"format":    Format{},
-		"template":  Template{},
-		"manifest":  Manifest{},
-		"localArch": LocalArch{},
-		"localOs":   LocalOS{},
-		"localCwd":  LocalCwd{},
-		"localEnv":  LocalEnv{},
-		"localRun":  LocalRun{},
+		"format":       Format{},
+		"template":     Template{},
+		"toLower":      ToLower{},
+		"toUpper":      ToUpper{},
+		"trimSpace":    TrimSpace{},
+		"trimPrefix":   TrimPrefix{},
+		"trimSuffix":   TrimSuffix{},
+		"replace":      Replace{},
+		"sha256":       Sha256{},
+		"base64encode": Base64Encode{},
+		"base64decode": Base64Decode{},
+		"manifest":     Manifest{},
+		"localArch":    LocalArch{},
+		"localOs":      LocalOS{},
+		"localCwd":     LocalCwd{},
+		"localEnv":     LocalEnv{},
+		"localRun":     LocalRun{},
+		"readFile":     ReadFile{},
+		"join":         Join{},
+	},
+	ast.List: {
+		"split": Split{},
 	},
 	ast.Pipeline: {
 		"stage":    Stage{},
 		"parallel": Stage{},
 	},
 	"option::image": {
-		"resolve":  Resolve{},
-		"platform": Platform{},
+		"resolve":   Resolve{},
+		"noResolve": NoResolve{},
+		"platform":  Platform{},
+		"authFrom":  AuthFrom{},
 	},
 	"option::http": {
 		"checksum": Checksum{},
@@ -64,29 +88,46 @@ var Callables = map[ast.Kind]map[string]interface{}{
 	},
 	"option::git": {
 		"keepGitDir": KeepGitDir{},
+		"subdir":     GitSubdir{},
 	},
 	"option::local": {
 		"includePatterns": IncludePatterns{},
 		"excludePatterns": ExcludePatterns{},
 	},
 	"option::frontend": {
-		"input": FrontendInput{},
-		"opt":   FrontendOpt{},
+		"input":    FrontendInput{},
+		"opt":      FrontendOpt{},
+		"target":   FrontendTarget{},
+		"buildArg": FrontendBuildArg{},
+	},
+	"option::fromDockerfile": {
+		"target":   FrontendTarget{},
+		"buildArg": FrontendBuildArg{},
 	},
 	"option::run": {
 		"readonlyRootfs": ReadonlyRootfs{},
 		"env":            RunEnv{},
 		"dir":            RunDir{},
 		"user":           RunUser{},
+		"ensureDir":      EnsureDir{},
+		"timeout":        RunTimeout{},
 		"ignoreCache":    IgnoreCache{},
 		"network":        Network{},
 		"security":       Security{},
+		"ulimit":         Ulimit{},
+		"cgroupParent":   CgroupParent{},
 		"shlex":          Shlex{},
+		"useEntrypoint":  UseEntrypoint{},
 		"host":           Host{},
+		"hostname":       Hostname{},
+		"stdin":          Stdin{},
+		"stdinFile":      StdinFile{},
 		"ssh":            SSH{},
 		"forward":        Forward{},
 		"secret":         Secret{},
 		"mount":          Mount{},
+		"mountFiles":     MountFiles{},
+		"cacheDir":       CacheDir{},
 	},
 	"option::forward": {
 		"uid":  UID{},
@@ -108,10 +149,12 @@ var Callables = map[ast.Kind]map[string]interface{}{
 		"excludePatterns": ExcludePatterns{},
 	},
 	"option::mount": {
-		"readonly":   Readonly{},
-		"tmpfs":      Tmpfs{},
-		"sourcePath": SourcePath{},
-		"cache":      Cache{},
+		"readonly":     Readonly{},
+		"tmpfs":        Tmpfs{},
+		"sourcePath":   SourcePath{},
+		"contentsOnly": MountContentsOnly{},
+		"cache":        Cache{},
+		"lockfile":     Lockfile{},
 	},
 	"option::mkdir": {
 		"createParents": CreateParents{},
@@ -126,8 +169,12 @@ var Callables = map[ast.Kind]map[string]interface{}{
 		"allowNotFound": AllowNotFound{},
 		"allowWildcard": AllowWildcard{},
 	},
+	"option::chmod": {
+		"allowWildcard": CopyAllowWildcard{},
+	},
 	"option::copy": {
 		"followSymlinks":     FollowSymlinks{},
+		"noDereference":      NoDereference{},
 		"contentsOnly":       ContentsOnly{},
 		"unpack":             Unpack{},
 		"createDestPath":     CreateDestPath{},
@@ -136,8 +183,18 @@ var Callables = map[ast.Kind]map[string]interface{}{
 		"chown":              UtilChown{},
 		"chmod":              UtilChmod{},
 		"createdTime":        UtilCreatedTime{},
+		"preserveTimestamps": PreserveTimestamps{},
 		"includePatterns":    IncludePatterns{},
 		"excludePatterns":    ExcludePatterns{},
+		"gitignore":          Gitignore{},
+		"platform":           CopyPlatform{},
+	},
+	"option::archive": {
+		"gzip": ArchiveGzip{},
+	},
+	"option::copyURL": {
+		"checksum": Checksum{},
+		"chmod":    Chmod{},
 	},
 	"option::localRun": {
 		"ignoreError":   IgnoreError{},
@@ -151,8 +208,40 @@ var Callables = map[ast.Kind]map[string]interface{}{
 	"option::manifest": {
 		"platform": Platform{},
 	},
+	"option::healthcheck": {
+		"interval":    HealthcheckInterval{},
+		"timeout":     HealthcheckTimeout{},
+		"startPeriod": HealthcheckStartPeriod{},
+		"retries":     HealthcheckRetries{},
+	},
+	"option::download": {
+		"cacheImport": CacheImport{},
+		"cacheExport": CacheExport{},
+	},
+	"option::downloadTarball": {
+		"checksum":    DownloadChecksum{},
+		"cacheImport": CacheImport{},
+		"cacheExport": CacheExport{},
+	},
+	"option::downloadOCITarball": {
+		"checksum":    DownloadChecksum{},
+		"cacheImport": CacheImport{},
+		"cacheExport": CacheExport{},
+	},
+	"option::downloadDockerTarball": {
+		"checksum":    DownloadChecksum{},
+		"cacheImport": CacheImport{},
+		"cacheExport": CacheExport{},
+	},
+	"option::dockerLoad": {
+		"cacheImport": CacheImport{},
+		"cacheExport": CacheExport{},
+	},
 	"option::dockerPush": {
-		"stargz": Stargz{},
+		"stargz":      Stargz{},
+		"authFrom":    AuthFrom{},
+		"cacheImport": CacheImport{},
+		"cacheExport": CacheExport{},
 	},
 }
 
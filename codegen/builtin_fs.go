@@ -6,14 +6,16 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net/url"
 	"os"
 	"path"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/containerd/containerd/platforms"
-	"github.com/containerd/containerd/remotes/docker"
 	"github.com/docker/buildx/util/imagetools"
 	"github.com/docker/buildx/util/progress"
 	"github.com/docker/distribution/reference"
@@ -25,10 +27,13 @@ import (
 	"github.com/moby/buildkit/client/llb/sourceresolver"
 	gateway "github.com/moby/buildkit/frontend/gateway/client"
 	"github.com/moby/buildkit/solver/pb"
+	dockerspec "github.com/moby/docker-image-spec/specs-go/v1"
+	digest "github.com/opencontainers/go-digest"
 	specs "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/openllb/hlb/errdefs"
 	"github.com/openllb/hlb/local"
 	"github.com/openllb/hlb/parser"
+	"github.com/openllb/hlb/pkg/gitignore"
 	"github.com/openllb/hlb/pkg/imageutil"
 	"github.com/openllb/hlb/pkg/llbutil"
 	"github.com/openllb/hlb/pkg/stargzutil"
@@ -56,6 +61,43 @@ func commitHistory(img *solver.ImageSpec, empty bool, format string, a ...interf
 	img.Created = &time.Time{}
 }
 
+// applyImageOverrides sets the labels and environment variables overridden in
+// the context on the image config. The config's label map and env slice are
+// replaced rather than modified since they may be shared with other values.
+func applyImageOverrides(ctx context.Context, img *solver.ImageSpec) {
+	overrides := GetImageOverrides(ctx)
+
+	if len(overrides.Labels) > 0 {
+		labels := make(map[string]string, len(img.Config.Labels)+len(overrides.Labels))
+		for key, value := range img.Config.Labels {
+			labels[key] = value
+		}
+		for key, value := range overrides.Labels {
+			labels[key] = value
+		}
+		img.Config.Labels = labels
+	}
+
+	if len(overrides.Env) > 0 {
+		var env []string
+		for _, kv := range img.Config.Env {
+			key, _, _ := strings.Cut(kv, "=")
+			if _, ok := overrides.Env[key]; !ok {
+				env = append(env, kv)
+			}
+		}
+		keys := make([]string, 0, len(overrides.Env))
+		for key := range overrides.Env {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			env = append(env, fmt.Sprintf("%s=%s", key, overrides.Env[key]))
+		}
+		img.Config.Env = env
+	}
+}
+
 type Scratch struct{}
 
 func (s Scratch) Call(ctx context.Context, cln *client.Client, val Value, opts Option) (Value, error) {
@@ -65,7 +107,11 @@ func (s Scratch) Call(ctx context.Context, cln *client.Client, val Value, opts O
 type Image struct{}
 
 func (i Image) Call(ctx context.Context, cln *client.Client, val Value, opts Option, ref string) (Value, error) {
-	var imageOpts []llb.ImageOption
+	var (
+		imageOpts  []llb.ImageOption
+		noResolve  bool
+		authSource *llbutil.AuthSource
+	)
 	platform := DefaultPlatform(ctx)
 	for _, opt := range opts {
 		switch o := opt.(type) {
@@ -73,10 +119,23 @@ func (i Image) Call(ctx context.Context, cln *client.Client, val Value, opts Opt
 			imageOpts = append(imageOpts, o)
 		case *specs.Platform:
 			platform = *o
+		case llbutil.NoResolveImageOption:
+			noResolve = true
+		case llbutil.AuthSource:
+			authSource = &o
 		}
 	}
 	imageOpts = append(imageOpts, llb.Platform(platform))
 
+	// For some reason, llb.ResolveModeDefault defaults to
+	// llb.ResolveModeForcePull on BuildKit but it defaults to
+	// llb.ResolveModePreferLocal on docker engine, so we just set our own.
+	resolveMode := llb.ResolveModeForcePull
+	if PreferLocal(ctx) {
+		resolveMode = llb.ResolveModePreferLocal
+		imageOpts = append(imageOpts, resolveMode)
+	}
+
 	for _, opt := range SourceMap(ctx) {
 		imageOpts = append(imageOpts, opt)
 	}
@@ -87,6 +146,18 @@ func (i Image) Call(ctx context.Context, cln *client.Client, val Value, opts Opt
 	}
 	ref = reference.TagNameOnly(named).String()
 
+	// The credential source is used to resolve the image config, and for the
+	// session of the solve that pulls the image.
+	var (
+		resolveCtx  = ctx
+		sessionOpts []llbutil.SessionOption
+	)
+	if authSource != nil {
+		authSource.Host = llbutil.RegistryHost(named)
+		resolveCtx = WithAuthSource(ctx, *authSource)
+		sessionOpts = append(sessionOpts, llbutil.WithAuthSource(*authSource))
+	}
+
 	var (
 		st         = llb.Image(ref, imageOpts...)
 		image      = &solver.ImageSpec{}
@@ -94,15 +165,14 @@ func (i Image) Call(ctx context.Context, cln *client.Client, val Value, opts Opt
 		resolveOpt = sourceresolver.Opt{
 			Platform: &platform,
 			ImageOpt: &sourceresolver.ResolveImageOpt{
-				// For some reason, llb.ResolveModeDefault defaults to
-				// llb.ResolveModeForcePull on BuildKit but it defaults to
-				// llb.ResolveModePreferLocal on docker engine, so we just set our own.
-				ResolveMode: llb.ResolveModeForcePull.String(),
+				ResolveMode: resolveMode.String(),
 			},
 		}
 	)
-	if resolver != nil {
-		_, dgst, config, err := resolver.ResolveImageConfig(ctx, ref, resolveOpt)
+	// Without resolving, the state has no inherited config and the image spec
+	// stays empty.
+	if resolver != nil && !noResolve {
+		_, dgst, config, err := resolver.ResolveImageConfig(resolveCtx, ref, resolveOpt)
 		if err != nil {
 			return nil, Arg(ctx, 0).WithError(err)
 		}
@@ -112,6 +182,13 @@ func (i Image) Call(ctx context.Context, cln *client.Client, val Value, opts Opt
 			return nil, Arg(ctx, 0).WithError(err)
 		}
 
+		// Floating tags are pinned in the exported manifest with the OCI base
+		// image annotations, so the digest the image was built from is kept.
+		image.Annotations = map[string]string{
+			specs.AnnotationBaseImageName:   ref,
+			specs.AnnotationBaseImageDigest: dgst.String(),
+		}
+
 		st, err = st.WithImageConfig(config)
 		if err != nil {
 			return nil, Arg(ctx, 0).WithError(err)
@@ -124,9 +201,10 @@ func (i Image) Call(ctx context.Context, cln *client.Client, val Value, opts Opt
 	}
 
 	return NewValue(ctx, Filesystem{
-		State:    st,
-		Image:    image,
-		Platform: platform,
+		State:       st,
+		Image:       image,
+		Platform:    platform,
+		SessionOpts: sessionOpts,
 	})
 }
 
@@ -150,18 +228,32 @@ func (h HTTP) Call(ctx context.Context, cln *client.Client, val Value, opts Opti
 type Git struct{}
 
 func (g Git) Call(ctx context.Context, cln *client.Client, val Value, opts Option, remote, ref string) (Value, error) {
-	var gitOpts []llb.GitOption
+	var (
+		gitOpts []llb.GitOption
+		subdir  string
+	)
 	for _, opt := range opts {
 		switch o := opt.(type) {
 		case llb.GitOption:
 			gitOpts = append(gitOpts, o)
+		case *GitSubdir:
+			subdir = o.Path
 		}
 	}
 	for _, opt := range SourceMap(ctx) {
 		gitOpts = append(gitOpts, opt)
 	}
 
-	return NewValue(ctx, llb.Git(remote, ref, gitOpts...))
+	st := llb.Git(remote, ref, gitOpts...)
+	if subdir != "" && subdir != "/" {
+		// BuildKit checks out the whole repository, so the subdirectory is
+		// copied to the root of a new filesystem.
+		st = llb.Scratch().File(
+			llb.Copy(st, subdir, "/", llbutil.WithCopyDirContentsOnly(true)),
+			SourceMap(ctx)...,
+		)
+	}
+	return NewValue(ctx, st)
 }
 
 type Local struct{}
@@ -238,6 +330,13 @@ func (l Local) Call(ctx context.Context, cln *client.Client, val Value, opts Opt
 		absPath = filepath.Join(cwd, localPath)
 	}
 
+	err = recordSource(ctx, absPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// The include and exclude patterns are part of the ID, so uses of the same
+	// directory with different patterns never share synced content.
 	id, err := llbutil.LocalID(ctx, absPath, localOpts...)
 	if err != nil {
 		return nil, err
@@ -253,7 +352,7 @@ func (l Local) Call(ctx context.Context, cln *client.Client, val Value, opts Opt
 		// currently seeing cache invalidation even if the `local` contents are
 		// unchanged. A hacky-workaround is to Copy the llb.Local first, then
 		// mount the Copy, which allows for better caching for Run calls.
-		st = llb.Scratch().File(llb.Copy(st, "/", "/"))
+		st = llb.Scratch().File(llb.Copy(st, "/", "/"), SourceMap(ctx)...)
 	}
 
 	fs := Filesystem{
@@ -288,15 +387,98 @@ func (f Frontend) Call(ctx context.Context, cln *client.Client, val Value, opts
 		return nil, errdefs.WithInvalidImageRef(err, Arg(ctx, 0), source)
 	}
 	source = reference.TagNameOnly(named).String()
+	return solveFrontend(ctx, cln, frontendRequest(source), opts)
+}
 
-	req := gateway.SolveRequest{
+// frontendRequest returns the request to build with the frontend image of
+// source through the gateway.v0 frontend.
+func frontendRequest(source string) gateway.SolveRequest {
+	return gateway.SolveRequest{
 		Frontend: "gateway.v0",
 		FrontendOpt: map[string]string{
 			"source": source,
 		},
 		FrontendInputs: make(map[string]*pb.Definition),
 	}
+}
+
+type FromDockerfile struct{}
 
+func (fd FromDockerfile) Call(ctx context.Context, cln *client.Client, val Value, opts Option, input Filesystem, filename string) (Value, error) {
+	req, opts, err := dockerfileRequest(ctx, input, filename, opts)
+	if err != nil {
+		return nil, err
+	}
+	return solveFrontend(ctx, cln, req, opts)
+}
+
+// dockerfileRequest returns the request to build a Dockerfile in the input
+// with the dockerfile.v0 frontend, and the options to solve it with. The
+// input is both the build context and the source of the Dockerfile, so the
+// options it needs to be solved, such as syncing a local directory, are
+// returned too.
+func dockerfileRequest(ctx context.Context, input Filesystem, filename string, opts Option) (gateway.SolveRequest, Option, error) {
+	req := gateway.SolveRequest{
+		Frontend: "dockerfile.v0",
+		FrontendOpt: map[string]string{
+			"filename": filename,
+			"platform": platforms.Format(DefaultPlatform(ctx)),
+		},
+		FrontendInputs: make(map[string]*pb.Definition),
+	}
+
+	def, err := input.State.Marshal(ctx, llb.Platform(input.Platform))
+	if err != nil {
+		return req, nil, err
+	}
+
+	retOpts := Option{
+		llbutil.FrontendInput("context", def),
+		llbutil.FrontendInput("dockerfile", def),
+	}
+	for _, opt := range input.SolveOpts {
+		retOpts = append(retOpts, opt)
+	}
+	for _, opt := range input.SessionOpts {
+		retOpts = append(retOpts, opt)
+	}
+	return req, append(retOpts, opts...), nil
+}
+
+// FrontendSolver solves frontend requests into a filesystem with the image
+// config returned by the frontend.
+type FrontendSolver interface {
+	SolveFrontend(ctx context.Context, req gateway.SolveRequest, opts Option) (Filesystem, error)
+}
+
+// solveFrontend solves the frontend request and returns its result as a
+// filesystem, or a field of its image config if it is bound.
+func solveFrontend(ctx context.Context, cln *client.Client, req gateway.SolveRequest, opts Option) (Value, error) {
+	fsolver := frontendSolver(ctx)
+	if fsolver == nil {
+		fsolver = buildkitFrontendSolver{cln}
+	}
+
+	fs, err := fsolver.SolveFrontend(ctx, req, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	switch Binding(ctx).Binds() {
+	case "entrypoint", "env", "labels":
+		return imageConfigBinding(ctx, fs.Image)
+	}
+
+	return NewValue(ctx, fs)
+}
+
+// buildkitFrontendSolver solves frontend requests through the BuildKit
+// gateway.
+type buildkitFrontendSolver struct {
+	cln *client.Client
+}
+
+func (bs buildkitFrontendSolver) SolveFrontend(ctx context.Context, req gateway.SolveRequest, opts Option) (Filesystem, error) {
 	var (
 		solveOpts   []solver.SolveOption
 		sessionOpts []llbutil.SessionOption
@@ -314,18 +496,18 @@ func (f Frontend) Call(ctx context.Context, cln *client.Client, val Value, opts
 
 	s, err := llbutil.NewSession(ctx, sessionOpts...)
 	if err != nil {
-		return nil, err
+		return Filesystem{}, err
 	}
 
 	g, ctx := errgroup.WithContext(ctx)
 
 	fs, err := ZeroValue(ctx).Filesystem()
 	if err != nil {
-		return nil, err
+		return Filesystem{}, err
 	}
 
 	g.Go(func() error {
-		return s.Run(ctx, cln.Dialer())
+		return s.Run(ctx, bs.cln.Dialer())
 	})
 
 	g.Go(func() error {
@@ -337,7 +519,7 @@ func (f Frontend) Call(ctx context.Context, cln *client.Client, val Value, opts
 			pw = mw.WithPrefix("", false)
 		}
 
-		return solver.Build(ctx, cln, s, pw, func(ctx context.Context, c gateway.Client) (res *gateway.Result, err error) {
+		return solver.Build(ctx, bs.cln, s, pw, func(ctx context.Context, c gateway.Client) (res *gateway.Result, err error) {
 			res, err = c.Solve(ctx, req)
 			if err != nil {
 				return
@@ -370,12 +552,38 @@ func (f Frontend) Call(ctx context.Context, cln *client.Client, val Value, opts
 		}, solveOpts...)
 	})
 
-	err = g.Wait()
+	return fs, g.Wait()
+}
+
+// imageConfigBinding returns the field of the image config that is bound as a
+// JSON string.
+func imageConfigBinding(ctx context.Context, image *solver.ImageSpec) (Value, error) {
+	var v interface{}
+	switch Binding(ctx).Binds() {
+	case "entrypoint":
+		v = image.Config.Entrypoint
+		if image.Config.Entrypoint == nil {
+			v = []string{}
+		}
+	case "env":
+		v = image.Config.Env
+		if image.Config.Env == nil {
+			v = []string{}
+		}
+	case "labels":
+		v = image.Config.Labels
+		if image.Config.Labels == nil {
+			v = map[string]string{}
+		}
+	default:
+		return nil, errdefs.WithInternalErrorf(ProgramCounter(ctx), "unknown image config binding %q", Binding(ctx).Binds())
+	}
+
+	dt, err := json.Marshal(v)
 	if err != nil {
 		return nil, err
 	}
-
-	return NewValue(ctx, fs)
+	return NewValue(ctx, string(dt))
 }
 
 type Env struct{}
@@ -423,6 +631,19 @@ func (u User) Call(ctx context.Context, cln *client.Client, val Value, opts Opti
 	return NewValue(ctx, fs)
 }
 
+type Shell struct{}
+
+func (sh Shell) Call(ctx context.Context, cln *client.Client, val Value, opts Option, args ...string) (Value, error) {
+	fs, err := val.Filesystem()
+	if err != nil {
+		return nil, err
+	}
+
+	fs.Image.Config.Shell = args
+	commitHistory(fs.Image, true, "SHELL %q", args)
+	return NewValue(ctx, fs)
+}
+
 type Run struct{}
 
 func (r Run) Call(ctx context.Context, cln *client.Client, val Value, opts Option, args ...string) (Value, error) {
@@ -434,9 +655,14 @@ func (r Run) Call(ctx context.Context, cln *client.Client, val Value, opts Optio
 		shlex       = false
 		image       *solver.ImageSpec
 		hasUserOpt  = false
+		stdin       *llbutil.StdinOption
+		entrypoint  = false
+		ensureDir   = false
 	)
 	for _, opt := range opts {
 		switch o := opt.(type) {
+		case llbutil.StdinOption:
+			stdin = &o
 		case llbutil.UserOption:
 			hasUserOpt = true
 			runOpts = append(runOpts, o)
@@ -451,26 +677,50 @@ func (r Run) Call(ctx context.Context, cln *client.Client, val Value, opts Optio
 			image = o.Image
 		case *Shlex:
 			shlex = true
+		case *UseEntrypoint:
+			entrypoint = true
+		case *EnsureDir:
+			ensureDir = true
 		}
 	}
 	for _, opt := range SourceMap(ctx) {
 		runOpts = append(runOpts, opt)
 	}
 
-	runArgs, err := ShlexArgs(args, shlex)
+	fs, err := val.Filesystem()
 	if err != nil {
 		return nil, err
 	}
 
-	customName := strings.ReplaceAll(shellquote.Join(runArgs...), "\n", "\\n")
-	runOpts = append(runOpts, llb.Args(runArgs), llb.WithCustomName(customName))
+	var runArgs []string
+	if entrypoint {
+		// Args are appended to the entrypoint like the args of docker run, so
+		// a single arg is only split with shlex and never wrapped in a shell.
+		runArgs = args
+		if shlex {
+			runArgs, err = ShlexArgs(args, shlex, nil)
+			if err != nil {
+				return nil, err
+			}
+		}
+		runArgs = append(append([]string{}, fs.Image.Config.Entrypoint...), runArgs...)
+	} else {
+		runArgs, err = ShlexArgs(args, shlex, fs.Image.Config.Shell)
+		if err != nil {
+			return nil, err
+		}
+	}
 
-	err = llbutil.ShimReadonlyMountpoints(runOpts)
-	if err != nil {
-		return nil, err
+	execArgs := runArgs
+	if stdin != nil {
+		runOpts = append(runOpts, stdin.Mount(SourceMap(ctx)...))
+		execArgs = stdin.Args(runArgs)
 	}
 
-	fs, err := val.Filesystem()
+	customName := strings.ReplaceAll(shellquote.Join(runArgs...), "\n", "\\n")
+	runOpts = append(runOpts, llb.Args(execArgs), llb.WithCustomName(customName))
+
+	err = llbutil.ShimReadonlyMountpoints(runOpts, SourceMap(ctx)...)
 	if err != nil {
 		return nil, err
 	}
@@ -479,6 +729,13 @@ func (r Run) Call(ctx context.Context, cln *client.Client, val Value, opts Optio
 		runOpts = append(runOpts, llbutil.WithUser(user))
 	}
 
+	if ensureDir {
+		fs.State, err = ensureRunDirs(ctx, fs.State, runOpts)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	run := fs.State.Run(runOpts...)
 	if bind != "" {
 		fs.State = run.GetMount(bind)
@@ -496,6 +753,69 @@ func (r Run) Call(ctx context.Context, cln *client.Client, val Value, opts Optio
 	return NewValue(ctx, fs)
 }
 
+// ensureRunDirs creates the working directory of a run before it executes, so
+// commands don't fail when it doesn't exist yet. When the run has a user, the
+// directory is owned by that user, and the user's HOME is created as well.
+func ensureRunDirs(ctx context.Context, st llb.State, runOpts []llb.RunOption) (llb.State, error) {
+	ei := llb.ExecInfo{State: st}
+	user := ""
+	for _, opt := range runOpts {
+		switch o := opt.(type) {
+		case llbutil.UserOption:
+			user = o.User
+		case llbutil.DirOption, llbutil.EnvOption:
+			o.SetRunOption(&ei)
+		}
+	}
+
+	dir, err := ei.State.GetDir(ctx)
+	if err != nil {
+		return st, err
+	}
+
+	var dirs []string
+	if dir != "" && dir != "/" {
+		dirs = append(dirs, dir)
+	}
+
+	mkdirOpts := []llb.MkdirOption{llb.WithParents(true)}
+	if user != "" {
+		mkdirOpts = append(mkdirOpts, llb.WithUser(user))
+
+		home, ok, err := ei.State.GetEnv(ctx, "HOME")
+		if err != nil {
+			return st, err
+		}
+		if ok && home != "" && home != "/" && home != dir {
+			dirs = append(dirs, home)
+		}
+	}
+
+	if len(dirs) == 0 {
+		return st, nil
+	}
+
+	fa := llb.Mkdir(dirs[0], os.FileMode(0o755), mkdirOpts...)
+	for _, dir := range dirs[1:] {
+		fa = fa.Mkdir(dir, os.FileMode(0o755), mkdirOpts...)
+	}
+	return st.File(fa, SourceMap(ctx)...), nil
+}
+
+func marshalOp(ctx context.Context, output llb.Output) (digest.Digest, *pb.Op, error) {
+	dgst, dt, _, _, err := output.Vertex(ctx, &llb.Constraints{}).Marshal(ctx, &llb.Constraints{})
+	if err != nil {
+		return "", nil, err
+	}
+
+	var op pb.Op
+	err = op.Unmarshal(dt)
+	if err != nil {
+		return "", nil, err
+	}
+	return dgst, &op, nil
+}
+
 type SetBreakpoint struct{}
 
 func (sb SetBreakpoint) Call(ctx context.Context, cln *client.Client, val Value, opts Option, args ...string) (Value, error) {
@@ -571,6 +891,53 @@ func (m Rm) Call(ctx context.Context, cln *client.Client, val Value, opts Option
 	return NewValue(ctx, fs)
 }
 
+// ChmodPath changes the mode of a path in the filesystem. BuildKit has no file
+// action to change modes, so the path is copied onto itself with the new mode.
+type ChmodPath struct{}
+
+func (cp ChmodPath) Call(ctx context.Context, cln *client.Client, val Value, opts Option, p string, mode os.FileMode) (Value, error) {
+	fs, err := val.Filesystem()
+	if err != nil {
+		return nil, err
+	}
+
+	wildcard := false
+	for _, opt := range opts {
+		switch o := opt.(type) {
+		case llbutil.AllowWildcard:
+			wildcard = bool(o)
+		}
+	}
+
+	// Copying a path onto itself with a mode changes the mode of everything
+	// within it, so the parent directory is copied onto itself instead with
+	// only the path included. Excluding the contents of the path leaves them
+	// unchanged, and the last element of the path is matched as a pattern
+	// when wildcards are allowed.
+	dir, base := path.Split(path.Clean(p))
+	if dir == "" {
+		dir = "."
+	}
+	if !wildcard {
+		base = chmodPatternEscaper.Replace(base)
+	}
+
+	fs.State = fs.State.File(
+		llb.Copy(fs.State, dir, dir,
+			llbutil.WithChmod(mode),
+			llbutil.WithCopyDirContentsOnly(true),
+			llbutil.WithIncludePatterns([]string{base}),
+			llbutil.WithExcludePatterns([]string{base + "/*"}),
+		),
+		SourceMap(ctx)...,
+	)
+	return NewValue(ctx, fs)
+}
+
+// chmodPatternEscaper escapes the pattern characters of a path to match it
+// literally.
+var chmodPatternEscaper = strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`)
+
 type Copy struct{}
 
 func (m Copy) Call(ctx context.Context, cln *client.Client, val Value, opts Option, input Filesystem, src, dest string) (Value, error) {
@@ -579,11 +946,48 @@ func (m Copy) Call(ctx context.Context, cln *client.Client, val Value, opts Opti
 		return nil, err
 	}
 
-	var copyOpts []llb.CopyOption
+	var (
+		copyOpts []llb.CopyOption
+		ignore   *Gitignore
+		platform *CopyPlatform
+	)
 	for _, opt := range opts {
 		switch o := opt.(type) {
 		case llb.CopyOption:
 			copyOpts = append(copyOpts, o)
+		case *Gitignore:
+			ignore = o
+		case *CopyPlatform:
+			platform = o
+		}
+	}
+
+	// Content built for another platform, such as a binary cross-compiled for
+	// the wrong architecture, would fail to run in the filesystem.
+	var flags string
+	if platform != nil {
+		actual := platforms.Normalize(fs.Platform)
+		if platform.Platform.OS != actual.OS || platform.Platform.Architecture != actual.Architecture || platform.Platform.Variant != actual.Variant {
+			return nil, errdefs.WithCopyPlatformMismatch(platform, platforms.Format(platform.Platform), platforms.Format(actual))
+		}
+		flags = fmt.Sprintf("--platform=%s ", platforms.Format(platform.Platform))
+	}
+
+	if ignore != nil {
+		localDir, ok, err := localSourceDir(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, errdefs.WithGitignoreNonLocal(ignore)
+		}
+
+		excludes, err := gitignore.Excludes(os.DirFS(localDir), src)
+		if err != nil {
+			return nil, ignore.WithError(err)
+		}
+		if len(excludes) > 0 {
+			copyOpts = append(copyOpts, llbutil.WithExcludePatterns(excludes))
 		}
 	}
 
@@ -593,7 +997,172 @@ func (m Copy) Call(ctx context.Context, cln *client.Client, val Value, opts Opti
 	)
 	fs.SolveOpts = append(fs.SolveOpts, input.SolveOpts...)
 	fs.SessionOpts = append(fs.SessionOpts, input.SessionOpts...)
-	commitHistory(fs.Image, false, "COPY %s %s", src, dest)
+
+	// Record the digest of the copied-from input and the platform of its
+	// content for provenance. History is only part of the image config, so it
+	// doesn't affect the cache key of the copy itself. Scratch has no vertex to
+	// digest.
+	if input.State.Output() == nil {
+		commitHistory(fs.Image, false, "COPY %s%s %s", flags, src, dest)
+	} else {
+		dgst, err := input.Digest(ctx)
+		if err != nil {
+			return nil, err
+		}
+		commitHistory(fs.Image, false, "COPY %s--from=%s %s %s", flags, dgst, src, dest)
+	}
+
+	return NewValue(ctx, fs)
+}
+
+// localSourceDir returns the host directory of a filesystem created by local
+// without further changes, or false if it isn't one.
+func localSourceDir(ctx context.Context, fs Filesystem) (string, bool, error) {
+	if fs.State.Output() == nil {
+		return "", false, nil
+	}
+
+	_, op, err := marshalOp(ctx, fs.State.Output())
+	if err != nil {
+		return "", false, err
+	}
+
+	source := op.GetSource()
+	if source == nil || !strings.HasPrefix(source.Identifier, "local://") {
+		return "", false, nil
+	}
+
+	localDir := strings.TrimPrefix(source.Identifier, "local://")
+	if !filepath.IsAbs(localDir) {
+		cwd, err := local.Cwd(ctx)
+		if err != nil {
+			return "", false, err
+		}
+		localDir = filepath.Join(cwd, localDir)
+	}
+	return localDir, true, nil
+}
+
+// httpSourceFilename returns the name of the file downloaded by a filesystem
+// created by http without further changes, or false if it isn't one.
+func httpSourceFilename(ctx context.Context, fs Filesystem) (string, bool, error) {
+	if fs.State.Output() == nil {
+		return "", false, nil
+	}
+
+	_, op, err := marshalOp(ctx, fs.State.Output())
+	if err != nil {
+		return "", false, err
+	}
+
+	source := op.GetSource()
+	if source == nil || !(strings.HasPrefix(source.Identifier, "http://") || strings.HasPrefix(source.Identifier, "https://")) {
+		return "", false, nil
+	}
+
+	if filename, ok := source.Attrs[pb.AttrHTTPFilename]; ok {
+		return filename, true, nil
+	}
+
+	// Without a filename, BuildKit names the file after the URL path, or
+	// "download" if the path has no name.
+	u, err := url.Parse(source.Identifier)
+	if err == nil {
+		if base := path.Base(u.Path); base != "." && base != "/" {
+			return base, true, nil
+		}
+	}
+	return "download", true, nil
+}
+
+type Archive struct{}
+
+// archiveImage is the image that archives are created in, since neither the
+// input nor the current filesystem are guaranteed to have tar.
+const archiveImage = "docker.io/library/busybox:1.36"
+
+// archiveScript tars the mounted path given as its first argument with the
+// tar flags given as its second. Directories are archived by their contents,
+// and files by their base name.
+const archiveScript = `if [ -d "$1" ]; then tar "$2" /out/archive.tar -C "$1" .; else tar "$2" /out/archive.tar -C "$(dirname "$1")" "$(basename "$1")"; fi`
+
+func (a Archive) Call(ctx context.Context, cln *client.Client, val Value, opts Option, input Filesystem, src, destTar string) (Value, error) {
+	fs, err := val.Filesystem()
+	if err != nil {
+		return nil, err
+	}
+
+	if input.State.Output() == nil {
+		return nil, Arg(ctx, 0).WithError(errors.Errorf("cannot archive %q from a scratch filesystem", src))
+	}
+
+	flags := "-cf"
+	for _, opt := range opts {
+		switch opt.(type) {
+		case *ArchiveGzip:
+			flags = "-czf"
+		}
+	}
+
+	// The archive is created by an exec over the mounted input, so the input
+	// is only solved as part of the build instead of during codegen.
+	target := path.Join("/in", path.Base(src))
+	runOpts := []llb.RunOption{
+		llb.Args([]string{"/bin/sh", "-c", archiveScript, "archive", target, flags}),
+		llb.AddMount(target, input.State, llb.SourcePath(src), llb.Readonly),
+	}
+	for _, opt := range SourceMap(ctx) {
+		runOpts = append(runOpts, opt)
+	}
+
+	exec := llb.Image(archiveImage, llb.Platform(DefaultPlatform(ctx))).Run(runOpts...)
+	out := exec.AddMount("/out", llb.Scratch())
+
+	fs.State = fs.State.File(
+		llb.Copy(out, "/archive.tar", destTar),
+		SourceMap(ctx)...,
+	)
+	fs.SolveOpts = append(fs.SolveOpts, input.SolveOpts...)
+	fs.SessionOpts = append(fs.SessionOpts, input.SessionOpts...)
+	return NewValue(ctx, fs)
+}
+
+type CopyURL struct{}
+
+func (cu CopyURL) Call(ctx context.Context, cln *client.Client, val Value, opts Option, rawURL, dest string) (Value, error) {
+	fs, err := val.Filesystem()
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, Arg(ctx, 0).WithError(err)
+	}
+
+	// Name the downloaded file explicitly so that it can be copied out of the
+	// http filesystem without knowing what the server responds with.
+	filename := path.Base(u.Path)
+	if filename == "." || filename == "/" {
+		filename = "download"
+	}
+
+	httpOpts := []llb.HTTPOption{llb.Filename(filename)}
+	for _, opt := range opts {
+		switch o := opt.(type) {
+		case llb.HTTPOption:
+			httpOpts = append(httpOpts, o)
+		}
+	}
+	for _, opt := range SourceMap(ctx) {
+		httpOpts = append(httpOpts, opt)
+	}
+
+	fs.State = fs.State.File(
+		llb.Copy(llb.HTTP(rawURL, httpOpts...), filename, dest),
+		SourceMap(ctx)...,
+	)
+	commitHistory(fs.Image, false, "ADD %s %s", rawURL, dest)
 
 	return NewValue(ctx, fs)
 }
@@ -623,6 +1192,28 @@ func (m Merge) Call(ctx context.Context, cln *client.Client, val Value, opts Opt
 	return NewValue(ctx, fs)
 }
 
+type MergeInput struct{}
+
+func (mi MergeInput) Call(ctx context.Context, cln *client.Client, val Value, opts Option, input Filesystem, subpath string) (Value, error) {
+	fs, err := ZeroValue(ctx).Filesystem()
+	if err != nil {
+		return nil, err
+	}
+
+	fs.State = llb.Scratch().File(
+		llb.Copy(input.State, subpath, subpath, &llb.CopyInfo{
+			CopyDirContentsOnly: true,
+			CreateDestPath:      true,
+		}),
+		SourceMap(ctx)...,
+	)
+	fs.Platform = input.Platform
+	fs.SolveOpts = append(fs.SolveOpts, input.SolveOpts...)
+	fs.SessionOpts = append(fs.SessionOpts, input.SessionOpts...)
+
+	return NewValue(ctx, fs)
+}
+
 type Diff struct{}
 
 func (d Diff) Call(ctx context.Context, cln *client.Client, val Value, opts Option, input Filesystem) (Value, error) {
@@ -631,7 +1222,7 @@ func (d Diff) Call(ctx context.Context, cln *client.Client, val Value, opts Opti
 		return nil, err
 	}
 
-	fs.State = llb.Diff(input.State, fs.State)
+	fs.State = llb.Diff(input.State, fs.State, SourceMap(ctx)...)
 
 	commitHistory(fs.Image, false, "DIFF %s %s", "/", "/")
 
@@ -690,6 +1281,25 @@ func (l Label) Call(ctx context.Context, cln *client.Client, val Value, opts Opt
 	return NewValue(ctx, fs)
 }
 
+type Annotation struct{}
+
+func (a Annotation) Call(ctx context.Context, cln *client.Client, val Value, opts Option, key, value string) (Value, error) {
+	fs, err := val.Filesystem()
+	if err != nil {
+		return nil, err
+	}
+
+	// The annotations of a resolved image are shared with other values of the
+	// same image, so they are copied before they are modified.
+	annotations := make(map[string]string, len(fs.Image.Annotations)+1)
+	for k, v := range fs.Image.Annotations {
+		annotations[k] = v
+	}
+	annotations[key] = value
+	fs.Image.Annotations = annotations
+	return NewValue(ctx, fs)
+}
+
 type Expose struct{}
 
 func (e Expose) Call(ctx context.Context, cln *client.Client, val Value, opts Option, ports ...string) (Value, error) {
@@ -702,13 +1312,47 @@ func (e Expose) Call(ctx context.Context, cln *client.Client, val Value, opts Op
 		fs.Image.Config.ExposedPorts = make(map[string]struct{})
 	}
 
-	for _, port := range ports {
-		fs.Image.Config.ExposedPorts[port] = struct{}{}
+	for i, port := range ports {
+		spec, ok := normalizePortSpec(port)
+		if !ok {
+			return nil, errdefs.WithInvalidPortSpec(Arg(ctx, i), port)
+		}
+		fs.Image.Config.ExposedPorts[spec] = struct{}{}
 	}
 
 	return NewValue(ctx, fs)
 }
 
+// normalizePortSpec validates a port spec of the form `<port>[/<protocol>]`
+// where port may also be a range like `8000-8010`. Like Docker, the protocol
+// defaults to tcp when omitted.
+func normalizePortSpec(spec string) (string, bool) {
+	port, proto, ok := strings.Cut(spec, "/")
+	if !ok {
+		proto = "tcp"
+	}
+
+	switch proto {
+	case "tcp", "udp", "sctp":
+	default:
+		return "", false
+	}
+
+	start, end, isRange := strings.Cut(port, "-")
+	startPort, err := strconv.ParseUint(start, 10, 16)
+	if err != nil || startPort == 0 {
+		return "", false
+	}
+	if isRange {
+		endPort, err := strconv.ParseUint(end, 10, 16)
+		if err != nil || endPort < startPort {
+			return "", false
+		}
+	}
+
+	return fmt.Sprintf("%s/%s", port, proto), true
+}
+
 type Volumes struct{}
 
 func (Volumes) Call(ctx context.Context, cln *client.Client, val Value, opts Option, mountpoints ...string) (Value, error) {
@@ -740,6 +1384,55 @@ func (ss StopSignal) Call(ctx context.Context, cln *client.Client, val Value, op
 	return NewValue(ctx, fs)
 }
 
+type Healthcheck struct{}
+
+func (h Healthcheck) Call(ctx context.Context, cln *client.Client, val Value, opts Option, args ...string) (Value, error) {
+	fs, err := val.Filesystem()
+	if err != nil {
+		return nil, err
+	}
+
+	hc := &dockerspec.HealthcheckConfig{}
+	for _, opt := range opts {
+		if o, ok := opt.(healthcheckOption); ok {
+			o(hc)
+		}
+	}
+
+	// Like Dockerfile, a single arg is a shell command and no args disable the
+	// healthcheck of the base image.
+	var cmd string
+	switch len(args) {
+	case 0:
+		hc.Test = []string{"NONE"}
+		cmd = "NONE"
+	case 1:
+		hc.Test = []string{"CMD-SHELL", args[0]}
+		cmd = fmt.Sprintf("CMD %s", args[0])
+	default:
+		hc.Test = append([]string{"CMD"}, args...)
+		cmd = fmt.Sprintf("CMD %q", args)
+	}
+
+	var flags []string
+	if hc.Interval != 0 {
+		flags = append(flags, fmt.Sprintf("--interval=%s", hc.Interval))
+	}
+	if hc.Timeout != 0 {
+		flags = append(flags, fmt.Sprintf("--timeout=%s", hc.Timeout))
+	}
+	if hc.StartPeriod != 0 {
+		flags = append(flags, fmt.Sprintf("--start-period=%s", hc.StartPeriod))
+	}
+	if hc.Retries != 0 {
+		flags = append(flags, fmt.Sprintf("--retries=%d", hc.Retries))
+	}
+
+	fs.Image.Config.Healthcheck = hc
+	commitHistory(fs.Image, true, "HEALTHCHECK %s", strings.Join(append(flags, cmd), " "))
+	return NewValue(ctx, fs)
+}
+
 type DockerPush struct{}
 
 func (dp DockerPush) Call(ctx context.Context, cln *client.Client, val Value, opts Option, ref string) (Value, error) {
@@ -749,11 +1442,20 @@ func (dp DockerPush) Call(ctx context.Context, cln *client.Client, val Value, op
 	}
 	ref = reference.TagNameOnly(named).String()
 
+	if NoOutput(ctx) {
+		if Binding(ctx).Binds() == "digest" {
+			return NewValue(ctx, "")
+		}
+		return val, nil
+	}
+
 	exportFS, err := val.Filesystem()
 	if err != nil {
 		return nil, err
 	}
 
+	applyImageOverrides(ctx, exportFS.Image)
+
 	// Maintains compatibility with systems depending on v1 `container_config`
 	// containing the last history `created_by`.
 	if len(exportFS.Image.History) > 0 {
@@ -777,11 +1479,24 @@ func (dp DockerPush) Call(ctx context.Context, cln *client.Client, val Value, op
 		exportFS.Image.Architecture = defaultPlat.Architecture
 	}
 
+	// When generating targets for multiple platforms, the image is pushed with
+	// the other platforms as a multi-platform image once they are generated.
+	// A bound digest needs the push to complete now, so it is pushed alone.
+	pushes := getPlatformPushes(ctx)
+	if Binding(ctx).Binds() == "digest" || DockerAPI(ctx).Moby {
+		pushes = nil
+	}
+
 	var dgst string
+	setDigest := func(string) {}
+	if pushes == nil {
+		setDigest = recordArtifact(ctx, &Artifact{Type: ArtifactImage, Ref: ref})
+	}
 	exportFS.SolveOpts = append(exportFS.SolveOpts,
 		solver.WithImageSpec(exportFS.Image),
 		solver.WithCallback(func(_ context.Context, resp *client.SolveResponse) error {
 			dgst = resp.ExporterResponse[llbutil.KeyContainerImageDigest]
+			setDigest(dgst)
 			return nil
 		}),
 	)
@@ -793,6 +1508,9 @@ func (dp DockerPush) Call(ctx context.Context, cln *client.Client, val Value, op
 			exportFS.SolveOpts = append(exportFS.SolveOpts, o)
 		case *Stargz:
 			stargz = true
+		case llbutil.AuthSource:
+			o.Host = llbutil.RegistryHost(named)
+			exportFS.SessionOpts = append(exportFS.SessionOpts, llbutil.WithAuthSource(o))
 		}
 	}
 
@@ -804,7 +1522,7 @@ func (dp DockerPush) Call(ctx context.Context, cln *client.Client, val Value, op
 		// keep mixed layers.
 		forceCompression := false
 		if exportFS.Image.Canonical != nil {
-			resolver := docker.NewResolver(docker.ResolverOptions{Credentials: imageutil.RegistryCreds})
+			resolver := imageutil.NewResolver(InsecureRegistries(ctx)...)
 			forceCompression, err = stargzutil.HasNonStargzLayer(ctx, resolver, platforms.Only(exportFS.Platform), exportFS.Image.Canonical.String())
 			if err != nil {
 				return nil, err
@@ -840,6 +1558,27 @@ func (dp DockerPush) Call(ctx context.Context, cln *client.Client, val Value, op
 	exportFS.SolveOpts = append(exportFS.SolveOpts,
 		solver.WithPushImage(ref),
 	)
+	if IsInsecureRegistry(ctx, ref) {
+		exportFS.SolveOpts = append(exportFS.SolveOpts, solver.WithInsecurePush())
+	}
+
+	if pushes != nil {
+		def, err := exportFS.State.Marshal(ctx, llb.Platform(exportFS.Platform))
+		if err != nil {
+			return nil, err
+		}
+
+		pushes.add(ctx, ref, specs.Platform{
+			OS:           exportFS.Image.OS,
+			Architecture: exportFS.Image.Architecture,
+			Variant:      exportFS.Image.Variant,
+		}, &solver.Params{
+			Def:         def,
+			SolveOpts:   exportFS.SolveOpts,
+			SessionOpts: exportFS.SessionOpts,
+		})
+		return val, nil
+	}
 
 	exportValue, err := NewValue(ctx, exportFS)
 	if err != nil {
@@ -958,6 +1697,10 @@ func (dl DockerLoad) Call(ctx context.Context, cln *client.Client, val Value, op
 		return nil, errdefs.WithInvalidImageRef(err, Arg(ctx, 0), ref)
 	}
 
+	if NoOutput(ctx) {
+		return val, nil
+	}
+
 	dockerAPI := DockerAPI(ctx)
 	if dockerAPI.Err != nil {
 		return nil, dockerAPI.Err
@@ -967,6 +1710,7 @@ func (dl DockerLoad) Call(ctx context.Context, cln *client.Client, val Value, op
 	if err != nil {
 		return nil, err
 	}
+	applyImageOverrides(ctx, exportFS.Image)
 
 	defaultPlat := DefaultPlatform(ctx)
 	switch {
@@ -1069,6 +1813,12 @@ func (d Download) Call(ctx context.Context, cln *client.Client, val Value, opts
 		return nil, err
 	}
 
+	if NoOutput(ctx) {
+		return val, nil
+	}
+
+	recordArtifact(ctx, &Artifact{Type: ArtifactDirectory, Path: localPath})
+
 	exportFS, err := val.Filesystem()
 	if err != nil {
 		return nil, err
@@ -1118,15 +1868,20 @@ func (dt DownloadTarball) Call(ctx context.Context, cln *client.Client, val Valu
 		return nil, err
 	}
 
+	if NoOutput(ctx) {
+		return val, nil
+	}
+
 	err = os.MkdirAll(filepath.Dir(localPath), 0o755)
 	if err != nil {
 		return nil, err
 	}
 
-	f, err := os.Create(localPath)
+	f, err := createExportFile(localPath)
 	if err != nil {
 		return nil, err
 	}
+	recordArtifact(ctx, &Artifact{Type: ArtifactTarball, Path: localPath})
 
 	exportFS, err := val.Filesystem()
 	if err != nil {
@@ -1138,6 +1893,8 @@ func (dt DownloadTarball) Call(ctx context.Context, cln *client.Client, val Valu
 		switch o := opt.(type) {
 		case solver.SolveOption:
 			exportFS.SolveOpts = append(exportFS.SolveOpts, o)
+		case *DownloadChecksum:
+			f.checksums = append(f.checksums, o)
 		}
 	}
 
@@ -1156,7 +1913,7 @@ func (dt DownloadTarball) Call(ctx context.Context, cln *client.Client, val Valu
 	g, ctx := errgroup.WithContext(ctx)
 
 	g.Go(func() error {
-		return request.Solve(ctx, cln, MultiWriter(ctx))
+		return f.finish(request.Solve(ctx, cln, MultiWriter(ctx)))
 	})
 
 	fs, err := val.Filesystem()
@@ -1177,6 +1934,10 @@ func (dot DownloadOCITarball) Call(ctx context.Context, cln *client.Client, val
 		return nil, err
 	}
 
+	if NoOutput(ctx) {
+		return val, nil
+	}
+
 	dockerAPI := DockerAPI(ctx)
 	if dockerAPI.Moby {
 		return nil, errdefs.WithDockerEngineUnsupported(ProgramCounter(ctx))
@@ -1187,10 +1948,11 @@ func (dot DownloadOCITarball) Call(ctx context.Context, cln *client.Client, val
 		return nil, err
 	}
 
-	f, err := os.Create(localPath)
+	f, err := createExportFile(localPath)
 	if err != nil {
 		return nil, err
 	}
+	recordArtifact(ctx, &Artifact{Type: ArtifactOCITarball, Path: localPath})
 
 	exportFS, err := val.Filesystem()
 	if err != nil {
@@ -1202,6 +1964,8 @@ func (dot DownloadOCITarball) Call(ctx context.Context, cln *client.Client, val
 		switch o := opt.(type) {
 		case solver.SolveOption:
 			exportFS.SolveOpts = append(exportFS.SolveOpts, o)
+		case *DownloadChecksum:
+			f.checksums = append(f.checksums, o)
 		}
 	}
 
@@ -1220,7 +1984,7 @@ func (dot DownloadOCITarball) Call(ctx context.Context, cln *client.Client, val
 	g, ctx := errgroup.WithContext(ctx)
 
 	g.Go(func() error {
-		return request.Solve(ctx, cln, MultiWriter(ctx))
+		return f.finish(request.Solve(ctx, cln, MultiWriter(ctx)))
 	})
 
 	fs, err := val.Filesystem()
@@ -1247,6 +2011,10 @@ func (dot DownloadDockerTarball) Call(ctx context.Context, cln *client.Client, v
 	}
 	ref = reference.TagNameOnly(named).String()
 
+	if NoOutput(ctx) {
+		return val, nil
+	}
+
 	dockerAPI := DockerAPI(ctx)
 	if dockerAPI.Moby {
 		return nil, errdefs.WithDockerEngineUnsupported(ProgramCounter(ctx))
@@ -1257,15 +2025,17 @@ func (dot DownloadDockerTarball) Call(ctx context.Context, cln *client.Client, v
 		return nil, err
 	}
 
-	f, err := os.Create(localPath)
+	f, err := createExportFile(localPath)
 	if err != nil {
 		return nil, err
 	}
+	recordArtifact(ctx, &Artifact{Type: ArtifactDockerTarball, Ref: ref, Path: localPath})
 
 	exportFS, err := val.Filesystem()
 	if err != nil {
 		return nil, err
 	}
+	applyImageOverrides(ctx, exportFS.Image)
 
 	exportFS.SolveOpts = append(exportFS.SolveOpts,
 		solver.WithImageSpec(exportFS.Image),
@@ -1275,6 +2045,8 @@ func (dot DownloadDockerTarball) Call(ctx context.Context, cln *client.Client, v
 		switch o := opt.(type) {
 		case solver.SolveOption:
 			exportFS.SolveOpts = append(exportFS.SolveOpts, o)
+		case *DownloadChecksum:
+			f.checksums = append(f.checksums, o)
 		}
 	}
 
@@ -1293,7 +2065,7 @@ func (dot DownloadDockerTarball) Call(ctx context.Context, cln *client.Client, v
 	g, ctx := errgroup.WithContext(ctx)
 
 	g.Go(func() error {
-		return request.Solve(ctx, cln, MultiWriter(ctx))
+		return f.finish(request.Solve(ctx, cln, MultiWriter(ctx)))
 	})
 
 	fs, err := val.Filesystem()
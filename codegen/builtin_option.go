@@ -2,16 +2,20 @@ package codegen
 
 import (
 	"context"
+	"encoding/csv"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net"
 	"net/url"
 	"os"
+	"path"
 	"path/filepath"
 	"sort"
 	"strings"
 	"time"
 
+	"github.com/containerd/containerd/platforms"
 	shellquote "github.com/kballard/go-shellquote"
 	"github.com/moby/buildkit/client"
 	"github.com/moby/buildkit/client/llb"
@@ -19,8 +23,10 @@ import (
 	"github.com/moby/buildkit/session/secrets/secretsprovider"
 	"github.com/moby/buildkit/solver/pb"
 	"github.com/moby/buildkit/util/entitlements"
+	dockerspec "github.com/moby/docker-image-spec/specs-go/v1"
 	digest "github.com/opencontainers/go-digest"
 	specs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/openllb/hlb/diagnostic"
 	"github.com/openllb/hlb/errdefs"
 	"github.com/openllb/hlb/parser"
 	"github.com/openllb/hlb/parser/ast"
@@ -37,6 +43,49 @@ func (ir Resolve) Call(ctx context.Context, cln *client.Client, val Value, opts
 	return val, nil
 }
 
+type NoResolve struct{}
+
+func (nr NoResolve) Call(ctx context.Context, cln *client.Client, val Value, opts Option) (Value, error) {
+	retOpts, err := val.Option()
+	if err != nil {
+		return nil, err
+	}
+	return NewValue(ctx, append(retOpts, llbutil.WithNoResolveImage()))
+}
+
+type AuthFrom struct{}
+
+func (af AuthFrom) Call(ctx context.Context, cln *client.Client, val Value, opts Option, source string) (Value, error) {
+	retOpts, err := val.Option()
+	if err != nil {
+		return nil, err
+	}
+
+	var authSource llbutil.AuthSource
+	kind, value, _ := strings.Cut(source, ":")
+	switch {
+	case value == "":
+		return nil, errdefs.WithInvalidAuthSource(Arg(ctx, 0), source)
+	case kind == "helper":
+		authSource.Helper = value
+	case kind == "token":
+		localPath, err := parser.ResolvePath(ModuleDir(ctx), value)
+		if err != nil {
+			return nil, err
+		}
+
+		dt, err := os.ReadFile(localPath)
+		if err != nil {
+			return nil, Arg(ctx, 0).WithError(err)
+		}
+		authSource.Token = strings.TrimSpace(string(dt))
+	default:
+		return nil, errdefs.WithInvalidAuthSource(Arg(ctx, 0), source)
+	}
+
+	return NewValue(ctx, append(retOpts, authSource))
+}
+
 type Checksum struct{}
 
 func (c Checksum) Call(ctx context.Context, cln *client.Client, val Value, opts Option, dgst digest.Digest) (Value, error) {
@@ -48,6 +97,103 @@ func (c Checksum) Call(ctx context.Context, cln *client.Client, val Value, opts
 	return NewValue(ctx, append(retOpts, llb.Checksum(dgst)))
 }
 
+type CacheImport struct{}
+
+func (ci CacheImport) Call(ctx context.Context, cln *client.Client, val Value, opts Option, spec string) (Value, error) {
+	retOpts, err := val.Option()
+	if err != nil {
+		return nil, err
+	}
+
+	entry, err := parseCacheSpec(ctx, spec, cacheImportTypes)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewValue(ctx, append(retOpts, solver.WithCacheImport(entry)))
+}
+
+type CacheExport struct{}
+
+func (ce CacheExport) Call(ctx context.Context, cln *client.Client, val Value, opts Option, spec string) (Value, error) {
+	retOpts, err := val.Option()
+	if err != nil {
+		return nil, err
+	}
+
+	entry, err := parseCacheSpec(ctx, spec, cacheExportTypes)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewValue(ctx, append(retOpts, solver.WithCacheExport(entry)))
+}
+
+var (
+	// cacheExportTypes are the cache backends that can be used with a shared
+	// session. Local caches are missing because BuildKit only syncs them
+	// through sessions it creates itself.
+	cacheExportTypes = []string{"registry", "inline", "gha", "s3", "azblob"}
+
+	// cacheImportTypes are the cache backends that can be imported from.
+	// Inline caches are embedded in an image, so they are imported with the
+	// registry type instead.
+	cacheImportTypes = []string{"registry", "gha", "s3", "azblob"}
+)
+
+// parseCacheSpec parses a cache spec in the form of the --cache-from and
+// --cache-to flags of docker buildx, such as type=registry,ref=<ref>. A spec
+// without any attributes is a shorthand for a registry cache of the ref.
+func parseCacheSpec(ctx context.Context, spec string, types []string) (client.CacheOptionsEntry, error) {
+	entry := client.CacheOptionsEntry{Attrs: make(map[string]string)}
+	if !strings.Contains(spec, "=") {
+		entry.Type = "registry"
+		entry.Attrs["ref"] = spec
+		return entry, nil
+	}
+
+	fields, err := csv.NewReader(strings.NewReader(spec)).Read()
+	if err != nil {
+		return entry, errdefs.WithInvalidCacheSpec(Arg(ctx, 0), spec, err.Error())
+	}
+
+	for _, field := range fields {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			return entry, errdefs.WithInvalidCacheSpec(Arg(ctx, 0), spec, fmt.Sprintf("expected `%s` to be a key=value pair", field))
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		if key == "type" {
+			entry.Type = value
+		} else {
+			entry.Attrs[key] = value
+		}
+	}
+
+	for _, typ := range types {
+		if entry.Type == typ {
+			return entry, nil
+		}
+	}
+	return entry, errdefs.WithInvalidCacheType(Arg(ctx, 0), entry.Type, types)
+}
+
+// DownloadChecksum verifies the bytes of a downloaded tarball against a
+// digest once it is exported.
+type DownloadChecksum struct {
+	ast.Node
+	Digest digest.Digest
+}
+
+func (dc DownloadChecksum) Call(ctx context.Context, cln *client.Client, val Value, opts Option, dgst digest.Digest) (Value, error) {
+	retOpts, err := val.Option()
+	if err != nil {
+		return nil, err
+	}
+
+	return NewValue(ctx, append(retOpts, &DownloadChecksum{ProgramCounter(ctx), dgst}))
+}
+
 type Chmod struct{}
 
 func (c Chmod) Call(ctx context.Context, cln *client.Client, val Value, opts Option, mode os.FileMode) (Value, error) {
@@ -81,6 +227,19 @@ func (kgd KeepGitDir) Call(ctx context.Context, cln *client.Client, val Value, o
 	return NewValue(ctx, append(retOpts, llb.KeepGitDir()))
 }
 
+type GitSubdir struct {
+	Path string
+}
+
+func (gs GitSubdir) Call(ctx context.Context, cln *client.Client, val Value, opts Option, subdir string) (Value, error) {
+	retOpts, err := val.Option()
+	if err != nil {
+		return nil, err
+	}
+
+	return NewValue(ctx, append(retOpts, &GitSubdir{Path: path.Clean("/" + subdir)}))
+}
+
 type IncludePatterns struct{}
 
 func (ip IncludePatterns) Call(ctx context.Context, cln *client.Client, val Value, opts Option, patterns ...string) (Value, error) {
@@ -103,6 +262,21 @@ func (ep ExcludePatterns) Call(ctx context.Context, cln *client.Client, val Valu
 	return NewValue(ctx, append(retOpts, llbutil.WithExcludePatterns(patterns)))
 }
 
+// Gitignore excludes the files ignored by the .gitignore files of a local
+// source from a copy.
+type Gitignore struct {
+	ast.Node
+}
+
+func (g Gitignore) Call(ctx context.Context, cln *client.Client, val Value, opts Option) (Value, error) {
+	retOpts, err := val.Option()
+	if err != nil {
+		return nil, err
+	}
+
+	return NewValue(ctx, append(retOpts, &Gitignore{ProgramCounter(ctx)}))
+}
+
 type FrontendInput struct{}
 
 func (fi FrontendInput) Call(ctx context.Context, cln *client.Client, val Value, opts Option, key string, input Filesystem) (Value, error) {
@@ -138,6 +312,28 @@ func (fo FrontendOpt) Call(ctx context.Context, cln *client.Client, val Value, o
 	return NewValue(ctx, append(retOpts, llbutil.FrontendOpt(key, value)))
 }
 
+type FrontendTarget struct{}
+
+func (ft FrontendTarget) Call(ctx context.Context, cln *client.Client, val Value, opts Option, stage string) (Value, error) {
+	retOpts, err := val.Option()
+	if err != nil {
+		return nil, err
+	}
+
+	return NewValue(ctx, append(retOpts, llbutil.FrontendOpt("target", stage)))
+}
+
+type FrontendBuildArg struct{}
+
+func (fba FrontendBuildArg) Call(ctx context.Context, cln *client.Client, val Value, opts Option, key, value string) (Value, error) {
+	retOpts, err := val.Option()
+	if err != nil {
+		return nil, err
+	}
+
+	return NewValue(ctx, append(retOpts, llbutil.FrontendOpt("build-arg:"+key, value)))
+}
+
 type CreateParents struct{}
 
 func (cp CreateParents) Call(ctx context.Context, cln *client.Client, val Value, opts Option) (Value, error) {
@@ -204,6 +400,17 @@ func (fs FollowSymlinks) Call(ctx context.Context, cln *client.Client, val Value
 	return NewValue(ctx, append(retOpts, llbutil.WithFollowSymlinks(true)))
 }
 
+type NoDereference struct{}
+
+func (nd NoDereference) Call(ctx context.Context, cln *client.Client, val Value, opts Option) (Value, error) {
+	retOpts, err := val.Option()
+	if err != nil {
+		return nil, err
+	}
+
+	return NewValue(ctx, append(retOpts, llbutil.WithFollowSymlinks(false)))
+}
+
 type ContentsOnly struct{}
 
 func (co ContentsOnly) Call(ctx context.Context, cln *client.Client, val Value, opts Option) (Value, error) {
@@ -292,6 +499,28 @@ func (uct UtilCreatedTime) Call(ctx context.Context, cln *client.Client, val Val
 	return NewValue(ctx, append(retOpts, llbutil.WithCreatedTime(t)))
 }
 
+type PreserveTimestamps struct{}
+
+func (pt PreserveTimestamps) Call(ctx context.Context, cln *client.Client, val Value, opts Option) (Value, error) {
+	retOpts, err := val.Option()
+	if err != nil {
+		return nil, err
+	}
+
+	return NewValue(ctx, append(retOpts, llbutil.WithPreserveTimestamps()))
+}
+
+type ArchiveGzip struct{}
+
+func (ag ArchiveGzip) Call(ctx context.Context, cln *client.Client, val Value, opts Option) (Value, error) {
+	retOpts, err := val.Option()
+	if err != nil {
+		return nil, err
+	}
+
+	return NewValue(ctx, append(retOpts, &ArchiveGzip{}))
+}
+
 type TemplateField struct {
 	Name  string
 	Value interface{}
@@ -364,7 +593,18 @@ func (s Shlex) Call(ctx context.Context, cln *client.Client, val Value, opts Opt
 	return NewValue(ctx, append(retOpts, &Shlex{}))
 }
 
-func ShlexArgs(args []string, shlex bool) ([]string, error) {
+type UseEntrypoint struct{}
+
+func (ue UseEntrypoint) Call(ctx context.Context, cln *client.Client, val Value, opts Option) (Value, error) {
+	retOpts, err := val.Option()
+	if err != nil {
+		return nil, err
+	}
+
+	return NewValue(ctx, append(retOpts, &UseEntrypoint{}))
+}
+
+func ShlexArgs(args []string, shlex bool, shell []string) ([]string, error) {
 	if len(args) == 0 {
 		return nil, nil
 	}
@@ -379,7 +619,10 @@ func ShlexArgs(args []string, shlex bool) ([]string, error) {
 			return parts, nil
 		}
 
-		return []string{"/bin/sh", "-c", args[0]}, nil
+		if len(shell) == 0 {
+			shell = []string{"/bin/sh", "-c"}
+		}
+		return append(append([]string{}, shell...), args[0]), nil
 	}
 
 	return args, nil
@@ -429,6 +672,35 @@ func (ru RunUser) Call(ctx context.Context, cln *client.Client, val Value, opts
 	return NewValue(ctx, append(retOpts, llbutil.WithUser(name)))
 }
 
+type EnsureDir struct{}
+
+func (ed EnsureDir) Call(ctx context.Context, cln *client.Client, val Value, opts Option) (Value, error) {
+	retOpts, err := val.Option()
+	if err != nil {
+		return nil, err
+	}
+
+	return NewValue(ctx, append(retOpts, &EnsureDir{}))
+}
+
+type RunTimeout struct{}
+
+func (rt RunTimeout) Call(ctx context.Context, cln *client.Client, val Value, opts Option, duration string) (Value, error) {
+	retOpts, err := val.Option()
+	if err != nil {
+		return nil, err
+	}
+
+	d, err := time.ParseDuration(duration)
+	if err != nil || d <= 0 {
+		return nil, errdefs.WithInvalidDuration(Arg(ctx, 0), duration)
+	}
+
+	// BuildKit has no timeout for a single op, so the timeout applies to the
+	// solve of the filesystem the run is part of.
+	return NewValue(ctx, append(retOpts, solver.WithTimeout(d)))
+}
+
 type IgnoreCache struct{}
 
 func (ig IgnoreCache) Call(ctx context.Context, cln *client.Client, val Value, opts Option) (Value, error) {
@@ -440,6 +712,10 @@ func (ig IgnoreCache) Call(ctx context.Context, cln *client.Client, val Value, o
 	return NewValue(ctx, append(retOpts, llb.AddEnv("HLB_IGNORE_CACHE", identity.NewID())))
 }
 
+// NetworkModes are the network modes supported by exec ops. LLB has no way to
+// attach an exec op to a named CNI network, so other modes are rejected.
+var NetworkModes = []string{"unset", "host", "none"}
+
 type Network struct{}
 
 func (n Network) Call(ctx context.Context, cln *client.Client, val Value, opts Option, mode string) (Value, error) {
@@ -454,11 +730,17 @@ func (n Network) Call(ctx context.Context, cln *client.Client, val Value, opts O
 		netMode = pb.NetMode_UNSET
 	case "host":
 		netMode = pb.NetMode_HOST
+		if !EntitlementAllowed(ctx, entitlements.EntitlementNetworkHost) {
+			return nil, errdefs.WithEntitlementNotAllowed(Arg(ctx, 0), entitlements.EntitlementNetworkHost)
+		}
 		retOpts = append(retOpts, solver.WithEntitlement(entitlements.EntitlementNetworkHost))
 	case "none":
 		netMode = pb.NetMode_NONE
 	default:
-		return nil, errdefs.WithInvalidNetworkMode(Arg(ctx, 0), mode, []string{"unset", "host", "none"})
+		if diagnostic.Suggestion(mode, NetworkModes) == "" {
+			return nil, errdefs.WithUnsupportedNetworkMode(Arg(ctx, 0), mode, NetworkModes)
+		}
+		return nil, errdefs.WithInvalidNetworkMode(Arg(ctx, 0), mode, NetworkModes)
 	}
 
 	return NewValue(ctx, append(retOpts, llbutil.WithNetwork(netMode)))
@@ -478,6 +760,9 @@ func (s Security) Call(ctx context.Context, cln *client.Client, val Value, opts
 		securityMode = pb.SecurityMode_SANDBOX
 	case "insecure":
 		securityMode = pb.SecurityMode_INSECURE
+		if !EntitlementAllowed(ctx, entitlements.EntitlementSecurityInsecure) {
+			return nil, errdefs.WithEntitlementNotAllowed(Arg(ctx, 0), entitlements.EntitlementSecurityInsecure)
+		}
 		retOpts = append(retOpts, solver.WithEntitlement(entitlements.EntitlementSecurityInsecure))
 	default:
 		return nil, errdefs.WithInvalidSecurityMode(Arg(ctx, 0), mode, []string{"sandbox", "insecure"})
@@ -486,6 +771,48 @@ func (s Security) Call(ctx context.Context, cln *client.Client, val Value, opts
 	return NewValue(ctx, append(retOpts, llbutil.WithSecurity(securityMode)))
 }
 
+// UlimitNames are the resource limits that can be set on exec ops.
+var UlimitNames = []string{
+	"core", "cpu", "data", "fsize", "locks", "memlock", "msgqueue", "nice",
+	"nofile", "nproc", "rss", "rtprio", "rttime", "sigpending", "stack",
+}
+
+type Ulimit struct{}
+
+func (u Ulimit) Call(ctx context.Context, cln *client.Client, val Value, opts Option, name string, soft, hard int) (Value, error) {
+	retOpts, err := val.Option()
+	if err != nil {
+		return nil, err
+	}
+
+	found := false
+	for _, candidate := range UlimitNames {
+		if name == candidate {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil, errdefs.WithInvalidUlimit(Arg(ctx, 0), name, UlimitNames)
+	}
+	if soft > hard {
+		return nil, errdefs.WithUlimitExceedsHard(Arg(ctx, 1), soft, hard)
+	}
+
+	return NewValue(ctx, append(retOpts, llbutil.WithUlimit(llb.UlimitName(name), int64(soft), int64(hard))))
+}
+
+type CgroupParent struct{}
+
+func (cp CgroupParent) Call(ctx context.Context, cln *client.Client, val Value, opts Option, name string) (Value, error) {
+	retOpts, err := val.Option()
+	if err != nil {
+		return nil, err
+	}
+
+	return NewValue(ctx, append(retOpts, llbutil.WithCgroupParent(name)))
+}
+
 type Host struct{}
 
 func (s Host) Call(ctx context.Context, cln *client.Client, val Value, opts Option, host string, address net.IP) (Value, error) {
@@ -497,6 +824,55 @@ func (s Host) Call(ctx context.Context, cln *client.Client, val Value, opts Opti
 	return NewValue(ctx, append(retOpts, llbutil.WithExtraHost(host, address)))
 }
 
+type Hostname struct{}
+
+func (h Hostname) Call(ctx context.Context, cln *client.Client, val Value, opts Option, hostname string) (Value, error) {
+	retOpts, err := val.Option()
+	if err != nil {
+		return nil, err
+	}
+
+	return NewValue(ctx, append(retOpts, llbutil.WithHostname(hostname)))
+}
+
+type Stdin struct{}
+
+func (s Stdin) Call(ctx context.Context, cln *client.Client, val Value, opts Option, content string) (Value, error) {
+	retOpts, err := val.Option()
+	if err != nil {
+		return nil, err
+	}
+
+	return NewValue(ctx, append(retOpts, llbutil.WithStdin(content)))
+}
+
+type StdinFile struct{}
+
+func (sf StdinFile) Call(ctx context.Context, cln *client.Client, val Value, opts Option, localPath string) (Value, error) {
+	retOpts, err := val.Option()
+	if err != nil {
+		return nil, err
+	}
+
+	localPath, err = parser.ResolvePath(ModuleDir(ctx), localPath)
+	if err != nil {
+		return nil, err
+	}
+
+	rc, err := Module(ctx).Directory.Open(localPath)
+	if err != nil {
+		return nil, Arg(ctx, 0).WithError(err)
+	}
+	defer rc.Close()
+
+	dt, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, Arg(ctx, 0).WithError(err)
+	}
+
+	return NewValue(ctx, append(retOpts, llbutil.WithStdin(string(dt))))
+}
+
 type SSH struct{}
 
 func (s SSH) Call(ctx context.Context, cln *client.Client, val Value, opts Option) (Value, error) {
@@ -693,13 +1069,38 @@ func (m Mount) Call(ctx context.Context, cln *client.Client, val Value, opts Opt
 		return nil, err
 	}
 
-	var cache *Cache
+	var (
+		cache        *Cache
+		lockfiles    []*Lockfile
+		contentsOnly bool
+	)
 	for _, opt := range opts {
-		var ok bool
-		cache, ok = opt.(*Cache)
+		switch o := opt.(type) {
+		case *Cache:
+			if cache == nil {
+				cache = o
+			}
+		case *Lockfile:
+			lockfiles = append(lockfiles, o)
+		case *MountContentsOnly:
+			contentsOnly = true
+		}
+	}
+	if contentsOnly {
+		filename, ok, err := httpSourceFilename(ctx, input)
+		if err != nil {
+			return nil, err
+		}
 		if ok {
-			break
+			// Prepended so that an explicit sourcePath takes precedence.
+			opts = append(Option{llbutil.WithSourcePath(filename)}, opts...)
+		}
+	}
+	if len(lockfiles) > 0 {
+		if cache == nil {
+			return nil, errdefs.WithLockfileWithoutCache(lockfiles[0])
 		}
+		opts = lockfileCacheIDs(opts, lockfiles)
 	}
 
 	if Binding(ctx).Binds() == "target" {
@@ -727,6 +1128,33 @@ func (m Mount) Call(ctx context.Context, cln *client.Client, val Value, opts Opt
 	return NewValue(ctx, retOpts)
 }
 
+type MountFiles struct{}
+
+func (mf MountFiles) Call(ctx context.Context, cln *client.Client, val Value, opts Option, input Filesystem, mountpoint string) (Value, error) {
+	retOpts, err := val.Option()
+	if err != nil {
+		return nil, err
+	}
+
+	retOpts = append(retOpts, &llbutil.MountRunOption{
+		Source: input.State,
+		Target: mountpoint,
+		Opts: []interface{}{
+			llbutil.WithReadonlyMount(),
+			llb.MountOption(llb.ForceNoOutput),
+		},
+	})
+
+	for _, opt := range input.SolveOpts {
+		retOpts = append(retOpts, opt)
+	}
+	for _, opt := range input.SessionOpts {
+		retOpts = append(retOpts, opt)
+	}
+
+	return NewValue(ctx, retOpts)
+}
+
 type MountTarget struct{}
 
 func (mt MountTarget) Call(ctx context.Context, cln *client.Client, val Value, opts Option, target string) (Value, error) {
@@ -790,6 +1218,17 @@ func (r Readonly) Call(ctx context.Context, cln *client.Client, val Value, opts
 	return NewValue(ctx, append(retOpts, llbutil.WithReadonlyMount()))
 }
 
+type MountContentsOnly struct{}
+
+func (mco MountContentsOnly) Call(ctx context.Context, cln *client.Client, val Value, opts Option) (Value, error) {
+	retOpts, err := val.Option()
+	if err != nil {
+		return nil, err
+	}
+
+	return NewValue(ctx, append(retOpts, &MountContentsOnly{}))
+}
+
 type Tmpfs struct{}
 
 func (t Tmpfs) Call(ctx context.Context, cln *client.Client, val Value, opts Option) (Value, error) {
@@ -822,22 +1261,161 @@ func (c Cache) Call(ctx context.Context, cln *client.Client, val Value, opts Opt
 		return nil, err
 	}
 
-	var sharing llb.CacheMountSharingMode
-	switch mode {
-	case "shared":
-		sharing = llb.CacheMountShared
-	case "private":
-		sharing = llb.CacheMountPrivate
-	case "locked":
-		sharing = llb.CacheMountLocked
-	default:
-		return nil, errdefs.WithInvalidSharingMode(Arg(ctx, 1), mode, []string{"shared", "private", "locked"})
+	sharing, err := cacheSharingMode(ctx, 1, mode)
+	if err != nil {
+		return nil, err
 	}
 
 	retOpts = append(retOpts, &Cache{ProgramCounter(ctx)}, llbutil.WithPersistentCacheDir(id, sharing))
 	return NewValue(ctx, retOpts)
 }
 
+// CacheSharingModes maps the sharing modes accepted by cache mounts to their
+// LLB and protobuf counterparts, so codegen and the debugger agree on them.
+var CacheSharingModes = []struct {
+	Name string
+	Mode llb.CacheMountSharingMode
+	Opt  pb.CacheSharingOpt
+}{
+	{"shared", llb.CacheMountShared, pb.CacheSharingOpt_SHARED},
+	{"private", llb.CacheMountPrivate, pb.CacheSharingOpt_PRIVATE},
+	{"locked", llb.CacheMountLocked, pb.CacheSharingOpt_LOCKED},
+}
+
+// cacheSharingMode parses the sharing mode of a cache, given as the n-th
+// argument of the builtin.
+func cacheSharingMode(ctx context.Context, n int, mode string) (llb.CacheMountSharingMode, error) {
+	var names []string
+	for _, sharing := range CacheSharingModes {
+		if mode == sharing.Name {
+			return sharing.Mode, nil
+		}
+		names = append(names, sharing.Name)
+	}
+	return 0, errdefs.WithInvalidSharingMode(Arg(ctx, n), mode, names)
+}
+
+// cacheSharingOpt returns the protobuf sharing mode for a cache mount.
+func cacheSharingOpt(mode llb.CacheMountSharingMode) (pb.CacheSharingOpt, error) {
+	for _, sharing := range CacheSharingModes {
+		if mode == sharing.Mode {
+			return sharing.Opt, nil
+		}
+	}
+	return 0, errors.Errorf("unrecognized cache sharing mode %v", mode)
+}
+
+// gatewayCacheOpt returns the cache options of a gateway container mount,
+// keeping the same cache id and sharing mode as the LLB cache mount.
+func gatewayCacheOpt(o llbutil.CacheMountOption) (*pb.CacheOpt, error) {
+	sharing, err := cacheSharingOpt(o.Sharing)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.CacheOpt{ID: o.ID, Sharing: sharing}, nil
+}
+
+type CacheDir struct{}
+
+func (cd CacheDir) Call(ctx context.Context, cln *client.Client, val Value, opts Option, id, mountpoint, mode string) (Value, error) {
+	retOpts, err := val.Option()
+	if err != nil {
+		return nil, err
+	}
+
+	sharing, err := cacheSharingMode(ctx, 2, mode)
+	if err != nil {
+		return nil, err
+	}
+
+	// The cache starts out empty, like a cache mount of scratch.
+	retOpts = append(retOpts, &llbutil.MountRunOption{
+		Source: llb.Scratch(),
+		Target: mountpoint,
+		Opts: []interface{}{
+			llbutil.WithPersistentCacheDir(id, sharing),
+			llb.MountOption(llb.ForceNoOutput),
+		},
+	})
+	return NewValue(ctx, retOpts)
+}
+
+// Lockfile keys the cache id of a mount by the content of a lockfile.
+type Lockfile struct {
+	ast.Node
+	Digest digest.Digest
+}
+
+func (l Lockfile) Call(ctx context.Context, cln *client.Client, val Value, opts Option, filename string) (Value, error) {
+	retOpts, err := val.Option()
+	if err != nil {
+		return nil, err
+	}
+
+	filename, err = parser.ResolvePath(ModuleDir(ctx), filename)
+	if err != nil {
+		return nil, err
+	}
+
+	dgst, err := digestFile(Module(ctx).Directory, filename)
+	if err != nil {
+		return nil, Arg(ctx, 0).WithError(err)
+	}
+
+	return NewValue(ctx, append(retOpts, &Lockfile{ProgramCounter(ctx), dgst}))
+}
+
+// digestFile returns the sha256 digest of a file in the directory.
+func digestFile(dir ast.Directory, filename string) (digest.Digest, error) {
+	rc, err := dir.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+	return digest.SHA256.FromReader(rc)
+}
+
+// lockfileCacheIDs appends the lockfile digests to the ids of cache mounts, so
+// that the cache is only shared among builds with identical dependencies.
+func lockfileCacheIDs(opts Option, lockfiles []*Lockfile) Option {
+	var keyed Option
+	for _, opt := range opts {
+		if o, ok := opt.(llbutil.CacheMountOption); ok {
+			for _, lockfile := range lockfiles {
+				o.ID = fmt.Sprintf("%s-%s", o.ID, lockfile.Digest.Encoded())
+			}
+			opt = o
+		}
+		keyed = append(keyed, opt)
+	}
+	return keyed
+}
+
+// CopyPlatform is the platform that the content of a copy is built for, such
+// as the target of a cross-compiled binary.
+type CopyPlatform struct {
+	ast.Node
+	Platform specs.Platform
+}
+
+func (cp CopyPlatform) Call(ctx context.Context, cln *client.Client, val Value, opts Option, os, arch string) (Value, error) {
+	retOpts, err := val.Option()
+	if err != nil {
+		return nil, err
+	}
+
+	// The architecture may have a variant, like arm/v7.
+	platform, err := platforms.Parse(path.Join(os, arch))
+	if err != nil {
+		return nil, Arg(ctx, 1).WithError(err)
+	}
+
+	return NewValue(ctx, append(retOpts, &CopyPlatform{
+		Node:     ProgramCounter(ctx),
+		Platform: platforms.Normalize(platform),
+	}))
+}
+
 type Platform struct{}
 
 func (p Platform) Call(ctx context.Context, cln *client.Client, val Value, opts Option, os, arch string) (Value, error) {
@@ -852,6 +1430,86 @@ func (p Platform) Call(ctx context.Context, cln *client.Client, val Value, opts
 	}))
 }
 
+// healthcheckOption modifies the healthcheck set on an image config.
+type healthcheckOption func(*dockerspec.HealthcheckConfig)
+
+// healthcheckDuration parses the duration of the nth arg in the format of
+// Go durations, like Docker does for the HEALTHCHECK flags.
+func healthcheckDuration(ctx context.Context, n int, duration string) (time.Duration, error) {
+	d, err := time.ParseDuration(duration)
+	if err != nil || d < 0 {
+		return 0, errdefs.WithInvalidDuration(Arg(ctx, n), duration)
+	}
+	return d, nil
+}
+
+type HealthcheckInterval struct{}
+
+func (hi HealthcheckInterval) Call(ctx context.Context, cln *client.Client, val Value, opts Option, duration string) (Value, error) {
+	retOpts, err := val.Option()
+	if err != nil {
+		return nil, err
+	}
+
+	d, err := healthcheckDuration(ctx, 0, duration)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewValue(ctx, append(retOpts, healthcheckOption(func(hc *dockerspec.HealthcheckConfig) {
+		hc.Interval = d
+	})))
+}
+
+type HealthcheckTimeout struct{}
+
+func (ht HealthcheckTimeout) Call(ctx context.Context, cln *client.Client, val Value, opts Option, duration string) (Value, error) {
+	retOpts, err := val.Option()
+	if err != nil {
+		return nil, err
+	}
+
+	d, err := healthcheckDuration(ctx, 0, duration)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewValue(ctx, append(retOpts, healthcheckOption(func(hc *dockerspec.HealthcheckConfig) {
+		hc.Timeout = d
+	})))
+}
+
+type HealthcheckStartPeriod struct{}
+
+func (hsp HealthcheckStartPeriod) Call(ctx context.Context, cln *client.Client, val Value, opts Option, duration string) (Value, error) {
+	retOpts, err := val.Option()
+	if err != nil {
+		return nil, err
+	}
+
+	d, err := healthcheckDuration(ctx, 0, duration)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewValue(ctx, append(retOpts, healthcheckOption(func(hc *dockerspec.HealthcheckConfig) {
+		hc.StartPeriod = d
+	})))
+}
+
+type HealthcheckRetries struct{}
+
+func (hr HealthcheckRetries) Call(ctx context.Context, cln *client.Client, val Value, opts Option, count int) (Value, error) {
+	retOpts, err := val.Option()
+	if err != nil {
+		return nil, err
+	}
+
+	return NewValue(ctx, append(retOpts, healthcheckOption(func(hc *dockerspec.HealthcheckConfig) {
+		hc.Retries = count
+	})))
+}
+
 type Stargz struct{}
 
 func (s Stargz) Call(ctx context.Context, cln *client.Client, val Value, opts Option) (Value, error) {
@@ -3,8 +3,12 @@ package codegen
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os/exec"
 	"strings"
 	"text/template"
@@ -17,6 +21,7 @@ import (
 	specs "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/openllb/hlb/errdefs"
 	"github.com/openllb/hlb/local"
+	"github.com/openllb/hlb/parser"
 	"github.com/openllb/hlb/pkg/imageutil"
 )
 
@@ -55,6 +60,116 @@ func (t Template) Call(ctx context.Context, cln *client.Client, val Value, opts
 	return NewValue(ctx, buf.String())
 }
 
+type ToLower struct{}
+
+func (tl ToLower) Call(ctx context.Context, cln *client.Client, val Value, opts Option) (Value, error) {
+	str, err := val.String()
+	if err != nil {
+		return nil, err
+	}
+	return NewValue(ctx, strings.ToLower(str))
+}
+
+type ToUpper struct{}
+
+func (tu ToUpper) Call(ctx context.Context, cln *client.Client, val Value, opts Option) (Value, error) {
+	str, err := val.String()
+	if err != nil {
+		return nil, err
+	}
+	return NewValue(ctx, strings.ToUpper(str))
+}
+
+type TrimSpace struct{}
+
+func (ts TrimSpace) Call(ctx context.Context, cln *client.Client, val Value, opts Option) (Value, error) {
+	str, err := val.String()
+	if err != nil {
+		return nil, err
+	}
+	return NewValue(ctx, strings.TrimSpace(str))
+}
+
+type TrimPrefix struct{}
+
+func (tp TrimPrefix) Call(ctx context.Context, cln *client.Client, val Value, opts Option, prefix string) (Value, error) {
+	str, err := val.String()
+	if err != nil {
+		return nil, err
+	}
+	return NewValue(ctx, strings.TrimPrefix(str, prefix))
+}
+
+type TrimSuffix struct{}
+
+func (ts TrimSuffix) Call(ctx context.Context, cln *client.Client, val Value, opts Option, suffix string) (Value, error) {
+	str, err := val.String()
+	if err != nil {
+		return nil, err
+	}
+	return NewValue(ctx, strings.TrimSuffix(str, suffix))
+}
+
+type Replace struct{}
+
+func (r Replace) Call(ctx context.Context, cln *client.Client, val Value, opts Option, old, new string) (Value, error) {
+	str, err := val.String()
+	if err != nil {
+		return nil, err
+	}
+	return NewValue(ctx, strings.ReplaceAll(str, old, new))
+}
+
+type Sha256 struct{}
+
+func (s Sha256) Call(ctx context.Context, cln *client.Client, val Value, opts Option) (Value, error) {
+	str, err := val.String()
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256([]byte(str))
+	return NewValue(ctx, hex.EncodeToString(sum[:]))
+}
+
+type Base64Encode struct{}
+
+func (be Base64Encode) Call(ctx context.Context, cln *client.Client, val Value, opts Option) (Value, error) {
+	str, err := val.String()
+	if err != nil {
+		return nil, err
+	}
+	return NewValue(ctx, base64.StdEncoding.EncodeToString([]byte(str)))
+}
+
+type Base64Decode struct{}
+
+func (bd Base64Decode) Call(ctx context.Context, cln *client.Client, val Value, opts Option) (Value, error) {
+	str, err := val.String()
+	if err != nil {
+		return nil, err
+	}
+	dt, err := base64.StdEncoding.DecodeString(str)
+	if err != nil {
+		return nil, errdefs.WithInvalidBase64(err, ProgramCounter(ctx))
+	}
+	return NewValue(ctx, string(dt))
+}
+
+type Join struct{}
+
+func (j Join) Call(ctx context.Context, cln *client.Client, val Value, opts Option, sep string, values []string) (Value, error) {
+	return NewValue(ctx, strings.Join(values, sep))
+}
+
+type Split struct{}
+
+func (s Split) Call(ctx context.Context, cln *client.Client, val Value, opts Option, sep, text string) (Value, error) {
+	if sep == "" {
+		return NewValue(ctx, strings.Fields(text))
+	}
+	return NewValue(ctx, strings.Split(text, sep))
+}
+
 type LocalArch struct{}
 
 func (la LocalArch) Call(ctx context.Context, cln *client.Client, val Value, opts Option) (Value, error) {
@@ -99,7 +214,7 @@ func (lr LocalRun) Call(ctx context.Context, cln *client.Client, val Value, opts
 		}
 	}
 
-	runArgs, err := ShlexArgs(args, shlex)
+	runArgs, err := ShlexArgs(args, shlex, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -108,22 +223,51 @@ func (lr LocalRun) Call(ctx context.Context, cln *client.Client, val Value, opts
 	cmd.Env = local.Environ(ctx)
 	cmd.Dir = ModuleDir(ctx)
 
-	var buf strings.Builder
+	// Stderr is kept separately when it isn't part of the output so that it
+	// can be shown if the command fails.
+	var buf, errBuf strings.Builder
+	stderr := &errBuf
 	if localRunOpts.OnlyStderr {
-		cmd.Stderr = &buf
+		stderr = &buf
 	} else {
 		cmd.Stdout = &buf
 	}
 	if localRunOpts.IncludeStderr {
-		cmd.Stderr = &buf
+		stderr = &buf
 	}
+	cmd.Stderr = stderr
 
 	err = cmd.Run()
 	if err != nil && !localRunOpts.IgnoreError {
+		return nil, errdefs.WithLocalRunFailed(err, ProgramCounter(ctx), strings.Join(args, " "), stderr.String())
+	}
+
+	// Trim trailing line endings so the output can be used as a value, such
+	// as the value of an env or label.
+	return NewValue(ctx, strings.TrimRight(buf.String(), "\r\n"))
+}
+
+type ReadFile struct{}
+
+func (rf ReadFile) Call(ctx context.Context, cln *client.Client, val Value, opts Option, localPath string) (Value, error) {
+	localPath, err := parser.ResolvePath(ModuleDir(ctx), localPath)
+	if err != nil {
 		return nil, err
 	}
 
-	return NewValue(ctx, strings.TrimRight(buf.String(), "\n"))
+	// The file is read from the module's directory when compiling, rather than
+	// synced to BuildKit like a local source.
+	rc, err := Module(ctx).Directory.Open(localPath)
+	if err != nil {
+		return nil, Arg(ctx, 0).WithError(err)
+	}
+	defer rc.Close()
+
+	dt, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, Arg(ctx, 0).WithError(err)
+	}
+	return NewValue(ctx, strings.TrimSpace(string(dt)))
 }
 
 type Manifest struct{}
@@ -136,7 +280,7 @@ func (m Manifest) Call(ctx context.Context, cln *client.Client, val Value, opts
 	ref = reference.TagNameOnly(named).String()
 
 	var (
-		resolver = imageutil.NewBufferedImageResolver()
+		resolver = imageutil.NewBufferedImageResolver(imageutil.WithInsecureRegistries(InsecureRegistries(ctx)...))
 		matcher  = resolver.MatchDefaultPlatform()
 	)
 	var platform *specs.Platform
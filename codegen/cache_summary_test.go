@@ -0,0 +1,110 @@
+package codegen
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lithammer/dedent"
+	"github.com/moby/buildkit/client"
+	"github.com/moby/buildkit/solver/pb"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/openllb/hlb/builtin"
+	"github.com/openllb/hlb/checker"
+	"github.com/openllb/hlb/parser"
+	"github.com/openllb/hlb/parser/ast"
+	"github.com/openllb/hlb/pkg/filebuffer"
+	"github.com/openllb/hlb/solver"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCacheSummary(t *testing.T) {
+	t.Parallel()
+
+	ctx := filebuffer.WithBuffers(context.Background(), builtin.Buffers())
+	ctx = ast.WithModules(ctx, builtin.Modules())
+
+	mod, err := parser.Parse(ctx, &parser.NamedReader{
+		Reader: strings.NewReader(strings.TrimSpace(dedent.Dedent(`
+		fs default() {
+			scratch
+			mkfile "/foo" 0o644 "foo"
+			mkfile "/bar" 0o644 "bar"
+		}
+		`)) + "\n"),
+		Value: "build.hlb",
+	})
+	require.NoError(t, err)
+
+	err = checker.SemanticPass(mod)
+	require.NoError(t, err)
+
+	err = checker.Check(mod)
+	require.NoError(t, err)
+
+	cg := New(nil, nil)
+	val, err := cg.emitTarget(ctx, mod, 0, Target{Name: "default"})
+	require.NoError(t, err)
+
+	fs, err := val.Filesystem()
+	require.NoError(t, err)
+
+	def, err := fs.State.Marshal(ctx)
+	require.NoError(t, err)
+
+	cs := solver.NewCacheSummary()
+	cs.AddDefinition(def)
+
+	// Find the vertex of each mkfile by the path it creates.
+	vertices := make(map[string]digest.Digest)
+	for _, dt := range def.Def {
+		var op pb.Op
+		err = op.Unmarshal(dt)
+		require.NoError(t, err)
+
+		if file := op.GetFile(); file != nil {
+			vertices[file.Actions[0].GetMkfile().Path] = digest.FromBytes(dt)
+		}
+	}
+	require.Len(t, vertices, 2)
+
+	now := time.Now()
+	cs.Write(&client.SolveStatus{
+		Vertexes: []*client.Vertex{{
+			Digest:    vertices["/bar"],
+			Name:      "mkfile /bar",
+			Started:   &now,
+			Completed: &now,
+		}, {
+			Digest:    vertices["/foo"],
+			Name:      "mkfile /foo",
+			Started:   &now,
+			Completed: &now,
+			Cached:    true,
+		}},
+	})
+
+	require.Equal(t, []solver.CacheEntry{{
+		Location: solver.SourceLocation{Filename: "build.hlb", Line: 3, Column: 2},
+		Digest:   vertices["/foo"],
+		Name:     "mkfile /foo",
+		Status:   solver.CacheStatusCached,
+	}, {
+		Location: solver.SourceLocation{Filename: "build.hlb", Line: 4, Column: 2},
+		Digest:   vertices["/bar"],
+		Name:     "mkfile /bar",
+		Status:   solver.CacheStatusComputed,
+	}}, cs.Entries())
+
+	var b strings.Builder
+	err = cs.Print(&b)
+	require.NoError(t, err)
+	require.Equal(t, strings.Join([]string{
+		"build.hlb:3:2",
+		"  cached   mkfile /foo",
+		"build.hlb:4:2",
+		"  computed mkfile /bar",
+		"",
+	}, "\n"), b.String())
+}
@@ -5,11 +5,13 @@ import (
 	"context"
 	"fmt"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 
 	"github.com/lithammer/dedent"
 	"github.com/moby/buildkit/client"
+	specs "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/openllb/hlb/checker"
 	"github.com/openllb/hlb/diagnostic"
 	"github.com/openllb/hlb/errdefs"
@@ -38,9 +40,36 @@ func New(cln *client.Client, resolver Resolver) *CodeGen {
 
 type Target struct {
 	Name string
+
+	// Platform overrides the default platform when generating the target, so
+	// that images without a platform option resolve to the matching variant.
+	Platform *specs.Platform
 }
 
 func (cg *CodeGen) Generate(ctx context.Context, mod *ast.Module, targets []Target) (result solver.Request, err error) {
+	requests, err := cg.GenerateRequests(ctx, mod, targets)
+	if err != nil {
+		return nil, err
+	}
+	return solver.Parallel(requests...), nil
+}
+
+// GenerateRequests generates the solve request of each target, in the order
+// of the targets.
+func (cg *CodeGen) GenerateRequests(ctx context.Context, mod *ast.Module, targets []Target) ([]solver.Request, error) {
+	requests, _, err := cg.generateRequests(ctx, mod, targets, false)
+	return requests, err
+}
+
+// GenerateEachRequest generates the solve request of each target like
+// GenerateRequests, but a target that fails to generate doesn't stop the
+// other targets from being generated. The request of a failed target is nil,
+// and its error is at the same index of the returned errors.
+func (cg *CodeGen) GenerateEachRequest(ctx context.Context, mod *ast.Module, targets []Target) ([]solver.Request, []error, error) {
+	return cg.generateRequests(ctx, mod, targets, true)
+}
+
+func (cg *CodeGen) generateRequests(ctx context.Context, mod *ast.Module, targets []Target, each bool) ([]solver.Request, []error, error) {
 	if GetDebugger(ctx) != nil {
 		switch dbgr := GetDebugger(ctx).(type) {
 		case testDebugger:
@@ -51,42 +80,163 @@ func (cg *CodeGen) Generate(ctx context.Context, mod *ast.Module, targets []Targ
 		ctx = WithGlobalSolveOpts(ctx, solver.WithErrorHandler(cg.errorHandler))
 	}
 
-	var requests []solver.Request
+	// Validate all targets upfront so a typo doesn't fail halfway through
+	// compiling the other targets.
+	for _, target := range targets {
+		if !isTarget(mod.Scope.Objects[target.Name]) {
+			return nil, nil, errdefs.WithUndefinedTarget(mod.Pos.Filename, target.Name, Targets(mod))
+		}
+	}
+
+	// Targets built for multiple platforms push their images together, once
+	// every platform has been generated.
+	var pushes *platformPushes
+	for _, target := range targets {
+		if target.Platform != nil {
+			pushes = &platformPushes{}
+			ctx = withPlatformPushes(ctx, pushes)
+			break
+		}
+	}
+
+	var (
+		requests = make([]solver.Request, len(targets))
+		errs     = make([]error, len(targets))
+	)
 	for i, target := range targets {
-		_, ok := mod.Scope.Objects[target.Name]
-		if !ok {
-			return nil, fmt.Errorf("target %q is not defined in %s", target.Name, mod.Pos.Filename)
+		if pushes != nil {
+			pushes.setTarget(i)
 		}
 
-		// Yield before compiling anything.
-		ret := NewRegister(ctx)
-		if cg.dbgr != nil {
-			err := cg.dbgr.yield(ctx, mod.Scope, mod, ret.Value(), nil, nil)
-			if err != nil {
-				return nil, err
+		val, err := cg.emitTarget(ctx, mod, i, target)
+		if err == nil {
+			requests[i], err = val.Request()
+		}
+		if err != nil {
+			if !each {
+				return nil, nil, err
+			}
+			errs[i] = err
+			requests[i] = nil
+
+			// The images of a failed target aren't pushed with the other
+			// platforms.
+			if pushes != nil {
+				pushes.discard(i)
 			}
 		}
+	}
+
+	if pushes != nil {
+		pushes.fold(requests)
+	}
+	return requests, errs, nil
+}
+
+// GenerateImage generates a filesystem target and returns its image config as
+// it would be exported, without solving or exporting it.
+func (cg *CodeGen) GenerateImage(ctx context.Context, mod *ast.Module, target Target) (*solver.ImageSpec, error) {
+	if !isTarget(mod.Scope.Objects[target.Name]) {
+		return nil, errdefs.WithUndefinedTarget(mod.Pos.Filename, target.Name, Targets(mod))
+	}
+
+	val, err := cg.emitTarget(ctx, mod, 0, target)
+	if err != nil {
+		return nil, err
+	}
 
-		// Build expression for target.
-		ie := ast.NewIdentExpr(target.Name)
-		ie.Pos.Filename = "target"
-		ie.Pos.Line = i
+	fs, err := val.Filesystem()
+	if err != nil {
+		return nil, err
+	}
+	applyImageOverrides(ctx, fs.Image)
+	return fs.Image, nil
+}
 
-		// Every target has a return register.
-		err := cg.EmitIdentExpr(ctx, mod.Scope, ie, ie.Ident, nil, nil, nil, ret)
+// GenerateValue generates a target of any kind and returns its value, without
+// composing a solve request.
+func (cg *CodeGen) GenerateValue(ctx context.Context, mod *ast.Module, target Target) (Value, error) {
+	if !isTarget(mod.Scope.Objects[target.Name]) {
+		return nil, errdefs.WithUndefinedTarget(mod.Pos.Filename, target.Name, Targets(mod))
+	}
+	return cg.emitTarget(ctx, mod, 0, target)
+}
+
+func (cg *CodeGen) emitTarget(ctx context.Context, mod *ast.Module, i int, target Target) (Value, error) {
+	if target.Platform != nil {
+		ctx = WithDefaultPlatform(ctx, *target.Platform)
+	}
+
+	// Yield before compiling anything.
+	ret := NewRegister(ctx)
+	if cg.dbgr != nil {
+		err := cg.dbgr.yield(ctx, mod.Scope, mod, ret.Value(), nil, nil)
 		if err != nil {
 			return nil, err
 		}
+	}
 
-		request, err := ret.Value().Request()
-		if err != nil {
-			return nil, err
+	// Build expression for target.
+	ie := ast.NewIdentExpr(target.Name)
+	ie.Pos.Filename = "target"
+	ie.Pos.Line = i
+
+	// Every target has a return register.
+	err := cg.EmitIdentExpr(ctx, mod.Scope, ie, ie.Ident, nil, nil, nil, ret)
+	if err != nil {
+		return nil, err
+	}
+	return ret.Value(), nil
+}
+
+// Targets returns the sorted names of all the callable targets in a module.
+func Targets(mod *ast.Module) []string {
+	var names []string
+	for name, obj := range mod.Scope.Objects {
+		if isTarget(obj) {
+			names = append(names, name)
 		}
+	}
+	sort.Strings(names)
+	return names
+}
 
-		requests = append(requests, request)
+// ExportedTargets returns the sorted names of the default and exported
+// filesystem or pipeline functions of a module that take no arguments, which
+// are the targets a module is expected to build.
+func ExportedTargets(mod *ast.Module) []string {
+	exported := map[string]bool{"default": true}
+	for _, decl := range mod.Decls {
+		if decl.Export != nil {
+			exported[decl.Export.Name.Text] = true
+		}
 	}
 
-	return solver.Parallel(requests...), nil
+	var names []string
+	for _, decl := range mod.Decls {
+		fd := decl.Func
+		if fd == nil || !exported[fd.Sig.Name.Text] || len(fd.Sig.Params.Fields()) > 0 {
+			continue
+		}
+		switch fd.Kind().Primary() {
+		case ast.Filesystem, ast.Pipeline:
+			names = append(names, fd.Sig.Name.Text)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func isTarget(obj *ast.Object) bool {
+	if obj == nil || obj.Kind.Primary() == ast.Option {
+		return false
+	}
+	switch obj.Node.(type) {
+	case *ast.FuncDecl, *ast.BindClause:
+		return true
+	default:
+		return false
+	}
 }
 
 func (cg *CodeGen) EmitExpr(ctx context.Context, scope *ast.Scope, expr *ast.Expr, opts Option, b *ast.Binding, ret Register) error {
@@ -97,6 +247,8 @@ func (cg *CodeGen) EmitExpr(ctx context.Context, scope *ast.Scope, expr *ast.Exp
 		return cg.EmitFuncLit(ctx, scope, expr.FuncLit, b, ret)
 	case expr.BasicLit != nil:
 		return cg.EmitBasicLit(ctx, scope, expr.BasicLit, ret)
+	case expr.ListLit != nil:
+		return cg.EmitListLit(ctx, scope, expr.ListLit, b, ret)
 	case expr.CallExpr != nil:
 		ret.SetAsync(func(val Value) (Value, error) {
 			if expr.CallExpr.Breakpoint() {
@@ -115,7 +267,7 @@ func (cg *CodeGen) EmitExpr(ctx context.Context, scope *ast.Scope, expr *ast.Exp
 
 			ret := NewRegister(ctx)
 			ret.Set(val)
-			err = cg.EmitCallExpr(ctx, scope, expr.CallExpr, ret)
+			err = cg.EmitCallExpr(ctx, scope, expr.CallExpr, b, ret)
 			return ret.Value(), err
 		})
 		return nil
@@ -149,6 +301,34 @@ func (cg *CodeGen) EmitBasicLit(ctx context.Context, scope *ast.Scope, lit *ast.
 	}
 }
 
+func (cg *CodeGen) EmitListLit(ctx context.Context, scope *ast.Scope, lit *ast.ListLit, b *ast.Binding, ret Register) error {
+	var elems []Register
+	for _, elem := range lit.Elements() {
+		ctx := WithProgramCounter(ctx, elem)
+		ctx = WithReturnType(ctx, ast.String)
+
+		elemRet := NewRegister(ctx)
+		err := cg.EmitExpr(ctx, scope, elem, nil, b, elemRet)
+		if err != nil {
+			return err
+		}
+		elems = append(elems, elemRet)
+	}
+
+	ret.SetAsync(func(Value) (Value, error) {
+		list := make([]string, len(elems))
+		for i, elem := range elems {
+			str, err := elem.Value().String()
+			if err != nil {
+				return nil, err
+			}
+			list[i] = str
+		}
+		return NewValue(ctx, list)
+	})
+	return nil
+}
+
 func (cg *CodeGen) EmitStringLit(ctx context.Context, scope *ast.Scope, str *ast.StringLit, ret Register) error {
 	var pieces []string
 	for _, f := range str.Fragments {
@@ -254,7 +434,7 @@ func (cg *CodeGen) EmitRawHeredoc(ctx context.Context, scope *ast.Scope, heredoc
 	return emitHeredocPieces(heredoc.Start, terminate, pieces, ret)
 }
 
-func (cg *CodeGen) EmitCallExpr(ctx context.Context, scope *ast.Scope, call *ast.CallExpr, ret Register) error {
+func (cg *CodeGen) EmitCallExpr(ctx context.Context, scope *ast.Scope, call *ast.CallExpr, b *ast.Binding, ret Register) error {
 	// Evaluate args first.
 	args := cg.Evaluate(ctx, scope, call, nil)
 	for i, arg := range call.Arguments() {
@@ -270,7 +450,27 @@ func (cg *CodeGen) EmitCallExpr(ctx context.Context, scope *ast.Scope, call *ast
 		}
 	}
 
-	return cg.EmitIdentExpr(ctx, scope, call.Name, call.Name.Ident, args, nil, nil, ret)
+	// Pass the binding if the option function may have the matching CallStmt.
+	var binding *ast.Binding
+	if b != nil && isOptionFunc(scope, call.Name) {
+		binding = b
+	}
+
+	return cg.EmitIdentExpr(ctx, scope, call.Name, call.Name.Ident, args, nil, binding, ret)
+}
+
+// isOptionFunc returns whether ie refers to an option function declared in
+// scope, whose body may bind on behalf of the closure it is used in.
+func isOptionFunc(scope *ast.Scope, ie *ast.IdentExpr) bool {
+	if ie.Reference != nil {
+		return false
+	}
+	obj := scope.Lookup(ie.Ident.Text)
+	if obj == nil {
+		return false
+	}
+	fd, ok := obj.Node.(*ast.FuncDecl)
+	return ok && fd.Kind().Primary() == ast.Option
 }
 
 func (cg *CodeGen) EmitIdentExpr(ctx context.Context, scope *ast.Scope, ie *ast.IdentExpr, lookup *ast.Ident, args []Register, opts Register, b *ast.Binding, ret Register) error {
@@ -288,7 +488,7 @@ func (cg *CodeGen) EmitIdentExpr(ctx context.Context, scope *ast.Scope, ie *ast.
 		})
 		return nil
 	case *ast.FuncDecl:
-		return cg.EmitFuncDecl(ctx, n, args, nil, ret)
+		return cg.EmitFuncDecl(ctx, n, args, b, ret)
 	case *ast.BindClause:
 		return cg.EmitBinding(ctx, n.TargetBinding(lookup.Text), args, ret)
 	case *ast.ImportDecl:
@@ -381,6 +581,11 @@ func (cg *CodeGen) EmitImport(ctx context.Context, mod *ast.Module, id *ast.Impo
 		}
 	}
 
+	err = parser.ResolveIncludes(ctx, imod)
+	if err != nil {
+		return nil, err
+	}
+
 	err = checker.SemanticPass(imod)
 	if err != nil {
 		return nil, err
@@ -389,7 +594,7 @@ func (cg *CodeGen) EmitImport(ctx context.Context, mod *ast.Module, id *ast.Impo
 	// Drop errors from linting.
 	_ = linter.Lint(ctx, imod)
 
-	return imod, checker.Check(imod)
+	return imod, checker.Check(imod, CheckOptions(ctx)...)
 }
 
 func (cg *CodeGen) EmitBuiltinDecl(ctx context.Context, scope *ast.Scope, bd *ast.BuiltinDecl, args []Register, opts Register, b *ast.Binding, val Value) (Value, error) {
@@ -466,8 +671,27 @@ func (cg *CodeGen) EmitBuiltinDecl(ctx context.Context, scope *ast.Scope, bd *as
 
 	// Reflect variadic arguments.
 	if c.Type().IsVariadic() {
+		param := c.Type().In(numIn).Elem()
 		for i := numIn - len(PrototypeIn); i < len(vals); i++ {
-			param := c.Type().In(numIn).Elem()
+			// Lists are spread into the variadic arguments.
+			if vals[i].Kind() == ast.List {
+				list, err := vals[i].List()
+				if err != nil {
+					return nil, err
+				}
+				for _, elem := range list {
+					val, err := NewValue(ctx, elem)
+					if err != nil {
+						return nil, err
+					}
+					rval, err := val.Reflect(param)
+					if err != nil {
+						return nil, err
+					}
+					ins = append(ins, rval)
+				}
+				continue
+			}
 			rval, err := vals[i].Reflect(param)
 			if err != nil {
 				return nil, err
@@ -476,10 +700,12 @@ func (cg *CodeGen) EmitBuiltinDecl(ctx context.Context, scope *ast.Scope, bd *as
 		}
 	}
 
-	outs := c.Call(ins)
-	if !outs[1].IsNil() {
+	outs, err := callBuiltin(ctx, bd, c, ins)
+	if err == nil && !outs[1].IsNil() {
+		err = outs[1].Interface().(error)
+	}
+	if err != nil {
 		var se *diagnostic.SpanError
-		err := outs[1].Interface().(error)
 		if !errors.As(err, &se) {
 			err = ProgramCounter(ctx).WithError(err)
 		}
@@ -496,6 +722,18 @@ func (cg *CodeGen) EmitBuiltinDecl(ctx context.Context, scope *ast.Scope, bd *as
 	return outs[0].Interface().(Value), nil
 }
 
+// callBuiltin calls the Call method of a builtin, recovering from a panic as
+// an error at the call so a bug in a builtin is reported with the position of
+// the source that triggered it.
+func callBuiltin(ctx context.Context, bd *ast.BuiltinDecl, c reflect.Value, ins []reflect.Value) (outs []reflect.Value, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = errdefs.WithInternalErrorf(ProgramCounter(ctx), "`%s` panicked: %v", bd.Name, r)
+		}
+	}()
+	return c.Call(ins), nil
+}
+
 func (cg *CodeGen) EmitFuncDecl(ctx context.Context, fd *ast.FuncDecl, args []Register, b *ast.Binding, ret Register) error {
 	if fd.Body == nil {
 		return nil
@@ -666,9 +904,10 @@ func (cg *CodeGen) EmitCallStmt(ctx context.Context, scope *ast.Scope, call *ast
 		}
 	}
 
-	// Pass the binding if this is the matching CallStmt.
+	// Pass the binding if this is the matching CallStmt, or an option function
+	// that may have the matching CallStmt.
 	var binding *ast.Binding
-	if b != nil && call.BindClause == b.Bind {
+	if b != nil && (call.BindClause == b.Bind || isOptionFunc(scope, call.Name)) {
 		binding = b
 	}
 
@@ -1,18 +1,31 @@
 package codegen_test
 
 import (
+	"bytes"
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"syscall"
 	"testing"
 	"time"
 
+	"github.com/containerd/containerd/platforms"
+	"github.com/docker/distribution/reference"
 	"github.com/lithammer/dedent"
+	"github.com/moby/buildkit/client"
 	"github.com/moby/buildkit/client/llb"
+	"github.com/moby/buildkit/client/llb/sourceresolver"
+	gateway "github.com/moby/buildkit/frontend/gateway/client"
 	"github.com/moby/buildkit/solver/pb"
 	"github.com/moby/buildkit/util/entitlements"
+	digest "github.com/opencontainers/go-digest"
 	specs "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/openllb/hlb/builtin"
 	"github.com/openllb/hlb/checker"
@@ -43,6 +56,15 @@ func Expect(t *testing.T, st llb.State, opts ...solver.SolveOption) solver.Reque
 	})
 }
 
+// linuxAmd64Image returns the image config pushed for an unresolved image on
+// the default test platform.
+func linuxAmd64Image() *solver.ImageSpec {
+	image := &solver.ImageSpec{}
+	image.OS = "linux"
+	image.Architecture = "amd64"
+	return image
+}
+
 func LocalState(ctx context.Context, t *testing.T, localPath string, opts ...llb.LocalOption) llb.State {
 	absPath := localPath
 	if !filepath.IsAbs(localPath) {
@@ -62,6 +84,32 @@ func LocalState(ctx context.Context, t *testing.T, localPath string, opts ...llb
 	return llb.Local(localPath, opts...)
 }
 
+// ParseModule parses and checks the HLB source with the builtins in scope,
+// returning the context to generate it with.
+func ParseModule(ctx context.Context, t *testing.T, hlb string) (context.Context, *ast.Module) {
+	ctx = filebuffer.WithBuffers(ctx, builtin.Buffers())
+	ctx = ast.WithModules(ctx, builtin.Modules())
+
+	mod, err := parser.Parse(ctx, strings.NewReader(cleanup(hlb)))
+	require.NoError(t, err)
+
+	err = checker.SemanticPass(mod)
+	require.NoError(t, err)
+
+	err = checker.Check(mod)
+	require.NoError(t, err)
+	return ctx, mod
+}
+
+// GenerateImage generates the image config of the default target of the HLB
+// source.
+func GenerateImage(ctx context.Context, t *testing.T, hlb string) *solver.ImageSpec {
+	ctx, mod := ParseModule(ctx, t, hlb)
+	image, err := codegen.New(nil, nil).GenerateImage(ctx, mod, codegen.Target{Name: "default"})
+	require.NoError(t, err)
+	return image
+}
+
 func TestCodeGen(t *testing.T) {
 	t.Parallel()
 
@@ -84,6 +132,28 @@ func TestCodeGen(t *testing.T) {
 		func(ctx context.Context, t *testing.T) solver.Request {
 			return Expect(t, llb.Image("alpine"))
 		},
+	}, {
+		"frontend image config binding",
+		[]string{"default"},
+		`
+		fs default() {
+			scratch
+			mkfile "/entrypoint" 0o644 ep
+			mkfile "/env" 0o644 environ
+			mkfile "/labels" 0o644 labels
+		}
+
+		fs build() {
+			frontend "docker/dockerfile" as (entrypoint ep, env environ, labels labels)
+		}
+		`, "",
+		func(ctx context.Context, t *testing.T) solver.Request {
+			return Expect(t, llb.Scratch().
+				File(llb.Mkfile("/entrypoint", 0o644, []byte(`["/app","--serve"]`))).
+				File(llb.Mkfile("/env", 0o644, []byte(`[]`))).
+				File(llb.Mkfile("/labels", 0o644, []byte(`{"maintainer":"openllb"}`))),
+			)
+		},
 	}, {
 		"basic scratch",
 		[]string{"default"},
@@ -125,6 +195,32 @@ func TestCodeGen(t *testing.T) {
 				llb.Chmod(os.FileMode(0x777)),
 				llb.Filename("myTest.out")))
 		},
+	}, {
+		"copyURL with options",
+		[]string{"default"},
+		`
+		fs default() {
+			scratch
+			copyURL "http://my.test.url/file.tar.gz" "/opt/file.tar.gz" with option {
+				checksum "sha256:4f858ddc9eb7302530d279eb1ad1468ea1253f45fd64fa3096e4ff5c0520b0f3"
+				chmod 0o755
+			}
+		}
+		`, "",
+		func(ctx context.Context, t *testing.T) solver.Request {
+			return Expect(t, llb.Scratch().File(
+				llb.Copy(
+					llb.HTTP(
+						"http://my.test.url/file.tar.gz",
+						llb.Filename("file.tar.gz"),
+						llb.Checksum("sha256:4f858ddc9eb7302530d279eb1ad1468ea1253f45fd64fa3096e4ff5c0520b0f3"),
+						llb.Chmod(os.FileMode(0o755)),
+					),
+					"file.tar.gz",
+					"/opt/file.tar.gz",
+				),
+			))
+		},
 	}, {
 		"basic git",
 		[]string{"default"},
@@ -152,6 +248,31 @@ func TestCodeGen(t *testing.T) {
 				"master",
 				llb.KeepGitDir()))
 		},
+	}, {
+		"git with subdir",
+		[]string{"default"},
+		`
+		fs default() {
+			git "https://github.com/openllb/hlb.git" "master" with option {
+				keepGitDir
+				subdir "docs/"
+			}
+		}
+		`, "",
+		func(ctx context.Context, t *testing.T) solver.Request {
+			return Expect(t, llb.Scratch().File(
+				llb.Copy(
+					llb.Git(
+						"https://github.com/openllb/hlb.git",
+						"master",
+						llb.KeepGitDir(),
+					),
+					"/docs",
+					"/",
+					&llb.CopyInfo{CopyDirContentsOnly: true},
+				),
+			))
+		},
 	}, {
 		"basic mkdir",
 		[]string{"default"},
@@ -227,6 +348,31 @@ func TestCodeGen(t *testing.T) {
 		func(ctx context.Context, t *testing.T) solver.Request {
 			return Expect(t, llb.Scratch().User("testUser").Run(llb.Shlex("echo Hello")).Root())
 		},
+	}, {
+		"basic shell",
+		[]string{"default"},
+		`
+		fs default() {
+			image "busybox"
+			shell "/bin/bash" "-eo" "pipefail" "-c"
+			run "echo Hello"
+			run "echo" "Bye"
+			run "echo Hello" with shlex
+			shell
+			run "echo Bye"
+		}
+		`, "",
+		func(ctx context.Context, t *testing.T) solver.Request {
+			return Expect(t, llb.Image("busybox").Run(
+				llb.Args([]string{"/bin/bash", "-eo", "pipefail", "-c", "echo Hello"}),
+			).Run(
+				llb.Args([]string{"echo", "Bye"}),
+			).Run(
+				llb.Args([]string{"echo", "Hello"}),
+			).Run(
+				llb.Args([]string{"/bin/sh", "-c", "echo Bye"}),
+			).Root())
+		},
 	}, {
 		"basic mkfile",
 		[]string{"default"},
@@ -349,6 +495,40 @@ func TestCodeGen(t *testing.T) {
 				llb.WithCreatedTime(createdTime),
 			)))
 		},
+	}, {
+		"copy without dereferencing symlinks",
+		[]string{"default"},
+		`
+		fs default() {
+			scratch
+			copy scratch "testSource" "testDest" with option {
+				followSymlinks
+				noDereference
+			}
+		}
+		`, "",
+		func(ctx context.Context, t *testing.T) solver.Request {
+			scratch := llb.Scratch()
+			return Expect(t, scratch.File(llb.Copy(scratch, "testSource", "testDest", &llb.CopyInfo{
+				FollowSymlinks: false,
+			})))
+		},
+	}, {
+		"copy preserving timestamps",
+		[]string{"default"},
+		`
+		fs default() {
+			scratch
+			copy scratch "testSource" "testDest" with option {
+				createdTime "2020-04-27T15:04:05Z"
+				preserveTimestamps
+			}
+		}
+		`, "",
+		func(ctx context.Context, t *testing.T) solver.Request {
+			scratch := llb.Scratch()
+			return Expect(t, scratch.File(llb.Copy(scratch, "testSource", "testDest")))
+		},
 	}, {
 		"call function",
 		[]string{"default"},
@@ -404,6 +584,37 @@ func TestCodeGen(t *testing.T) {
 				llb.IncludePatterns([]string{"codegen_test.go"}),
 			))
 		},
+	}, {
+		"same local with different patterns",
+		[]string{"default"},
+		`
+		pipeline default() {
+			stage fs {
+				local "." with option {
+					includePatterns "*.go"
+				}
+			} fs {
+				local "."
+			}
+		}
+		`, "",
+		func(ctx context.Context, t *testing.T) solver.Request {
+			cwd, err := local.Cwd(ctx)
+			require.NoError(t, err)
+
+			// Differently filtered uses of the same directory must not share
+			// content in BuildKit, so their shared keys differ.
+			filtered, err := llbutil.LocalID(ctx, cwd, llb.IncludePatterns([]string{"*.go"}))
+			require.NoError(t, err)
+			unfiltered, err := llbutil.LocalID(ctx, cwd)
+			require.NoError(t, err)
+			require.NotEqual(t, filtered, unfiltered)
+
+			return solver.Parallel(
+				Expect(t, LocalState(ctx, t, ".", llb.IncludePatterns([]string{"*.go"}))),
+				Expect(t, LocalState(ctx, t, ".")),
+			)
+		},
 	}, {
 		"copy file with patterns",
 		[]string{"default"},
@@ -456,6 +667,186 @@ func TestCodeGen(t *testing.T) {
 				llb.Shlex("touch /out/foo"),
 			).AddMount("/out", llb.Scratch()))
 		},
+	}, {
+		"bind scratch mount in option function",
+		[]string{"default"},
+		`
+		option::run mounts() {
+			mount scratch "/out" as build
+			shlex
+		}
+
+		fs compile() {
+			image "alpine"
+			run "touch /out/foo" with mounts
+		}
+
+		fs default() {
+			image "alpine"
+			copy build "/foo" "/foo"
+			run "cat /foo" with shlex
+		}
+		`, "",
+		func(ctx context.Context, t *testing.T) solver.Request {
+			build := llb.Image("alpine").Run(
+				llb.Shlex("touch /out/foo"),
+			).AddMount("/out", llb.Scratch())
+			return Expect(t, llb.Image("alpine").File(
+				llb.Copy(build, "/foo", "/foo"),
+			).Run(llb.Shlex("cat /foo")).Root())
+		},
+	}, {
+		"bind scratch mount in option function within option block",
+		[]string{"default"},
+		`
+		option::run mounts() {
+			mount scratch "/out" as build
+		}
+
+		fs compile() {
+			image "alpine"
+			run "touch /out/foo" with option {
+				mounts
+				shlex
+			}
+		}
+
+		fs default() {
+			scratch
+			copy build "/foo" "/foo"
+		}
+		`, "",
+		func(ctx context.Context, t *testing.T) solver.Request {
+			build := llb.Image("alpine").Run(
+				llb.Shlex("touch /out/foo"),
+			).AddMount("/out", llb.Scratch())
+			return Expect(t, llb.Scratch().File(llb.Copy(build, "/foo", "/foo")))
+		},
+	}, {
+		"cache dir without mount",
+		[]string{"default"},
+		`
+		fs default() {
+			image "golang:alpine"
+			run "go build ./..." with option {
+				cacheDir "gocache" "/root/.cache/go-build" "locked"
+				shlex
+			}
+		}
+		`, "",
+		func(ctx context.Context, t *testing.T) solver.Request {
+			return Expect(t, llb.Image("golang:alpine").Run(
+				llb.Shlex("go build ./..."),
+				llb.AddMount(
+					"/root/.cache/go-build",
+					llb.Scratch(),
+					llb.AsPersistentCacheDir("gocache", llb.CacheMountLocked),
+					llb.ForceNoOutput,
+				),
+			).Root())
+		},
+	}, {
+		"cache mount seeded from input",
+		[]string{"default"},
+		`
+		fs default() {
+			image "golang:alpine"
+			run "go mod download" with option {
+				mount image("golang:alpine") "/go/pkg/mod" with option {
+					cache "gomod" "shared"
+				}
+				shlex
+			}
+		}
+		`, "",
+		func(ctx context.Context, t *testing.T) solver.Request {
+			return Expect(t, llb.Image("golang:alpine").Run(
+				llb.Shlex("go mod download"),
+				llb.AddMount(
+					"/go/pkg/mod",
+					llb.Image("golang:alpine"),
+					llb.AsPersistentCacheDir("gomod", llb.CacheMountShared),
+					llb.ForceNoOutput,
+				),
+			).Root())
+		},
+	}, {
+		"cache mount keyed by lockfile",
+		[]string{"default"},
+		`
+		fs default() {
+			image "golang:alpine"
+			run "go mod download" with option {
+				mount scratch "/go/pkg/mod" with option {
+					cache "gomod" "shared"
+					lockfile "testdata/VERSION"
+				}
+				shlex
+			}
+		}
+		`, "",
+		func(ctx context.Context, t *testing.T) solver.Request {
+			dt, err := os.ReadFile("testdata/VERSION")
+			require.NoError(t, err)
+
+			id := "gomod-" + digest.FromBytes(dt).Encoded()
+			return Expect(t, llb.Image("golang:alpine").Run(
+				llb.Shlex("go mod download"),
+				llb.AddMount(
+					"/go/pkg/mod",
+					llb.Scratch(),
+					llb.AsPersistentCacheDir(id, llb.CacheMountShared),
+					llb.ForceNoOutput,
+				),
+			).Root())
+		},
+	}, {
+		"mount http with contentsOnly",
+		[]string{"default"},
+		`
+		fs default() {
+			image "alpine"
+			run "cat /dl /tools/bin" with option {
+				mount http("https://my.test.url/releases/tool.tar.gz") "/dl" with option {
+					readonly
+					contentsOnly
+				}
+				mount tool "/tools/bin" with option {
+					contentsOnly
+					readonly
+				}
+				mount git("https://github.com/openllb/hlb.git", "master") "/src" with contentsOnly
+			}
+		}
+
+		fs tool() {
+			http "https://my.test.url/latest" with filename("tool")
+		}
+		`, "",
+		func(ctx context.Context, t *testing.T) solver.Request {
+			return Expect(t, llb.Image("alpine").Run(
+				llb.Args([]string{"/bin/sh", "-c", "cat /dl /tools/bin"}),
+				llb.AddMount(
+					"/dl",
+					llb.HTTP("https://my.test.url/releases/tool.tar.gz"),
+					llb.SourcePath("tool.tar.gz"),
+					llb.Readonly,
+					llb.ForceNoOutput,
+				),
+				llb.AddMount(
+					"/tools/bin",
+					llb.HTTP("https://my.test.url/latest", llb.Filename("tool")),
+					llb.SourcePath("tool"),
+					llb.Readonly,
+					llb.ForceNoOutput,
+				),
+				llb.AddMount(
+					"/src",
+					llb.Git("https://github.com/openllb/hlb.git", "master"),
+					llb.ForceNoOutput,
+				),
+			).Root())
+		},
 	}, {
 		"option builtin without func lit",
 		[]string{"default"},
@@ -591,6 +982,35 @@ func TestCodeGen(t *testing.T) {
 				Expect(t, llb.Scratch().File(llb.Mkfile("foo", 0o644, []byte("hello world")))),
 			)
 		},
+	}, {
+		"stage mounting an earlier stage",
+		[]string{"default"},
+		`
+		pipeline default() {
+			stage build
+			stage fs {
+				image "alpine"
+				run "cat /build/out" with option {
+					mount build "/build"
+				}
+			}
+		}
+
+		fs build() {
+			scratch
+			mkfile "out" 0o644 "hello world"
+		}
+		`, "",
+		func(ctx context.Context, t *testing.T) solver.Request {
+			build := llb.Scratch().File(llb.Mkfile("out", 0o644, []byte("hello world")))
+			return solver.Sequential(
+				Expect(t, build),
+				Expect(t, llb.Image("alpine").Run(
+					llb.Args([]string{"/bin/sh", "-c", "cat /build/out"}),
+					llb.AddMount("/build", build),
+				).Root()),
+			)
+		},
 	}, {
 		"here doc processing",
 		[]string{"default"},
@@ -715,34 +1135,123 @@ func TestCodeGen(t *testing.T) {
 			)
 		},
 	}, {
-		"mount over readonly",
+		"resource limits",
 		[]string{"default"},
 		`
 		fs default() {
 			image "busybox"
-			run "find ." with option {
-				shlex
-				dir "/foo"
-				mount fs {
-					local "."
-				} "/foo" with readonly
-				mount scratch "/foo/bar"
-				secret "codegen_test.go" "/foo/secret/codegen_test.go"
+			run "ulimit -n" with option {
+				ulimit "nofile" 1024 2048
+				cgroupParent "builds"
 			}
 		}
 		`, "",
 		func(ctx context.Context, t *testing.T) solver.Request {
-			sid := llbutil.SecretID("codegen_test.go")
-			return Expect(t, llb.Image("busybox").Run(
-				llb.Shlex("find ."),
-				llb.Dir("/foo"),
-				llb.AddMount(
-					"/foo",
-					LocalState(ctx, t, ".").File(
-						// this Mkdir is made implicitly due to /foo/secret
-						// secret over readonly FS
-						llb.Mkdir("secret", 0o755, llb.WithParents(true)),
-					).File(
+			return Expect(t,
+				llb.Image("busybox").Run(
+					llb.Args([]string{"/bin/sh", "-c", "ulimit -n"}),
+					llb.AddUlimit(llb.UlimitNofile, 1024, 2048),
+					llb.WithCgroupParent("builds"),
+				).Root(),
+			)
+		},
+	}, {
+		"run with hostname",
+		[]string{"default"},
+		`
+		fs default() {
+			image "busybox"
+			run "hostname" with option {
+				hostname "builder"
+			}
+		}
+		`, "",
+		func(ctx context.Context, t *testing.T) solver.Request {
+			return Expect(t,
+				llb.Image("busybox").Run(
+					llb.Args([]string{"/bin/sh", "-c", "hostname"}),
+					llb.Hostname("builder"),
+				).Root(),
+			)
+		},
+	}, {
+		"run with ensureDir",
+		[]string{"default"},
+		`
+		fs default() {
+			image "busybox"
+			run "pwd" with option {
+				dir "/app"
+				ensureDir
+			}
+		}
+		`, "",
+		func(ctx context.Context, t *testing.T) solver.Request {
+			return Expect(t,
+				llb.Image("busybox").File(
+					llb.Mkdir("/app", os.FileMode(0o755), llb.WithParents(true)),
+				).Run(
+					llb.Args([]string{"/bin/sh", "-c", "pwd"}),
+					llb.Dir("/app"),
+				).Root(),
+			)
+		},
+	}, {
+		"run with ensureDir as user",
+		[]string{"default"},
+		`
+		fs default() {
+			image "busybox"
+			run "pwd" with option {
+				dir "/app"
+				user "builder"
+				env "HOME" "/home/builder"
+				ensureDir
+			}
+		}
+		`, "",
+		func(ctx context.Context, t *testing.T) solver.Request {
+			return Expect(t,
+				llb.Image("busybox").File(
+					llb.Mkdir("/app", os.FileMode(0o755), llb.WithParents(true), llb.WithUser("builder")).
+						Mkdir("/home/builder", os.FileMode(0o755), llb.WithParents(true), llb.WithUser("builder")),
+				).Run(
+					llb.Args([]string{"/bin/sh", "-c", "pwd"}),
+					llb.Dir("/app"),
+					llb.User("builder"),
+					llb.AddEnv("HOME", "/home/builder"),
+				).Root(),
+			)
+		},
+	}, {
+		"mount over readonly",
+		[]string{"default"},
+		`
+		fs default() {
+			image "busybox"
+			run "find ." with option {
+				shlex
+				dir "/foo"
+				mount fs {
+					local "."
+				} "/foo" with readonly
+				mount scratch "/foo/bar"
+				secret "codegen_test.go" "/foo/secret/codegen_test.go"
+			}
+		}
+		`, "",
+		func(ctx context.Context, t *testing.T) solver.Request {
+			sid := llbutil.SecretID("codegen_test.go")
+			return Expect(t, llb.Image("busybox").Run(
+				llb.Shlex("find ."),
+				llb.Dir("/foo"),
+				llb.AddMount(
+					"/foo",
+					LocalState(ctx, t, ".").File(
+						// this Mkdir is made implicitly due to /foo/secret
+						// secret over readonly FS
+						llb.Mkdir("secret", 0o755, llb.WithParents(true)),
+					).File(
 						// this Mkfile is made implicitly due to /foo/secret
 						// secret over readonly FS
 						llb.Mkfile("secret/codegen_test.go", 0o644, []byte{}),
@@ -757,6 +1266,47 @@ func TestCodeGen(t *testing.T) {
 				llb.AddSecret("/foo/secret/codegen_test.go", llb.SecretID(sid)),
 			).Root())
 		},
+	}, {
+		"ssh over readonly",
+		[]string{"default"},
+		`
+		fs default() {
+			image "busybox"
+			run "find ." with option {
+				shlex
+				dir "/foo"
+				mount fs {
+					local "."
+				} "/foo" with readonly
+				ssh with option {
+					target "/foo/ssh/agent.sock"
+				}
+			}
+		}
+		`, "",
+		func(ctx context.Context, t *testing.T) solver.Request {
+			return Expect(t, llb.Image("busybox").Run(
+				llb.Shlex("find ."),
+				llb.Dir("/foo"),
+				llb.AddMount(
+					"/foo",
+					LocalState(ctx, t, ".").File(
+						// this Mkdir is made implicitly due to /foo/ssh
+						// ssh socket over readonly FS
+						llb.Mkdir("ssh", 0o755, llb.WithParents(true)),
+					).File(
+						// this Mkfile is made implicitly due to /foo/ssh
+						// ssh socket over readonly FS
+						llb.Mkfile("ssh/agent.sock", 0o644, []byte{}),
+					),
+					llb.Readonly,
+				),
+				llb.AddSSHSocket(
+					llb.SSHID(llbutil.SSHID()),
+					llb.SSHSocketTarget("/foo/ssh/agent.sock"),
+				),
+			).Root())
+		},
 	}, {
 		"merging user defined option::copy with func lit",
 		[]string{"default"},
@@ -826,6 +1376,155 @@ func TestCodeGen(t *testing.T) {
 				llb.Mkfile("shlex", os.FileMode(0o644), []byte("$HOME")),
 			))
 		},
+	}, {
+		"run with stdin",
+		[]string{"default"},
+		`
+		fs default() {
+			image "busybox"
+			run "cat" with option {
+				stdin "hello"
+			}
+		}
+		`, "",
+		func(ctx context.Context, t *testing.T) solver.Request {
+			stdin := llb.Scratch().File(llb.Mkfile("stdin", 0o444, []byte("hello")))
+			return Expect(t, llb.Image("busybox").Run(
+				llb.AddMount(llbutil.StdinPath, stdin, llb.Readonly, llb.SourcePath("stdin"), llb.ForceNoOutput),
+				llb.Args([]string{"/bin/sh", "-c", `exec "$@" <` + llbutil.StdinPath, "sh", "/bin/sh", "-c", "cat"}),
+			).Root())
+		},
+	}, {
+		"run with entrypoint",
+		[]string{"default"},
+		`
+		fs default() {
+			scratch
+			entrypoint "/usr/bin/git"
+			run "status" "--short" with useEntrypoint
+			run "log --oneline" with option {
+				useEntrypoint
+				shlex
+			}
+		}
+		`, "",
+		func(ctx context.Context, t *testing.T) solver.Request {
+			return Expect(t, llb.Scratch().Run(
+				llb.Args([]string{"/usr/bin/git", "status", "--short"}),
+			).Run(
+				llb.Args([]string{"/usr/bin/git", "log", "--oneline"}),
+			).Root())
+		},
+	}, {
+		"localRun env",
+		[]string{"default"},
+		`
+		fs default() {
+			scratch
+			env "GIT_SHA" string {
+				localRun "printf '0123abcd\\r\\n'"
+			}
+			run "env" with shlex
+		}
+		`, "",
+		func(ctx context.Context, t *testing.T) solver.Request {
+			return Expect(t, llb.Scratch().AddEnv("GIT_SHA", "0123abcd").Run(llb.Shlex("env")).Root())
+		},
+	}, {
+		"string manipulation",
+		[]string{"default"},
+		`
+		fs default() {
+			scratch
+			mkfile "/name" 0o644 string {
+				format "  Foo-Bar.tar.gz \n"
+				trimSpace
+				toLower
+				trimSuffix ".tar.gz"
+				replace "-" "_"
+			}
+			mkfile "/version" 0o644 string {
+				format "v1.2.3"
+				trimPrefix "v"
+				toUpper
+			}
+		}
+		`, "",
+		func(ctx context.Context, t *testing.T) solver.Request {
+			return Expect(t, llb.Scratch().
+				File(llb.Mkfile("/name", 0o644, []byte("foo_bar"))).
+				File(llb.Mkfile("/version", 0o644, []byte("1.2.3"))),
+			)
+		},
+	}, {
+		"split args into run",
+		[]string{"default"},
+		`
+		fs default() {
+			image "busybox"
+			run "echo" list { split "" " hello  world\n" }
+			run split(",", "echo,a,b")
+			run ["echo", "${join(",", ["a", "b"])}"]
+			greet ["hello", "world"]
+		}
+
+		fs greet(list words) {
+			run "echo" words
+		}
+		`, "",
+		func(ctx context.Context, t *testing.T) solver.Request {
+			return Expect(t, llb.Image("busybox").Run(
+				llb.Args([]string{"echo", "hello", "world"}),
+			).Run(
+				llb.Args([]string{"echo", "a", "b"}),
+			).Run(
+				llb.Args([]string{"echo", "a,b"}),
+			).Run(
+				llb.Args([]string{"echo", "hello", "world"}),
+			).Root())
+		},
+	}, {
+		"string digest and base64",
+		[]string{"default"},
+		`
+		fs default() {
+			scratch
+			mkfile "/sha256" 0o644 string {
+				format "hello"
+				sha256
+			}
+			mkfile "/encoded" 0o644 string {
+				format "hello"
+				base64encode
+			}
+			mkfile "/decoded" 0o644 string {
+				format "aGVsbG8="
+				base64decode
+			}
+		}
+		`, "",
+		func(ctx context.Context, t *testing.T) solver.Request {
+			return Expect(t, llb.Scratch().
+				File(llb.Mkfile("/sha256", 0o644, []byte("2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"))).
+				File(llb.Mkfile("/encoded", 0o644, []byte("aGVsbG8="))).
+				File(llb.Mkfile("/decoded", 0o644, []byte("hello"))),
+			)
+		},
+	}, {
+		"read local file",
+		[]string{"default"},
+		`
+		fs default() {
+			scratch
+			mkfile "/version" 0o644 string {
+				readFile "testdata/VERSION"
+				trimPrefix "v"
+			}
+		}
+		`, "",
+		func(ctx context.Context, t *testing.T) solver.Request {
+			return Expect(t, llb.Scratch().File(llb.Mkfile("/version", 0o644, []byte("1.2.3"))))
+		},
 	}, {
 		"dockerfile meta",
 		[]string{"default"},
@@ -874,6 +1573,55 @@ func TestCodeGen(t *testing.T) {
 				llb.Dir("/etc"),
 			).Root())
 		},
+	}, {
+		"option block mixing imported, local and inline options",
+		[]string{"default"},
+		`
+		import other from "./other.hlb"
+
+		fs default() {
+			scratch
+			copy scratch "src" "dst" with option {
+				other.foo
+				chown "user"
+				myOpt
+				other.bar
+			}
+		}
+
+		option::copy myOpt() {
+			allowWildcard
+			contentsOnly
+		}
+		`,
+		`
+		export foo
+		export bar
+
+		option::copy foo() {
+			createDestPath
+		}
+
+		option::copy bar() {
+			chmod 0o755
+		}
+		`,
+		func(ctx context.Context, t *testing.T) solver.Request {
+			fileMode := os.FileMode(0o755)
+			scratch := llb.Scratch()
+			return Expect(t, scratch.File(llb.Copy(
+				scratch,
+				"src",
+				"dst",
+				&llb.CopyInfo{
+					Mode:                &fileMode,
+					CreateDestPath:      true,
+					AllowWildcard:       true,
+					CopyDirContentsOnly: true,
+				},
+				llb.WithUser("user"),
+			)))
+		},
 	}, {
 		"merge op",
 		[]string{"default"},
@@ -891,52 +1639,180 @@ func TestCodeGen(t *testing.T) {
 			}))
 		},
 	}, {
-		"diff op",
+		"chmod op",
 		[]string{"default"},
 		`
 		fs default() {
-			image "alpine"
-			diff image("root1")
+			image "busybox"
+			chmod "/bin/app" 0o755
+			chmod "bin/*" 0o700 with allowWildcard
 		}
 		`, "",
 		func(ctx context.Context, t *testing.T) solver.Request {
-			return Expect(t, llb.Diff(llb.Image("root1"), llb.Image("alpine")))
+			exec, private := os.FileMode(0o755), os.FileMode(0o700)
+			st := llb.Image("busybox")
+			st = st.File(llb.Copy(st, "/bin/", "/bin/", &llb.CopyInfo{
+				Mode:                &exec,
+				CopyDirContentsOnly: true,
+				IncludePatterns:     []string{"app"},
+				ExcludePatterns:     []string{"app/*"},
+			}))
+			st = st.File(llb.Copy(st, "bin/", "bin/", &llb.CopyInfo{
+				Mode:                &private,
+				CopyDirContentsOnly: true,
+				IncludePatterns:     []string{"*"},
+				ExcludePatterns:     []string{"*/*"},
+			}))
+			return Expect(t, st)
 		},
 	}, {
-		"multiple platforms",
+		"chmod directory",
 		[]string{"default"},
 		`
 		fs default() {
-			image "alpine" with platform("linux", "amd64")
-			run "echo Amd" with option {
-				shlex
-				mount fs {
-					image "alpine" with platform("linux", "arm64")
-					run "echo Arm" with shlex
-				} "/foobar"
-			}
+			image "busybox"
+			chmod "/usr/local/bin/" 0o700
+			chmod "data[1]" 0o755
 		}
 		`, "",
 		func(ctx context.Context, t *testing.T) solver.Request {
-			st := llb.Image("alpine", llb.Platform(specs.Platform{
-				OS:           "linux",
-				Architecture: "amd64",
+			// Only the directory is changed, so its contents keep the execute
+			// bit of their directories. Paths are matched literally without
+			// wildcards.
+			private, exec := os.FileMode(0o700), os.FileMode(0o755)
+			st := llb.Image("busybox")
+			st = st.File(llb.Copy(st, "/usr/local/", "/usr/local/", &llb.CopyInfo{
+				Mode:                &private,
+				CopyDirContentsOnly: true,
+				IncludePatterns:     []string{"bin"},
+				ExcludePatterns:     []string{"bin/*"},
 			}))
-
-			mnt := llb.Image("alpine", llb.Platform(specs.Platform{
-				OS:           "linux",
-				Architecture: "arm64",
-			})).Run(
-				llb.Shlex("echo Arm"),
-			).Root()
-
-			return Expect(t, st.Run(
-				llb.Shlex("echo Amd"),
-				llb.AddMount("/foobar", mnt),
-			).Root())
+			st = st.File(llb.Copy(st, ".", ".", &llb.CopyInfo{
+				Mode:                &exec,
+				CopyDirContentsOnly: true,
+				IncludePatterns:     []string{`data\[1]`},
+				ExcludePatterns:     []string{`data\[1]/*`},
+			}))
+			return Expect(t, st)
 		},
 	}, {
-		"mount local with bind is copied",
+		"merge op with subpaths",
+		[]string{"default"},
+		`
+		fs default() {
+			scratch
+			merge mergeInput(image("busybox"), "/bin") mergeInput(image("alpine"), "/lib")
+		}
+		`, "",
+		func(ctx context.Context, t *testing.T) solver.Request {
+			subpath := func(input llb.State, path string) llb.State {
+				return llb.Scratch().File(llb.Copy(input, path, path, &llb.CopyInfo{
+					CopyDirContentsOnly: true,
+					CreateDestPath:      true,
+				}))
+			}
+			return Expect(t, llb.Merge([]llb.State{
+				llb.Scratch(),
+				subpath(llb.Image("busybox"), "/bin"),
+				subpath(llb.Image("alpine"), "/lib"),
+			}))
+		},
+	}, {
+		"diff op",
+		[]string{"default"},
+		`
+		fs default() {
+			image "alpine"
+			diff image("root1")
+		}
+		`, "",
+		func(ctx context.Context, t *testing.T) solver.Request {
+			return Expect(t, llb.Diff(llb.Image("root1"), llb.Image("alpine")))
+		},
+	}, {
+		"archive op",
+		[]string{"default"},
+		`
+		fs default() {
+			image "alpine"
+			archive image("golang") "/go/src" "/vendor.tar"
+			archive image("golang") "/go/bin/app" "/app.tgz" with gzip
+		}
+		`, "",
+		func(ctx context.Context, t *testing.T) solver.Request {
+			archive := func(src, target, flags string) llb.State {
+				script := `if [ -d "$1" ]; then tar "$2" /out/archive.tar -C "$1" .; else tar "$2" /out/archive.tar -C "$(dirname "$1")" "$(basename "$1")"; fi`
+				exec := llb.Image("docker.io/library/busybox:1.36").Run(
+					llb.Args([]string{"/bin/sh", "-c", script, "archive", target, flags}),
+					llb.AddMount(target, llb.Image("golang"), llb.SourcePath(src), llb.Readonly),
+				)
+				return exec.AddMount("/out", llb.Scratch())
+			}
+			st := llb.Image("alpine")
+			st = st.File(llb.Copy(archive("/go/src", "/in/src", "-cf"), "/archive.tar", "/vendor.tar"))
+			st = st.File(llb.Copy(archive("/go/bin/app", "/in/app", "-czf"), "/archive.tar", "/app.tgz"))
+			return Expect(t, st)
+		},
+	}, {
+		"multiple platforms",
+		[]string{"default"},
+		`
+		fs default() {
+			image "alpine" with platform("linux", "amd64")
+			run "echo Amd" with option {
+				shlex
+				mount fs {
+					image "alpine" with platform("linux", "arm64")
+					run "echo Arm" with shlex
+				} "/foobar"
+			}
+		}
+		`, "",
+		func(ctx context.Context, t *testing.T) solver.Request {
+			st := llb.Image("alpine", llb.Platform(specs.Platform{
+				OS:           "linux",
+				Architecture: "amd64",
+			}))
+
+			mnt := llb.Image("alpine", llb.Platform(specs.Platform{
+				OS:           "linux",
+				Architecture: "arm64",
+			})).Run(
+				llb.Shlex("echo Arm"),
+			).Root()
+
+			return Expect(t, st.Run(
+				llb.Shlex("echo Amd"),
+				llb.AddMount("/foobar", mnt),
+			).Root())
+		},
+	}, {
+		"mountFiles is readonly without output",
+		[]string{"default"},
+		`
+		fs default() {
+			image "busybox"
+			run "cat /cfg/app.conf" with option {
+				shlex
+				mountFiles fs {
+					mkfile "app.conf" 0o644 "key=value"
+				} "/cfg"
+			}
+		}
+		`, "",
+		func(ctx context.Context, t *testing.T) solver.Request {
+			return Expect(t, llb.Image("busybox").Run(
+				llb.Shlex("cat /cfg/app.conf"),
+				llb.AddMount(
+					"/cfg",
+					llb.Scratch().File(llb.Mkfile("app.conf", 0o644, []byte("key=value"))),
+					llb.Readonly,
+					llb.ForceNoOutput,
+				),
+			).Root())
+		},
+	}, {
+		"mount local with bind is copied",
 		[]string{"default"},
 		`
 		fs _default() {
@@ -955,16 +1831,91 @@ func TestCodeGen(t *testing.T) {
 				),
 			).Root())
 		},
+	}, {
+		"run with timeout",
+		[]string{"default"},
+		`
+		fs default() {
+			image "busybox"
+			run "sleep 60" with option {
+				timeout "1m30s"
+			}
+		}
+		`, "",
+		func(ctx context.Context, t *testing.T) solver.Request {
+			return Expect(t, llb.Image("busybox").Run(
+				llb.Args([]string{"/bin/sh", "-c", "sleep 60"}),
+			).Root(), solver.WithTimeout(90*time.Second))
+		},
+	}, {
+		"dockerPush with registry cache ref",
+		[]string{"default"},
+		`
+		fs default() {
+			image "alpine"
+			dockerPush "openllb/hlb" with option {
+				cacheImport "docker.io/openllb/hlb:buildcache"
+				cacheExport "docker.io/openllb/hlb:buildcache"
+			}
+		}
+		`, "",
+		func(ctx context.Context, t *testing.T) solver.Request {
+			// A spec with only a ref is a registry cache.
+			cache := client.CacheOptionsEntry{
+				Type:  "registry",
+				Attrs: map[string]string{"ref": "docker.io/openllb/hlb:buildcache"},
+			}
+			return solver.Parallel(
+				Expect(t, llb.Image("alpine")),
+				Expect(t, llb.Image("alpine"),
+					solver.WithImageSpec(linuxAmd64Image()),
+					solver.WithPushImage("docker.io/openllb/hlb:latest"),
+					solver.WithCacheImport(cache),
+					solver.WithCacheExport(cache),
+				),
+			)
+		},
+	}, {
+		"dockerPush with cache spec",
+		[]string{"default"},
+		`
+		fs default() {
+			image "alpine"
+			dockerPush "openllb/hlb" with option {
+				cacheImport "type=registry,ref=docker.io/openllb/hlb:buildcache"
+				cacheExport "type=registry,ref=docker.io/openllb/hlb:buildcache,mode=max"
+			}
+		}
+		`, "",
+		func(ctx context.Context, t *testing.T) solver.Request {
+			return solver.Parallel(
+				Expect(t, llb.Image("alpine")),
+				Expect(t, llb.Image("alpine"),
+					solver.WithImageSpec(linuxAmd64Image()),
+					solver.WithPushImage("docker.io/openllb/hlb:latest"),
+					solver.WithCacheImport(client.CacheOptionsEntry{
+						Type:  "registry",
+						Attrs: map[string]string{"ref": "docker.io/openllb/hlb:buildcache"},
+					}),
+					solver.WithCacheExport(client.CacheOptionsEntry{
+						Type:  "registry",
+						Attrs: map[string]string{"ref": "docker.io/openllb/hlb:buildcache", "mode": "max"},
+					}),
+				),
+			)
+		},
 	}} {
 		tc := tc
 		t.Run(tc.name, func(t *testing.T) {
 			ctx := filebuffer.WithBuffers(context.Background(), builtin.Buffers())
 			ctx = ast.WithModules(ctx, builtin.Modules())
 			// make tests consistent even if running on non amd64 platform
-			ctx = codegen.WithDefaultPlatform(ctx, specs.Platform{
+			platform := specs.Platform{
 				OS:           "linux",
 				Architecture: "amd64",
-			})
+			}
+			ctx = codegen.WithDefaultPlatform(ctx, platform)
+			ctx = codegen.WithFrontendSolver(ctx, testFrontendSolver{})
 
 			mod, err := parser.Parse(ctx, strings.NewReader(dedent.Dedent(tc.hlb)))
 			require.NoError(t, err, tc.name)
@@ -972,7 +1923,7 @@ func TestCodeGen(t *testing.T) {
 			err = checker.SemanticPass(mod)
 			require.NoError(t, err, tc.name)
 
-			err = checker.Check(mod)
+			err = checker.Check(mod, checker.WithExperimental())
 			require.NoError(t, err, tc.name)
 
 			if tc.hlbImport != "" {
@@ -996,94 +1947,1490 @@ func TestCodeGen(t *testing.T) {
 				require.NoError(t, err, tc.name)
 			}
 
+			// Targets generated for a platform push their images in the
+			// request instead of solving them during codegen.
 			var targets []codegen.Target
 			for _, target := range tc.targets {
-				targets = append(targets, codegen.Target{Name: target})
+				targets = append(targets, codegen.Target{Name: target, Platform: &platform})
+			}
+
+			cg := codegen.New(nil, nil)
+			request, err := cg.Generate(ctx, mod, targets)
+			require.NoError(t, err, tc.name)
+
+			testRequest := tc.fn(ctx, t)
+
+			expected := treeprint.New()
+			err = testRequest.Tree(expected)
+			require.NoError(t, err, tc.name)
+			t.Logf("expected: %s", expected)
+
+			actual := treeprint.New()
+			err = request.Tree(actual)
+			require.NoError(t, err, tc.name)
+			t.Logf("actual: %s", actual)
+
+			// Compare trees.
+			require.Equal(t, expected.String(), actual.String(), tc.name)
+		})
+	}
+}
+
+func TestCodegenError(t *testing.T) {
+	t.Parallel()
+
+	type testCase struct {
+		name    string
+		targets []string
+		input   string
+		fn      func(*ast.Module) error
+	}
+
+	for _, tc := range []testCase{
+		{
+			"invalid downloadDockerTarball ref",
+			[]string{"default"},
+			`
+			fs default() {
+				downloadDockerTarball "image.tar" "#"
+			}
+			`,
+			func(mod *ast.Module) error {
+				return errdefs.WithInvalidImageRef(
+					errors.New("invalid reference format"),
+					ast.Search(mod, `"#"`),
+					"#",
+				)
+			},
+		},
+		{
+			"archive from scratch",
+			[]string{"default"},
+			`
+			fs default() {
+				image "alpine"
+				archive scratch "/src" "/src.tar"
+			}
+			`,
+			func(mod *ast.Module) error {
+				return ast.Search(mod, `scratch`).WithError(
+					errors.New(`cannot archive "/src" from a scratch filesystem`),
+				)
+			},
+		},
+		{
+			"named network mode",
+			[]string{"default"},
+			`
+			fs default() {
+				image "busybox"
+				run "true" with option {
+					network "mynet"
+				}
+			}
+			`,
+			func(mod *ast.Module) error {
+				return errdefs.WithUnsupportedNetworkMode(
+					ast.Search(mod, `"mynet"`),
+					"mynet",
+					codegen.NetworkModes,
+				)
+			},
+		},
+		{
+			"misspelled ulimit",
+			[]string{"default"},
+			`
+			fs default() {
+				image "busybox"
+				run "true" with option {
+					ulimit "nofiles" 1024 2048
+				}
+			}
+			`,
+			func(mod *ast.Module) error {
+				return errdefs.WithInvalidUlimit(
+					ast.Search(mod, `"nofiles"`),
+					"nofiles",
+					codegen.UlimitNames,
+				)
+			},
+		},
+		{
+			"ulimit soft limit exceeds hard limit",
+			[]string{"default"},
+			`
+			fs default() {
+				image "busybox"
+				run "true" with option {
+					ulimit "nofile" 4096 2048
+				}
+			}
+			`,
+			func(mod *ast.Module) error {
+				return errdefs.WithUlimitExceedsHard(ast.Search(mod, "4096"), 4096, 2048)
+			},
+		},
+		{
+			"misspelled network mode",
+			[]string{"default"},
+			`
+			fs default() {
+				image "busybox"
+				run "true" with option {
+					network "hots"
+				}
+			}
+			`,
+			func(mod *ast.Module) error {
+				return errdefs.WithInvalidNetworkMode(
+					ast.Search(mod, `"hots"`),
+					"hots",
+					codegen.NetworkModes,
+				)
+			},
+		},
+		{
+			"expose port zero",
+			[]string{"default"},
+			`
+			fs default() {
+				scratch
+				expose "0"
+			}
+			`,
+			func(mod *ast.Module) error {
+				return errdefs.WithInvalidPortSpec(ast.Search(mod, `"0"`), "0")
+			},
+		},
+		{
+			"expose unsupported protocol",
+			[]string{"default"},
+			`
+			fs default() {
+				scratch
+				expose "80" "80/icmp"
 			}
+			`,
+			func(mod *ast.Module) error {
+				return errdefs.WithInvalidPortSpec(ast.Search(mod, `"80/icmp"`), "80/icmp")
+			},
+		},
+		{
+			"expose descending range",
+			[]string{"default"},
+			`
+			fs default() {
+				scratch
+				expose "9000-8000"
+			}
+			`,
+			func(mod *ast.Module) error {
+				return errdefs.WithInvalidPortSpec(ast.Search(mod, `"9000-8000"`), "9000-8000")
+			},
+		},
+		{
+			"failed localRun",
+			[]string{"default"},
+			`
+			fs default() {
+				scratch
+				env "GIT_SHA" string {
+					localRun "echo not a git repository >&2; exit 128"
+				}
+			}
+			`,
+			func(mod *ast.Module) error {
+				return errdefs.WithLocalRunFailed(
+					errors.New("exit status 128"),
+					ast.Search(mod, "localRun"),
+					"echo not a git repository >&2; exit 128",
+					"not a git repository\n",
+				)
+			},
+		},
+		{
+			"invalid base64",
+			[]string{"default"},
+			`
+			fs default() {
+				scratch
+				mkfile "/decoded" 0o644 string {
+					format "not base64!"
+					base64decode
+				}
+			}
+			`,
+			func(mod *ast.Module) error {
+				return errdefs.WithInvalidBase64(
+					base64.CorruptInputError(3),
+					ast.Search(mod, "base64decode"),
+				)
+			},
+		},
+		{
+			"copy platform mismatch",
+			[]string{"default"},
+			`
+			fs default() {
+				image "busybox" with option {
+					platform "linux" "amd64"
+				}
+				copy scratch "/app" "/usr/bin/app" with option {
+					platform "linux" "arm64"
+				}
+			}
+			`,
+			func(mod *ast.Module) error {
+				return errdefs.WithCopyPlatformMismatch(
+					ast.Search(mod, "platform", ast.WithSkip(1)),
+					"linux/arm64",
+					"linux/amd64",
+				)
+			},
+		},
+		{
+			"copy platform variant mismatch",
+			[]string{"default"},
+			`
+			fs default() {
+				image "busybox" with option {
+					platform "linux" "arm"
+				}
+				copy scratch "/app" "/usr/bin/app" with option {
+					platform "linux" "arm/v6"
+				}
+			}
+			`,
+			func(mod *ast.Module) error {
+				return errdefs.WithCopyPlatformMismatch(
+					ast.Search(mod, "platform", ast.WithSkip(1)),
+					"linux/arm/v6",
+					"linux/arm/v7",
+				)
+			},
+		},
+		{
+			"unsupported cache type",
+			[]string{"default"},
+			`
+			fs default() {
+				image "busybox"
+				dockerPush "openllb/hlb" with option {
+					cacheExport "type=local,dest=cache"
+				}
+			}
+			`,
+			func(mod *ast.Module) error {
+				return errdefs.WithInvalidCacheType(
+					ast.Search(mod, `"type=local,dest=cache"`),
+					"local",
+					[]string{"registry", "inline", "gha", "s3", "azblob"},
+				)
+			},
+		},
+		{
+			"inline cache import",
+			[]string{"default"},
+			`
+			fs default() {
+				image "busybox"
+				dockerPush "openllb/hlb" with option {
+					cacheImport "type=inline"
+				}
+			}
+			`,
+			func(mod *ast.Module) error {
+				return errdefs.WithInvalidCacheType(
+					ast.Search(mod, `"type=inline"`),
+					"inline",
+					[]string{"registry", "gha", "s3", "azblob"},
+				)
+			},
+		},
+		{
+			"malformed cache spec",
+			[]string{"default"},
+			`
+			fs default() {
+				image "busybox"
+				dockerPush "openllb/hlb" with option {
+					cacheExport "type=registry,ref"
+				}
+			}
+			`,
+			func(mod *ast.Module) error {
+				return errdefs.WithInvalidCacheSpec(
+					ast.Search(mod, `"type=registry,ref"`),
+					"type=registry,ref",
+					"expected `ref` to be a key=value pair",
+				)
+			},
+		},
+		{
+			"invalid cacheDir sharing mode",
+			[]string{"default"},
+			`
+			fs default() {
+				image "busybox"
+				run "true" with option {
+					cacheDir "cache" "/cache" "shard"
+				}
+			}
+			`,
+			func(mod *ast.Module) error {
+				return errdefs.WithInvalidSharingMode(
+					ast.Search(mod, `"shard"`),
+					"shard",
+					[]string{"shared", "private", "locked"},
+				)
+			},
+		},
+		{
+			"invalid healthcheck duration",
+			[]string{"default"},
+			`
+			fs default() {
+				image "busybox"
+				healthcheck "true" with option {
+					interval "30"
+				}
+			}
+			`,
+			func(mod *ast.Module) error {
+				return errdefs.WithInvalidDuration(
+					ast.Search(mod, `"30"`),
+					"30",
+				)
+			},
+		},
+		{
+			"invalid run timeout",
+			[]string{"default"},
+			`
+			fs default() {
+				image "busybox"
+				run "sleep 60" with option {
+					timeout "0s"
+				}
+			}
+			`,
+			func(mod *ast.Module) error {
+				return errdefs.WithInvalidDuration(
+					ast.Search(mod, `"0s"`),
+					"0s",
+				)
+			},
+		},
+		{
+			"negative run timeout",
+			[]string{"default"},
+			`
+			fs default() {
+				image "busybox"
+				run "sleep 60" with option {
+					timeout "-1s"
+				}
+			}
+			`,
+			func(mod *ast.Module) error {
+				return errdefs.WithInvalidDuration(
+					ast.Search(mod, `"-1s"`),
+					"-1s",
+				)
+			},
+		},
+		{
+			"malformed run timeout",
+			[]string{"default"},
+			`
+			fs default() {
+				image "busybox"
+				run "sleep 60" with option {
+					timeout "abc"
+				}
+			}
+			`,
+			func(mod *ast.Module) error {
+				return errdefs.WithInvalidDuration(
+					ast.Search(mod, `"abc"`),
+					"abc",
+				)
+			},
+		},
+		{
+			"invalid authFrom source",
+			[]string{"default"},
+			`
+			fs default() {
+				image "busybox" with option {
+					authFrom "pass"
+				}
+			}
+			`,
+			func(mod *ast.Module) error {
+				return errdefs.WithInvalidAuthSource(ast.Search(mod, `"pass"`), "pass")
+			},
+		},
+		{
+			"missing readFile",
+			[]string{"default"},
+			`
+			fs default() {
+				scratch
+				mkfile "/version" 0o644 string {
+					readFile "testdata/MISSING"
+				}
+			}
+			`,
+			func(mod *ast.Module) error {
+				return ast.Search(mod, `"testdata/MISSING"`).WithError(&fs.PathError{
+					Op:   "open",
+					Path: "testdata/MISSING",
+					Err:  syscall.ENOENT,
+				})
+			},
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := filebuffer.WithBuffers(context.Background(), builtin.Buffers())
+			ctx = ast.WithModules(ctx, builtin.Modules())
+
+			mod, err := parser.Parse(ctx, strings.NewReader(tc.input))
+			require.NoError(t, err, "unexpected parse error")
+
+			err = checker.SemanticPass(mod)
+			require.NoError(t, err, tc.name)
+
+			err = checker.Check(mod)
+			require.NoError(t, err, tc.name)
+
+			var targets []codegen.Target
+			for _, target := range tc.targets {
+				targets = append(targets, codegen.Target{Name: target})
+			}
+
+			cg := codegen.New(nil, nil)
+			_, err = cg.Generate(ctx, mod, targets)
+			var expected error
+			if tc.fn != nil {
+				expected = tc.fn(mod)
+			}
+			validateError(t, ctx, expected, err, tc.name)
+		})
+	}
+}
+
+type panicBuiltin struct{}
+
+func (p panicBuiltin) Call(ctx context.Context, cln *client.Client, val codegen.Value, opts codegen.Option) (codegen.Value, error) {
+	var fs *codegen.Filesystem
+	return codegen.NewValue(ctx, fs.State)
+}
+
+func init() {
+	codegen.Callables[ast.Kind("test")] = map[string]interface{}{
+		"panic": panicBuiltin{},
+	}
+}
+
+func TestCodeGenPanic(t *testing.T) {
+	t.Parallel()
+
+	ctx := filebuffer.WithBuffers(context.Background(), builtin.Buffers())
+	ctx = ast.WithModules(ctx, builtin.Modules())
+
+	mod, err := parser.Parse(ctx, strings.NewReader(cleanup(`
+	fs default() {
+		scratch
+	}
+	`)))
+	require.NoError(t, err)
+
+	call := ast.Search(mod, "scratch")
+	ctx = codegen.WithProgramCounter(ctx, call)
+
+	bd := &ast.BuiltinDecl{Name: "panic", Kinds: []ast.Kind{"test"}}
+	cg := codegen.New(nil, nil)
+	_, err = cg.EmitBuiltinDecl(ctx, mod.Scope, bd, nil, nil, nil, codegen.ZeroValue(ctx))
+	validateError(t, ctx, errdefs.WithInternalErrorf(
+		call,
+		"`panic` panicked: %v",
+		"runtime error: invalid memory address or nil pointer dereference",
+	), err, "panic")
+}
+
+func TestCodeGenUndefinedTarget(t *testing.T) {
+	t.Parallel()
+
+	ctx := filebuffer.WithBuffers(context.Background(), builtin.Buffers())
+	ctx = ast.WithModules(ctx, builtin.Modules())
+
+	mod, err := parser.Parse(ctx, &parser.NamedReader{
+		Reader: strings.NewReader(cleanup(`
+		fs build() {
+			scratch
+		}
+
+		fs test() {
+			scratch
+		}
+
+		option::run opts() {
+			shlex
+		}
+		`)),
+		Value: "build.hlb",
+	})
+	require.NoError(t, err)
+
+	err = checker.SemanticPass(mod)
+	require.NoError(t, err)
+
+	err = checker.Check(mod)
+	require.NoError(t, err)
+
+	cg := codegen.New(nil, nil)
+	_, err = cg.Generate(ctx, mod, []codegen.Target{{Name: "test"}, {Name: "biuld"}})
+	require.EqualError(t, err, strings.Join([]string{
+		"target `biuld` is not defined in build.hlb",
+		"did you mean `build`?",
+		"available targets: build, test",
+	}, "\n"))
+}
+
+type testFile struct {
+	filename string
+	content  string
+}
+
+func TestExportedTargets(t *testing.T) {
+	t.Parallel()
+
+	ctx := ast.WithModules(context.Background(), builtin.Modules())
+	mod, err := parser.Parse(ctx, strings.NewReader(dedent.Dedent(`
+	export build
+	export test
+	export version
+	export withArgs
+
+	fs default() {
+		build
+	}
+
+	fs build() {
+		image "golang"
+	}
+
+	pipeline test() {
+		stage build
+	}
+
+	string version() {
+		value "v1.0.0"
+	}
+
+	fs withArgs(string ref) {
+		image ref
+	}
+
+	fs helper() {
+		scratch
+	}
+	`)))
+	require.NoError(t, err)
+
+	require.Equal(t, []string{"build", "default", "test"}, codegen.ExportedTargets(mod))
+}
+
+func TestAnnotationExports(t *testing.T) {
+	t.Parallel()
+
+	image := GenerateImage(context.Background(), t, `
+	fs default() {
+		scratch
+		label "maintainer" "hlb"
+		annotation "org.opencontainers.image.title" "hlb"
+	}
+	`)
+	require.Equal(t, map[string]string{"maintainer": "hlb"}, image.Config.Labels)
+
+	// Annotations are applied by the exporters of pushed images and OCI
+	// tarballs instead of being part of the image config.
+	info := &solver.SolveInfo{}
+	for _, opt := range []solver.SolveOption{
+		solver.WithImageSpec(image),
+		solver.WithPushImage("docker.io/openllb/hlb"),
+		solver.WithDownloadOCITarball(),
+	} {
+		require.NoError(t, opt(info))
+	}
+	require.Equal(t, []client.ExportEntry{{
+		Type: client.ExporterImage,
+		Attrs: map[string]string{
+			"name": "docker.io/openllb/hlb",
+			"push": "true",
+			"annotation.org.opencontainers.image.title": "hlb",
+		},
+	}, {
+		Type: client.ExporterOCI,
+		Attrs: map[string]string{
+			"annotation.org.opencontainers.image.title": "hlb",
+		},
+	}}, info.ExportEntries())
+}
+
+func TestCodeGenEntitlements(t *testing.T) {
+	t.Parallel()
+
+	type testCase struct {
+		name    string
+		allowed []entitlements.Entitlement
+		fn      func(*ast.Module) error
+	}
+
+	for _, tc := range []testCase{{
+		"insecure allowed",
+		[]entitlements.Entitlement{entitlements.EntitlementSecurityInsecure},
+		nil,
+	}, {
+		"insecure not allowed",
+		[]entitlements.Entitlement{entitlements.EntitlementNetworkHost},
+		func(mod *ast.Module) error {
+			return errdefs.WithEntitlementNotAllowed(
+				ast.Search(mod, `"insecure"`),
+				entitlements.EntitlementSecurityInsecure,
+			)
+		},
+	}} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, mod := ParseModule(codegen.WithAllowedEntitlements(context.Background(), tc.allowed...), t, `
+			fs default() {
+				image "busybox"
+				run "echo insecure" with option {
+					security "insecure"
+				}
+			}
+			`)
+
+			cg := codegen.New(nil, nil)
+			_, err := cg.Generate(ctx, mod, []codegen.Target{{Name: "default"}})
+			var expected error
+			if tc.fn != nil {
+				expected = tc.fn(mod)
+			}
+			validateError(t, ctx, expected, err, tc.name)
+		})
+	}
+}
+
+// testFrontendSolver solves every frontend to an empty filesystem with an
+// image config that has an entrypoint and labels.
+type testFrontendSolver struct{}
+
+func (testFrontendSolver) SolveFrontend(ctx context.Context, req gateway.SolveRequest, opts codegen.Option) (codegen.Filesystem, error) {
+	image := &solver.ImageSpec{}
+	image.Config.Entrypoint = []string{"/app", "--serve"}
+	image.Config.Labels = map[string]string{"maintainer": "openllb"}
+	return codegen.Filesystem{State: llb.Scratch(), Image: image}, nil
+}
+
+type testImageResolver struct {
+	configs     map[string][]byte
+	modes       []string
+	sessionOpts []llbutil.SessionOption
+}
+
+func (r *testImageResolver) ResolveImageConfig(ctx context.Context, ref string, opt sourceresolver.Opt) (string, digest.Digest, []byte, error) {
+	r.modes = append(r.modes, opt.ImageOpt.ResolveMode)
+	r.sessionOpts = append(r.sessionOpts, codegen.AuthSourceOpts(ctx)...)
+	config, ok := r.configs[ref]
+	if !ok {
+		return "", "", nil, fmt.Errorf("%s: not found", ref)
+	}
+	return ref, digest.FromBytes(config), config, nil
+}
+
+func TestStdinFileModuleDir(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "input.txt"), []byte("hello"), 0o644)
+	require.NoError(t, err)
+
+	ctx, mod := ParseModule(context.Background(), t, `
+	fs default() {
+		image "busybox"
+		run "cat" with option {
+			stdinFile "input.txt"
+		}
+	}
+	`)
+
+	// The file is read from the module directory rather than the working
+	// directory of the process.
+	mod.Directory = parser.NewLocalDirectory(dir, "")
+
+	request, err := codegen.New(nil, nil).Generate(ctx, mod, []codegen.Target{{Name: "default"}})
+	require.NoError(t, err)
+
+	actual := treeprint.New()
+	err = request.Tree(actual)
+	require.NoError(t, err)
+
+	stdin := llb.Scratch().File(llb.Mkfile("stdin", 0o444, []byte("hello")))
+	expected := treeprint.New()
+	err = Expect(t, llb.Image("busybox").Run(
+		llb.AddMount(llbutil.StdinPath, stdin, llb.Readonly, llb.SourcePath("stdin"), llb.ForceNoOutput),
+		llb.Args([]string{"/bin/sh", "-c", `exec "$@" <` + llbutil.StdinPath, "sh", "/bin/sh", "-c", "cat"}),
+	).Root()).Tree(expected)
+	require.NoError(t, err)
+	require.Equal(t, expected.String(), actual.String())
+}
+
+func TestImagePreferLocal(t *testing.T) {
+	t.Parallel()
+
+	ref := "docker.io/library/busybox:latest"
+	resolver := &testImageResolver{configs: map[string][]byte{
+		ref: []byte(`{"config":{"Env":["PATH=/bin"]}}`),
+	}}
+
+	ctx, mod := ParseModule(codegen.WithImageResolver(context.Background(), resolver), t, `
+	fs default() {
+		image "busybox"
+	}
+	`)
+
+	// Images are always pulled unless the local cache is preferred, in which
+	// case missing images are still pulled by BuildKit.
+	cg := codegen.New(nil, nil)
+	_, err := cg.Generate(ctx, mod, []codegen.Target{{Name: "default"}})
+	require.NoError(t, err)
+
+	_, err = cg.Generate(codegen.WithPreferLocal(ctx, true), mod, []codegen.Target{{Name: "default"}})
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		llb.ResolveModeForcePull.String(),
+		llb.ResolveModePreferLocal.String(),
+	}, resolver.modes)
+}
+
+func TestImageNoResolve(t *testing.T) {
+	t.Parallel()
+
+	resolver := &testImageResolver{configs: map[string][]byte{
+		"docker.io/library/busybox:latest": []byte(`{"config":{"Env":["PATH=/bin"]}}`),
+	}}
+
+	ctx := codegen.WithImageResolver(context.Background(), resolver)
+	image := GenerateImage(ctx, t, `
+	fs default() {
+		image "busybox" with noResolve
+	}
+	`)
+	require.Empty(t, resolver.modes)
+	require.Equal(t, &solver.ImageSpec{}, image)
+}
+
+func TestImageBaseAnnotations(t *testing.T) {
+	t.Parallel()
+
+	ref := "docker.io/library/busybox:latest"
+	config := []byte(`{"config":{"Env":["PATH=/bin"]}}`)
+	resolver := &testImageResolver{configs: map[string][]byte{ref: config}}
+
+	ctx, mod := ParseModule(codegen.WithImageResolver(context.Background(), resolver), t, `
+	fs base() {
+		image "busybox"
+	}
+
+	fs default() {
+		base
+		annotation "org.opencontainers.image.title" "app"
+	}
+	`)
+
+	cg := codegen.New(nil, nil)
+	image, err := cg.GenerateImage(ctx, mod, codegen.Target{Name: "default"})
+	require.NoError(t, err)
+
+	dgst := digest.FromBytes(config)
+	require.Equal(t, "docker.io/library/busybox@"+dgst.String(), image.Canonical.String())
+	require.Equal(t, map[string]string{
+		specs.AnnotationBaseImageName:    ref,
+		specs.AnnotationBaseImageDigest:  dgst.String(),
+		"org.opencontainers.image.title": "app",
+	}, image.Annotations)
+
+	// Annotating a later value doesn't change the resolved image.
+	image, err = cg.GenerateImage(ctx, mod, codegen.Target{Name: "base"})
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{
+		specs.AnnotationBaseImageName:   ref,
+		specs.AnnotationBaseImageDigest: dgst.String(),
+	}, image.Annotations)
+}
+
+func TestImageAuthFrom(t *testing.T) {
+	t.Parallel()
+
+	token := filepath.Join(t.TempDir(), "token")
+	err := os.WriteFile(token, []byte("s3cr3t\n"), 0o600)
+	require.NoError(t, err)
+
+	config := []byte(`{"config":{"Env":["PATH=/bin"]}}`)
+	for _, tc := range []struct {
+		name     string
+		ref      string
+		source   string
+		expected llbutil.AuthSource
+	}{{
+		"credential helper",
+		"registry.local/app",
+		"helper:pass",
+		llbutil.AuthSource{Host: "registry.local", Helper: "pass"},
+	}, {
+		"token for docker hub",
+		"busybox",
+		"token:" + token,
+		llbutil.AuthSource{Host: "registry-1.docker.io", Token: "s3cr3t"},
+	}} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			named, err := reference.ParseNormalizedNamed(tc.ref)
+			require.NoError(t, err)
+			resolver := &testImageResolver{configs: map[string][]byte{
+				reference.TagNameOnly(named).String(): config,
+			}}
+
+			ctx, mod := ParseModule(codegen.WithImageResolver(context.Background(), resolver), t, fmt.Sprintf(`
+			fs default() {
+				image %q with option {
+					authFrom %q
+				}
+			}
+			`, tc.ref, tc.source))
+
+			cg := codegen.New(nil, nil)
+			_, err = cg.Generate(ctx, mod, []codegen.Target{{Name: "default"}})
+			require.NoError(t, err)
+
+			si := &llbutil.SessionInfo{AuthSourceByHost: make(map[string]llbutil.AuthSource)}
+			for _, opt := range resolver.sessionOpts {
+				opt(si)
+			}
+			require.Equal(t, map[string]llbutil.AuthSource{
+				tc.expected.Host: tc.expected,
+			}, si.AuthSourceByHost)
+		})
+	}
+}
+
+// barrierImageResolver only resolves images once n resolves are in progress,
+// so it fails unless the images are resolved concurrently.
+type barrierImageResolver struct {
+	n       int
+	mu      sync.Mutex
+	waiting int
+	ready   chan struct{}
+}
+
+func newBarrierImageResolver(n int) *barrierImageResolver {
+	return &barrierImageResolver{n: n, ready: make(chan struct{})}
+}
+
+func (r *barrierImageResolver) ResolveImageConfig(ctx context.Context, ref string, opt sourceresolver.Opt) (string, digest.Digest, []byte, error) {
+	r.mu.Lock()
+	r.waiting++
+	if r.waiting == r.n {
+		close(r.ready)
+	}
+	r.mu.Unlock()
+
+	select {
+	case <-r.ready:
+	case <-time.After(5 * time.Second):
+		return "", "", nil, fmt.Errorf("%s: resolved sequentially", ref)
+	}
+
+	config := []byte(`{"config":{"Env":["PATH=/bin"]}}`)
+	return ref, digest.FromBytes(config), config, nil
+}
+
+func TestCopyResolvesInputsConcurrently(t *testing.T) {
+	t.Parallel()
+
+	ctx := codegen.WithImageResolver(context.Background(), newBarrierImageResolver(3))
+	image := GenerateImage(ctx, t, `
+	fs default() {
+		scratch
+		copy fs { image "alpine"; } "/etc" "/alpine"
+		copy fs { image "busybox"; } "/bin" "/busybox"
+		copy fs { image "debian"; } "/etc" "/debian"
+	}
+	`)
+
+	// The copies are still applied in order.
+	require.Len(t, image.History, 3)
+	for i, dest := range []string{"/alpine", "/busybox", "/debian"} {
+		require.True(t, strings.HasSuffix(image.History[i].CreatedBy, " "+dest))
+	}
+}
+
+// platformImageResolver resolves a manifest list with a variant per
+// architecture.
+type platformImageResolver struct {
+	configs map[string][]byte
+}
+
+func (r *platformImageResolver) ResolveImageConfig(ctx context.Context, ref string, opt sourceresolver.Opt) (string, digest.Digest, []byte, error) {
+	config, ok := r.configs[opt.Platform.Architecture]
+	if !ok {
+		return "", "", nil, fmt.Errorf("%s: no variant for %s", ref, platforms.Format(*opt.Platform))
+	}
+	return ref, digest.FromBytes(config), config, nil
+}
+
+func TestImagePlatforms(t *testing.T) {
+	t.Parallel()
+
+	resolver := &platformImageResolver{configs: map[string][]byte{
+		"amd64": []byte(`{"architecture":"amd64","os":"linux","config":{"Env":["ARCH=amd64"]}}`),
+		"arm64": []byte(`{"architecture":"arm64","os":"linux","config":{"Env":["ARCH=arm64"]}}`),
+	}}
+
+	ctx, mod := ParseModule(codegen.WithImageResolver(context.Background(), resolver), t, `
+	fs default() {
+		image "busybox"
+		run "uname -m"
+	}
+	`)
+
+	amd64 := specs.Platform{OS: "linux", Architecture: "amd64"}
+	arm64 := specs.Platform{OS: "linux", Architecture: "arm64"}
+	targets := []codegen.Target{
+		{Name: "default", Platform: &amd64},
+		{Name: "default", Platform: &arm64},
+	}
+
+	cg := codegen.New(nil, nil)
+	for _, target := range targets {
+		image, err := cg.GenerateImage(ctx, mod, target)
+		require.NoError(t, err)
+		require.Equal(t, target.Platform.Architecture, image.Architecture)
+		require.Equal(t, []string{"ARCH=" + target.Platform.Architecture}, image.Config.Env)
+	}
+
+	request, err := cg.Generate(ctx, mod, targets)
+	require.NoError(t, err)
+
+	var expected []solver.Request
+	for _, platform := range []specs.Platform{amd64, arm64} {
+		st := llb.Image("docker.io/library/busybox:latest", llb.Platform(platform)).
+			AddEnv("ARCH", platform.Architecture).
+			Run(llb.Shlex("/bin/sh -c 'uname -m'")).Root()
+		def, err := st.Marshal(ctx, llb.Platform(platform))
+		require.NoError(t, err)
+		expected = append(expected, solver.Single(&solver.Params{Def: def}))
+	}
+
+	expectedTree, actualTree := treeprint.New(), treeprint.New()
+	require.NoError(t, solver.Parallel(expected...).Tree(expectedTree))
+	require.NoError(t, request.Tree(actualTree))
+	require.Equal(t, expectedTree.String(), actualTree.String())
+}
+
+func TestImageOverrides(t *testing.T) {
+	t.Parallel()
+
+	ctx := codegen.WithImageOverrides(context.Background(), codegen.ImageOverrides{
+		Labels: map[string]string{
+			"org.opencontainers.image.revision": "abc123",
+			"maintainer":                        "ci",
+		},
+		Env: map[string]string{
+			"VERSION": "1.2.3",
+		},
+	})
+
+	image := GenerateImage(ctx, t, `
+	fs default() {
+		scratch
+		env "PATH" "/bin"
+		env "VERSION" "dev"
+		label "maintainer" "openllb"
+	}
+	`)
+	require.Equal(t, []string{"PATH=/bin", "VERSION=1.2.3"}, image.Config.Env)
+	require.Equal(t, map[string]string{
+		"org.opencontainers.image.revision": "abc123",
+		"maintainer":                        "ci",
+	}, image.Config.Labels)
+}
+
+func TestCopyHistory(t *testing.T) {
+	t.Parallel()
+
+	ctx := codegen.WithDefaultPlatform(context.Background(), specs.Platform{OS: "linux", Architecture: "amd64"})
+	image := GenerateImage(ctx, t, `
+	fs default() {
+		scratch
+		copy fs {
+			scratch
+			mkfile "/src" 0o644 "hello"
+		} "/src" "/dest"
+		copy scratch "/" "/empty"
+		copy scratch "/" "/bin" with option {
+			platform "linux" "x86_64"
+		}
+	}
+	`)
+
+	input := codegen.Filesystem{
+		State: llb.Scratch().File(llb.Mkfile("/src", 0o644, []byte("hello"))),
+	}
+	dgst, err := input.Digest(ctx)
+	require.NoError(t, err)
+
+	require.Len(t, image.History, 3)
+	require.Equal(t, fmt.Sprintf("COPY --from=%s /src /dest", dgst), image.History[0].CreatedBy)
+	require.Equal(t, "COPY / /empty", image.History[1].CreatedBy)
+	require.Equal(t, "COPY --platform=linux/amd64 / /bin", image.History[2].CreatedBy)
+}
+
+func TestImageConfig(t *testing.T) {
+	t.Parallel()
+
+	type testCase struct {
+		name string
+		hlb  string
+		fn   func(t *testing.T, image *solver.ImageSpec)
+	}
+
+	for _, tc := range []testCase{{
+		"shell",
+		`
+		fs default() {
+			scratch
+			shell "/bin/bash" "-c"
+		}
+		`,
+		func(t *testing.T, image *solver.ImageSpec) {
+			require.Equal(t, []string{"/bin/bash", "-c"}, image.Config.Shell)
+			require.Len(t, image.History, 1)
+			require.Equal(t, `SHELL ["/bin/bash" "-c"]`, image.History[0].CreatedBy)
+			require.True(t, image.History[0].EmptyLayer)
+		},
+	}, {
+		"healthcheck shell form",
+		`
+		fs default() {
+			scratch
+			healthcheck "curl -f http://localhost/" with option {
+				interval "1m"
+				timeout "10s"
+				startPeriod "5s"
+				retries 5
+			}
+		}
+		`,
+		func(t *testing.T, image *solver.ImageSpec) {
+			require.Len(t, image.History, 1)
+			require.Equal(t, "HEALTHCHECK --interval=1m0s --timeout=10s --start-period=5s --retries=5 CMD curl -f http://localhost/", image.History[0].CreatedBy)
+			require.True(t, image.History[0].EmptyLayer)
+
+			// The image spec is serialized as is into the config of pushed
+			// images.
+			require.Equal(t, map[string]interface{}{
+				"Test":        []interface{}{"CMD-SHELL", "curl -f http://localhost/"},
+				"Interval":    float64(time.Minute),
+				"Timeout":     float64(10 * time.Second),
+				"StartPeriod": float64(5 * time.Second),
+				"Retries":     float64(5),
+			}, healthcheckConfig(t, image))
+		},
+	}, {
+		"healthcheck exec form",
+		`
+		fs default() {
+			scratch
+			healthcheck "/bin/check" "--port" "8080"
+		}
+		`,
+		func(t *testing.T, image *solver.ImageSpec) {
+			require.Len(t, image.History, 1)
+			require.Equal(t, `HEALTHCHECK CMD ["/bin/check" "--port" "8080"]`, image.History[0].CreatedBy)
+			require.Equal(t, map[string]interface{}{
+				"Test": []interface{}{"CMD", "/bin/check", "--port", "8080"},
+			}, healthcheckConfig(t, image))
+		},
+	}, {
+		"healthcheck disabled",
+		`
+		fs default() {
+			scratch
+			healthcheck
+		}
+		`,
+		func(t *testing.T, image *solver.ImageSpec) {
+			require.Len(t, image.History, 1)
+			require.Equal(t, "HEALTHCHECK NONE", image.History[0].CreatedBy)
+			require.Equal(t, map[string]interface{}{
+				"Test": []interface{}{"NONE"},
+			}, healthcheckConfig(t, image))
+		},
+	}, {
+		"expose port",
+		`
+		fs default() {
+			scratch
+			expose "80"
+		}
+		`,
+		func(t *testing.T, image *solver.ImageSpec) {
+			require.Equal(t, map[string]struct{}{
+				"80/tcp": {},
+			}, image.Config.ExposedPorts)
+		},
+	}, {
+		"expose protocol and range",
+		`
+		fs default() {
+			scratch
+			expose "53/udp" "8000-8010"
+		}
+		`,
+		func(t *testing.T, image *solver.ImageSpec) {
+			require.Equal(t, map[string]struct{}{
+				"53/udp":        {},
+				"8000-8010/tcp": {},
+			}, image.Config.ExposedPorts)
+		},
+	}} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			tc.fn(t, GenerateImage(context.Background(), t, tc.hlb))
+		})
+	}
+}
+
+// healthcheckConfig returns the healthcheck of the image as it is serialized
+// into the config of pushed images.
+func healthcheckConfig(t *testing.T, image *solver.ImageSpec) map[string]interface{} {
+	dt, err := json.Marshal(image)
+	require.NoError(t, err)
+
+	var spec struct {
+		Config struct {
+			Healthcheck map[string]interface{}
+		} `json:"config"`
+	}
+	err = json.Unmarshal(dt, &spec)
+	require.NoError(t, err)
+	return spec.Config.Healthcheck
+}
+
+func TestSourceMap(t *testing.T) {
+	t.Parallel()
+
+	ctx := filebuffer.WithBuffers(context.Background(), builtin.Buffers())
+	ctx = ast.WithModules(ctx, builtin.Modules())
+
+	mod, err := parser.Parse(ctx, &parser.NamedReader{
+		Reader: strings.NewReader(cleanup(`
+		fs default() {
+			image "alpine"
+			run "cat" with option {
+				stdin "foo"
+				mount local(".") "/src" as src
+				mount scratch "/ro" with readonly
+				mount scratch "/ro/out"
+			}
+			diff scratch
+		}
+		`)),
+		Value: "build.hlb",
+	})
+	require.NoError(t, err)
+
+	err = checker.SemanticPass(mod)
+	require.NoError(t, err)
+
+	err = checker.Check(mod, checker.WithExperimental())
+	require.NoError(t, err)
+
+	cg := codegen.New(nil, nil)
+	val, err := cg.GenerateValue(ctx, mod, codegen.Target{Name: "default"})
+	require.NoError(t, err)
+
+	fs, err := val.Filesystem()
+	require.NoError(t, err)
+
+	def, err := fs.State.Marshal(ctx)
+	require.NoError(t, err)
+
+	// BuildKit attributes the errors of an op to its source locations, so
+	// every op must have one, starting with the call that produced it.
+	for _, dt := range def.Def {
+		var op pb.Op
+		err = op.Unmarshal(dt)
+		require.NoError(t, err)
+
+		var line int
+		switch o := op.Op.(type) {
+		case nil:
+			// The terminal op only selects the output.
+			continue
+		case *pb.Op_Source:
+			line = 2
+			if strings.HasPrefix(o.Source.Identifier, "local://") {
+				line = 5
+			}
+		case *pb.Op_File:
+			line = 3
+			if o.File.Actions[0].GetCopy() != nil {
+				line = 5
+			}
+		case *pb.Op_Exec:
+			line = 3
+		case *pb.Op_Diff:
+			line = 9
+		default:
+			t.Fatalf("unexpected op %T", o)
+		}
+
+		locs, ok := def.Source.Locations[digest.FromBytes(dt).String()]
+		require.True(t, ok, "op %s has no source location", op.String())
+		require.NotEmpty(t, locs.Locations)
+		loc := locs.Locations[0]
+		require.Equal(t, "build.hlb", def.Source.Infos[loc.SourceIndex].Filename)
+		require.Equal(t, int32(line), loc.Ranges[0].Start.Line, op.String())
+	}
+}
+
+func TestReport(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	report := codegen.NewReport()
+	ctx = codegen.WithReport(ctx, report)
+
+	// Exports are solved as they are generated, so point the client at a
+	// daemon that doesn't exist. Only the recorded artifacts are asserted.
+	dir := t.TempDir()
+	cln, err := client.New(ctx, "unix://"+filepath.Join(dir, "buildkitd.sock"))
+	require.NoError(t, err)
+	defer cln.Close()
+
+	out := filepath.Join(dir, "out")
+	ctx, mod := ParseModule(ctx, t, fmt.Sprintf(`
+	fs default() {
+		scratch
+		mkfile "hello" 0o644 "world"
+		download %q
+		dockerPush "openllb/hello"
+	}
+	`, out))
+
+	cg := codegen.New(cln, nil)
+	_, err = cg.Generate(ctx, mod, []codegen.Target{{Name: "default"}})
+	require.NoError(t, err)
+
+	require.Equal(t, []codegen.Artifact{{
+		Type: codegen.ArtifactDirectory,
+		Path: out,
+	}, {
+		Type: codegen.ArtifactImage,
+		Ref:  "docker.io/openllb/hello:latest",
+	}}, report.Artifacts())
+
+	buf := new(bytes.Buffer)
+	err = report.WriteJSON(buf)
+	require.NoError(t, err)
+	require.JSONEq(t, fmt.Sprintf(`{
+		"artifacts": [
+			{"type": "directory", "path": %q},
+			{"type": "image", "ref": "docker.io/openllb/hello:latest"}
+		]
+	}`, out), buf.String())
+}
+
+func TestReportSources(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	for _, dir := range []string{"module", "src"} {
+		err := os.Mkdir(filepath.Join(root, dir), 0o755)
+		require.NoError(t, err)
+	}
+
+	filename := filepath.Join(root, "module", "build.hlb")
+	err := os.WriteFile(filename, []byte(cleanup(fmt.Sprintf(`
+	fs default() {
+		local %q
+	}
+	`, filepath.Join(root, "src")))), 0o644)
+	require.NoError(t, err)
+
+	report := codegen.NewReport()
+	ctx := codegen.WithReport(context.Background(), report)
+	ctx = filebuffer.WithBuffers(ctx, builtin.Buffers())
+	ctx = ast.WithModules(ctx, builtin.Modules())
+
+	mod, err := codegen.ParseModuleURI(ctx, nil, parser.NewLocalDirectory("", ""), filename)
+	require.NoError(t, err)
+
+	err = checker.SemanticPass(mod)
+	require.NoError(t, err)
+
+	err = checker.Check(mod)
+	require.NoError(t, err)
 
-			cg := codegen.New(nil, nil)
-			request, err := cg.Generate(ctx, mod, targets)
-			require.NoError(t, err, tc.name)
+	cg := codegen.New(nil, nil)
+	_, err = cg.Generate(ctx, mod, []codegen.Target{{Name: "default"}})
+	require.NoError(t, err)
 
-			testRequest := tc.fn(ctx, t)
+	// Local sources outside the module's directory are sources of the run
+	// too, but aren't part of the JSON report.
+	require.Equal(t, []string{filename, filepath.Join(root, "src")}, report.Sources())
 
-			expected := treeprint.New()
-			err = testRequest.Tree(expected)
-			require.NoError(t, err, tc.name)
-			t.Logf("expected: %s", expected)
+	buf := new(bytes.Buffer)
+	err = report.WriteJSON(buf)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"artifacts": []}`, buf.String())
+}
 
-			actual := treeprint.New()
-			err = request.Tree(actual)
-			require.NoError(t, err, tc.name)
-			t.Logf("actual: %s", actual)
+func TestGenerateEachRequest(t *testing.T) {
+	t.Parallel()
 
-			// Compare trees.
-			require.Equal(t, expected.String(), actual.String(), tc.name)
-		})
+	ctx, mod := ParseModule(context.Background(), t, `
+	fs build() {
+		image "#"
 	}
+
+	fs test() {
+		scratch
+		mkfile "ok" 0o644 "ok"
+	}
+	`)
+
+	// A target that fails to generate doesn't stop the targets after it.
+	cg := codegen.New(nil, nil)
+	requests, errs, err := cg.GenerateEachRequest(ctx, mod, []codegen.Target{{Name: "build"}, {Name: "test"}})
+	require.NoError(t, err)
+	require.Len(t, requests, 2)
+	require.Nil(t, requests[0])
+	validateError(t, ctx, errdefs.WithInvalidImageRef(
+		errors.New("invalid reference format"),
+		ast.Search(mod, `"#"`),
+		"#",
+	), errs[0], "build")
+	require.NoError(t, errs[1])
+	require.NotNil(t, requests[1])
+
+	tree := treeprint.New()
+	err = requests[1].Tree(tree)
+	require.NoError(t, err)
+	require.Contains(t, tree.String(), "[file]")
+
+	// Without generating each request, the first failure is returned.
+	_, err = cg.GenerateRequests(ctx, mod, []codegen.Target{{Name: "build"}, {Name: "test"}})
+	require.Error(t, err)
 }
 
-func TestCodegenError(t *testing.T) {
+func TestMultiPlatformPush(t *testing.T) {
 	t.Parallel()
 
-	type testCase struct {
-		name    string
-		targets []string
-		input   string
-		fn      func(*ast.Module) error
+	report := codegen.NewReport()
+	ctx, mod := ParseModule(codegen.WithReport(context.Background(), report), t, `
+	fs default() {
+		scratch
+		mkfile "hello" 0o644 "world"
+		dockerPush "openllb/hello"
 	}
+	`)
+
+	// The pushes of every platform are solved together after codegen, so
+	// nothing is solved without a client.
+	amd64 := specs.Platform{OS: "linux", Architecture: "amd64"}
+	arm64 := specs.Platform{OS: "linux", Architecture: "arm64"}
+	cg := codegen.New(nil, nil)
+	requests, err := cg.GenerateRequests(ctx, mod, []codegen.Target{
+		{Name: "default", Platform: &amd64},
+		{Name: "default", Platform: &arm64},
+	})
+	require.NoError(t, err)
+	require.Len(t, requests, 2)
 
-	for _, tc := range []testCase{
-		{
-			"invalid downloadDockerTarball ref",
-			[]string{"default"},
-			`
-			fs default() {
-				downloadDockerTarball "image.tar" "#"
-			}
-			`,
-			func(mod *ast.Module) error {
-				return errdefs.WithInvalidImageRef(
-					errors.New("invalid reference format"),
-					ast.Search(mod, `"#"`),
-					"#",
-				)
-			},
-		},
-	} {
-		tc := tc
-		t.Run(tc.name, func(t *testing.T) {
-			ctx := filebuffer.WithBuffers(context.Background(), builtin.Buffers())
-			ctx = ast.WithModules(ctx, builtin.Modules())
-
-			mod, err := parser.Parse(ctx, strings.NewReader(tc.input))
-			require.NoError(t, err, "unexpected parse error")
+	// The first target to push the image solves the push for both platforms.
+	tree := treeprint.New()
+	err = requests[0].Tree(tree)
+	require.NoError(t, err)
 
-			err = checker.SemanticPass(mod)
-			require.NoError(t, err, tc.name)
+	require.Contains(t, tree.String(), "└── multi-platform\n")
+	require.Contains(t, tree.String(), "├── linux/amd64\n")
+	require.Contains(t, tree.String(), "└── linux/arm64\n")
+	require.Equal(t, 2, strings.Count(tree.String(), "[pushImage]  docker.io/openllb/hello:latest"))
 
-			err = checker.Check(mod)
-			require.NoError(t, err, tc.name)
+	tree = treeprint.New()
+	err = requests[1].Tree(tree)
+	require.NoError(t, err)
+	require.NotContains(t, tree.String(), "multi-platform")
+	require.NotContains(t, tree.String(), "[pushImage]")
+
+	// The image is recorded once for the image index.
+	require.Equal(t, []codegen.Artifact{{
+		Type: codegen.ArtifactImage,
+		Ref:  "docker.io/openllb/hello:latest",
+	}}, report.Artifacts())
+}
 
-			var targets []codegen.Target
-			for _, target := range tc.targets {
-				targets = append(targets, codegen.Target{Name: target})
-			}
+func TestNoOutput(t *testing.T) {
+	t.Parallel()
 
-			cg := codegen.New(nil, nil)
-			_, err = cg.Generate(ctx, mod, targets)
-			var expected error
-			if tc.fn != nil {
-				expected = tc.fn(mod)
-			}
-			validateError(t, ctx, expected, err, tc.name)
-		})
+	report := codegen.NewReport()
+	ctx := codegen.WithNoOutput(context.Background(), true)
+	ctx = codegen.WithReport(ctx, report)
+
+	out := filepath.Join(t.TempDir(), "out")
+	ctx, mod := ParseModule(ctx, t, fmt.Sprintf(`
+	fs default() {
+		scratch
+		mkfile "hello" 0o644 "world"
+		download %q
+		downloadTarball %q
+		dockerPush "openllb/hello"
 	}
-}
+	`, out, out+".tar"))
 
-type testFile struct {
-	filename string
-	content  string
+	// Without a client, any export solved during codegen would panic.
+	cg := codegen.New(nil, nil)
+	request, err := cg.Generate(ctx, mod, []codegen.Target{{Name: "default"}})
+	require.NoError(t, err)
+
+	def, err := llb.Scratch().File(llb.Mkfile("hello", 0o644, []byte("world"))).Marshal(ctx)
+	require.NoError(t, err)
+
+	expected := treeprint.New()
+	err = solver.Single(&solver.Params{Def: def}).Tree(expected)
+	require.NoError(t, err)
+
+	actual := treeprint.New()
+	err = request.Tree(actual)
+	require.NoError(t, err)
+	require.Equal(t, expected.String(), actual.String())
+
+	require.Empty(t, report.Artifacts())
+	require.NoDirExists(t, out)
+	require.NoFileExists(t, out+".tar")
 }
 
 func TestCodeGenImport(t *testing.T) {
@@ -1342,6 +3689,222 @@ func TestCodeGenImport(t *testing.T) {
 	}
 }
 
+func TestCodeGenInclude(t *testing.T) {
+	t.Parallel()
+
+	type testCase struct {
+		name  string
+		files []testFile
+		fn    func(files []*ast.Module) error
+	}
+
+	for _, tc := range []testCase{{
+		"included functions are callable unqualified",
+		[]testFile{{
+			"build.hlb",
+			`
+			include "./fragment.hlb"
+
+			fs default() {
+				foo
+			}
+			`,
+		}, {
+			"fragment.hlb",
+			`
+			fs foo() {
+				image "alpine"
+			}
+			`,
+		}},
+		nil,
+	}, {
+		"includes respect the including file's dir",
+		[]testFile{{
+			"build.hlb",
+			`
+			include "./sub/a.hlb"
+
+			fs default() {
+				bar
+			}
+			`,
+		}, {
+			"sub/a.hlb",
+			`
+			include "./b.hlb"
+
+			fs bar() {
+				foo
+			}
+			`,
+		}, {
+			"sub/b.hlb",
+			`
+			fs foo() {
+				image "alpine"
+			}
+			`,
+		}},
+		nil,
+	}, {
+		"file included twice is merged once",
+		[]testFile{{
+			"build.hlb",
+			`
+			include "./a.hlb"
+			include "./common.hlb"
+
+			fs default() {
+				bar
+			}
+			`,
+		}, {
+			"a.hlb",
+			`
+			include "./common.hlb"
+
+			fs bar() {
+				foo
+			}
+			`,
+		}, {
+			"common.hlb",
+			`
+			fs foo() {
+				image "alpine"
+			}
+			`,
+		}},
+		nil,
+	}, {
+		"name collisions with includes error",
+		[]testFile{{
+			"build.hlb",
+			`
+			include "./fragment.hlb"
+
+			fs foo() {
+				image "alpine"
+			}
+
+			fs default() {
+				foo
+			}
+			`,
+		}, {
+			"fragment.hlb",
+			`
+			fs foo() {
+				image "busybox"
+			}
+			`,
+		}},
+		func(files []*ast.Module) error {
+			return errdefs.WithDuplicates([]ast.Node{
+				ast.Search(files[0], "foo"),
+				ast.Search(files[1], "foo"),
+			})
+		},
+	}, {
+		"name collisions across includes error",
+		[]testFile{{
+			"build.hlb",
+			`
+			include "./a.hlb"
+			include "./b.hlb"
+
+			fs default() {
+				foo
+			}
+			`,
+		}, {
+			"a.hlb",
+			`
+			fs foo() {
+				image "alpine"
+			}
+			`,
+		}, {
+			"b.hlb",
+			`
+			fs foo() {
+				image "busybox"
+			}
+			`,
+		}},
+		func(files []*ast.Module) error {
+			return errdefs.WithDuplicates([]ast.Node{
+				ast.Search(files[1], "foo"),
+				ast.Search(files[2], "foo"),
+			})
+		},
+	}, {
+		"include cycles error",
+		[]testFile{{
+			"build.hlb",
+			`
+			include "./a.hlb"
+
+			fs default() {
+				image "alpine"
+			}
+			`,
+		}, {
+			"a.hlb",
+			`
+			include "./build.hlb"
+			`,
+		}},
+		func(files []*ast.Module) error {
+			return errdefs.WithIncludeCycle(
+				ast.Search(files[1], `"./build.hlb"`),
+				filepath.Join(filepath.Dir(files[0].Pos.Filename), "build.hlb"),
+			)
+		},
+	}} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := filebuffer.WithBuffers(context.Background(), builtin.Buffers())
+			ctx = ast.WithModules(ctx, builtin.Modules())
+
+			dir := t.TempDir()
+			for _, f := range tc.files {
+				filename := filepath.Join(dir, f.filename)
+				err := os.MkdirAll(filepath.Dir(filename), 0755)
+				require.NoError(t, err)
+				err = os.WriteFile(filename, []byte(cleanup(f.content)), 0644)
+				require.NoError(t, err)
+			}
+
+			f, err := os.Open(filepath.Join(dir, tc.files[0].filename))
+			require.NoError(t, err)
+			defer f.Close()
+
+			mod, err := parser.Parse(ctx, f)
+			require.NoError(t, err)
+
+			actual := parser.ResolveIncludes(ctx, mod)
+			if actual == nil {
+				actual = checker.SemanticPass(mod)
+			}
+			if actual == nil {
+				actual = checker.Check(mod)
+			}
+			if actual == nil {
+				cg := codegen.New(nil, nil)
+				_, actual = cg.Generate(ctx, mod, []codegen.Target{{Name: "default"}})
+			}
+
+			var expected error
+			if tc.fn != nil {
+				expected = tc.fn(mod.Files())
+			}
+			validateError(t, ctx, expected, actual, tc.name)
+		})
+	}
+}
+
 func parseTestFile(t *testing.T, ctx context.Context, files []testFile, f testFile) (*ast.Module, error) {
 	r := &parser.NamedReader{
 		Reader: strings.NewReader(cleanup(f.content)),
@@ -1422,3 +3985,68 @@ func validateError(t *testing.T, ctx context.Context, expected, actual error, na
 		}
 	}
 }
+
+func TestCopyGitignore(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		".gitignore":        "*.log\n",
+		"web/.gitignore":    "node_modules/\n/dist\n",
+		"web/ui/.gitignore": "!debug.log\n",
+		"web/index.html":    "",
+	} {
+		err := os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), 0755)
+		require.NoError(t, err)
+		err = os.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+		require.NoError(t, err)
+	}
+
+	ctx, err := local.WithCwd(context.Background(), dir)
+	require.NoError(t, err)
+
+	ctx, mod := ParseModule(ctx, t, `
+	fs default() {
+		scratch
+		copy local(".") "/web" "/src" with gitignore
+	}
+
+	fs nonLocal() {
+		scratch
+		copy scratch "/" "/src" with gitignore
+	}
+	`)
+
+	cg := codegen.New(nil, nil)
+	req, err := cg.Generate(ctx, mod, []codegen.Target{{Name: "default"}})
+	require.NoError(t, err)
+
+	tree := treeprint.New()
+	err = req.Tree(tree)
+	require.NoError(t, err)
+	require.Contains(t, tree.String(), strings.Join([]string{
+		`exclude_patterns:"**/*.log"`,
+		`exclude_patterns:"**/node_modules"`,
+		`exclude_patterns:"dist"`,
+		`exclude_patterns:"!ui/**/debug.log"`,
+	}, " "))
+
+	_, err = cg.Generate(ctx, mod, []codegen.Target{{Name: "nonLocal"}})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "gitignore can only be used when copying from a local filesystem")
+}
+
+func TestIsInsecureRegistry(t *testing.T) {
+	t.Parallel()
+
+	ctx := codegen.WithInsecureRegistries(context.Background(), []string{"localhost:5000", "registry.local"})
+	for ref, expected := range map[string]bool{
+		"localhost:5000/app:latest": true,
+		"registry.local/team/app":   true,
+		"localhost:5001/app":        false,
+		"alpine":                    false,
+		"docker.io/library/alpine":  false,
+	} {
+		require.Equal(t, expected, codegen.IsInsecureRegistry(ctx, ref), ref)
+	}
+}
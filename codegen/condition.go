@@ -0,0 +1,186 @@
+package codegen
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/openllb/hlb/parser/ast"
+)
+
+// condition is a boolean expression of a conditional breakpoint. It compares
+// arguments in scope to string or int literals, and comparisons can be
+// combined with "&&" and "||", where "&&" binds tighter.
+//
+// For example, `ref == "alpine" || tag != "latest"`.
+type condition struct {
+	// disjuncts are the comparisons joined by "||", each of which are the
+	// comparisons joined by "&&".
+	disjuncts [][]comparison
+}
+
+type comparison struct {
+	ident string
+	equal bool
+	lit   interface{}
+}
+
+var conditionTokenRegexp = regexp.MustCompile(`^\s*(==|!=|&&|\|\||"(?:[^"\\]|\\.)*"|[\w:]+)`)
+
+// parseCondition parses the condition expression and checks its identifiers
+// are arguments of the same kind as the literals they are compared to in
+// scope.
+func parseCondition(scope *ast.Scope, expr string) (*condition, error) {
+	var tokens []string
+	for rest := expr; strings.TrimSpace(rest) != ""; {
+		match := conditionTokenRegexp.FindStringSubmatch(rest)
+		if match == nil {
+			return nil, fmt.Errorf("invalid condition %q: unexpected %q", expr, strings.TrimSpace(rest))
+		}
+		tokens = append(tokens, match[1])
+		rest = rest[len(match[0]):]
+	}
+
+	cond := &condition{}
+	conjuncts := []comparison{}
+	for i := 0; ; i += 4 {
+		if i+3 > len(tokens) {
+			return nil, fmt.Errorf("invalid condition %q: expected comparison of an argument to a literal", expr)
+		}
+		cmp, err := parseComparison(scope, tokens[i], tokens[i+1], tokens[i+2])
+		if err != nil {
+			return nil, fmt.Errorf("invalid condition %q: %w", expr, err)
+		}
+		conjuncts = append(conjuncts, cmp)
+
+		if i+3 == len(tokens) {
+			break
+		}
+		switch tokens[i+3] {
+		case "&&":
+		case "||":
+			cond.disjuncts = append(cond.disjuncts, conjuncts)
+			conjuncts = []comparison{}
+		default:
+			return nil, fmt.Errorf("invalid condition %q: expected && or || but got %q", expr, tokens[i+3])
+		}
+	}
+	cond.disjuncts = append(cond.disjuncts, conjuncts)
+	return cond, nil
+}
+
+func parseComparison(scope *ast.Scope, ident, op, lit string) (cmp comparison, err error) {
+	cmp.ident = ident
+	switch op {
+	case "==":
+		cmp.equal = true
+	case "!=":
+	default:
+		return cmp, fmt.Errorf("expected == or != but got %q", op)
+	}
+
+	var kind ast.Kind
+	switch {
+	case strings.HasPrefix(lit, `"`):
+		cmp.lit, err = strconv.Unquote(lit)
+		kind = ast.String
+	default:
+		var i int64
+		i, err = strconv.ParseInt(lit, 0, 0)
+		cmp.lit, kind = int(i), ast.Int
+	}
+	if err != nil {
+		return cmp, fmt.Errorf("expected string or int literal but got %q", lit)
+	}
+
+	obj := scope.Lookup(ident)
+	if obj == nil {
+		return cmp, fmt.Errorf("undefined argument %q", ident)
+	}
+	if !isArgument(scope, obj) {
+		return cmp, fmt.Errorf("%q is not an argument", ident)
+	}
+	if obj.Kind != kind {
+		return cmp, fmt.Errorf("cannot compare %s argument %q to %s %s", obj.Kind, ident, kind, lit)
+	}
+	return cmp, nil
+}
+
+// isArgument returns whether obj is a parameter of the function declaration of
+// scope. Variadic parameters and side effects are not arguments in scope when
+// the function is called.
+func isArgument(scope *ast.Scope, obj *ast.Object) bool {
+	fd, ok := scope.Node.(*ast.FuncDecl)
+	if !ok || fd.Sig.Params == nil {
+		return false
+	}
+	for _, param := range fd.Sig.Params.Fields() {
+		if param == obj.Node {
+			return param.Modifier == nil
+		}
+	}
+	return false
+}
+
+// eval returns whether the condition is true for the arguments in scope.
+func (c *condition) eval(scope *ast.Scope) (bool, error) {
+	for _, conjuncts := range c.disjuncts {
+		ok := true
+		for _, cmp := range conjuncts {
+			equal, err := cmp.eval(scope)
+			if err != nil {
+				return false, err
+			}
+			if equal != cmp.equal {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// eval returns whether the argument is equal to the literal.
+func (cmp comparison) eval(scope *ast.Scope) (bool, error) {
+	obj := scope.Lookup(cmp.ident)
+	if obj == nil {
+		return false, fmt.Errorf("undefined argument %q", cmp.ident)
+	}
+	reg, ok := obj.Data.(Register)
+	if !ok {
+		return false, fmt.Errorf("argument %q is not evaluated", cmp.ident)
+	}
+
+	val := reg.Value()
+	switch lit := cmp.lit.(type) {
+	case string:
+		s, err := val.String()
+		return s == lit, err
+	case int:
+		i, err := val.Int()
+		return i == lit, err
+	}
+	return false, nil
+}
+
+// conditionScope returns the scope of the function declaration the node is
+// within, for the arguments a condition may compare.
+func conditionScope(mod *ast.Module, node ast.Node) *ast.Scope {
+	pos := node.Position()
+	for _, file := range mod.Files() {
+		for _, decl := range file.Decls {
+			fd := decl.Func
+			if fd == nil || fd.Scope == nil || fd.Position().Filename != pos.Filename {
+				continue
+			}
+			if ast.IsPositionWithinNode(fd, pos.Line, pos.Column) {
+				return fd.Scope
+			}
+		}
+	}
+	return mod.Scope
+}
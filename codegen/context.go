@@ -7,12 +7,15 @@ import (
 	"strings"
 
 	"github.com/docker/buildx/util/imagetools"
+	"github.com/docker/distribution/reference"
 	dockerclient "github.com/docker/docker/client"
 	"github.com/moby/buildkit/client"
 	"github.com/moby/buildkit/client/llb"
 	"github.com/moby/buildkit/solver/errdefs"
 	"github.com/moby/buildkit/solver/pb"
+	"github.com/moby/buildkit/util/entitlements"
 	specs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/openllb/hlb/checker"
 	"github.com/openllb/hlb/diagnostic"
 	"github.com/openllb/hlb/parser/ast"
 	"github.com/openllb/hlb/pkg/filebuffer"
@@ -30,12 +33,22 @@ type (
 	calleeBindingKey   struct{}
 	multiwriterKey     struct{}
 	imageResolverKey   struct{}
+	frontendSolverKey  struct{}
 	backtraceKey       struct{}
 	progressKey        struct{}
 	platformKey        struct{}
 	dockerAPIKey       struct{}
 	debuggerKey        struct{}
 	globalSolveOptsKey struct{}
+	entitlementsKey    struct{}
+	preferLocalKey     struct{}
+	insecureKey        struct{}
+	noOutputKey        struct{}
+	reportKey          struct{}
+	imageOverridesKey  struct{}
+	authSourceKey      struct{}
+	experimentalKey    struct{}
+	platformPushesKey  struct{}
 )
 
 func WithProgramCounter(ctx context.Context, node ast.Node) context.Context {
@@ -141,6 +154,33 @@ func ImageResolver(ctx context.Context) llb.ImageMetaResolver {
 	return resolver
 }
 
+// WithFrontendSolver sets the solver for the frontend and dockerfile builtins,
+// which otherwise solve through the BuildKit gateway.
+func WithFrontendSolver(ctx context.Context, fsolver FrontendSolver) context.Context {
+	return context.WithValue(ctx, frontendSolverKey{}, fsolver)
+}
+
+func frontendSolver(ctx context.Context) FrontendSolver {
+	fsolver, _ := ctx.Value(frontendSolverKey{}).(FrontendSolver)
+	return fsolver
+}
+
+// WithAuthSource sets the source of the credentials to resolve images from
+// the registry host of the source with, overriding the Docker config.
+func WithAuthSource(ctx context.Context, source llbutil.AuthSource) context.Context {
+	return context.WithValue(ctx, authSourceKey{}, source)
+}
+
+// AuthSourceOpts returns the session options to resolve images with the
+// credential source of the context, if any.
+func AuthSourceOpts(ctx context.Context) []llbutil.SessionOption {
+	source, ok := ctx.Value(authSourceKey{}).(llbutil.AuthSource)
+	if !ok {
+		return nil
+	}
+	return []llbutil.SessionOption{llbutil.WithAuthSource(source)}
+}
+
 type Frame struct {
 	ast.Node
 	Name string
@@ -271,6 +311,24 @@ func GetDebugger(ctx context.Context) Debugger {
 	return dbgr
 }
 
+func WithReport(ctx context.Context, r *Report) context.Context {
+	return context.WithValue(ctx, reportKey{}, r)
+}
+
+func GetReport(ctx context.Context) *Report {
+	r, _ := ctx.Value(reportKey{}).(*Report)
+	return r
+}
+
+func withPlatformPushes(ctx context.Context, pushes *platformPushes) context.Context {
+	return context.WithValue(ctx, platformPushesKey{}, pushes)
+}
+
+func getPlatformPushes(ctx context.Context) *platformPushes {
+	pushes, _ := ctx.Value(platformPushesKey{}).(*platformPushes)
+	return pushes
+}
+
 func WithGlobalSolveOpts(ctx context.Context, opts ...solver.SolveOption) context.Context {
 	return context.WithValue(ctx, globalSolveOptsKey{}, append(GlobalSolveOpts(ctx), opts...))
 }
@@ -279,3 +337,109 @@ func GlobalSolveOpts(ctx context.Context) []solver.SolveOption {
 	opts, _ := ctx.Value(globalSolveOptsKey{}).([]solver.SolveOption)
 	return opts
 }
+
+// WithAllowedEntitlements restricts the entitlements that operations may
+// request to the given set. Without it, every entitlement is allowed.
+func WithAllowedEntitlements(ctx context.Context, ents ...entitlements.Entitlement) context.Context {
+	allowed := make(entitlements.Set)
+	for _, e := range ents {
+		allowed[e] = struct{}{}
+	}
+	return context.WithValue(ctx, entitlementsKey{}, allowed)
+}
+
+// EntitlementAllowed returns whether operations may request the entitlement.
+func EntitlementAllowed(ctx context.Context, e entitlements.Entitlement) bool {
+	allowed, ok := ctx.Value(entitlementsKey{}).(entitlements.Set)
+	if !ok {
+		return true
+	}
+	return allowed.Allowed(e)
+}
+
+// WithPreferLocal sets whether images are resolved from the local cache when
+// present instead of always being pulled. Images that aren't present are still
+// pulled from their registry.
+func WithPreferLocal(ctx context.Context, preferLocal bool) context.Context {
+	return context.WithValue(ctx, preferLocalKey{}, preferLocal)
+}
+
+func PreferLocal(ctx context.Context) bool {
+	preferLocal, _ := ctx.Value(preferLocalKey{}).(bool)
+	return preferLocal
+}
+
+// WithExperimental sets whether modules may call experimental builtins.
+func WithExperimental(ctx context.Context, experimental bool) context.Context {
+	return context.WithValue(ctx, experimentalKey{}, experimental)
+}
+
+func Experimental(ctx context.Context) bool {
+	experimental, _ := ctx.Value(experimentalKey{}).(bool)
+	return experimental
+}
+
+// CheckOptions returns the options to check modules with in the context.
+func CheckOptions(ctx context.Context) []checker.CheckOption {
+	var opts []checker.CheckOption
+	if Experimental(ctx) {
+		opts = append(opts, checker.WithExperimental())
+	}
+	return opts
+}
+
+// WithInsecureRegistries sets the registries, as host[:port], that images may
+// be pulled from and pushed to over HTTP or with unverified certificates.
+func WithInsecureRegistries(ctx context.Context, hosts []string) context.Context {
+	return context.WithValue(ctx, insecureKey{}, hosts)
+}
+
+func InsecureRegistries(ctx context.Context) []string {
+	hosts, _ := ctx.Value(insecureKey{}).([]string)
+	return hosts
+}
+
+// IsInsecureRegistry returns whether the registry of the normalized image
+// reference is insecure.
+func IsInsecureRegistry(ctx context.Context, ref string) bool {
+	named, err := reference.ParseNormalizedNamed(ref)
+	if err != nil {
+		return false
+	}
+	domain := reference.Domain(named)
+	for _, host := range InsecureRegistries(ctx) {
+		if host == domain {
+			return true
+		}
+	}
+	return false
+}
+
+// WithNoOutput sets whether builtins that export a filesystem, such as
+// download and dockerPush, are skipped. The filesystems they would have
+// exported are still solved as part of their target.
+func WithNoOutput(ctx context.Context, noOutput bool) context.Context {
+	return context.WithValue(ctx, noOutputKey{}, noOutput)
+}
+
+func NoOutput(ctx context.Context) bool {
+	noOutput, _ := ctx.Value(noOutputKey{}).(bool)
+	return noOutput
+}
+
+// ImageOverrides are labels and environment variables set from outside the
+// module, such as from the command line. They take precedence over the values
+// set by the module in the config of every exported image.
+type ImageOverrides struct {
+	Labels map[string]string
+	Env    map[string]string
+}
+
+func WithImageOverrides(ctx context.Context, overrides ImageOverrides) context.Context {
+	return context.WithValue(ctx, imageOverridesKey{}, overrides)
+}
+
+func GetImageOverrides(ctx context.Context) ImageOverrides {
+	overrides, _ := ctx.Value(imageOverridesKey{}).(ImageOverrides)
+	return overrides
+}
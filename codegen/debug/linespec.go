@@ -9,6 +9,7 @@ import (
 	"strings"
 
 	"github.com/openllb/hlb/checker"
+	"github.com/openllb/hlb/codegen"
 	"github.com/openllb/hlb/linter"
 	"github.com/openllb/hlb/parser"
 	"github.com/openllb/hlb/parser/ast"
@@ -148,6 +149,11 @@ func findModule(ctx context.Context, filename string) (*ast.Module, error) {
 			return nil, err
 		}
 
+		err = parser.ResolveIncludes(ctx, mod)
+		if err != nil {
+			return nil, err
+		}
+
 		err = checker.SemanticPass(mod)
 		if err != nil {
 			return nil, err
@@ -155,7 +161,7 @@ func findModule(ctx context.Context, filename string) (*ast.Module, error) {
 
 		_ = linter.Lint(ctx, mod)
 
-		err = checker.Check(mod)
+		err = checker.Check(mod, codegen.CheckOptions(ctx)...)
 		if err != nil {
 			return nil, err
 		}
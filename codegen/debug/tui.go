@@ -6,12 +6,17 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"os"
+	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 
 	"github.com/chzyer/readline"
+	"github.com/containerd/containerd/platforms"
 	shellquote "github.com/kballard/go-shellquote"
 	"github.com/moby/buildkit/solver/errdefs"
+	specs "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/openllb/hlb/codegen"
 	"github.com/openllb/hlb/diagnostic"
 	"github.com/openllb/hlb/parser/ast"
@@ -25,16 +30,13 @@ func TUIFrontend(ctx context.Context, dbgr codegen.Debugger, is *steer.InputStee
 	}
 	defer dbgr.Terminate()
 
-	l, err := readline.NewEx(&readline.Config{
-		Prompt: "(hlb) ",
-		Stdin:  stdin,
-		Stdout: stdout,
-		Stderr: stderr,
-	})
+	l, err := newPrompt(HistoryFile(), stdin, stdout, stderr)
 	if err != nil {
 		return err
 	}
-	defer l.Close()
+	defer func() {
+		l.Close()
+	}()
 
 	firstPrompt, firstExec := true, true
 	color := diagnostic.Color(ctx)
@@ -177,12 +179,7 @@ func TUIFrontend(ctx context.Context, dbgr codegen.Debugger, is *steer.InputStee
 				printError(stderr, s, err)
 			}
 
-			l, err = readline.NewEx(&readline.Config{
-				Prompt: "(hlb) ",
-				Stdin:  stdin,
-				Stdout: stdout,
-				Stderr: stderr,
-			})
+			l, err = newPrompt(HistoryFile(), stdin, stdout, stderr)
 			if err != nil {
 				return err
 			}
@@ -209,6 +206,12 @@ func TUIFrontend(ctx context.Context, dbgr codegen.Debugger, is *steer.InputStee
 			goto prompt
 		case "next", "n":
 			s, serr = dbgr.Next(direction)
+		case "print", "p":
+			err = handlePrint(stdout, s, args)
+			if err != nil {
+				printError(stderr, s, err)
+			}
+			goto prompt
 		case "pwd":
 			err = handlePwd(stdout, s)
 			if err != nil {
@@ -233,6 +236,12 @@ func TUIFrontend(ctx context.Context, dbgr codegen.Debugger, is *steer.InputStee
 			goto prompt
 		case "step", "s":
 			s, serr = dbgr.Step(direction)
+		case "whatis":
+			err = handleWhatis(stdout, s, args)
+			if err != nil {
+				printError(stderr, s, err)
+			}
+			goto prompt
 		case "stepout":
 			s, serr = dbgr.StepOut(direction)
 		default:
@@ -244,6 +253,29 @@ func TUIFrontend(ctx context.Context, dbgr codegen.Debugger, is *steer.InputStee
 	return nil
 }
 
+// HistoryFile returns the path where debugger commands are persisted between
+// sessions, or an empty string if the home directory cannot be determined.
+func HistoryFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".hlb_history")
+}
+
+// newPrompt returns a readline instance for the debugger prompt. Commands are
+// appended to historyFile and reloaded from it so they can be recalled with the
+// up arrow in later sessions. An empty historyFile keeps history in memory.
+func newPrompt(historyFile string, stdin io.ReadCloser, stdout, stderr io.Writer) (*readline.Instance, error) {
+	return readline.NewEx(&readline.Config{
+		Prompt:      "(hlb) ",
+		HistoryFile: historyFile,
+		Stdin:       stdin,
+		Stdout:      stdout,
+		Stderr:      stderr,
+	})
+}
+
 func printError(w io.Writer, s *codegen.State, err error) {
 	color := diagnostic.Color(s.Ctx)
 	fmt.Fprintln(w, color.Sprintf("%s: %s", color.Red("Command failed"), err.Error()))
@@ -262,18 +294,13 @@ func handleArgs(w io.Writer, s *codegen.State) error {
 	if scope == nil {
 		return errors.New("no args")
 	}
-	for _, obj := range scope.Locals() {
-		var value string
-		val, err := codegen.NewValue(s.Ctx, obj.Data)
-		if err != nil {
-			value = fmt.Sprintf("<%s>", obj.Kind)
-		} else if obj.Kind == ast.String {
-			value, _ = val.String()
-			value = strconv.Quote(value)
-		} else {
-			value = fmt.Sprintf("<%s>", obj.Kind)
-		}
-		fmt.Fprintf(w, "%s = %s\n", obj.Ident, value)
+	// Scopes are unordered, so sort the args to print them consistently.
+	objs := scope.Locals()
+	sort.Slice(objs, func(i, j int) bool {
+		return objs[i].Ident.Text < objs[j].Ident.Text
+	})
+	for _, obj := range objs {
+		fmt.Fprintf(w, "%s = %s\n", obj.Ident, renderObject(s.Ctx, obj))
 	}
 	return nil
 }
@@ -444,6 +471,8 @@ func handleHelp(ctx context.Context, w io.Writer) {
 	printSection(ctx, w, "Viewing program variables and functions")
 	printCommand(ctx, w, "args", "", nil, "print function arguments")
 	printCommand(ctx, w, "funcs", "", nil, "print functions in this module")
+	printCommand(ctx, w, "print", "p", []string{"expression"}, "evaluate an identifier or selector and print its value")
+	printCommand(ctx, w, "whatis", "", []string{"expression"}, "print the type of an identifier or selector")
 	fmt.Println("")
 
 	printSection(ctx, w, "Viewing the call stack and selecting frames")
@@ -532,6 +561,109 @@ func handleNetwork(w io.Writer, s *codegen.State) error {
 	return nil
 }
 
+func handlePrint(w io.Writer, s *codegen.State, args []string) error {
+	if len(args) == 0 {
+		return requiredArgs("print", 1)
+	}
+
+	expr := strings.Join(args, " ")
+	obj, err := codegen.LookupExpr(s.Scope, expr)
+	if err != nil {
+		return err
+	}
+	if obj == nil {
+		return fmt.Errorf("undefined: %s", expr)
+	}
+
+	fmt.Fprintf(w, "%s = %s\n", expr, renderObject(s.Ctx, obj))
+	return nil
+}
+
+// renderObject returns the value of obj, or the error evaluating it so that
+// it is printed in place of the value.
+func renderObject(ctx context.Context, obj *ast.Object) string {
+	data := obj.Data
+	if reg, ok := data.(codegen.Register); ok {
+		data = reg.Value()
+	}
+
+	// Functions and unresolved imports have no value.
+	val, err := codegen.NewValue(ctx, data)
+	if err != nil {
+		return fmt.Sprintf("<%s>", obj.Kind)
+	}
+
+	var value string
+	switch obj.Kind {
+	case ast.String:
+		value, err = val.String()
+		value = strconv.Quote(value)
+	case ast.Int:
+		var i int
+		i, err = val.Int()
+		value = strconv.Itoa(i)
+	case ast.Bool:
+		value, err = val.String()
+	case ast.List:
+		var list []string
+		list, err = val.List()
+		quoted := make([]string, len(list))
+		for i, str := range list {
+			quoted[i] = strconv.Quote(str)
+		}
+		value = fmt.Sprintf("[%s]", strings.Join(quoted, ", "))
+	case ast.Filesystem:
+		var fs codegen.Filesystem
+		fs, err = val.Filesystem()
+		if err == nil {
+			value, err = summarizeFS(ctx, fs)
+		}
+	default:
+		value = fmt.Sprintf("<%s>", obj.Kind)
+	}
+	if err != nil {
+		return fmt.Sprintf("err: %s", err)
+	}
+	return value
+}
+
+// summarizeFS returns the digest of the filesystem, followed by its platform,
+// the image it was based on and the number of environment variables if any.
+func summarizeFS(ctx context.Context, fs codegen.Filesystem) (string, error) {
+	ref := "scratch"
+	if fs.State.Output() != nil {
+		dgst, err := fs.Digest(ctx)
+		if err != nil {
+			return "", err
+		}
+		ref = dgst.String()
+	}
+
+	var details []string
+	if fs.Platform.OS != "" {
+		details = append(details, platforms.Format(fs.Platform))
+	}
+	if fs.Image != nil {
+		if base := fs.Image.Annotations[specs.AnnotationBaseImageName]; base != "" {
+			details = append(details, fmt.Sprintf("from %s", base))
+		}
+	}
+
+	envs, err := fs.State.Env(ctx)
+	if err != nil {
+		return "", err
+	}
+	if n := len(envs.Keys()); n > 0 {
+		details = append(details, fmt.Sprintf("%d env", n))
+	}
+
+	summary := fmt.Sprintf("fs %s", ref)
+	if len(details) > 0 {
+		summary = fmt.Sprintf("%s (%s)", summary, strings.Join(details, ", "))
+	}
+	return summary, nil
+}
+
 func handlePwd(w io.Writer, s *codegen.State) error {
 	fs, err := s.Value.Filesystem()
 	if err != nil {
@@ -558,6 +690,32 @@ func handleSecurity(w io.Writer, s *codegen.State) error {
 	return nil
 }
 
+func handleWhatis(w io.Writer, s *codegen.State, args []string) error {
+	if len(args) == 0 {
+		return requiredArgs("whatis", 1)
+	}
+
+	expr := strings.Join(args, " ")
+	obj, err := codegen.LookupExpr(s.Scope, expr)
+	if err != nil {
+		return err
+	}
+	if obj == nil {
+		return fmt.Errorf("undefined: %s", expr)
+	}
+
+	// Builtins may be declared once per kind, so print every signature.
+	if bd, ok := obj.Node.(*ast.BuiltinDecl); ok {
+		for _, kind := range bd.Kinds {
+			fmt.Fprintln(w, bd.FuncDeclByKind[kind].Sig)
+		}
+		return nil
+	}
+
+	fmt.Fprintln(w, obj.Kind)
+	return nil
+}
+
 func handleExec(ctx context.Context, d codegen.Debugger, is *steer.InputSteerer, stdout, stderr io.Writer, args ...string) error {
 	pr, pw := io.Pipe()
 	is.Push(pw)
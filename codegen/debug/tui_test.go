@@ -0,0 +1,261 @@
+package debug
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	shellquote "github.com/kballard/go-shellquote"
+	"github.com/lithammer/dedent"
+	"github.com/moby/buildkit/client/llb"
+	specs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/openllb/hlb/builtin"
+	"github.com/openllb/hlb/checker"
+	"github.com/openllb/hlb/codegen"
+	"github.com/openllb/hlb/parser"
+	"github.com/openllb/hlb/parser/ast"
+	"github.com/openllb/hlb/pkg/filebuffer"
+	"github.com/openllb/hlb/solver"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPromptHistory(t *testing.T) {
+	t.Parallel()
+
+	historyFile := filepath.Join(t.TempDir(), ".hlb_history")
+
+	l, err := newPrompt(historyFile, io.NopCloser(strings.NewReader("break foo\nnext\n")), io.Discard, io.Discard)
+	require.NoError(t, err)
+	for _, expected := range []string{"break foo", "next"} {
+		line, err := l.Readline()
+		require.NoError(t, err)
+		require.Equal(t, expected, line)
+	}
+	require.NoError(t, l.Close())
+
+	dt, err := os.ReadFile(historyFile)
+	require.NoError(t, err)
+	require.Equal(t, "break foo\nnext\n", string(dt))
+
+	// Pressing the up arrow twice in a new session recalls the older command.
+	l, err = newPrompt(historyFile, io.NopCloser(strings.NewReader("\x1b[A\x1b[A\n")), io.Discard, io.Discard)
+	require.NoError(t, err)
+	defer l.Close()
+
+	line, err := l.Readline()
+	require.NoError(t, err)
+	require.Equal(t, "break foo", line)
+}
+
+func TestHandlePrint(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	failed := codegen.NewRegister(ctx)
+	failed.SetAsync(func(codegen.Value) (codegen.Value, error) {
+		return nil, errors.New("image not found")
+	})
+
+	imod := &ast.Module{Scope: ast.NewScope(nil, ast.ModuleScope, nil)}
+	imod.Scope.Insert(&ast.Object{Kind: ast.String, Ident: ast.NewIdent("version"), Data: "v1.0.0"})
+
+	scope := ast.NewScope(nil, ast.ArgsScope, nil)
+	for _, obj := range []*ast.Object{
+		{Kind: ast.String, Ident: ast.NewIdent("ref"), Data: "alpine"},
+		{Kind: ast.Int, Ident: ast.NewIdent("mode"), Data: 0o644},
+		{Kind: ast.Bool, Ident: ast.NewIdent("verbose"), Data: "true"},
+		{Kind: ast.List, Ident: ast.NewIdent("args"), Data: []string{"-v", "./..."}},
+		{Kind: ast.Filesystem, Ident: ast.NewIdent("input"), Data: codegen.Filesystem{State: llb.Scratch()}},
+		{Kind: ast.Filesystem, Ident: ast.NewIdent("build"), Node: &ast.FuncDecl{}},
+		{Kind: ast.String, Ident: ast.NewIdent("failed"), Data: failed},
+		{Ident: ast.NewIdent("lib"), Node: &ast.ImportDecl{}, Data: imod},
+	} {
+		scope.Insert(obj)
+	}
+	s := &codegen.State{Ctx: ctx, Scope: scope}
+
+	type testCase struct {
+		name     string
+		args     []string
+		expected string
+		hasErr   bool
+	}
+
+	for _, tc := range []testCase{{
+		"string",
+		[]string{"ref"},
+		"ref = \"alpine\"\n",
+		false,
+	}, {
+		"int",
+		[]string{"mode"},
+		"mode = 420\n",
+		false,
+	}, {
+		"bool",
+		[]string{"verbose"},
+		"verbose = true\n",
+		false,
+	}, {
+		"list",
+		[]string{"args"},
+		"args = [\"-v\", \"./...\"]\n",
+		false,
+	}, {
+		"filesystem",
+		[]string{"input"},
+		"input = fs scratch\n",
+		false,
+	}, {
+		"function",
+		[]string{"build"},
+		"build = <fs>\n",
+		false,
+	}, {
+		"error is printed inline",
+		[]string{"failed"},
+		"failed = err: image not found\n",
+		false,
+	}, {
+		"selector",
+		[]string{"lib.version"},
+		"lib.version = \"v1.0.0\"\n",
+		false,
+	}, {
+		"undefined",
+		[]string{"missing"},
+		"",
+		true,
+	}, {
+		"no args",
+		nil,
+		"",
+		true,
+	}} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var buf bytes.Buffer
+			err := handlePrint(&buf, s, tc.args)
+			if tc.hasErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, buf.String())
+		})
+	}
+}
+
+func TestHandleArgs(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	platform := specs.Platform{OS: "linux", Architecture: "amd64"}
+	input := codegen.Filesystem{
+		State: llb.Image("alpine").AddEnv("PATH", "/bin").AddEnv("HOME", "/root"),
+		Image: &solver.ImageSpec{
+			Annotations: map[string]string{
+				specs.AnnotationBaseImageName: "docker.io/library/alpine:latest",
+			},
+		},
+		Platform: platform,
+	}
+	dgst, err := input.Digest(ctx)
+	require.NoError(t, err)
+
+	scope := ast.NewScope(nil, ast.ArgsScope, nil)
+	for _, obj := range []*ast.Object{
+		{Kind: ast.String, Ident: ast.NewIdent("ref"), Data: "alpine"},
+		{Kind: ast.Filesystem, Ident: ast.NewIdent("input"), Data: input},
+	} {
+		scope.Insert(obj)
+	}
+
+	var buf bytes.Buffer
+	err = handleArgs(&buf, &codegen.State{Ctx: ctx, Scope: scope})
+	require.NoError(t, err)
+	require.Equal(t, dedent.Dedent(fmt.Sprintf(`
+		input = fs %s (linux/amd64, from docker.io/library/alpine:latest, 2 env)
+		ref = "alpine"
+	`, dgst))[1:], buf.String())
+}
+
+func TestHandleWhatis(t *testing.T) {
+	t.Parallel()
+
+	ctx := filebuffer.WithBuffers(context.Background(), builtin.Buffers())
+	ctx = ast.WithModules(ctx, builtin.Modules())
+
+	mod, err := parser.Parse(ctx, strings.NewReader(dedent.Dedent(`
+	fs build(string ref) {
+		image ref
+		run "make" with offline
+	}
+
+	option::run offline() {
+		network "none"
+	}
+	`)))
+	require.NoError(t, err)
+
+	err = checker.SemanticPass(mod)
+	require.NoError(t, err)
+
+	err = checker.Check(mod)
+	require.NoError(t, err)
+
+	fd, ok := mod.Scope.Lookup("build").Node.(*ast.FuncDecl)
+	require.True(t, ok)
+	s := &codegen.State{Ctx: ctx, Scope: fd.Scope}
+
+	// Commands are read by the prompt as they are in a debugging session.
+	l, err := newPrompt("", io.NopCloser(strings.NewReader(strings.Join([]string{
+		"whatis ref",
+		"whatis build",
+		"whatis offline",
+		"whatis format",
+		"whatis missing",
+		"whatis",
+	}, "\n")+"\n")), io.Discard, io.Discard)
+	require.NoError(t, err)
+	defer l.Close()
+
+	var stdout, stderr bytes.Buffer
+	for {
+		line, err := l.Readline()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		require.NoError(t, err)
+
+		args, err := shellquote.Split(line)
+		require.NoError(t, err)
+		require.Equal(t, "whatis", args[0])
+
+		err = handleWhatis(&stdout, s, args[1:])
+		if err != nil {
+			printError(&stderr, s, err)
+		}
+	}
+
+	require.Equal(t, strings.Join([]string{
+		"string",
+		"fs",
+		"option::run",
+		"string format(string formatString, variadic string values)",
+		"",
+	}, "\n"), stdout.String())
+	require.Equal(t, strings.Join([]string{
+		"Command failed: undefined: missing",
+		"Command failed: whatis requires exactly 1 arg",
+		"",
+	}, "\n"), stderr.String())
+}
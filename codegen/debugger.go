@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"regexp"
+	"strconv"
 	"strings"
 	"sync"
 
@@ -17,6 +19,11 @@ import (
 var (
 	// ErrDebugExit is a special error to early exit from a program.
 	ErrDebugExit = errors.Errorf("exiting debugger")
+
+	// ErrImportNotLoaded is returned when an expression selects from an
+	// import that isn't loaded yet, since imports are loaded when they are
+	// first called.
+	ErrImportNotLoaded = errors.Errorf("import is not loaded until it is first called")
 )
 
 // Debugger is a source-level debugger that provides controls over the program
@@ -55,6 +62,10 @@ type Debugger interface {
 	// ClearBreakpoint deletes a breakpoint.
 	ClearBreakpoint(bp *Breakpoint) error
 
+	// SetVariable sets a string or int argument in the current scope to a new
+	// value, which is used for the rest of the program.
+	SetVariable(name, value string) (*ast.Object, error)
+
 	// Terminate sends a signal to end the debugging session.
 	Terminate() error
 
@@ -102,6 +113,35 @@ type State struct {
 	Err        error
 }
 
+// exprRegexp matches the expressions that can be evaluated, which are
+// identifiers optionally referencing an identifier of an imported module.
+var exprRegexp = regexp.MustCompile(`^([\w:]+)(?:\.([\w:]+))?$`)
+
+// LookupExpr returns the object the expression refers to in scope, or nil if
+// it is undefined. It is shared by the debugger frontends to evaluate the
+// expressions of their users. Selecting from an import that isn't loaded yet
+// returns ErrImportNotLoaded.
+func LookupExpr(scope *ast.Scope, expr string) (*ast.Object, error) {
+	matches := exprRegexp.FindStringSubmatch(strings.TrimSpace(expr))
+	if matches == nil {
+		return nil, fmt.Errorf("unable to evaluate %q: expected an identifier or selector", expr)
+	}
+
+	obj := scope.Lookup(matches[1])
+	if obj == nil || matches[2] == "" {
+		return obj, nil
+	}
+
+	if _, ok := obj.Node.(*ast.ImportDecl); !ok {
+		return nil, nil
+	}
+	imod, ok := obj.Data.(*ast.Module)
+	if !ok {
+		return nil, errors.Wrapf(ErrImportNotLoaded, "unable to evaluate %q", expr)
+	}
+	return imod.Scope.Lookup(matches[2]), nil
+}
+
 type debugger struct {
 	cln *client.Client
 	err error
@@ -198,9 +238,34 @@ func (d *debugger) Breakpoints() ([]*Breakpoint, error) {
 }
 
 func (d *debugger) CreateBreakpoint(bp *Breakpoint) (*Breakpoint, error) {
+	if bp.Node == nil && bp.Func != nil {
+		bp.Node = bp.Func.Sig.Name
+	}
 	if _, ok := d.breakpointIDs[bp.ID()]; ok {
 		return bp, fmt.Errorf("breakpoint already exists at %s", bp.ID())
 	}
+	// The condition of a pending breakpoint is parsed once its function is
+	// resolved.
+	if bp.Condition != "" && !bp.Pending() {
+		if len(d.recording) == 0 {
+			return bp, fmt.Errorf("cannot set condition before program start")
+		}
+		mod, ok := d.recording[0].Scope.ByLevel(ast.ModuleScope).Node.(*ast.Module)
+		if !ok {
+			return bp, fmt.Errorf("failed to find module scope")
+		}
+
+		scope := conditionScope(mod, bp.Node)
+		if bp.Func != nil && bp.Func.Scope != nil {
+			scope = bp.Func.Scope
+		}
+
+		var err error
+		bp.cond, err = parseCondition(scope, bp.Condition)
+		if err != nil {
+			return bp, err
+		}
+	}
 	if bp.SourceDefined {
 		d.sourceDefinedBreakpoints = append(d.sourceDefinedBreakpoints, bp)
 	} else {
@@ -231,6 +296,47 @@ func (d *debugger) ClearBreakpoint(bp *Breakpoint) error {
 	return nil
 }
 
+func (d *debugger) SetVariable(name, value string) (*ast.Object, error) {
+	s, err := d.GetState()
+	if err != nil {
+		return nil, err
+	}
+
+	obj := s.Scope.Lookup(name)
+	if obj == nil {
+		return nil, fmt.Errorf("undefined: %s", name)
+	}
+	if _, ok := obj.Node.(*ast.Field); !ok {
+		return nil, fmt.Errorf("cannot set %s: only arguments can be set", name)
+	}
+
+	var iface interface{}
+	switch obj.Kind {
+	case ast.String:
+		iface = value
+		if str, err := strconv.Unquote(value); err == nil {
+			iface = str
+		}
+	case ast.Int:
+		iface, err = strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("cannot set %s: %q is not an int", name, value)
+		}
+	default:
+		return nil, fmt.Errorf("cannot set %s: only string and int arguments can be set, not %s", name, obj.Kind)
+	}
+
+	// Arguments are looked up by their register, so replacing it changes the
+	// value for the rest of the program without affecting the caller.
+	reg := NewRegister(s.Ctx)
+	err = reg.Set(iface)
+	if err != nil {
+		return nil, err
+	}
+	obj.Data = reg
+	return obj, nil
+}
+
 func (d *debugger) Terminate() error {
 	// Set debugger error so that next yield it exits early.
 	d.err = ErrDebugExit
@@ -446,14 +552,18 @@ func (d *debugger) stopReason(s *State) string {
 			return ""
 		}
 
-		// Break if the stop node is one of the breakpoints.
+		// Break if the stop node is one of the breakpoints whose condition, if
+		// any, is true.
 		for _, bp := range d.breakpoints {
-			if bp.Position().Filename == stop.Position().Filename &&
-				ast.IsPositionWithinNode(
-					stop.Subject(),
-					bp.Position().Line,
-					bp.Position().Column,
-				) {
+			d.resolvePending(bp)
+			if bp.halts(s, stop) {
+				if bp.cond != nil {
+					// Halt on errors so that they aren't silently ignored.
+					ok, err := bp.cond.eval(s.Scope)
+					if err == nil && !ok {
+						continue
+					}
+				}
 				return "breakpoint"
 			}
 		}
@@ -461,6 +571,34 @@ func (d *debugger) stopReason(s *State) string {
 	return ""
 }
 
+// resolvePending resolves the function of a pending breakpoint once the module
+// it is imported from is loaded.
+func (d *debugger) resolvePending(bp *Breakpoint) {
+	if !bp.Pending() || len(d.recording) == 0 {
+		return
+	}
+
+	obj, err := LookupExpr(d.recording[0].Scope.ByLevel(ast.ModuleScope), bp.FuncName)
+	if err != nil || obj == nil {
+		return
+	}
+	fd, ok := obj.Node.(*ast.FuncDecl)
+	if !ok {
+		return
+	}
+
+	delete(d.breakpointIDs, bp.ID())
+	bp.Func = fd
+	bp.Node = fd.Sig.Name
+	d.breakpointIDs[bp.ID()] = struct{}{}
+
+	if bp.Condition != "" {
+		// A condition that fails to parse halts on every call, so that the
+		// error isn't silently ignored.
+		bp.cond, _ = parseCondition(fd.Scope, bp.Condition)
+	}
+}
+
 func (d *debugger) findSourceDefinedBreakpoints(mod *ast.Module) {
 	ast.Match(mod, ast.MatchOpts{},
 		func(block *ast.BlockStmt, call *ast.CallStmt) {
@@ -521,9 +659,61 @@ type Breakpoint struct {
 
 	// SourceDefined is true if the breakpoint is defined by the source.
 	SourceDefined bool
+
+	// Condition is an optional boolean expression comparing the arguments of
+	// the function the breakpoint is in, such as `ref == "alpine"`. The
+	// breakpoint only halts the program when it is true.
+	Condition string
+
+	// Func is the function the breakpoint was set on by name instead of by
+	// position. The breakpoint halts when the function is entered, or when it
+	// is called if it is a builtin.
+	Func *ast.FuncDecl
+
+	// FuncName is the name of a function of an imported module, like
+	// `other.build`, that the breakpoint was set on before the import was
+	// loaded. The breakpoint is pending until the function is resolved.
+	FuncName string
+
+	cond *condition
+}
+
+// halts returns whether the breakpoint is at the stop node of the state.
+func (bp *Breakpoint) halts(s *State, stop ast.StopNode) bool {
+	if bp.Pending() {
+		return false
+	}
+	if bp.Func != nil {
+		// Builtins have no body to enter, so their calls are matched by the
+		// declaration of the kind they are called as.
+		ie, ok := stop.Subject().(*ast.IdentExpr)
+		if ok && ie.Reference == nil && s.Scope != nil {
+			obj := s.Scope.Lookup(ie.Ident.Text)
+			if obj != nil {
+				if bd, ok := obj.Node.(*ast.BuiltinDecl); ok {
+					return bd.FuncDecl(ReturnType(s.Ctx)) == bp.Func
+				}
+			}
+		}
+	}
+	return bp.Position().Filename == stop.Position().Filename &&
+		ast.IsPositionWithinNode(
+			stop.Subject(),
+			bp.Position().Line,
+			bp.Position().Column,
+		)
+}
+
+// Pending returns true if the breakpoint is set on a function of an import
+// that isn't loaded yet.
+func (bp *Breakpoint) Pending() bool {
+	return bp.Node == nil && bp.FuncName != ""
 }
 
 func (bp *Breakpoint) ID() string {
+	if bp.Pending() {
+		return bp.FuncName
+	}
 	return diagnostic.FormatPos(bp.Position())
 }
 
@@ -533,6 +723,14 @@ func (bp *Breakpoint) Print(ctx context.Context, w io.Writer, cleared bool) {
 	if cleared {
 		name = color.Sprintf(color.StrikeThrough(name))
 	}
+	if bp.Pending() {
+		fmt.Fprintf(w, color.Sprintf(
+			"%s pending on %s\n",
+			color.Yellow(name),
+			bp.FuncName,
+		))
+		return
+	}
 	fmt.Fprintf(w, color.Sprintf(
 		"%s at ",
 		color.Yellow(name),
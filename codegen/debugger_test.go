@@ -1,7 +1,13 @@
 package codegen
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
 	"testing"
+
+	"github.com/openllb/hlb/parser/ast"
+	"github.com/stretchr/testify/require"
 )
 
 func TestDebugger(t *testing.T) {
@@ -9,3 +15,90 @@ func TestDebugger(t *testing.T) {
 		return NewDebugger(nil)
 	})
 }
+
+func TestDebuggerFunctionBreakpoint(t *testing.T) {
+	t.Parallel()
+
+	input := `
+	fs default() {
+		bar
+	}
+
+	fs bar() {
+		image "alpine"
+		run "echo foo" with option {
+			mount scratch "/in"
+		}
+	}
+	`
+
+	controlDebugger(t, NewDebugger(nil), input, func(t *testing.T, d Debugger, mod *ast.Module) {
+		line5 := ast.Search(mod, `fs bar()`).(ast.StopNode)
+		line8 := ast.Search(mod, `mount scratch "/in"`).(ast.StopNode)
+
+		mount, ok := mod.Scope.Lookup("mount").Node.(*ast.BuiltinDecl)
+		require.True(t, ok)
+
+		for _, fd := range []*ast.FuncDecl{
+			mount.FuncDeclByKind[ast.Kind("option::run")],
+			mod.Scope.Lookup("bar").Node.(*ast.FuncDecl),
+		} {
+			_, err := d.CreateBreakpoint(&Breakpoint{Func: fd})
+			require.NoError(t, err)
+		}
+
+		// User functions halt when they are entered.
+		s, err := d.Continue(ForwardDirection)
+		require.NoError(t, err)
+		requireSameNode(t, line5, s.Node)
+
+		// Builtins halt when they are called as the kind of the breakpoint.
+		s, err = d.Continue(ForwardDirection)
+		require.NoError(t, err)
+		requireSameNode(t, line8, s.Node)
+	})
+}
+
+func TestDebuggerPendingFunctionBreakpoint(t *testing.T) {
+	t.Parallel()
+
+	other := filepath.Join(t.TempDir(), "other.hlb")
+	err := os.WriteFile(other, []byte(cleanup(`
+	export build
+
+	fs build() {
+		image "alpine"
+	}
+	`)), 0o644)
+	require.NoError(t, err)
+
+	input := fmt.Sprintf(`
+	import other from %q
+
+	fs default() {
+		scratch
+		other.build
+	}
+	`, other)
+
+	controlDebugger(t, NewDebugger(nil), input, func(t *testing.T, d Debugger, mod *ast.Module) {
+		// Imports are only loaded when they are first called.
+		_, err := LookupExpr(mod.Scope, "other.build")
+		require.ErrorIs(t, err, ErrImportNotLoaded)
+
+		bp, err := d.CreateBreakpoint(&Breakpoint{FuncName: "other.build"})
+		require.NoError(t, err)
+		require.True(t, bp.Pending())
+
+		// The breakpoint is resolved once the call loads the import, and halts
+		// when the imported function is entered.
+		s, err := d.Continue(ForwardDirection)
+		require.NoError(t, err)
+		require.False(t, bp.Pending())
+		require.Equal(t, other, s.Node.Position().Filename)
+		require.Equal(t, "fs build()", s.Node.String())
+
+		err = d.ClearBreakpoint(bp)
+		require.NoError(t, err)
+	})
+}
@@ -48,9 +48,15 @@ func SubtestDebuggerSuite(t *testing.T, factory DebuggerFactory) {
 	}, {
 		"breakpoint",
 		SubtestDebuggerBreakpoint,
+	}, {
+		"conditional breakpoint",
+		SubtestDebuggerConditionalBreakpoint,
 	}, {
 		"source-defined breakpoint",
 		SubtestDebuggerSourceDefinedBreakpoint,
+	}, {
+		"set variable",
+		SubtestDebuggerSetVariable,
 	}} {
 		tc := tc
 		t.Run(tc.name, func(t *testing.T) {
@@ -442,6 +448,117 @@ func SubtestDebuggerBreakpoint(t *testing.T, d Debugger) {
 	})
 }
 
+// SubtestDebuggerConditionalBreakpoint tests that the debugger only halts at
+// conditional breakpoints when their condition is true.
+func SubtestDebuggerConditionalBreakpoint(t *testing.T, d Debugger) {
+	input := `
+	fs default() {
+		build "busybox" 1
+		build "alpine" 2
+	}
+
+	fs build(string ref, int attempt) {
+		image ref
+	}
+	`
+
+	controlDebugger(t, d, input, func(t *testing.T, d Debugger, mod *ast.Module) {
+		line7 := ast.Search(mod, `image ref`).(ast.StopNode)
+
+		for _, condition := range []string{
+			`ref == 1`,
+			`attempt == "2"`,
+			`tag == "alpine"`,
+			`build == "alpine"`,
+			`ref ==`,
+			`ref == "alpine" &&`,
+			`ref < "alpine"`,
+		} {
+			_, err := d.CreateBreakpoint(&Breakpoint{
+				Node:      line7.Subject(),
+				Condition: condition,
+			})
+			require.Error(t, err, condition)
+		}
+
+		_, err := d.CreateBreakpoint(&Breakpoint{
+			Node:      line7.Subject(),
+			Condition: `ref == "alpine" && attempt != 1 || ref == "scratch"`,
+		})
+		require.NoError(t, err)
+
+		// Continue past the first invocation to the second.
+		s, err := d.Continue(ForwardDirection)
+		require.NoError(t, err)
+		requireSameNode(t, line7, s.Node)
+		logState(t, s, "line7")
+
+		ref, ok := s.Scope.Lookup("ref").Data.(Register)
+		require.True(t, ok)
+		value, err := ref.Value().String()
+		require.NoError(t, err)
+		require.Equal(t, "alpine", value)
+
+		// Final continue should exit program.
+		s, err = d.Continue(ForwardDirection)
+		require.Nil(t, s)
+		require.ErrorIs(t, err, ErrDebugExit)
+	})
+}
+
+// SubtestDebuggerSetVariable tests that the debugger can set arguments, and
+// that the program continues with their new values.
+func SubtestDebuggerSetVariable(t *testing.T, d Debugger) {
+	input := `
+	fs default() {
+		build scratch "alpine"
+	}
+
+	fs build(fs base, string ref) {
+		image ref
+		env "REF" ref
+		run "true"
+	}
+	`
+
+	controlDebugger(t, d, input, func(t *testing.T, d Debugger, mod *ast.Module) {
+		line6 := ast.Search(mod, `image ref`)
+		line8 := ast.Search(mod, `run "true"`)
+
+		_, err := d.CreateBreakpoint(&Breakpoint{Node: line6})
+		require.NoError(t, err)
+
+		s, err := d.Continue(ForwardDirection)
+		require.NoError(t, err)
+		requireSameNode(t, line6, s.Node)
+
+		// Only string and int arguments can be set.
+		_, err = d.SetVariable("base", "scratch")
+		require.Error(t, err)
+		_, err = d.SetVariable("build", `"busybox"`)
+		require.Error(t, err)
+		_, err = d.SetVariable("missing", `"busybox"`)
+		require.Error(t, err)
+
+		obj, err := d.SetVariable("ref", `"busybox"`)
+		require.NoError(t, err)
+		require.Equal(t, "ref", obj.Ident.Text)
+
+		_, err = d.CreateBreakpoint(&Breakpoint{Node: line8})
+		require.NoError(t, err)
+
+		s, err = d.Continue(ForwardDirection)
+		require.NoError(t, err)
+		requireSameNode(t, line8, s.Node)
+
+		fs, err := s.Value.Filesystem()
+		require.NoError(t, err)
+		ref, _, err := fs.State.GetEnv(s.Ctx, "REF")
+		require.NoError(t, err)
+		require.Equal(t, "busybox", ref)
+	})
+}
+
 // SubtestDebuggerSourceDefinedBreakpoint tests that the debugger can parse
 // source defined breakpoints and halt at them.
 func SubtestDebuggerSourceDefinedBreakpoint(t *testing.T, d Debugger) {
@@ -592,7 +709,7 @@ func generate(t *testing.T, ctx context.Context, input string) {
 	require.NoError(t, err)
 
 	cg := New(nil, nil)
-	_, err = cg.Generate(ctx, mod, []Target{{"default"}})
+	_, err = cg.Generate(ctx, mod, []Target{{Name: "default"}})
 	if err != nil {
 		require.ErrorIs(t, err, ErrDebugExit)
 	}
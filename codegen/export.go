@@ -0,0 +1,109 @@
+package codegen
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/openllb/hlb/errdefs"
+)
+
+// exportFile is the local file that a tarball is exported to. BuildKit closes
+// it once the export is transferred, which also flushes it to disk so the
+// file is complete by the time the build reports success.
+type exportFile struct {
+	f *os.File
+
+	// checksums are the digests the exported bytes are verified against.
+	checksums []*DownloadChecksum
+
+	mu      sync.Mutex
+	written int64
+	closed  bool
+	err     error
+}
+
+func createExportFile(localPath string) (*exportFile, error) {
+	f, err := os.Create(localPath)
+	if err != nil {
+		return nil, err
+	}
+	return &exportFile{f: f}, nil
+}
+
+func (ef *exportFile) Write(p []byte) (int, error) {
+	n, err := ef.f.Write(p)
+	ef.mu.Lock()
+	ef.written += int64(n)
+	ef.mu.Unlock()
+	return n, err
+}
+
+// Close syncs and closes the file. It is safe to call multiple times.
+func (ef *exportFile) Close() error {
+	ef.mu.Lock()
+	defer ef.mu.Unlock()
+	if ef.closed {
+		return ef.err
+	}
+	ef.closed = true
+
+	ef.err = ef.f.Sync()
+	err := ef.f.Close()
+	if ef.err == nil {
+		ef.err = err
+	}
+	return ef.err
+}
+
+// finish closes the file when the export's solve returns, in case it failed
+// before BuildKit closed it. If the solve succeeded, it also verifies that
+// everything written made it to disk and matches the expected checksums, and
+// removes the file if it doesn't match so it isn't mistaken for a good one.
+func (ef *exportFile) finish(solveErr error) error {
+	err := ef.Close()
+	if solveErr != nil {
+		return solveErr
+	}
+	if err != nil {
+		return err
+	}
+
+	fi, err := os.Stat(ef.f.Name())
+	if err != nil {
+		return err
+	}
+
+	ef.mu.Lock()
+	written := ef.written
+	ef.mu.Unlock()
+	if fi.Size() != written {
+		return fmt.Errorf("export to %s is incomplete: wrote %d bytes but found %d", ef.f.Name(), written, fi.Size())
+	}
+
+	err = ef.verify()
+	if err != nil {
+		os.Remove(ef.f.Name())
+		return err
+	}
+	return nil
+}
+
+// verify hashes the exported file and compares it to each expected checksum.
+func (ef *exportFile) verify() error {
+	for _, checksum := range ef.checksums {
+		f, err := os.Open(ef.f.Name())
+		if err != nil {
+			return err
+		}
+		actual, err := checksum.Digest.Algorithm().FromReader(f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+		if actual != checksum.Digest {
+			return errdefs.WithChecksumMismatch(checksum, ef.f.Name(), checksum.Digest.String(), actual.String())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package codegen
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/openllb/hlb/parser/ast"
+	"github.com/openllb/hlb/pkg/llbutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportFile(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	localPath := filepath.Join(dir, "out.tar")
+
+	f, err := createExportFile(localPath)
+	require.NoError(t, err)
+
+	// Export the way BuildKit's sync target does, closing when it's done.
+	wc, err := llbutil.OutputFromWriter(f)(nil)
+	require.NoError(t, err)
+	_, err = wc.Write([]byte("hello "))
+	require.NoError(t, err)
+	_, err = wc.Write([]byte("world"))
+	require.NoError(t, err)
+	err = wc.Close()
+	require.NoError(t, err)
+
+	err = f.finish(nil)
+	require.NoError(t, err)
+
+	dt, err := os.ReadFile(localPath)
+	require.NoError(t, err)
+	require.Equal(t, "hello world", string(dt))
+
+	_, err = f.f.Write([]byte("!"))
+	require.ErrorIs(t, err, os.ErrClosed)
+}
+
+func TestExportFileSolveError(t *testing.T) {
+	t.Parallel()
+
+	f, err := createExportFile(filepath.Join(t.TempDir(), "out.tar"))
+	require.NoError(t, err)
+
+	_, err = f.Write([]byte("partial"))
+	require.NoError(t, err)
+
+	solveErr := errors.New("solve failed")
+	err = f.finish(solveErr)
+	require.ErrorIs(t, err, solveErr)
+
+	_, err = f.f.Write([]byte("!"))
+	require.ErrorIs(t, err, os.ErrClosed)
+}
+
+func TestExportFileIncomplete(t *testing.T) {
+	t.Parallel()
+
+	localPath := filepath.Join(t.TempDir(), "out.tar")
+	f, err := createExportFile(localPath)
+	require.NoError(t, err)
+
+	_, err = f.Write([]byte("hello world"))
+	require.NoError(t, err)
+	err = f.Close()
+	require.NoError(t, err)
+
+	err = os.Truncate(localPath, 5)
+	require.NoError(t, err)
+
+	err = f.finish(nil)
+	require.EqualError(t, err, "export to "+localPath+" is incomplete: wrote 11 bytes but found 5")
+}
+
+func TestExportFileChecksum(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		name     string
+		checksum digest.Digest
+		err      string
+	}{{
+		"matching checksum",
+		digest.FromString("hello world"),
+		"",
+	}, {
+		"mismatching checksum",
+		digest.FromString("hello"),
+		"checksum mismatch for %s: expected " + digest.FromString("hello").String() + " but got " + digest.FromString("hello world").String(),
+	}} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			localPath := filepath.Join(t.TempDir(), "out.tar")
+			f, err := createExportFile(localPath)
+			require.NoError(t, err)
+			f.checksums = append(f.checksums, &DownloadChecksum{&ast.CallStmt{}, tc.checksum})
+
+			_, err = f.Write([]byte("hello world"))
+			require.NoError(t, err)
+
+			err = f.finish(nil)
+			if tc.err == "" {
+				require.NoError(t, err)
+				require.FileExists(t, localPath)
+			} else {
+				require.ErrorContains(t, err, fmt.Sprintf(tc.err, localPath))
+				require.NoFileExists(t, localPath)
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package codegen
+
+import (
+	"context"
+	"testing"
+
+	"github.com/moby/buildkit/client/llb"
+	"github.com/moby/buildkit/solver/pb"
+	specs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/openllb/hlb/pkg/llbutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFrontendRequest(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	val, err := NewValue(ctx, Option{})
+	require.NoError(t, err)
+
+	val, err = FrontendTarget{}.Call(ctx, nil, val, nil, "build")
+	require.NoError(t, err)
+
+	val, err = FrontendBuildArg{}.Call(ctx, nil, val, nil, "GO_VERSION", "1.22")
+	require.NoError(t, err)
+
+	val, err = FrontendOpt{}.Call(ctx, nil, val, nil, "no-cache", "")
+	require.NoError(t, err)
+
+	opts, err := val.Option()
+	require.NoError(t, err)
+
+	req := frontendRequest("docker.io/docker/dockerfile:latest")
+	for _, opt := range opts {
+		if o, ok := opt.(llbutil.GatewayOption); ok {
+			o(&req)
+		}
+	}
+
+	require.Equal(t, "gateway.v0", req.Frontend)
+	require.Equal(t, map[string]string{
+		"source":               "docker.io/docker/dockerfile:latest",
+		"target":               "build",
+		"build-arg:GO_VERSION": "1.22",
+		"no-cache":             "",
+	}, req.FrontendOpt)
+}
+
+func TestDockerfileRequest(t *testing.T) {
+	t.Parallel()
+
+	arm64 := specs.Platform{OS: "linux", Architecture: "arm64"}
+	ctx := WithDefaultPlatform(context.Background(), arm64)
+	source := llbutil.AuthSource{Host: "registry.local", Token: "s3cr3t"}
+	input := Filesystem{
+		State:       llb.Local("context"),
+		SessionOpts: []llbutil.SessionOption{llbutil.WithAuthSource(source)},
+		Platform:    arm64,
+	}
+
+	val, err := NewValue(ctx, Option{})
+	require.NoError(t, err)
+
+	val, err = FrontendTarget{}.Call(ctx, nil, val, nil, "build")
+	require.NoError(t, err)
+
+	val, err = FrontendBuildArg{}.Call(ctx, nil, val, nil, "GO_VERSION", "1.22")
+	require.NoError(t, err)
+
+	opts, err := val.Option()
+	require.NoError(t, err)
+
+	req, opts, err := dockerfileRequest(ctx, input, "build/Dockerfile", opts)
+	require.NoError(t, err)
+
+	var sessionOpts []llbutil.SessionOption
+	for _, opt := range opts {
+		switch o := opt.(type) {
+		case llbutil.GatewayOption:
+			o(&req)
+		case llbutil.SessionOption:
+			sessionOpts = append(sessionOpts, o)
+		}
+	}
+
+	require.Equal(t, "dockerfile.v0", req.Frontend)
+	require.Equal(t, map[string]string{
+		"filename":             "build/Dockerfile",
+		"platform":             "linux/arm64",
+		"target":               "build",
+		"build-arg:GO_VERSION": "1.22",
+	}, req.FrontendOpt)
+
+	// The input is both the context and the source of the Dockerfile.
+	require.Len(t, req.FrontendInputs, 2)
+	require.Equal(t, req.FrontendInputs["context"], req.FrontendInputs["dockerfile"])
+
+	var identifiers []string
+	for _, dt := range req.FrontendInputs["context"].Def {
+		var op pb.Op
+		err = op.Unmarshal(dt)
+		require.NoError(t, err)
+
+		if src := op.GetSource(); src != nil {
+			identifiers = append(identifiers, src.Identifier)
+		}
+	}
+	require.Equal(t, []string{"local://context"}, identifiers)
+
+	// The session of the input is kept, so local contexts are synced.
+	si := &llbutil.SessionInfo{AuthSourceByHost: make(map[string]llbutil.AuthSource)}
+	for _, opt := range sessionOpts {
+		opt(si)
+	}
+	require.Equal(t, map[string]llbutil.AuthSource{"registry.local": source}, si.AuthSourceByHost)
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strings"
 
 	"github.com/docker/buildx/util/progress"
 	"github.com/moby/buildkit/client"
@@ -14,7 +15,6 @@ import (
 	"github.com/moby/buildkit/solver/pb"
 	"github.com/openllb/hlb/pkg/llbutil"
 	"github.com/openllb/hlb/solver"
-	"github.com/pkg/errors"
 	"golang.org/x/crypto/ssh/terminal"
 	"golang.org/x/sync/errgroup"
 )
@@ -23,6 +23,7 @@ func ExecWithFS(ctx context.Context, cln *client.Client, fs Filesystem, opts Opt
 	var (
 		securityMode pb.SecurityMode
 		netMode      pb.NetMode
+		hostname     string
 		extraHosts   []*pb.HostIP
 		secrets      []llbutil.SecretOption
 		ssh          []llbutil.SSHOption
@@ -67,6 +68,10 @@ func ExecWithFS(ctx context.Context, cln *client.Client, fs Filesystem, opts Opt
 				Host: o.Host,
 				IP:   o.IP.String(),
 			})
+		case llbutil.HostnameOption:
+			hostname = o.Hostname
+		case llbutil.StdinOption:
+			stdin = strings.NewReader(o.Content)
 		case llbutil.SecretOption:
 			secrets = append(secrets, o)
 		case llbutil.SSHOption:
@@ -97,6 +102,7 @@ func ExecWithFS(ctx context.Context, cln *client.Client, fs Filesystem, opts Opt
 
 		return solver.Build(ctx, cln, s, pw, func(ctx context.Context, c gateway.Client) (res *gateway.Result, err error) {
 			ctrReq := gateway.NewContainerRequest{
+				Hostname:   hostname,
 				NetMode:    netMode,
 				ExtraHosts: extraHosts,
 			}
@@ -114,19 +120,9 @@ func ExecWithFS(ctx context.Context, cln *client.Client, fs Filesystem, opts Opt
 						gatewayMount.Selector = o.Path
 					case llbutil.CacheMountOption:
 						gatewayMount.MountType = pb.MountType_CACHE
-						gatewayMount.CacheOpt = &pb.CacheOpt{
-							ID:      o.ID,
-							Sharing: pb.CacheSharingOpt(o.Sharing),
-						}
-						switch o.Sharing {
-						case llb.CacheMountShared:
-							gatewayMount.CacheOpt.Sharing = pb.CacheSharingOpt_SHARED
-						case llb.CacheMountPrivate:
-							gatewayMount.CacheOpt.Sharing = pb.CacheSharingOpt_PRIVATE
-						case llb.CacheMountLocked:
-							gatewayMount.CacheOpt.Sharing = pb.CacheSharingOpt_LOCKED
-						default:
-							return nil, errors.Errorf("unrecognized cache sharing mode %v", o.Sharing)
+						gatewayMount.CacheOpt, err = gatewayCacheOpt(o)
+						if err != nil {
+							return nil, err
 						}
 					case llbutil.TmpfsMountOption:
 						gatewayMount.MountType = pb.MountType_TMPFS
@@ -271,6 +267,7 @@ func ExecWithSolveErr(ctx context.Context, c gateway.Client, se *solvererrdefs.S
 
 	ctr, err := c.NewContainer(ctx, gateway.NewContainerRequest{
 		Mounts:      mounts,
+		Hostname:    exec.Meta.Hostname,
 		NetMode:     exec.Network,
 		ExtraHosts:  exec.Meta.ExtraHosts,
 		Platform:    op.Platform,
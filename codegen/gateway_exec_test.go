@@ -0,0 +1,58 @@
+package codegen
+
+import (
+	"context"
+	"testing"
+
+	"github.com/moby/buildkit/solver/pb"
+	"github.com/openllb/hlb/pkg/llbutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGatewayCacheOpt(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		mode    string
+		sharing pb.CacheSharingOpt
+	}{{
+		"shared",
+		pb.CacheSharingOpt_SHARED,
+	}, {
+		"private",
+		pb.CacheSharingOpt_PRIVATE,
+	}, {
+		"locked",
+		pb.CacheSharingOpt_LOCKED,
+	}} {
+		tc := tc
+		t.Run(tc.mode, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			val, err := NewValue(ctx, Option{})
+			require.NoError(t, err)
+
+			val, err = CacheDir{}.Call(ctx, nil, val, nil, "gocache", "/root/.cache/go-build", tc.mode)
+			require.NoError(t, err)
+
+			opts, err := val.Option()
+			require.NoError(t, err)
+			require.Len(t, opts, 1)
+
+			mount, ok := opts[0].(*llbutil.MountRunOption)
+			require.True(t, ok)
+
+			var cacheOpt *pb.CacheOpt
+			for _, opt := range mount.Opts {
+				if o, ok := opt.(llbutil.CacheMountOption); ok {
+					cacheOpt, err = gatewayCacheOpt(o)
+					require.NoError(t, err)
+				}
+			}
+			require.NotNil(t, cacheOpt)
+			require.Equal(t, "gocache", cacheOpt.ID)
+			require.Equal(t, tc.sharing, cacheOpt.Sharing)
+		})
+	}
+}
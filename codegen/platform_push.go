@@ -0,0 +1,112 @@
+package codegen
+
+import (
+	"context"
+	"sync"
+
+	"github.com/moby/buildkit/client"
+	specs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/openllb/hlb/pkg/llbutil"
+	"github.com/openllb/hlb/solver"
+)
+
+// platformPushes collects the images pushed while generating targets for
+// multiple platforms, so that the images pushed to the same ref are exported
+// as a single multi-platform image index instead of overwriting each other.
+type platformPushes struct {
+	mu     sync.Mutex
+	target int
+	pushes []*platformPush
+}
+
+type platformPush struct {
+	ref       string
+	target    int
+	targets   []int
+	platforms []specs.Platform
+	params    []*solver.Params
+	setDigest func(string)
+}
+
+// setTarget sets the index of the target being generated.
+func (pp *platformPushes) setTarget(i int) {
+	pp.mu.Lock()
+	defer pp.mu.Unlock()
+	pp.target = i
+}
+
+// add registers the push of ref for a platform. The first push of a ref
+// records its artifact, which gets the digest of the image index once it is
+// pushed.
+func (pp *platformPushes) add(ctx context.Context, ref string, platform specs.Platform, params *solver.Params) {
+	pp.mu.Lock()
+	defer pp.mu.Unlock()
+
+	for _, push := range pp.pushes {
+		if push.ref == ref {
+			push.targets = append(push.targets, pp.target)
+			push.platforms = append(push.platforms, platform)
+			push.params = append(push.params, params)
+			return
+		}
+	}
+
+	pp.pushes = append(pp.pushes, &platformPush{
+		ref:       ref,
+		target:    pp.target,
+		targets:   []int{pp.target},
+		platforms: []specs.Platform{platform},
+		params:    []*solver.Params{params},
+		setDigest: recordArtifact(ctx, &Artifact{Type: ArtifactImage, Ref: ref}),
+	})
+}
+
+// discard removes the pushes of a target that failed to generate. A push
+// first registered by the target moves to the next target that pushes the
+// same ref.
+func (pp *platformPushes) discard(target int) {
+	pp.mu.Lock()
+	defer pp.mu.Unlock()
+
+	var pushes []*platformPush
+	for _, push := range pp.pushes {
+		var kept platformPush
+		for i, t := range push.targets {
+			if t == target {
+				continue
+			}
+			kept.targets = append(kept.targets, t)
+			kept.platforms = append(kept.platforms, push.platforms[i])
+			kept.params = append(kept.params, push.params[i])
+		}
+		if len(kept.targets) == 0 {
+			continue
+		}
+
+		push.targets, push.platforms, push.params = kept.targets, kept.platforms, kept.params
+		push.target = push.targets[0]
+		pushes = append(pushes, push)
+	}
+	pp.pushes = pushes
+}
+
+// fold adds the request of each push to the request of the target that first
+// pushed it, solving it in parallel with the target.
+func (pp *platformPushes) fold(requests []solver.Request) {
+	pp.mu.Lock()
+	defer pp.mu.Unlock()
+
+	for _, push := range pp.pushes {
+		setDigest := push.setDigest
+		push.params[0].SolveOpts = append(push.params[0].SolveOpts, solver.WithCallback(func(_ context.Context, resp *client.SolveResponse) error {
+			setDigest(resp.ExporterResponse[llbutil.KeyContainerImageDigest])
+			return nil
+		}))
+
+		request := solver.Single(push.params[0])
+		if len(push.params) > 1 {
+			request = solver.MultiPlatform(push.platforms, push.params)
+		}
+		requests[push.target] = solver.Parallel(requests[push.target], request)
+	}
+}
@@ -0,0 +1,127 @@
+package codegen
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"sync"
+)
+
+// ArtifactType is the kind of output produced by a run.
+type ArtifactType string
+
+const (
+	ArtifactImage         ArtifactType = "image"
+	ArtifactDirectory     ArtifactType = "directory"
+	ArtifactTarball       ArtifactType = "tarball"
+	ArtifactOCITarball    ArtifactType = "ociTarball"
+	ArtifactDockerTarball ArtifactType = "dockerTarball"
+)
+
+// Artifact is an output produced by a run, such as a pushed image or a
+// downloaded directory.
+type Artifact struct {
+	Type   ArtifactType `json:"type"`
+	Ref    string       `json:"ref,omitempty"`
+	Digest string       `json:"digest,omitempty"`
+	Path   string       `json:"path,omitempty"`
+}
+
+// Report collects the artifacts produced by a run. Artifacts are recorded
+// during code generation and details only known after solving, like image
+// digests, are filled in once their solve completes.
+//
+// The report also collects the local files the run reads, so that they can be
+// watched for changes. They aren't part of the JSON report.
+type Report struct {
+	mu        sync.Mutex
+	artifacts []*Artifact
+	sources   []string
+}
+
+func NewReport() *Report {
+	return &Report{}
+}
+
+// Artifacts returns a copy of the recorded artifacts in the order they were
+// recorded.
+func (r *Report) Artifacts() []Artifact {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	artifacts := make([]Artifact, len(r.artifacts))
+	for i, artifact := range r.artifacts {
+		artifacts[i] = *artifact
+	}
+	return artifacts
+}
+
+// Sources returns the absolute paths of the local module files and local
+// sources read by the run, in the order they were read.
+func (r *Report) Sources() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]string(nil), r.sources...)
+}
+
+// WriteJSON writes the report as a JSON document.
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(struct {
+		Artifacts []Artifact `json:"artifacts"`
+	}{r.Artifacts()})
+}
+
+func (r *Report) record(artifact *Artifact) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.artifacts = append(r.artifacts, artifact)
+}
+
+func (r *Report) recordSource(path string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, source := range r.sources {
+		if source == path {
+			return
+		}
+	}
+	r.sources = append(r.sources, path)
+}
+
+func (r *Report) setDigest(artifact *Artifact, dgst string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	artifact.Digest = dgst
+}
+
+// recordArtifact adds an artifact to the report in the context, if any. The
+// returned function sets the artifact's digest once it is known.
+func recordArtifact(ctx context.Context, artifact *Artifact) (setDigest func(string)) {
+	r := GetReport(ctx)
+	if r == nil {
+		return func(string) {}
+	}
+	r.record(artifact)
+	return func(dgst string) {
+		r.setDigest(artifact, dgst)
+	}
+}
+
+// recordSource adds a local path read by the run to the report in the context,
+// if any.
+func recordSource(ctx context.Context, path string) error {
+	r := GetReport(ctx)
+	if r == nil {
+		return nil
+	}
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	r.recordSource(path)
+	return nil
+}
@@ -11,6 +11,7 @@ import (
 	gateway "github.com/moby/buildkit/frontend/gateway/client"
 	digest "github.com/opencontainers/go-digest"
 	"github.com/openllb/hlb/parser/ast"
+	"github.com/openllb/hlb/pkg/imageutil"
 	"github.com/openllb/hlb/pkg/llbutil"
 	"github.com/openllb/hlb/solver"
 	"golang.org/x/sync/errgroup"
@@ -66,7 +67,35 @@ func (r *cachedImageResolver) ResolveImageConfig(ctx context.Context, ref string
 		return cfg.ref, cfg.dgst, cfg.config, nil
 	}
 
-	s, err := llbutil.NewSession(ctx)
+	if IsInsecureRegistry(ctx, ref) {
+		// BuildKit resolves images with the registry config of the daemon, so
+		// resolve insecure registries on the client instead.
+		resolver := imageutil.NewBufferedImageResolver(imageutil.WithInsecureRegistries(InsecureRegistries(ctx)...))
+		dgst, config, err = resolver.ResolveImageConfig(ctx, ref, opt)
+		if err != nil {
+			return
+		}
+		resolvedRef = ref
+	} else {
+		resolvedRef, dgst, config, err = r.solveImageConfig(ctx, ref, opt)
+		if err != nil {
+			return
+		}
+	}
+
+	r.mu.Lock()
+	r.cache[key] = &imageConfig{
+		ref:    resolvedRef,
+		dgst:   dgst,
+		config: config,
+	}
+	r.mu.Unlock()
+	return
+}
+
+// solveImageConfig resolves the image config through the BuildKit gateway.
+func (r *cachedImageResolver) solveImageConfig(ctx context.Context, ref string, opt sourceresolver.Opt) (resolvedRef string, dgst digest.Digest, config []byte, err error) {
+	s, err := llbutil.NewSession(ctx, AuthSourceOpts(ctx)...)
 	if err != nil {
 		return
 	}
@@ -93,16 +122,5 @@ func (r *cachedImageResolver) ResolveImageConfig(ctx context.Context, ref string
 	})
 
 	err = g.Wait()
-	if err != nil {
-		return
-	}
-
-	r.mu.Lock()
-	r.cache[key] = &imageConfig{
-		ref:    resolvedRef,
-		dgst:   dgst,
-		config: config,
-	}
-	r.mu.Unlock()
 	return
 }
@@ -67,6 +67,18 @@ func parseModuleFileURI(ctx context.Context, cln *client.Client, dir ast.Directo
 	}
 	mod.Directory = dir
 
+	// Only modules read from the local filesystem are sources of the run.
+	if dir.Definition() == nil {
+		path := filename
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir.Path(), path)
+		}
+		err = recordSource(ctx, path)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	if u.Scheme == "" {
 		u.Scheme = "file"
 	}
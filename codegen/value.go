@@ -108,6 +108,7 @@ type Value interface {
 	Filesystem() (Filesystem, error)
 	String() (string, error)
 	Int() (int, error)
+	List() ([]string, error)
 	Option() (Option, error)
 	Request() (solver.Request, error)
 	Reflect(reflect.Type) (reflect.Value, error)
@@ -132,6 +133,8 @@ func NewValue(ctx context.Context, iface interface{}) (Value, error) {
 		return &stringValue{&nilValue{}, v}, nil
 	case int:
 		return &intValue{&nilValue{}, v}, nil
+	case []string:
+		return &listValue{&nilValue{}, v}, nil
 	case Option:
 		return &optValue{&nilValue{}, v}, nil
 	case solver.Request:
@@ -168,6 +171,10 @@ func (v *nilValue) String() (string, error) {
 	return "", fmt.Errorf("cannot coerce to string")
 }
 
+func (v *nilValue) List() ([]string, error) {
+	return nil, fmt.Errorf("cannot coerce to list")
+}
+
 func (v *nilValue) Option() (Option, error) {
 	return nil, fmt.Errorf("cannot coerce to option")
 }
@@ -200,6 +207,10 @@ func (v *errorValue) String() (string, error) {
 	return "", v.err
 }
 
+func (v *errorValue) List() ([]string, error) {
+	return nil, v.err
+}
+
 func (v *errorValue) Option() (Option, error) {
 	return nil, v.err
 }
@@ -245,6 +256,11 @@ func (v *lazyValue) String() (string, error) {
 	return v.val.String()
 }
 
+func (v *lazyValue) List() ([]string, error) {
+	v.wait()
+	return v.val.List()
+}
+
 func (v *lazyValue) Option() (Option, error) {
 	v.wait()
 	return v.val.Option()
@@ -289,6 +305,10 @@ func (v *zeroValue) String() (string, error) {
 	return "", nil
 }
 
+func (v *zeroValue) List() ([]string, error) {
+	return nil, nil
+}
+
 func (v *zeroValue) Option() (Option, error) {
 	return Option([]interface{}{}), nil
 }
@@ -414,6 +434,23 @@ func (v *intValue) Reflect(t reflect.Type) (reflect.Value, error) {
 	return ReflectTo(v, t)
 }
 
+type listValue struct {
+	Value
+	list []string
+}
+
+func (v *listValue) Kind() ast.Kind {
+	return ast.List
+}
+
+func (v *listValue) List() ([]string, error) {
+	return v.list, nil
+}
+
+func (v *listValue) Reflect(t reflect.Type) (reflect.Value, error) {
+	return ReflectTo(v, t)
+}
+
 type optValue struct {
 	Value
 	opt Option
@@ -449,6 +486,7 @@ var (
 	rFilesystem = reflect.TypeOf(Filesystem{})
 	rString     = reflect.TypeOf("")
 	rInt        = reflect.TypeOf(0)
+	rList       = reflect.TypeOf([]string{})
 	rOption     = reflect.TypeOf((Option)([]interface{}{}))
 	rRequest    = reflect.TypeOf((*solver.Request)(nil)).Elem()
 	rFileMode   = reflect.TypeOf(os.FileMode(0))
@@ -473,6 +511,8 @@ func ReflectTo(v Value, t reflect.Type) (reflect.Value, error) {
 		iface, err = v.String()
 	case rInt:
 		iface, err = v.Int()
+	case rList:
+		iface, err = v.List()
 	case rOption:
 		iface, err = v.Option()
 	case rRequest:
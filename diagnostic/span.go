@@ -188,9 +188,19 @@ func (se *SpanError) Pretty(ctx context.Context, opts ...PrettyOption) string {
 				lines = append(lines, string(leading))
 			}
 
+			// Underline the span from its start to its end. Spans that end on a
+			// later line are underlined to the end of their first line.
+			width := span.End.Column - span.Start.Column
+			if span.End.Line > span.Start.Line {
+				width = len(bytes.TrimRightFunc(data, unicode.IsSpace)) - end
+			}
+			if width < 1 {
+				width = 1
+			}
+
 			// Add line for the span.
 			lines = append(lines, string(data))
-			lines = append(lines, color.Sprintf(msgColor("%s%s"), padding, strings.Repeat(underline, span.End.Column-span.Start.Column)))
+			lines = append(lines, color.Sprintf(msgColor("%s%s"), padding, strings.Repeat(underline, width)))
 
 			// Offset is the number of lines taken by the underline and message.
 			offset := 1
@@ -0,0 +1,75 @@
+package diagnostic_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/lithammer/dedent"
+	"github.com/openllb/hlb/diagnostic"
+	"github.com/openllb/hlb/parser"
+	"github.com/openllb/hlb/parser/ast"
+	"github.com/openllb/hlb/pkg/filebuffer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrettyUnderline(t *testing.T) {
+	t.Parallel()
+
+	type testCase struct {
+		name     string
+		node     func(*ast.FuncDecl) ast.Node
+		expected string
+	}
+
+	for _, tc := range []testCase{{
+		"signature",
+		func(fd *ast.FuncDecl) ast.Node {
+			return fd.Sig
+		},
+		`
+		error: invalid signature
+		<stdin>:1:1:
+		  │ 
+		1 │ fs build(string ref) binds (string digest) {
+		  │ ^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^
+		  │ invalid signature
+		`,
+	}, {
+		"multiple lines",
+		func(fd *ast.FuncDecl) ast.Node {
+			return fd
+		},
+		`
+		error: invalid signature
+		<stdin>:1:1:
+		  │ 
+		1 │ fs build(string ref) binds (string digest) {
+		  │ ^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^
+		  │ invalid signature
+		`,
+	}} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := filebuffer.WithBuffers(context.Background(), filebuffer.NewBuffers())
+			mod, err := parser.Parse(ctx, strings.NewReader(dedent.Dedent(`
+			fs build(string ref) binds (string digest) {
+				image ref
+			}
+			`)[1:]))
+			require.NoError(t, err)
+
+			node := tc.node(mod.Decls[0].Func)
+			se := node.WithError(
+				errors.New("invalid signature"),
+				node.Spanf(diagnostic.Primary, "invalid signature"),
+			).(*diagnostic.SpanError)
+
+			expected := strings.TrimSpace(dedent.Dedent(tc.expected))
+			require.Equal(t, expected, strings.TrimSpace(se.Pretty(ctx)))
+		})
+	}
+}
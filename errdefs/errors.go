@@ -5,6 +5,8 @@ import (
 	"os"
 	"strings"
 
+	"github.com/alecthomas/participle/v2/lexer"
+	"github.com/moby/buildkit/util/entitlements"
 	"github.com/openllb/hlb/diagnostic"
 	"github.com/openllb/hlb/parser/ast"
 	"github.com/pkg/errors"
@@ -54,6 +56,62 @@ func WithDeprecated(mod *ast.Module, node ast.Node, format string, a ...interfac
 	)
 }
 
+// ErrWarning is a lint diagnostic that doesn't fail linting unless warnings
+// are treated as errors.
+type ErrWarning struct {
+	Err error
+}
+
+func (e *ErrWarning) Unwrap() error {
+	return e.Err
+}
+
+func (e *ErrWarning) Error() string {
+	return e.Err.Error()
+}
+
+func IsWarning(err error) bool {
+	var ew *ErrWarning
+	return errors.As(err, &ew)
+}
+
+func WithBreakpoint(node ast.Node) error {
+	return node.WithError(
+		&ErrWarning{fmt.Errorf("breakpoint left in module")},
+		node.Spanf(diagnostic.Primary, "breakpoint should be removed before committing"),
+	)
+}
+
+func WithUnusedParam(param ast.Node) error {
+	return param.WithError(
+		&ErrWarning{fmt.Errorf("parameter `%s` is unused", param)},
+		param.Spanf(diagnostic.Primary, "unused parameter, rename to `_%s` if intended", param),
+	)
+}
+
+// WithUnusedFunc warns about a function that is never referenced. When the
+// function cannot be run as a target, removing it from mod is a fix.
+func WithUnusedFunc(mod *ast.Module, name ast.Node, fixable bool) error {
+	err := fmt.Errorf("function `%s` is unused", name)
+	if !fixable {
+		return name.WithError(
+			&ErrWarning{err},
+			name.Spanf(diagnostic.Primary, "unused function, remove it unless it is run as a target"),
+		)
+	}
+	return name.WithError(
+		&ErrWarning{&ErrModule{mod, err}},
+		name.Spanf(diagnostic.Primary, "unused function, remove it or export it"),
+	)
+}
+
+func WithIgnoredOptions(name, with ast.Node) error {
+	return with.WithError(
+		&ErrWarning{fmt.Errorf("`%s` has no options", name)},
+		with.Spanf(diagnostic.Primary, "options are ignored"),
+	)
+}
+
 func WithInternalErrorf(node ast.Node, format string, a ...interface{}) error {
 	return node.WithError(
 		fmt.Errorf(format, a...),
@@ -68,6 +126,26 @@ func WithInvalidCompileTarget(ident ast.Node) error {
 	)
 }
 
+func WithUndefinedTarget(filename, target string, targets []string) error {
+	msg := fmt.Sprintf("target `%s` is not defined in %s", target, filename)
+	suggestion := diagnostic.Suggestion(target, targets)
+	if suggestion != "" {
+		msg = fmt.Sprintf("%s\ndid you mean `%s`?", msg, suggestion)
+	}
+	if len(targets) > 0 {
+		msg = fmt.Sprintf("%s\navailable targets: %s", msg, strings.Join(targets, ", "))
+	}
+	return errors.New(msg)
+}
+
+func WithUnterminatedHeredoc(start, end lexer.Position, terminator string) error {
+	return diagnostic.WithError(
+		fmt.Errorf("unterminated heredoc, expected `%s` to end it", terminator),
+		start, end,
+		diagnostic.Spanf(diagnostic.Primary, start, end, "heredoc is never terminated\nexpected a line with `%s` after this", terminator),
+	)
+}
+
 func WithWrongType(expr ast.Node, expected []ast.Kind, actual ast.Kind, opts ...diagnostic.Option) error {
 	opts = append(opts, expr.Spanf(
 		diagnostic.Primary,
@@ -94,6 +172,20 @@ func WithImportPathNotExist(err error, expr ast.Node, filename string) error {
 	)
 }
 
+func WithIncludeInterpolated(path ast.Node) error {
+	return path.WithError(
+		fmt.Errorf("include path cannot be interpolated"),
+		path.Spanf(diagnostic.Primary, "interpolated include path"),
+	)
+}
+
+func WithIncludeCycle(path ast.Node, filename string) error {
+	return path.WithError(
+		fmt.Errorf("%q cannot include itself", filename),
+		path.Spanf(diagnostic.Primary, "include cycle"),
+	)
+}
+
 func WithUndefinedIdent(ident ast.Node, suggested *ast.Object, opts ...diagnostic.Option) error {
 	opts = append(opts, ident.Spanf(diagnostic.Primary, "undefined or not in scope"))
 	if suggested != nil {
@@ -157,6 +249,29 @@ func WithDuplicates(dups []ast.Node) error {
 	)
 }
 
+// WithRecursiveCall reports a cycle of calls. Each call is made from the
+// function called before it, and the first call is made from the function
+// called last.
+func WithRecursiveCall(calls []ast.Node) error {
+	if len(calls) == 0 {
+		return nil
+	}
+	path := fmt.Sprintf("`%s`", calls[len(calls)-1])
+	var opts []diagnostic.Option
+	for i, call := range calls {
+		path += fmt.Sprintf(" -> `%s`", call)
+		if i == 0 {
+			opts = append(opts, call.Spanf(diagnostic.Primary, "recursive call"))
+		} else {
+			opts = append(opts, call.Spanf(diagnostic.Secondary, "calls `%s`", call))
+		}
+	}
+	return calls[0].WithError(
+		fmt.Errorf("functions cannot be recursive, found call cycle %s", path),
+		opts...,
+	)
+}
+
 func WithNoBindTarget(as ast.Node) error {
 	return as.WithError(
 		fmt.Errorf("cannot bind, has no target"),
@@ -172,6 +287,17 @@ func WithNoBindClosure(as, option ast.Node) error {
 	)
 }
 
+func WithAmbiguousBindClosure(as ast.Node, uses []ast.Node) error {
+	opts := []diagnostic.Option{as.Spanf(diagnostic.Primary, "ambiguous closure for binding")}
+	for _, use := range uses {
+		opts = append(opts, use.Spanf(diagnostic.Secondary, "option function used here"))
+	}
+	return as.WithError(
+		fmt.Errorf("cannot bind, option function is used in %d closures", len(uses)),
+		opts...,
+	)
+}
+
 func WithNoBindEffects(callee, as ast.Node, opts ...diagnostic.Option) error {
 	opts = append(opts, as.Spanf(
 		diagnostic.Primary,
@@ -197,6 +323,17 @@ func WithInvalidImageRef(err error, arg ast.Node, ref string) error {
 	)
 }
 
+func WithLocalRunFailed(err error, call ast.Node, command, stderr string) error {
+	msg := fmt.Sprintf("`%s` failed: %s", command, err)
+	if stderr = strings.TrimSpace(stderr); stderr != "" {
+		msg = fmt.Sprintf("%s\n%s", msg, stderr)
+	}
+	return call.WithError(
+		errors.Wrapf(err, "local command `%s` failed", command),
+		call.Spanf(diagnostic.Primary, "%s", msg),
+	)
+}
+
 func WithInvalidNetworkMode(arg ast.Node, mode string, modes []string) error {
 	suggestion := diagnostic.Suggestion(mode, modes)
 	if suggestion != "" {
@@ -208,6 +345,38 @@ func WithInvalidNetworkMode(arg ast.Node, mode string, modes []string) error {
 	)
 }
 
+func WithInvalidAuthSource(arg ast.Node, source string) error {
+	return arg.WithError(
+		fmt.Errorf("invalid auth source `%s`", source),
+		arg.Spanf(diagnostic.Primary, "expected `helper:<name>` or `token:<path>`"),
+	)
+}
+
+func WithUnsupportedNetworkMode(arg ast.Node, mode string, modes []string) error {
+	return arg.WithError(
+		fmt.Errorf("named network `%s` is not supported", mode),
+		arg.Spanf(diagnostic.Primary, "named network `%s` is not supported by BuildKit, must be one of %s", mode, strings.Join(modes, ", ")),
+	)
+}
+
+func WithInvalidUlimit(arg ast.Node, name string, names []string) error {
+	suggestion := diagnostic.Suggestion(name, names)
+	if suggestion != "" {
+		suggestion = fmt.Sprintf("\ndid you mean `%s`?", suggestion)
+	}
+	return arg.WithError(
+		fmt.Errorf("invalid ulimit `%s`", name),
+		arg.Spanf(diagnostic.Primary, "invalid ulimit `%s`%s", name, suggestion),
+	)
+}
+
+func WithUlimitExceedsHard(arg ast.Node, soft, hard int) error {
+	return arg.WithError(
+		fmt.Errorf("soft limit %d exceeds hard limit %d", soft, hard),
+		arg.Spanf(diagnostic.Primary, "soft limit must not exceed the hard limit %d", hard),
+	)
+}
+
 func WithInvalidSecurityMode(arg ast.Node, mode string, modes []string) error {
 	suggestion := diagnostic.Suggestion(mode, modes)
 	if suggestion != "" {
@@ -219,6 +388,80 @@ func WithInvalidSecurityMode(arg ast.Node, mode string, modes []string) error {
 	)
 }
 
+func WithEntitlementNotAllowed(arg ast.Node, entitlement entitlements.Entitlement) error {
+	return arg.WithError(
+		fmt.Errorf("entitlement `%s` is not allowed", entitlement),
+		arg.Spanf(diagnostic.Primary, "requires entitlement `%s`, allow it with `--allow %s`", entitlement, entitlement),
+	)
+}
+
+func WithInvalidPortSpec(arg ast.Node, spec string) error {
+	return arg.WithError(
+		fmt.Errorf("invalid port spec `%s`", spec),
+		arg.Spanf(diagnostic.Primary, "invalid port spec `%s`, expected `<port>[/tcp|udp|sctp]`", spec),
+	)
+}
+
+func WithExperimental(ident ast.Node) error {
+	return ident.WithError(
+		fmt.Errorf("`%s` is experimental", ident),
+		ident.Spanf(diagnostic.Primary, "`%s` is experimental, enable experimental builtins with --experimental", ident),
+	)
+}
+
+func WithInvalidTimestamp(arg ast.Node, timestamp string) error {
+	return arg.WithError(
+		fmt.Errorf("invalid timestamp `%s`", timestamp),
+		arg.Spanf(diagnostic.Primary, "invalid timestamp `%s`, expected RFC3339 like `2006-01-02T15:04:05Z`", timestamp),
+	)
+}
+
+func WithInvalidDuration(arg ast.Node, duration string) error {
+	return arg.WithError(
+		fmt.Errorf("invalid duration `%s`", duration),
+		arg.Spanf(diagnostic.Primary, "invalid duration `%s`, expected a sequence of numbers with units like `30s` or `1m30s`", duration),
+	)
+}
+
+func WithInvalidBase64(err error, call ast.Node) error {
+	return call.WithError(
+		errors.Wrap(err, "invalid base64"),
+		call.Spanf(diagnostic.Primary, "current string is not valid base64: %s", err),
+	)
+}
+
+func WithChecksumMismatch(call ast.Node, path, expected, actual string) error {
+	return call.WithError(
+		fmt.Errorf("checksum mismatch for %s: expected %s but got %s", path, expected, actual),
+		call.Spanf(diagnostic.Primary, "downloaded %s has checksum %s", path, actual),
+	)
+}
+
+func WithInvalidCacheSpec(arg ast.Node, spec, reason string) error {
+	return arg.WithError(
+		fmt.Errorf("invalid cache spec `%s`: %s", spec, reason),
+		arg.Spanf(diagnostic.Primary, "%s", reason),
+	)
+}
+
+func WithInvalidCacheType(arg ast.Node, typ string, types []string) error {
+	suggestion := diagnostic.Suggestion(typ, types)
+	if suggestion != "" {
+		suggestion = fmt.Sprintf("\ndid you mean `%s`?", suggestion)
+	}
+	return arg.WithError(
+		fmt.Errorf("unsupported cache type `%s`", typ),
+		arg.Spanf(diagnostic.Primary, "unsupported cache type `%s`, must be one of %s%s", typ, strings.Join(types, ", "), suggestion),
+	)
+}
+
+func WithCopyPlatformMismatch(opt ast.Node, expected, actual string) error {
+	return opt.WithError(
+		fmt.Errorf("copied content is for %s but the filesystem is %s", expected, actual),
+		opt.Spanf(diagnostic.Primary, "copied content is for %s but the filesystem is %s", expected, actual),
+	)
+}
+
 func WithInvalidSharingMode(arg ast.Node, mode string, modes []string) error {
 	suggestion := diagnostic.Suggestion(mode, modes)
 	if suggestion != "" {
@@ -238,6 +481,20 @@ func WithBindCacheMount(as, cache ast.Node) error {
 	)
 }
 
+func WithLockfileWithoutCache(lockfile ast.Node) error {
+	return lockfile.WithError(
+		fmt.Errorf("lockfile can only key a cache mount"),
+		lockfile.Spanf(diagnostic.Primary, "mount has no cache option"),
+	)
+}
+
+func WithGitignoreNonLocal(gitignore ast.Node) error {
+	return gitignore.WithError(
+		fmt.Errorf("gitignore can only be used when copying from a local filesystem"),
+		gitignore.Spanf(diagnostic.Primary, "source is not created by local"),
+	)
+}
+
 func WithDockerEngineUnsupported(decl ast.Node) error {
 	err := fmt.Errorf("not supported by buildkit embedded in docker engine, use standalone buildkit")
 	if decl == nil {
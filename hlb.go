@@ -12,6 +12,7 @@ import (
 	"github.com/openllb/hlb/diagnostic"
 	"github.com/openllb/hlb/linter"
 	"github.com/openllb/hlb/module"
+	"github.com/openllb/hlb/parser"
 	"github.com/openllb/hlb/parser/ast"
 	"github.com/openllb/hlb/pkg/filebuffer"
 	"github.com/openllb/hlb/solver"
@@ -32,31 +33,82 @@ func WithDefaultContext(ctx context.Context, cln *client.Client) context.Context
 
 // Compile compiles targets in a module and returns a solver.Request.
 func Compile(ctx context.Context, cln *client.Client, w io.Writer, mod *ast.Module, targets []codegen.Target) (solver.Request, error) {
-	err := checker.SemanticPass(mod)
+	cg, ctx, err := newCodeGen(ctx, cln, w, mod)
 	if err != nil {
 		return nil, err
 	}
+	return cg.Generate(ctx, mod, targets)
+}
+
+// CompileRequests compiles the targets in a module and returns the solve
+// request of each target, so that they can be solved independently. A target
+// that fails to compile has a nil request and its error at the same index, so
+// the other targets can still be solved.
+func CompileRequests(ctx context.Context, cln *client.Client, w io.Writer, mod *ast.Module, targets []codegen.Target) ([]solver.Request, []error, error) {
+	cg, ctx, err := newCodeGen(ctx, cln, w, mod)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cg.GenerateEachRequest(ctx, mod, targets)
+}
+
+// Inspect compiles a filesystem target in a module and returns its image
+// config without solving it. Outputs of the target, like pushes and
+// downloads, are skipped.
+func Inspect(ctx context.Context, cln *client.Client, w io.Writer, mod *ast.Module, target codegen.Target) (*solver.ImageSpec, error) {
+	ctx = codegen.WithNoOutput(ctx, true)
+	cg, ctx, err := newCodeGen(ctx, cln, w, mod)
+	if err != nil {
+		return nil, err
+	}
+	return cg.GenerateImage(ctx, mod, target)
+}
 
-	err = linter.Lint(ctx, mod)
+// Evaluate compiles a target in a module and returns its value without
+// composing a solve request.
+func Evaluate(ctx context.Context, cln *client.Client, w io.Writer, mod *ast.Module, target codegen.Target) (codegen.Value, error) {
+	cg, ctx, err := newCodeGen(ctx, cln, w, mod)
+	if err != nil {
+		return nil, err
+	}
+	return cg.GenerateValue(ctx, mod, target)
+}
+
+func newCodeGen(ctx context.Context, cln *client.Client, w io.Writer, mod *ast.Module) (*codegen.CodeGen, context.Context, error) {
+	err := parser.ResolveIncludes(ctx, mod)
+	if err != nil {
+		return nil, ctx, err
+	}
+
+	err = checker.SemanticPass(mod)
+	if err != nil {
+		return nil, ctx, err
+	}
+
+	var lintOpts []linter.LintOption
+	if codegen.GetDebugger(ctx) != nil {
+		lintOpts = append(lintOpts, linter.WithAllowBreakpoints())
+	}
+
+	err = linter.Lint(ctx, mod, lintOpts...)
 	if err != nil {
 		for _, span := range diagnostic.Spans(err) {
 			fmt.Fprintln(w, span.Pretty(ctx))
 		}
 	}
 
-	err = checker.Check(mod)
+	err = checker.Check(mod, codegen.CheckOptions(ctx)...)
 	if err != nil {
-		return nil, err
+		return nil, ctx, err
 	}
 
 	resolver, err := module.NewResolver(cln)
 	if err != nil {
-		return nil, err
+		return nil, ctx, err
 	}
 
-	cg := codegen.New(cln, resolver)
 	if solver.ConcurrencyLimiter(ctx) == nil {
 		ctx = solver.WithConcurrencyLimiter(ctx, semaphore.NewWeighted(defaultMaxConcurrency))
 	}
-	return cg.Generate(ctx, mod, targets)
+	return codegen.New(cln, resolver), ctx, nil
 }
@@ -2,18 +2,61 @@ package linter
 
 import (
 	"context"
+	"fmt"
+	"strings"
 
+	"github.com/openllb/hlb/builtin"
 	"github.com/openllb/hlb/diagnostic"
 	"github.com/openllb/hlb/errdefs"
 	"github.com/openllb/hlb/parser/ast"
 )
 
 type Linter struct {
-	errs []error
+	allowBreakpoints bool
+	unusedFuncs      bool
+	unusedTargets    bool
+	fix              bool
+	errs             []error
 }
 
 type LintOption func(*Linter)
 
+// WithAllowBreakpoints skips warning about breakpoints, for example when the
+// module is being debugged.
+func WithAllowBreakpoints() LintOption {
+	return func(l *Linter) {
+		l.allowBreakpoints = true
+	}
+}
+
+// WithUnusedFuncs warns about functions that are never referenced. It is only
+// meaningful when the module isn't being run, since any function can be run
+// as a target.
+func WithUnusedFuncs() LintOption {
+	return func(l *Linter) {
+		l.unusedFuncs = true
+		l.unusedTargets = true
+	}
+}
+
+// WithUnusedNonTargets warns about functions that are never referenced and
+// cannot be run as targets, such as options and functions with parameters.
+// Unlike WithUnusedFuncs, it is meaningful while the module is being edited.
+func WithUnusedNonTargets() LintOption {
+	return func(l *Linter) {
+		l.unusedFuncs = true
+	}
+}
+
+// WithFix modifies the module to fix lint errors that have no deprecated
+// syntax to rewrite, such as removing unused functions. Without it, those
+// errors are only reported.
+func WithFix() LintOption {
+	return func(l *Linter) {
+		l.fix = true
+	}
+}
+
 func Lint(ctx context.Context, mod *ast.Module, opts ...LintOption) error {
 	l := Linter{}
 	for _, opt := range opts {
@@ -27,6 +70,16 @@ func Lint(ctx context.Context, mod *ast.Module, opts ...LintOption) error {
 }
 
 func (l *Linter) Lint(ctx context.Context, mod *ast.Module) {
+	files := mod.Files()
+	for _, file := range files {
+		l.lint(ctx, file)
+	}
+	if l.unusedFuncs {
+		l.lintUnusedFuncs(files)
+	}
+}
+
+func (l *Linter) lint(ctx context.Context, mod *ast.Module) {
 	ast.Match(mod, ast.MatchOpts{},
 		func(id *ast.ImportDecl) {
 			if id.DeprecatedPath != nil {
@@ -60,5 +113,162 @@ func (l *Linter) Lint(ctx context.Context, mod *ast.Module) {
 				call.Name.Ident.Text = "stage"
 			}
 		},
+		func(call *ast.CallStmt) {
+			if l.allowBreakpoints || call.Name == nil || call.Name.Reference != nil {
+				return
+			}
+			if call.Name.Ident.Text == "breakpoint" {
+				l.errs = append(l.errs, errdefs.WithBreakpoint(call.Name))
+			}
+		},
+		func(call *ast.CallStmt) {
+			l.lintIgnoredOptions(call)
+		},
+		func(fd *ast.FuncDecl) {
+			l.lintUnusedParams(fd)
+		},
 	)
 }
+
+// lintIgnoredOptions warns about with clauses on builtins that have no
+// options, since any options given to them are ignored.
+func (l *Linter) lintIgnoredOptions(call *ast.CallStmt) {
+	if call.WithClause == nil || call.Name == nil || call.Name.Reference != nil {
+		return
+	}
+
+	name := call.Name.Ident.Text
+	if !isBuiltin(name) {
+		return
+	}
+
+	kind := ast.Kind(fmt.Sprintf("%s::%s", ast.Option, name))
+	if len(builtin.Lookup.ByKind[kind].Func) == 0 {
+		l.errs = append(l.errs, errdefs.WithIgnoredOptions(call.Name, call.WithClause.With))
+	}
+}
+
+func isBuiltin(name string) bool {
+	for _, lookup := range builtin.Lookup.ByKind {
+		if _, ok := lookup.Func[name]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// lintUnusedParams warns about parameters that are never referenced in the
+// function body. Parameters named with a leading underscore are allowed to be
+// unused.
+func (l *Linter) lintUnusedParams(fd *ast.FuncDecl) {
+	if fd.Body == nil || fd.Sig.Params == nil || fd.Scope == nil {
+		return
+	}
+
+	// Identifiers are resolved like the checker does, so a name that refers to
+	// something else shadowing the parameter doesn't count as a use.
+	used := make(map[ast.Node]struct{})
+	ast.Match(fd.Body, ast.MatchOpts{},
+		func(ie *ast.IdentExpr) {
+			if ie.Ident == nil {
+				return
+			}
+			if obj := fd.Scope.Lookup(ie.Ident.Text); obj != nil {
+				used[obj.Node] = struct{}{}
+			}
+		},
+	)
+
+	for _, param := range fd.Sig.Params.Fields() {
+		if param.Name == nil || strings.HasPrefix(param.Name.Text, "_") {
+			continue
+		}
+		if _, ok := used[param]; !ok {
+			l.errs = append(l.errs, errdefs.WithUnusedParam(param.Name))
+		}
+	}
+}
+
+// lintUnusedFuncs warns about functions that are neither exported nor
+// referenced by any file of the module. Options and functions with parameters
+// cannot be run as targets, so they are removed when fixing.
+func (l *Linter) lintUnusedFuncs(files []*ast.Module) {
+	// References are resolved like the checker does, so a name that refers to
+	// something else shadowing the function doesn't count as a use.
+	used := make(map[*ast.FuncDecl]struct{})
+	use := func(scope *ast.Scope, ident *ast.Ident) {
+		if scope == nil || ident == nil {
+			return
+		}
+		obj := scope.Lookup(ident.Text)
+		if obj == nil {
+			return
+		}
+		if fd, ok := obj.Node.(*ast.FuncDecl); ok {
+			used[fd] = struct{}{}
+		}
+	}
+	for _, file := range files {
+		ast.Match(file, ast.MatchOpts{},
+			func(ed *ast.ExportDecl) {
+				use(file.Scope, ed.Name)
+			},
+			func(_ *ast.ImportDecl, ie *ast.IdentExpr) {
+				use(file.Scope, ie.Ident)
+			},
+			func(fd *ast.FuncDecl, ie *ast.IdentExpr) {
+				use(fd.Scope, ie.Ident)
+			},
+		)
+	}
+
+	for _, file := range files {
+		var fixes []*ast.FuncDecl
+		for _, decl := range file.Decls {
+			fd := decl.Func
+			if fd == nil || fd.Sig == nil || fd.Sig.Name == nil || fd.Sig.Name.Text == "default" {
+				continue
+			}
+			if _, ok := used[fd]; ok {
+				continue
+			}
+
+			fixable := fd.Kind().Primary() == ast.Option || len(fd.Sig.Params.Fields()) > 0
+			if !fixable && !l.unusedTargets {
+				continue
+			}
+			l.errs = append(l.errs, errdefs.WithUnusedFunc(file, fd.Sig.Name, fixable))
+			if fixable && l.fix {
+				fixes = append(fixes, fd)
+			}
+		}
+		for _, fd := range fixes {
+			removeFunc(file, fd)
+		}
+	}
+}
+
+// removeFunc removes a function declaration from mod along with its doc
+// string and the blank line that follows it.
+func removeFunc(mod *ast.Module, fd *ast.FuncDecl) {
+	var decls []*ast.Decl
+	for i := 0; i < len(mod.Decls); i++ {
+		decl := mod.Decls[i]
+		if decl.Func != fd {
+			decls = append(decls, decl)
+			continue
+		}
+
+		// Comments are separated from the function by a newline declaration
+		// unless they are its doc string.
+		if n := len(decls); n > 0 && decls[n-1].Comments != nil {
+			decls = decls[:n-1]
+		}
+
+		// Skip the newline ending the function and the blank line after it.
+		for j := 0; j < 2 && i+1 < len(mod.Decls) && mod.Decls[i+1].Newline != nil; j++ {
+			i++
+		}
+	}
+	mod.Decls = decls
+}
@@ -60,6 +60,145 @@ func TestLinter_Lint(t *testing.T) {
 				},
 			}
 		},
+	}, {
+		"breakpoint",
+		`
+		fs default() {
+			image "alpine"
+			breakpoint
+			run "echo hello"
+		}
+		`,
+		func(mod *ast.Module) error {
+			return errdefs.WithBreakpoint(ast.Search(mod, "breakpoint"))
+		},
+	}, {
+		"no breakpoint",
+		`
+		fs default() {
+			image "alpine"
+			run "echo hello"
+		}
+		`,
+		nil,
+	}, {
+		"used params",
+		`
+		fs default(string ref, string cmd) {
+			image ref
+			run string { format "echo ${cmd}"; }
+		}
+		`,
+		nil,
+	}, {
+		"unused param",
+		`
+		fs default(string ref, string tag) {
+			image ref
+		}
+		`,
+		func(mod *ast.Module) error {
+			return errdefs.WithUnusedParam(ast.Search(mod, "tag"))
+		},
+	}, {
+		"param shadowed by effect",
+		`
+		fs default(string ref) binds (string ref) {
+			image "alpine"
+			dockerPush ref
+		}
+		`,
+		func(mod *ast.Module) error {
+			return errdefs.WithUnusedParam(ast.Search(mod, "ref"))
+		},
+	}, {
+		"options on op without options",
+		`
+		fs default() {
+			scratch with option {
+				resolve
+			}
+		}
+		`,
+		func(mod *ast.Module) error {
+			return errdefs.WithIgnoredOptions(
+				ast.Search(mod, "scratch"),
+				ast.Search(mod, "with"),
+			)
+		},
+	}, {
+		"options on op with options",
+		`
+		fs default() {
+			image "x" with option {
+				resolve
+			}
+		}
+		`,
+		nil,
+	}, {
+		"unused functions",
+		`
+		fs default() {
+			image "alpine" with pinned
+		}
+
+		option::image pinned() {
+			resolve
+		}
+
+		option::image unpinned() {
+			resolve
+		}
+
+		fs test() {
+			scratch
+		}
+		`,
+		func(mod *ast.Module) error {
+			return &diagnostic.Error{
+				Diagnostics: []error{
+					errdefs.WithUnusedFunc(mod, ast.Search(mod, "unpinned"), true),
+					errdefs.WithUnusedFunc(mod, ast.Search(mod, "test"), false),
+				},
+			}
+		},
+	}, {
+		"function shadowed by param",
+		`
+		fs build() {
+			scratch
+		}
+
+		fs default() {
+			f "alpine"
+		}
+
+		fs f(string build) {
+			image build
+		}
+		`,
+		func(mod *ast.Module) error {
+			return errdefs.WithUnusedFunc(mod, ast.Search(mod, "build"), false)
+		},
+	}, {
+		"exported functions",
+		`
+		export build
+
+		fs build() {
+			scratch
+		}
+		`,
+		nil,
+	}, {
+		"underscore params",
+		`
+		fs default(string _, string _tag) {
+			image "alpine"
+		}
+		`,
+		nil,
 	}} {
 		tc := tc
 		t.Run(tc.name, func(t *testing.T) {
@@ -77,12 +216,118 @@ func TestLinter_Lint(t *testing.T) {
 			if tc.fn != nil {
 				expected = tc.fn(mod)
 			}
-			err = Lint(ctx, mod)
+			err = Lint(ctx, mod, WithUnusedFuncs())
 			validateError(t, ctx, expected, err, tc.name)
 		})
 	}
 }
 
+func TestLinter_AllowBreakpoints(t *testing.T) {
+	t.Parallel()
+
+	ctx := filebuffer.WithBuffers(context.Background(), builtin.Buffers())
+	ctx = ast.WithModules(ctx, builtin.Modules())
+
+	in := strings.NewReader(dedent.Dedent(`
+	fs default() {
+		image "alpine"
+		breakpoint
+	}
+	`))
+	mod, err := parser.Parse(ctx, in)
+	require.NoError(t, err)
+
+	err = checker.SemanticPass(mod)
+	require.NoError(t, err)
+
+	err = Lint(ctx, mod)
+	require.Error(t, err)
+	for _, span := range diagnostic.Spans(err) {
+		require.True(t, errdefs.IsWarning(span))
+	}
+
+	err = Lint(ctx, mod, WithAllowBreakpoints())
+	require.NoError(t, err)
+}
+
+func TestLinter_UnusedNonTargets(t *testing.T) {
+	t.Parallel()
+
+	ctx := filebuffer.WithBuffers(context.Background(), builtin.Buffers())
+	ctx = ast.WithModules(ctx, builtin.Modules())
+
+	in := strings.NewReader(dedent.Dedent(`
+	fs default() {
+		image "alpine"
+	}
+
+	fs build() {
+		scratch
+	}
+
+	option::image pinned() {
+		resolve
+	}
+	`))
+	mod, err := parser.Parse(ctx, in)
+	require.NoError(t, err)
+
+	err = checker.SemanticPass(mod)
+	require.NoError(t, err)
+
+	// Functions without parameters may be run as targets.
+	err = Lint(ctx, mod, WithUnusedNonTargets())
+	validateError(t, ctx, errdefs.WithUnusedFunc(mod, ast.Search(mod, "pinned"), true), err, "unused non-targets")
+}
+
+func TestLinter_UnusedFuncs(t *testing.T) {
+	t.Parallel()
+
+	ctx := filebuffer.WithBuffers(context.Background(), builtin.Buffers())
+	ctx = ast.WithModules(ctx, builtin.Modules())
+
+	parse := func(t *testing.T) *ast.Module {
+		in := strings.NewReader(dedent.Dedent(`
+		fs default() {
+			image "alpine"
+		}
+
+		option::run helper(string _s) {
+			mount 123 "/x"
+		}
+		`))
+		mod, err := parser.Parse(ctx, in)
+		require.NoError(t, err)
+
+		err = checker.SemanticPass(mod)
+		require.NoError(t, err)
+		return mod
+	}
+
+	// Unused functions are only reported when asked for.
+	mod := parse(t)
+	err := Lint(ctx, mod)
+	require.NoError(t, err)
+
+	// Without fixing, the unused function is kept so its errors are still
+	// reported by the checker.
+	mod = parse(t)
+	err = Lint(ctx, mod, WithUnusedFuncs())
+	require.Error(t, err)
+	require.NotNil(t, mod.Scope.Lookup("helper"))
+	require.Contains(t, mod.String(), "option::run helper")
+
+	err = checker.Check(mod)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "cannot use int as type fs")
+
+	// Fixing removes it.
+	mod = parse(t)
+	err = Lint(ctx, mod, WithUnusedFuncs(), WithFix())
+	require.Error(t, err)
+	require.NotContains(t, mod.String(), "option::run helper")
+}
+
 func validateError(t *testing.T, ctx context.Context, expected, actual error, name string) {
 	switch {
 	case expected == nil:
@@ -11,9 +11,11 @@ import (
 
 	"github.com/lithammer/dedent"
 	"github.com/moby/buildkit/client/llb"
+	"github.com/moby/buildkit/solver/pb"
 	digest "github.com/opencontainers/go-digest"
 	"github.com/openllb/hlb/builtin"
 	"github.com/openllb/hlb/checker"
+	"github.com/openllb/hlb/codegen"
 	"github.com/openllb/hlb/diagnostic"
 	"github.com/openllb/hlb/errdefs"
 	"github.com/openllb/hlb/parser"
@@ -148,6 +150,70 @@ func TestResolveGraph(t *testing.T) {
 	}
 }
 
+type testResolver func(ctx context.Context, id *ast.ImportDecl, fs codegen.Filesystem) (ast.Directory, error)
+
+func (r testResolver) Resolve(ctx context.Context, id *ast.ImportDecl, fs codegen.Filesystem) (ast.Directory, error) {
+	return r(ctx, id, fs)
+}
+
+func TestResolveGraphParameterizedImport(t *testing.T) {
+	t.Parallel()
+
+	ctx := filebuffer.WithBuffers(context.Background(), builtin.Buffers())
+	ctx = ast.WithModules(ctx, builtin.Modules())
+
+	in := strings.NewReader(dedent.Dedent(`
+	import lib from builder("v2")
+
+	fs builder(string version) {
+		image "openllb/builder:${version}"
+	}
+
+	fs default() {
+		lib.build
+	}
+	`))
+	mod, err := parser.Parse(ctx, in)
+	require.NoError(t, err)
+
+	err = checker.SemanticPass(mod)
+	require.NoError(t, err)
+
+	err = checker.Check(mod)
+	require.NoError(t, err)
+
+	var identifiers []string
+	resolver := testResolver(func(ctx context.Context, id *ast.ImportDecl, fs codegen.Filesystem) (ast.Directory, error) {
+		def, err := fs.State.Marshal(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, dt := range def.Def {
+			var op pb.Op
+			err = op.Unmarshal(dt)
+			if err != nil {
+				return nil, err
+			}
+			if src := op.GetSource(); src != nil {
+				identifiers = append(identifiers, src.Identifier)
+			}
+		}
+		return &testDirectory{map[string]string{
+			codegen.ModuleFilename: `
+				export build
+				fs build()
+			`,
+		}}, nil
+	})
+
+	err = ResolveGraph(ctx, nil, resolver, mod, nil)
+	require.NoError(t, err)
+	require.Equal(t, []string{"docker-image://docker.io/openllb/builder:v2"}, identifiers)
+
+	_, err = codegen.New(nil, resolver).Generate(ctx, mod, []codegen.Target{{Name: "default"}})
+	require.NoError(t, err)
+}
+
 func validateError(t *testing.T, ctx context.Context, expected, actual error, name string) {
 	switch {
 	case expected == nil:
@@ -18,7 +18,7 @@ var (
 	// Lexer lexes HLB into tokens for the parser.
 	Lexer = lexer.MustStateful(lexer.Rules{
 		"Root": {
-			{"Keyword", `\b(import|export|with|as)\b`, nil},
+			{"Keyword", `\b(import|include|export|with|as)\b`, nil},
 			{"Numeric", `\b(0(b|B|o|O|x|X)[a-fA-F0-9]+)\b`, nil},
 			{"Decimal", `\b(0|[1-9][0-9]*)\b`, nil},
 			{"Bool", `\b(true|false)\b`, nil},
@@ -28,6 +28,7 @@ var (
 			{"RawHeredoc", "<<[-~]?`(\\w+)`", lexer.Push("RawHeredoc")},
 			{"Block", `{`, lexer.Push("Block")},
 			{"Paren", `\(`, lexer.Push("Paren")},
+			{"Bracket", `\[`, lexer.Push("Bracket")},
 			{"Ident", `[\w:]+`, lexer.Push("Reference")},
 			{"Operator", `;`, nil},
 			{"Newline", `\n`, nil},
@@ -74,6 +75,11 @@ var (
 			{"Delimit", `,`, nil},
 			lexer.Include("Root"),
 		},
+		"Bracket": {
+			{"BracketEnd", `\]`, lexer.Pop()},
+			{"Delimit", `,`, nil},
+			lexer.Include("Root"),
+		},
 	})
 
 	// Parser parses HLB into a concrete syntax tree rooted from a Module.
@@ -148,6 +154,10 @@ const (
 	Filesystem Kind = "fs"
 	Pipeline   Kind = "pipeline"
 	Option     Kind = "option"
+
+	// List is a list of strings. Lists passed to a variadic string field are
+	// spread into its arguments.
+	List Kind = "list"
 )
 
 func (k Kind) Primary() Kind {
@@ -182,7 +192,7 @@ type Directory interface {
 }
 
 // Module represents a HLB source file. HLB is file-scoped, so every file
-// represents a module.
+// represents a module, unless it is included into another module.
 //
 // Initially, the Parser will fill in this struct as a parse tree / concrete
 // syntax tree, but a second pass from the Checker will type check and fill in
@@ -196,10 +206,36 @@ type Module struct {
 	Decls     []*Decl `parser:"@@*"`
 }
 
+// Files returns the module followed by the files it includes, transitively.
+// Included files share the module's scope. A file included more than once is
+// only returned once.
+func (m *Module) Files() []*Module {
+	var (
+		files []*Module
+		seen  = make(map[*Module]struct{})
+		visit func(*Module)
+	)
+	visit = func(m *Module) {
+		if _, ok := seen[m]; ok {
+			return
+		}
+		seen[m] = struct{}{}
+		files = append(files, m)
+		for _, decl := range m.Decls {
+			if decl.Include != nil && decl.Include.Module != nil {
+				visit(decl.Include.Module)
+			}
+		}
+	}
+	visit(m)
+	return files
+}
+
 // Decl represents a declaration node.
 type Decl struct {
 	Mixin
 	Import   *ImportDecl   `parser:"( @@"`
+	Include  *IncludeDecl  `parser:"| @@"`
 	Export   *ExportDecl   `parser:"| @@"`
 	Func     *FuncDecl     `parser:"| @@"`
 	Newline  *Newline      `parser:"| @@"`
@@ -228,6 +264,24 @@ type From struct {
 	Text string `parser:"@'from'"`
 }
 
+// IncludeDecl represents an include declaration. Unlike an import, the
+// declarations of an included file are merged into the including module's
+// scope, so they are referenced without a qualifier.
+type IncludeDecl struct {
+	Mixin
+	Include *Include   `parser:"@@"`
+	Path    *StringLit `parser:"@@"`
+
+	// Module is the included file, filled in when includes are resolved.
+	Module *Module
+}
+
+// Include represents the keyword "include".
+type Include struct {
+	Mixin
+	Text string `parser:"@'include'"`
+}
+
 // ExportDecl represents an export declaration.
 type ExportDecl struct {
 	Mixin
@@ -634,6 +688,7 @@ type Expr struct {
 	Mixin
 	FuncLit  *FuncLit  `parser:"( @@"`
 	BasicLit *BasicLit `parser:"| @@"`
+	ListLit  *ListLit  `parser:"| @@"`
 	CallExpr *CallExpr `parser:"| @@ )"`
 }
 
@@ -643,6 +698,8 @@ func (e *Expr) Kind() Kind {
 		return e.FuncLit.Kind()
 	case e.BasicLit != nil:
 		return e.BasicLit.Kind()
+	case e.ListLit != nil:
+		return List
 	}
 	return None
 }
@@ -859,6 +916,35 @@ func NewBoolExpr(v bool) *Expr {
 	}
 }
 
+// ListLit represents a list of expressions enclosed in brackets.
+type ListLit struct {
+	Mixin
+	Start     *OpenBracket  `parser:"@@"`
+	Fields    []*ExprField  `parser:"@@*"`
+	Terminate *CloseBracket `parser:"@@"`
+}
+
+func NewListExpr(elems ...*Expr) *Expr {
+	var fields []*ExprField
+	for _, elem := range elems {
+		fields = append(fields, &ExprField{Expr: elem})
+	}
+	return &Expr{
+		ListLit: &ListLit{Fields: fields},
+	}
+}
+
+// Elements returns the expressions of the list.
+func (ll *ListLit) Elements() []*Expr {
+	var elems []*Expr
+	for _, field := range ll.Fields {
+		if field.Expr != nil {
+			elems = append(elems, field.Expr)
+		}
+	}
+	return elems
+}
+
 // CallExpr represents a short-hand way of invoking a function as an
 // expression.
 type CallExpr struct {
@@ -988,6 +1074,18 @@ type CloseParen struct {
 	Text string `parser:"@ParenEnd"`
 }
 
+// OpenBracket represents the "[" bracket.
+type OpenBracket struct {
+	Mixin
+	Text string `parser:"@Bracket"`
+}
+
+// CloseBracket represents the "]" bracket.
+type CloseBracket struct {
+	Mixin
+	Text string `parser:"@BracketEnd"`
+}
+
 // OpenBrace represents the "{" brace.
 type OpenBrace struct {
 	Mixin
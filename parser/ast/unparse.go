@@ -95,6 +95,8 @@ func (d *Decl) Unparse(opts ...UnparseOption) string {
 	switch {
 	case d.Import != nil:
 		return d.Import.Unparse(opts...)
+	case d.Include != nil:
+		return d.Include.Unparse(opts...)
 	case d.Export != nil:
 		return d.Export.Unparse(opts...)
 	case d.Func != nil:
@@ -132,6 +134,18 @@ func (f *From) Unparse(opts ...UnparseOption) string {
 	return f.Text
 }
 
+func (id *IncludeDecl) String() string { return id.Unparse() }
+
+func (id *IncludeDecl) Unparse(opts ...UnparseOption) string {
+	return fmt.Sprintf("%s %s", id.Include.Unparse(opts...), id.Path.Unparse(opts...))
+}
+
+func (i *Include) String() string { return i.Unparse() }
+
+func (i *Include) Unparse(opts ...UnparseOption) string {
+	return i.Text
+}
+
 func (ed *ExportDecl) String() string { return ed.Unparse() }
 
 func (ed *ExportDecl) Unparse(opts ...UnparseOption) string {
@@ -429,6 +443,8 @@ func (e *Expr) Unparse(opts ...UnparseOption) string {
 		return e.FuncLit.Unparse(opts...)
 	case e.BasicLit != nil:
 		return e.BasicLit.Unparse(opts...)
+	case e.ListLit != nil:
+		return e.ListLit.Unparse(opts...)
 	case e.CallExpr != nil:
 		return e.CallExpr.Unparse(opts...)
 	}
@@ -589,6 +605,16 @@ func (oi *OpenInterpolated) Unparse(opts ...UnparseOption) string {
 	return oi.Text
 }
 
+func (ll *ListLit) String() string { return ll.Unparse() }
+
+func (ll *ListLit) Unparse(opts ...UnparseOption) string {
+	var list []Node
+	for _, field := range ll.Fields {
+		list = append(list, field)
+	}
+	return unparseDelimited("[", "]", list, opts...)
+}
+
 func (ce *CallExpr) String() string { return ce.Unparse() }
 
 func (ce *CallExpr) Unparse(opts ...UnparseOption) string {
@@ -698,13 +724,19 @@ func (se *StmtEnd) Unparse(opts ...UnparseOption) string {
 }
 
 func unparseList(list []Node, opts ...UnparseOption) string {
+	return unparseDelimited("(", ")", list, opts...)
+}
+
+// unparseDelimited unparses a comma separated list enclosed by open and
+// close, with one element per line if the list spans multiple lines.
+func unparseDelimited(open, close string, list []Node, opts ...UnparseOption) string {
 	var info UnparseInfo
 	for _, opt := range opts {
 		opt(&info)
 	}
 
 	if len(list) == 0 {
-		return "()"
+		return open + close
 	}
 
 	hasNewline := false
@@ -732,7 +764,7 @@ func unparseList(list []Node, opts ...UnparseOption) string {
 			}
 			stmts = append(stmts, str)
 		}
-		return fmt.Sprintf("(%s)", strings.Join(stmts, ", "))
+		return fmt.Sprintf("%s%s%s", open, strings.Join(stmts, ", "), close)
 	}
 	indent := strings.Repeat("\t", info.Indent+1)
 	opts = append(opts, WithIndent(info.Indent+1))
@@ -776,5 +808,5 @@ func unparseList(list []Node, opts ...UnparseOption) string {
 	}
 	stmts = stmts[:i+1]
 
-	return fmt.Sprintf("(\n%s\n%s)", strings.Join(stmts, ""), strings.Repeat("\t", info.Indent))
+	return fmt.Sprintf("%s\n%s\n%s%s", open, strings.Join(stmts, ""), strings.Repeat("\t", info.Indent), close)
 }
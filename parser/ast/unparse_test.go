@@ -34,6 +34,18 @@ func TestUnparse(t *testing.T) {
 			fs foo() { scratch }
 			`,
 		},
+		{
+			"include",
+			`
+			include   "./fragment.hlb"
+			fs foo() { scratch; }
+			`,
+			`
+			include "./fragment.hlb"
+
+			fs foo() { scratch }
+			`,
+		},
 		{
 			"no space",
 			`
@@ -653,6 +665,29 @@ func TestUnparse(t *testing.T) {
 			}
 			`,
 		},
+		{
+			"list literals",
+			`
+			fs default() {
+				run [ "echo",  "hello" ]
+				run "echo" [
+					"hello", # greeting
+					"world"
+				]
+				run []
+			}
+			`,
+			`
+			fs default() {
+				run ["echo", "hello"]
+				run "echo" [
+					"hello", # greeting
+					"world",
+				]
+				run []
+			}
+			`,
+		},
 	} {
 		tc := tc
 		t.Run(tc.name, func(t *testing.T) {
@@ -58,6 +58,8 @@ func (w *walker) walk(node Node, v Visitor) {
 		switch {
 		case n.Import != nil:
 			w.walk(n.Import, v)
+		case n.Include != nil:
+			w.walk(n.Include, v)
 		case n.Export != nil:
 			w.walk(n.Export, v)
 		case n.Func != nil:
@@ -75,6 +77,10 @@ func (w *walker) walk(node Node, v Visitor) {
 		if n.Name != nil {
 			w.walk(n.Name, v)
 		}
+	case *IncludeDecl:
+		if n.Path != nil {
+			w.walk(n.Path, v)
+		}
 	case *ExportDecl:
 		if n.Name != nil {
 			w.walk(n.Name, v)
@@ -204,6 +210,8 @@ func (w *walker) walk(node Node, v Visitor) {
 			w.walk(n.FuncLit, v)
 		case n.BasicLit != nil:
 			w.walk(n.BasicLit, v)
+		case n.ListLit != nil:
+			w.walk(n.ListLit, v)
 		case n.CallExpr != nil:
 			w.walk(n.CallExpr, v)
 		}
@@ -258,6 +266,8 @@ func (w *walker) walk(node Node, v Visitor) {
 		if n.List != nil {
 			w.walk(n.List, v)
 		}
+	case *ListLit:
+		w.walkExprFieldList(n.Fields, v)
 	case *ExprList:
 		w.walkExprFieldList(n.Fields, v)
 	case *ExprField:
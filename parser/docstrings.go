@@ -16,7 +16,7 @@ func AssignDocStrings(mod *ast.Module) {
 			}
 		},
 		func(fun *ast.FuncDecl) {
-			if lastCG != nil && lastCG.End().Line == fun.Pos.Line-1 {
+			if precedes(lastCG, fun.Pos.Line) {
 				fun.Doc = lastCG
 			}
 
@@ -26,7 +26,7 @@ func AssignDocStrings(mod *ast.Module) {
 						lastCG = cg
 					},
 					func(call *ast.CallStmt) {
-						if lastCG != nil && lastCG.End().Line == call.Pos.Line-1 {
+						if precedes(lastCG, call.Pos.Line) {
 							call.Doc = lastCG
 						}
 					},
@@ -35,3 +35,13 @@ func AssignDocStrings(mod *ast.Module) {
 		},
 	)
 }
+
+// precedes returns whether the comment group is on the lines immediately before
+// line. Comments include their trailing newline, so a comment group ends at the
+// start of the next line rather than on the line of its last comment.
+func precedes(cg *ast.CommentGroup, line int) bool {
+	if cg == nil || len(cg.List) == 0 {
+		return false
+	}
+	return cg.List[len(cg.List)-1].Pos.Line == line-1
+}
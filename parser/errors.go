@@ -0,0 +1,68 @@
+package parser
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+
+	participle "github.com/alecthomas/participle/v2"
+	"github.com/alecthomas/participle/v2/lexer"
+	"github.com/openllb/hlb/diagnostic"
+	"github.com/openllb/hlb/errdefs"
+	"github.com/openllb/hlb/parser/ast"
+	"github.com/openllb/hlb/pkg/filebuffer"
+)
+
+// newSyntaxError returns a diagnostic for syntax errors that are more helpful
+// when annotated at a different position than where the parser gave up.
+// Otherwise, the original error is returned.
+func newSyntaxError(fb *filebuffer.FileBuffer, err error) error {
+	var ute participle.UnexpectedTokenError
+	if !errors.As(err, &ute) || !ute.Unexpected.EOF() {
+		return err
+	}
+
+	// The heredoc lexer state consumes everything until its terminator, so an
+	// unterminated heredoc is only noticed at EOF. Find the heredoc that was
+	// left open instead.
+	opening, ok := unterminatedHeredoc(fb)
+	if !ok {
+		return err
+	}
+
+	terminator := strings.TrimLeft(opening.Value, "<-~")
+	terminator = strings.Trim(terminator, "`")
+	end := diagnostic.Offset(opening.Pos, len(opening.Value), 0)
+	return errdefs.WithUnterminatedHeredoc(opening.Pos, end, terminator)
+}
+
+// unterminatedHeredoc returns the innermost heredoc opening token that is never
+// terminated.
+func unterminatedHeredoc(fb *filebuffer.FileBuffer) (lexer.Token, bool) {
+	l, err := ast.Lexer.Lex(fb.Filename(), bytes.NewReader(fb.Bytes()))
+	if err != nil {
+		return lexer.Token{}, false
+	}
+
+	tokens, err := lexer.ConsumeAll(l)
+	if err != nil {
+		return lexer.Token{}, false
+	}
+
+	symbols := ast.Lexer.Symbols()
+	var opened []lexer.Token
+	for _, token := range tokens {
+		switch token.Type {
+		case symbols["Heredoc"], symbols["RawHeredoc"]:
+			opened = append(opened, token)
+		case symbols["HeredocEnd"], symbols["RawHeredocEnd"]:
+			if len(opened) > 0 {
+				opened = opened[:len(opened)-1]
+			}
+		}
+	}
+	if len(opened) == 0 {
+		return lexer.Token{}, false
+	}
+	return opened[len(opened)-1], true
+}
@@ -0,0 +1,113 @@
+package parser
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+
+	"github.com/openllb/hlb/errdefs"
+	"github.com/openllb/hlb/parser/ast"
+	"github.com/openllb/hlb/pkg/filebuffer"
+)
+
+// ResolveIncludes parses the files included by the module, transitively, and
+// attaches them to their include declarations. Include paths are relative to
+// the including file and are read from the module's directory, so it must be
+// called after the module's directory is set.
+func ResolveIncludes(ctx context.Context, mod *ast.Module) error {
+	if mod.Directory == nil {
+		mod.Directory = NewLocalDirectory("", "")
+	}
+	r := &includeResolver{
+		files:     map[string]*ast.Module{includeKey(mod): mod},
+		including: make(map[string]struct{}),
+	}
+	return r.resolve(ctx, mod)
+}
+
+// includeKey returns the module's filename relative to its directory.
+func includeKey(mod *ast.Module) string {
+	return filepath.Clean(strings.TrimPrefix(mod.Pos.Filename, mod.Directory.Path()))
+}
+
+type includeResolver struct {
+	// files are the modules parsed by filename, so a file included more than
+	// once is only parsed and merged once.
+	files map[string]*ast.Module
+
+	// including are the filenames of the modules being resolved, to detect
+	// include cycles.
+	including map[string]struct{}
+}
+
+func (r *includeResolver) resolve(ctx context.Context, mod *ast.Module) error {
+	key := includeKey(mod)
+	r.including[key] = struct{}{}
+	defer delete(r.including, key)
+
+	dir := filepath.Dir(key)
+	for _, decl := range mod.Decls {
+		id := decl.Include
+		if id == nil || id.Path == nil || id.Module != nil {
+			continue
+		}
+
+		for _, fragment := range id.Path.Fragments {
+			if fragment.Interpolated != nil {
+				return errdefs.WithIncludeInterpolated(id.Path)
+			}
+		}
+
+		filename, err := ResolvePath(dir, id.Path.Unquoted())
+		if err != nil {
+			return err
+		}
+
+		filename = filepath.Clean(filename)
+		if _, ok := r.including[filename]; ok {
+			return errdefs.WithIncludeCycle(id.Path, filename)
+		}
+
+		imod, ok := r.files[filename]
+		if !ok {
+			imod, err = r.parse(ctx, mod, filename)
+			if err != nil {
+				if errdefs.IsNotExist(err) {
+					return errdefs.WithImportPathNotExist(err, id.Path, filename)
+				}
+				return err
+			}
+			r.files[filename] = imod
+		}
+		id.Module = imod
+
+		err = r.resolve(ctx, imod)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *includeResolver) parse(ctx context.Context, mod *ast.Module, filename string) (*ast.Module, error) {
+	rc, err := mod.Directory.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	// Included files are read from the same place as the including module, so
+	// they are only on disk if it is.
+	var opts []filebuffer.Option
+	if fb := filebuffer.Buffers(ctx).Get(mod.Pos.Filename); fb != nil && !fb.OnDisk() {
+		opts = append(opts, filebuffer.WithEphemeral())
+	}
+
+	imod, err := Parse(ctx, rc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	imod.Directory = mod.Directory
+	imod.URI = mod.URI
+	return imod, nil
+}
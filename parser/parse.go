@@ -12,6 +12,36 @@ import (
 )
 
 func Parse(ctx context.Context, r io.Reader, opts ...filebuffer.Option) (*ast.Module, error) {
+	mod, err := parse(ctx, r, opts...)
+	if err != nil {
+		return nil, err
+	}
+	ast.Modules(ctx).Set(mod.Pos.Filename, mod)
+	return mod, nil
+}
+
+// ParsePartial is like Parse, but on a syntax error it also returns a module
+// with the top-level declarations parsed before the error, so that tools like
+// the language server keep working on broken files. The declaration that
+// failed to parse and everything after it are dropped.
+func ParsePartial(ctx context.Context, r io.Reader, opts ...filebuffer.Option) (*ast.Module, error) {
+	mod, err := parse(ctx, r, opts...)
+	if err != nil {
+		for i, decl := range mod.Decls {
+			// Declarations are only given an end position once fully parsed.
+			if decl.EndPos.Line == 0 {
+				mod.Decls = mod.Decls[:i]
+				break
+			}
+		}
+		return mod, err
+	}
+	ast.Modules(ctx).Set(mod.Pos.Filename, mod)
+	return mod, nil
+}
+
+// parse always returns the module, which is incomplete if there is an error.
+func parse(ctx context.Context, r io.Reader, opts ...filebuffer.Option) (*ast.Module, error) {
 	mod := &ast.Module{}
 	defer AssignDocStrings(mod)
 
@@ -31,10 +61,12 @@ func Parse(ctx context.Context, r io.Reader, opts ...filebuffer.Option) (*ast.Mo
 
 	err := ast.Parser.Parse(name, r, mod)
 	if err != nil {
-		return nil, err
+		// Register the file buffer so that syntax errors can be annotated.
+		filebuffer.Buffers(ctx).Set(name, fb)
+		mod.Directory = NewLocalDirectory("", "")
+		return mod, newSyntaxError(fb, err)
 	}
 	mod.Directory = NewLocalDirectory("", "")
-	ast.Modules(ctx).Set(mod.Pos.Filename, mod)
 	return mod, nil
 }
 
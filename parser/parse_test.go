@@ -2,9 +2,14 @@ package parser
 
 import (
 	"context"
+	"errors"
 	"strings"
 	"testing"
 
+	"github.com/alecthomas/participle/v2"
+	"github.com/alecthomas/participle/v2/lexer"
+	"github.com/openllb/hlb/diagnostic"
+	"github.com/openllb/hlb/pkg/filebuffer"
 	"github.com/stretchr/testify/require"
 )
 
@@ -116,3 +121,135 @@ func TestParse(t *testing.T) {
 	require.NoError(t, err)
 	require.NotNil(t, file)
 }
+
+func TestParseUnterminatedHeredoc(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		name  string
+		input string
+		start lexer.Position
+	}{{
+		"heredoc",
+		"fs default() {\n\tmkfile \"foo\" 0o644 <<EOM\n\t\thello\n\tEO\n}\n",
+		lexer.Position{Filename: "<stdin>", Offset: 35, Line: 2, Column: 21},
+	}, {
+		"raw heredoc",
+		"fs default() {\n\trun <<-`EOM`\n\t\techo hello\n}\n",
+		lexer.Position{Filename: "<stdin>", Offset: 20, Line: 2, Column: 6},
+	}} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := filebuffer.WithBuffers(context.Background(), filebuffer.NewBuffers())
+			_, err := Parse(ctx, strings.NewReader(tc.input))
+			require.Error(t, err)
+			require.EqualError(t, err, FormatPos(tc.start)+" unterminated heredoc, expected `EOM` to end it")
+
+			spans := diagnostic.Spans(err)
+			require.Len(t, spans, 1)
+			require.Len(t, spans[0].Spans, 1)
+
+			span := spans[0].Spans[0]
+			require.Equal(t, diagnostic.Primary, span.Type)
+			require.Equal(t, tc.start, span.Start)
+			require.Contains(t, span.Message, "expected a line with `EOM`")
+			require.Contains(t, spans[0].Pretty(ctx), "heredoc is never terminated")
+		})
+	}
+}
+
+func TestParsePartial(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		name  string
+		input string
+		funcs []string
+		line  int
+	}{{
+		"broken declaration after a good one",
+		"fs good() {\n\tscratch\n}\n\nfs bad( {\n}\n",
+		[]string{"good"},
+		5,
+	}, {
+		"declarations after the broken one are dropped",
+		"fs good() {\n\tscratch\n}\n\nfs bad() {\n\trun \"echo\" with\n}\n\nfs after() {\n\tscratch\n}\n",
+		[]string{"good"},
+		6,
+	}, {
+		"broken first declaration",
+		"fs bad( {\n}\n",
+		nil,
+		1,
+	}} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := filebuffer.WithBuffers(context.Background(), filebuffer.NewBuffers())
+			mod, err := ParsePartial(ctx, strings.NewReader(tc.input))
+			require.NotNil(t, mod)
+
+			var perr participle.Error
+			require.True(t, errors.As(err, &perr))
+			require.Equal(t, tc.line, perr.Position().Line)
+
+			var funcs []string
+			for _, decl := range mod.Decls {
+				if decl.Func != nil {
+					funcs = append(funcs, decl.Func.Sig.Name.Text)
+				}
+			}
+			require.Equal(t, tc.funcs, funcs)
+
+			// Parse still only returns the error.
+			mod, err = Parse(ctx, strings.NewReader(tc.input))
+			require.Error(t, err)
+			require.Nil(t, mod)
+		})
+	}
+}
+
+func TestAssignDocStrings(t *testing.T) {
+	t.Parallel()
+
+	ctx := filebuffer.WithBuffers(context.Background(), filebuffer.NewBuffers())
+	mod, err := Parse(ctx, strings.NewReader(strings.Join([]string{
+		"# Documented has a doc string.",
+		"# It spans two lines.",
+		"fs documented() {",
+		"\t# Scratch has a doc string.",
+		"\tscratch",
+		"}",
+		"",
+		"# Detached is separated by a blank line.",
+		"",
+		"fs undocumented() {",
+		"\tscratch",
+		"}",
+	}, "\n")+"\n"))
+	require.NoError(t, err)
+
+	docs := make(map[string][]string)
+	for _, decl := range mod.Decls {
+		fd := decl.Func
+		if fd == nil {
+			continue
+		}
+		var doc []string
+		if fd.Doc != nil {
+			for _, comment := range fd.Doc.List {
+				doc = append(doc, strings.TrimSpace(comment.Text))
+			}
+		}
+		docs[fd.Sig.Name.Text] = doc
+
+		if fd.Sig.Name.Text == "documented" {
+			call := fd.Body.Stmts()[0].Call
+			require.NotNil(t, call.Doc)
+			require.Equal(t, "# Scratch has a doc string.", strings.TrimSpace(call.Doc.List[0].Text))
+		}
+	}
+	require.Equal(t, map[string][]string{
+		"documented":   {"# Documented has a doc string.", "# It spans two lines."},
+		"undocumented": nil,
+	}, docs)
+}
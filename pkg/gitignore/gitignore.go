@@ -0,0 +1,223 @@
+package gitignore
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+
+	"github.com/moby/patternmatcher"
+)
+
+// Filename is the name of the ignore files read in each directory.
+const Filename = ".gitignore"
+
+// Pattern is a rule of an ignore file.
+type Pattern struct {
+	// Glob is the cleaned pattern without a leading slash or negation.
+	Glob string
+
+	// Negate is whether the rule re-includes files matched by earlier rules.
+	Negate bool
+
+	// Anchored is whether the rule is relative to the directory of the ignore
+	// file. Rules that aren't anchored match at any depth below it.
+	Anchored bool
+}
+
+// ReadAll reads the rules of an ignore file.
+//
+// Unlike dockerignore files, a gitignore rule without a slash matches at any
+// depth, so whether a rule is anchored must be kept. Rules for directories
+// only, which end in a slash, are treated as rules for any path.
+func ReadAll(r io.Reader) ([]Pattern, error) {
+	var patterns []Pattern
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var p Pattern
+		if strings.HasPrefix(line, "!") {
+			p.Negate = true
+			line = line[1:]
+		} else if strings.HasPrefix(line, `\#`) || strings.HasPrefix(line, `\!`) {
+			line = line[1:]
+		}
+
+		line = strings.TrimRight(line, "/")
+		if line == "" {
+			continue
+		}
+		p.Anchored = strings.Contains(line, "/")
+		p.Glob = strings.TrimPrefix(path.Clean("/"+line), "/")
+		patterns = append(patterns, p)
+	}
+	return patterns, scanner.Err()
+}
+
+// Excludes returns exclude patterns relative to the directory src in fsys for
+// the ignore files that apply to it. Ignore files in the ancestors of src come
+// first, followed by the ignore files nested within src in walk order, so that
+// rules of deeper ignore files take precedence when the last match wins.
+//
+// If src doesn't exist or isn't a directory, there are no patterns.
+func Excludes(fsys fs.FS, src string) ([]string, error) {
+	src = path.Clean(strings.TrimPrefix(path.Clean("/"+src), "/"))
+	if src == "" {
+		src = "."
+	}
+
+	fi, err := fs.Stat(fsys, src)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if !fi.IsDir() {
+		return nil, nil
+	}
+
+	var excludes []string
+	add := func(dir string) error {
+		patterns, err := readFile(fsys, path.Join(dir, Filename))
+		if err != nil {
+			return err
+		}
+		for _, p := range patterns {
+			if exclude, ok := rebase(dir, src, p); ok {
+				excludes = append(excludes, exclude)
+			}
+		}
+		return nil
+	}
+
+	if src != "." {
+		dir := "."
+		for _, elem := range strings.Split(src, "/") {
+			err = add(dir)
+			if err != nil {
+				return nil, err
+			}
+			dir = path.Join(dir, elem)
+		}
+	}
+
+	var (
+		pm       *patternmatcher.PatternMatcher
+		pmLength int
+	)
+	err = fs.WalkDir(fsys, src, func(dir string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+
+		if dir != src {
+			if d.Name() == ".git" {
+				return fs.SkipDir
+			}
+
+			// Git doesn't look for ignore files in ignored directories.
+			if pm == nil || pmLength != len(excludes) {
+				pm, err = patternmatcher.New(excludes)
+				if err != nil {
+					return err
+				}
+				pmLength = len(excludes)
+			}
+			ignored, err := pm.MatchesOrParentMatches(relative(src, dir))
+			if err != nil {
+				return err
+			}
+			if ignored {
+				return fs.SkipDir
+			}
+		}
+		return add(dir)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return excludes, nil
+}
+
+func readFile(fsys fs.FS, filename string) ([]Pattern, error) {
+	f, err := fsys.Open(filename)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	return ReadAll(f)
+}
+
+// rebase returns the pattern relative to src for a rule of the ignore file in
+// dir, which is either src, a directory within it, or one of its ancestors. It
+// returns false if the rule can never match a path within src.
+func rebase(dir, src string, p Pattern) (string, bool) {
+	var glob string
+	switch {
+	case dir == src || src == "." || strings.HasPrefix(dir, src+"/"):
+		rel := relative(src, dir)
+		if p.Anchored {
+			glob = path.Join(rel, p.Glob)
+		} else {
+			glob = path.Join(rel, "**", p.Glob)
+		}
+	case !p.Anchored:
+		glob = path.Join("**", p.Glob)
+	default:
+		// Match the leading elements of the rule against the path from dir to
+		// src, keeping the remainder to match within src.
+		prefix := strings.Split(relative(dir, src), "/")
+		elems := strings.Split(p.Glob, "/")
+		for i, elem := range prefix {
+			if i == len(elems) {
+				break
+			}
+			if elems[i] == "**" {
+				elems = append([]string{"**"}, elems[i+1:]...)
+				prefix = nil
+				break
+			}
+			ok, err := path.Match(elems[i], elem)
+			if err != nil || !ok {
+				return "", false
+			}
+		}
+		if len(prefix) >= len(elems) {
+			// The rule matches src or one of its ancestors, so everything
+			// within src is ignored.
+			glob = "**"
+		} else {
+			glob = path.Join(elems[len(prefix):]...)
+		}
+	}
+
+	if p.Negate {
+		glob = "!" + glob
+	}
+	return glob, true
+}
+
+// relative returns target relative to its ancestor base, or the empty string
+// if they are the same.
+func relative(base, target string) string {
+	switch {
+	case base == target:
+		return ""
+	case base == ".":
+		return target
+	}
+	return strings.TrimPrefix(target, base+"/")
+}
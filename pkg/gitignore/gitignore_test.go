@@ -0,0 +1,125 @@
+package gitignore
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadAll(t *testing.T) {
+	patterns, err := ReadAll(strings.NewReader(strings.Join([]string{
+		"# comment",
+		"",
+		"*.log  ",
+		"/build/",
+		"docs/*.md",
+		"!keep.log",
+		`\#hash`,
+	}, "\n")))
+	require.NoError(t, err)
+	require.Equal(t, []Pattern{
+		{Glob: "*.log"},
+		{Glob: "build", Anchored: true},
+		{Glob: "docs/*.md", Anchored: true},
+		{Glob: "keep.log", Negate: true},
+		{Glob: "#hash"},
+	}, patterns)
+}
+
+func TestExcludes(t *testing.T) {
+	type testCase struct {
+		name     string
+		files    map[string]string
+		src      string
+		expected []string
+	}
+
+	for _, tc := range []testCase{{
+		"no ignore files",
+		map[string]string{
+			"main.go": "",
+		},
+		"/",
+		nil,
+	}, {
+		"root",
+		map[string]string{
+			".gitignore": "*.log\n/bin\n",
+		},
+		"/",
+		[]string{"**/*.log", "bin"},
+	}, {
+		"nested",
+		map[string]string{
+			".gitignore":        "*.log\n",
+			"web/.gitignore":    "node_modules/\n/dist\n",
+			"web/ui/.gitignore": "!debug.log\n",
+		},
+		"/",
+		[]string{"**/*.log", "web/**/node_modules", "web/dist", "!web/ui/**/debug.log"},
+	}, {
+		"ignored directory",
+		map[string]string{
+			".gitignore":        "vendor\n",
+			"vendor/.gitignore": "*.go\n",
+		},
+		"/",
+		[]string{"**/vendor"},
+	}, {
+		"git directory",
+		map[string]string{
+			".git/.gitignore": "*\n",
+		},
+		"/",
+		nil,
+	}, {
+		"ancestors",
+		map[string]string{
+			".gitignore":          "*.log\n/web/dist\n/api\n*/ui/tmp\n**/cache\n",
+			"web/.gitignore":      "/ui/build\n",
+			"web/ui/.gitignore":   "/coverage\n",
+			"web/ui/x/.gitignore": "/y\n",
+		},
+		"web/ui",
+		[]string{"**/*.log", "tmp", "**/cache", "build", "coverage", "x/y"},
+	}, {
+		"ignored source",
+		map[string]string{
+			".gitignore":     "/web\n",
+			"web/index.html": "",
+		},
+		"web",
+		[]string{"**"},
+	}, {
+		"file source",
+		map[string]string{
+			".gitignore": "*.log\n",
+			"main.go":    "",
+		},
+		"main.go",
+		nil,
+	}, {
+		"missing source",
+		map[string]string{
+			".gitignore": "*.log\n",
+		},
+		"missing",
+		nil,
+	}} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			fsys := fstest.MapFS{}
+			for name, content := range tc.files {
+				fsys[name] = &fstest.MapFile{Data: []byte(content)}
+			}
+
+			excludes, err := Excludes(fsys, tc.src)
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, excludes)
+		})
+	}
+}
@@ -10,7 +10,6 @@ import (
 	"github.com/containerd/containerd/platforms"
 	"github.com/containerd/containerd/reference"
 	"github.com/containerd/containerd/remotes"
-	"github.com/containerd/containerd/remotes/docker"
 	"github.com/docker/cli/cli/config"
 	"github.com/moby/buildkit/client/llb/sourceresolver"
 	"github.com/moby/buildkit/session/auth"
@@ -44,6 +43,12 @@ func WithDefaultPlatform(p specs.Platform) ResolverOpt {
 	}
 }
 
+func WithInsecureRegistries(hosts ...string) ResolverOpt {
+	return func(bir *BufferedImageResolver) {
+		bir.resolver = NewResolver(hosts...)
+	}
+}
+
 // RegistryCreds is a Credentials function to pass into NewResolver. It uses the
 // registry auth settings configured in the local Docker config file.
 func RegistryCreds(host string) (string, string, error) {
@@ -65,7 +70,7 @@ func RegistryCreds(host string) (string, string, error) {
 func NewBufferedImageResolver(with ...ResolverOpt) *BufferedImageResolver {
 	ir := &BufferedImageResolver{
 		Buffer:          contentutil.NewBuffer(),
-		resolver:        docker.NewResolver(docker.ResolverOptions{Credentials: RegistryCreds}),
+		resolver:        NewResolver(),
 		defaultPlatform: specs.Platform{OS: "linux", Architecture: "amd64"},
 	}
 	for _, o := range with {
@@ -0,0 +1,74 @@
+package imageutil
+
+import (
+	"crypto/tls"
+	"net/http"
+
+	"github.com/containerd/containerd/remotes"
+	"github.com/containerd/containerd/remotes/docker"
+)
+
+// NewResolver returns a resolver for registries authenticated with the local
+// Docker config that also allows the insecure registries.
+func NewResolver(insecureRegistries ...string) remotes.Resolver {
+	return docker.NewResolver(docker.ResolverOptions{
+		Hosts: RegistryHosts(insecureRegistries...),
+	})
+}
+
+// RegistryHosts configures the hosts of registries. Insecure registries, given
+// as host[:port], are tried over HTTPS without verifying certificates and then
+// over plain HTTP, the same way BuildKit treats registries configured as
+// insecure.
+func RegistryHosts(insecureRegistries ...string) docker.RegistryHosts {
+	secure := docker.ConfigureDefaultRegistries(
+		docker.WithAuthorizer(docker.NewDockerAuthorizer(
+			docker.WithAuthCreds(RegistryCreds),
+		)),
+	)
+	if len(insecureRegistries) == 0 {
+		return secure
+	}
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			TLSClientConfig: &tls.Config{
+				InsecureSkipVerify: true, //nolint:gosec
+			},
+		},
+	}
+	insecure := docker.ConfigureDefaultRegistries(
+		docker.WithClient(client),
+		docker.WithAuthorizer(docker.NewDockerAuthorizer(
+			docker.WithAuthClient(client),
+			docker.WithAuthCreds(RegistryCreds),
+		)),
+	)
+
+	isInsecure := make(map[string]struct{})
+	for _, host := range insecureRegistries {
+		isInsecure[host] = struct{}{}
+	}
+
+	return func(host string) ([]docker.RegistryHost, error) {
+		if _, ok := isInsecure[host]; !ok {
+			return secure(host)
+		}
+
+		hosts, err := insecure(host)
+		if err != nil {
+			return nil, err
+		}
+
+		var withHTTP []docker.RegistryHost
+		for _, h := range hosts {
+			withHTTP = append(withHTTP, h)
+			if h.Scheme == "https" {
+				h.Scheme = "http"
+				withHTTP = append(withHTTP, h)
+			}
+		}
+		return withHTTP, nil
+	}
+}
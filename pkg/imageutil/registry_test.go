@@ -0,0 +1,35 @@
+package imageutil
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistryHosts(t *testing.T) {
+	t.Parallel()
+
+	hosts := RegistryHosts("localhost:5000")
+
+	insecure, err := hosts("localhost:5000")
+	require.NoError(t, err)
+	require.Len(t, insecure, 2)
+	require.Equal(t, "https", insecure[0].Scheme)
+	require.Equal(t, "http", insecure[1].Scheme)
+	for _, host := range insecure {
+		require.Equal(t, "localhost:5000", host.Host)
+		transport, ok := host.Client.Transport.(*http.Transport)
+		require.True(t, ok)
+		require.True(t, transport.TLSClientConfig.InsecureSkipVerify)
+	}
+
+	secure, err := hosts("docker.io")
+	require.NoError(t, err)
+	require.Len(t, secure, 1)
+	require.Equal(t, "https", secure[0].Scheme)
+	require.Equal(t, "registry-1.docker.io", secure[0].Host)
+	if transport, ok := secure[0].Client.Transport.(*http.Transport); ok && transport.TLSClientConfig != nil {
+		require.False(t, transport.TLSClientConfig.InsecureSkipVerify)
+	}
+}
@@ -0,0 +1,154 @@
+package imageutil
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/containerd/containerd/platforms"
+	"github.com/moby/buildkit/client/llb"
+	"github.com/moby/buildkit/client/llb/sourceresolver"
+	"github.com/opencontainers/go-digest"
+)
+
+// ResolveCache is an image resolver that caches the image configs resolved by
+// another resolver on disk, so repeated builds don't resolve the same images
+// from their registries until the cached configs expire.
+//
+// Configs are cached for every resolve mode, including images that are always
+// pulled, since those are resolved from their registry on every build. The
+// resolve mode is part of the cache key, so modes don't share entries.
+//
+// Each config is written to its own file and replaced atomically, so the cache
+// is safe to share between concurrent resolves and processes.
+type ResolveCache struct {
+	resolver llb.ImageMetaResolver
+	dir      string
+	ttl      time.Duration
+	now      func() time.Time
+}
+
+// NewResolveCache returns a resolver that caches the configs resolved by
+// resolver in dir for the duration of ttl.
+func NewResolveCache(resolver llb.ImageMetaResolver, dir string, ttl time.Duration) *ResolveCache {
+	return &ResolveCache{
+		resolver: resolver,
+		dir:      dir,
+		ttl:      ttl,
+		now:      time.Now,
+	}
+}
+
+// DefaultResolveCacheDir returns the directory under the user's cache
+// directory to cache image configs in.
+func DefaultResolveCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "hlb", "image-config"), nil
+}
+
+type resolveCacheEntry struct {
+	Ref      string        `json:"ref"`
+	Digest   digest.Digest `json:"digest"`
+	Config   []byte        `json:"config"`
+	Resolved time.Time     `json:"resolved"`
+}
+
+func (rc *ResolveCache) ResolveImageConfig(ctx context.Context, ref string, opt sourceresolver.Opt) (string, digest.Digest, []byte, error) {
+	var resolveMode string
+	if opt.ImageOpt != nil {
+		resolveMode = opt.ImageOpt.ResolveMode
+	}
+
+	filename := rc.filename(ref, opt, resolveMode)
+	entry, ok := rc.read(filename)
+	if ok {
+		return entry.Ref, entry.Digest, entry.Config, nil
+	}
+
+	resolvedRef, dgst, config, err := rc.resolver.ResolveImageConfig(ctx, ref, opt)
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	// Failing to cache the config only makes the next resolve slower.
+	_ = rc.write(filename, &resolveCacheEntry{
+		Ref:      resolvedRef,
+		Digest:   dgst,
+		Config:   config,
+		Resolved: rc.now(),
+	})
+	return resolvedRef, dgst, config, nil
+}
+
+func (rc *ResolveCache) filename(ref string, opt sourceresolver.Opt, resolveMode string) string {
+	var platform string
+	if opt.Platform != nil {
+		platform = platforms.Format(*opt.Platform)
+	}
+
+	h := sha256.New()
+	for _, s := range []string{ref, platform, resolveMode} {
+		h.Write([]byte(s))
+		h.Write([]byte{0})
+	}
+	return filepath.Join(rc.dir, hex.EncodeToString(h.Sum(nil))+".json")
+}
+
+// read returns the cached entry in filename, or false if there is none or it
+// has expired.
+func (rc *ResolveCache) read(filename string) (*resolveCacheEntry, bool) {
+	dt, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, false
+	}
+
+	var entry resolveCacheEntry
+	err = json.Unmarshal(dt, &entry)
+	if err != nil {
+		return nil, false
+	}
+
+	if rc.now().Sub(entry.Resolved) >= rc.ttl {
+		return nil, false
+	}
+	return &entry, true
+}
+
+// write replaces filename with the entry by renaming a temporary file, so
+// concurrent reads never see a partially written entry.
+func (rc *ResolveCache) write(filename string, entry *resolveCacheEntry) error {
+	dt, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(rc.dir, 0o755)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(rc.dir, ".resolve-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.Write(dt)
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), filename)
+}
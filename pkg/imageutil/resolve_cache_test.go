@@ -0,0 +1,84 @@
+package imageutil
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/moby/buildkit/client/llb"
+	"github.com/moby/buildkit/client/llb/sourceresolver"
+	"github.com/opencontainers/go-digest"
+	specs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/require"
+)
+
+type countingResolver struct {
+	calls int
+}
+
+func (r *countingResolver) ResolveImageConfig(ctx context.Context, ref string, opt sourceresolver.Opt) (string, digest.Digest, []byte, error) {
+	r.calls++
+	config := []byte(`{"config":{"Env":["PATH=/bin"]}}`)
+	return ref, digest.FromBytes(config), config, nil
+}
+
+func TestResolveCache(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	ref := "docker.io/library/busybox:latest"
+	opt := func(mode llb.ResolveMode) sourceresolver.Opt {
+		return sourceresolver.Opt{
+			Platform: &specs.Platform{OS: "linux", Architecture: "amd64"},
+			ImageOpt: &sourceresolver.ResolveImageOpt{ResolveMode: mode.String()},
+		}
+	}
+
+	resolver := &countingResolver{}
+	rc := NewResolveCache(resolver, t.TempDir(), time.Hour)
+	now := time.Now()
+	rc.now = func() time.Time { return now }
+
+	// A cold cache resolves and populates the cache.
+	resolvedRef, dgst, config, err := rc.ResolveImageConfig(ctx, ref, opt(llb.ResolveModeDefault))
+	require.NoError(t, err)
+	require.Equal(t, 1, resolver.calls)
+
+	// A warm cache avoids the resolver.
+	cachedRef, cachedDgst, cachedConfig, err := rc.ResolveImageConfig(ctx, ref, opt(llb.ResolveModeDefault))
+	require.NoError(t, err)
+	require.Equal(t, 1, resolver.calls)
+	require.Equal(t, resolvedRef, cachedRef)
+	require.Equal(t, dgst, cachedDgst)
+	require.Equal(t, config, cachedConfig)
+
+	// The resolve mode and platform are part of the key.
+	_, _, _, err = rc.ResolveImageConfig(ctx, ref, opt(llb.ResolveModePreferLocal))
+	require.NoError(t, err)
+	require.Equal(t, 2, resolver.calls)
+
+	arm := opt(llb.ResolveModeDefault)
+	arm.Platform = &specs.Platform{OS: "linux", Architecture: "arm64"}
+	_, _, _, err = rc.ResolveImageConfig(ctx, ref, arm)
+	require.NoError(t, err)
+	require.Equal(t, 3, resolver.calls)
+
+	// Pulls are cached too, since images are pulled by default.
+	_, _, _, err = rc.ResolveImageConfig(ctx, ref, opt(llb.ResolveModeForcePull))
+	require.NoError(t, err)
+	require.Equal(t, 4, resolver.calls)
+
+	_, _, _, err = rc.ResolveImageConfig(ctx, ref, opt(llb.ResolveModeForcePull))
+	require.NoError(t, err)
+	require.Equal(t, 4, resolver.calls)
+
+	// An expired entry is resolved again and repopulated.
+	now = now.Add(time.Hour)
+	_, _, _, err = rc.ResolveImageConfig(ctx, ref, opt(llb.ResolveModeDefault))
+	require.NoError(t, err)
+	require.Equal(t, 5, resolver.calls)
+
+	_, _, _, err = rc.ResolveImageConfig(ctx, ref, opt(llb.ResolveModeDefault))
+	require.NoError(t, err)
+	require.Equal(t, 5, resolver.calls)
+}
@@ -0,0 +1,110 @@
+package llbutil
+
+import (
+	"context"
+
+	"github.com/docker/cli/cli/config/configfile"
+	"github.com/docker/distribution/reference"
+	"github.com/moby/buildkit/session"
+	"github.com/moby/buildkit/session/auth"
+	"github.com/moby/buildkit/session/auth/authprovider"
+	"google.golang.org/grpc"
+)
+
+const (
+	dockerHubConfigfileKey = "https://index.docker.io/v1/"
+	dockerHubRegistryHost  = "registry-1.docker.io"
+)
+
+// AuthSource selects where the credentials of a registry are read from,
+// instead of the default chain of the local Docker config.
+type AuthSource struct {
+	// Host is the registry host the source applies to.
+	Host string
+
+	// Helper is the name of a credential helper, which is executed as
+	// docker-credential-<helper>.
+	Helper string
+
+	// Token is a bearer token used for the registry as-is.
+	Token string
+}
+
+// RegistryHost returns the host BuildKit requests credentials for when
+// pulling or pushing the named reference.
+func RegistryHost(named reference.Named) string {
+	host := reference.Domain(named)
+	if host == "docker.io" {
+		return dockerHubRegistryHost
+	}
+	return host
+}
+
+// WithAuthSource overrides the credentials the session provides for the host
+// of the source.
+func WithAuthSource(source AuthSource) SessionOption {
+	return func(si *SessionInfo) {
+		si.AuthSourceByHost[source.Host] = source
+	}
+}
+
+// NewAuthProvider returns an auth provider for the credentials in the Docker
+// config, except for the hosts of the given sources.
+func NewAuthProvider(cfg *configfile.ConfigFile, sources map[string]AuthSource) session.Attachable {
+	if len(sources) == 0 {
+		return authprovider.NewDockerAuthProvider(cfg, nil)
+	}
+
+	// Credential helpers are configured per host, so they are handled by a
+	// copy of the Docker config.
+	helpers := make(map[string]string)
+	for host, helper := range cfg.CredentialHelpers {
+		helpers[host] = helper
+	}
+	tokens := make(map[string]string)
+	for host, source := range sources {
+		switch {
+		case source.Helper != "":
+			if host == dockerHubRegistryHost {
+				host = dockerHubConfigfileKey
+			}
+			helpers[host] = source.Helper
+		case source.Token != "":
+			tokens[host] = source.Token
+		}
+	}
+
+	copied := *cfg
+	copied.CredentialHelpers = helpers
+	return &authProvider{
+		AuthServer: authprovider.NewDockerAuthProvider(&copied, nil).(auth.AuthServer),
+		tokens:     tokens,
+	}
+}
+
+// authProvider responds with the configured tokens for their hosts, and
+// defers to the Docker auth provider for the rest.
+type authProvider struct {
+	auth.AuthServer
+	tokens map[string]string
+}
+
+func (ap *authProvider) Register(server *grpc.Server) {
+	auth.RegisterAuthServer(server, ap)
+}
+
+func (ap *authProvider) Credentials(ctx context.Context, req *auth.CredentialsRequest) (*auth.CredentialsResponse, error) {
+	if _, ok := ap.tokens[req.Host]; ok {
+		// Tokens are only provided through FetchToken, so the credentials of
+		// the Docker config for the host are never shared.
+		return &auth.CredentialsResponse{}, nil
+	}
+	return ap.AuthServer.Credentials(ctx, req)
+}
+
+func (ap *authProvider) FetchToken(ctx context.Context, req *auth.FetchTokenRequest) (*auth.FetchTokenResponse, error) {
+	if token, ok := ap.tokens[req.Host]; ok {
+		return &auth.FetchTokenResponse{Token: token, ExpiresIn: 60}, nil
+	}
+	return ap.AuthServer.FetchToken(ctx, req)
+}
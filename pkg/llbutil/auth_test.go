@@ -0,0 +1,43 @@
+package llbutil
+
+import (
+	"context"
+	"testing"
+
+	"github.com/docker/cli/cli/config/configfile"
+	"github.com/moby/buildkit/session/auth"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewAuthProvider(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	cfg := configfile.New("")
+	cfg.CredentialHelpers = map[string]string{"other.local": "osxkeychain"}
+
+	ap, ok := NewAuthProvider(cfg, map[string]AuthSource{
+		"token.local":          {Host: "token.local", Token: "s3cr3t"},
+		"registry-1.docker.io": {Host: "registry-1.docker.io", Helper: "hlb-missing"},
+	}).(auth.AuthServer)
+	require.True(t, ok)
+
+	// Tokens are fetched as-is, without sharing other credentials.
+	token, err := ap.FetchToken(ctx, &auth.FetchTokenRequest{Host: "token.local"})
+	require.NoError(t, err)
+	require.Equal(t, "s3cr3t", token.Token)
+
+	creds, err := ap.Credentials(ctx, &auth.CredentialsRequest{Host: "token.local"})
+	require.NoError(t, err)
+	require.Equal(t, &auth.CredentialsResponse{}, creds)
+
+	// Credential helpers are executed for their host.
+	_, err = ap.Credentials(ctx, &auth.CredentialsRequest{Host: "registry-1.docker.io"})
+	require.ErrorContains(t, err, "docker-credential-hlb-missing")
+
+	// Other hosts use the Docker config, which is left unchanged.
+	creds, err = ap.Credentials(ctx, &auth.CredentialsRequest{Host: "registry.local"})
+	require.NoError(t, err)
+	require.Equal(t, &auth.CredentialsResponse{}, creds)
+	require.Equal(t, map[string]string{"other.local": "osxkeychain"}, cfg.CredentialHelpers)
+}
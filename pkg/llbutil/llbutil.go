@@ -49,6 +49,13 @@ func WithPersistentCacheDir(id string, sharing llb.CacheMountSharingMode) CacheM
 	}
 }
 
+// NoResolveImageOption skips resolving the config of an image.
+type NoResolveImageOption struct{}
+
+func WithNoResolveImage() NoResolveImageOption {
+	return NoResolveImageOption{}
+}
+
 type TmpfsMountOption struct{}
 
 func WithTmpfs() TmpfsMountOption {
@@ -150,6 +157,16 @@ func (ct CreatedTime) SetCopyOption(ci *llb.CopyInfo) {
 	ci.CreatedTime = (*time.Time)(&ct)
 }
 
+type PreserveTimestamps struct{}
+
+func WithPreserveTimestamps() PreserveTimestamps {
+	return PreserveTimestamps{}
+}
+
+func (pt PreserveTimestamps) SetCopyOption(ci *llb.CopyInfo) {
+	ci.CreatedTime = nil
+}
+
 type FollowSymlinks bool
 
 func WithFollowSymlinks(ok bool) FollowSymlinks {
@@ -350,6 +367,76 @@ func (host HostOption) SetRunOption(ei *llb.ExecInfo) {
 	llb.AddExtraHost(host.Host, host.IP).SetRunOption(ei)
 }
 
+type HostnameOption struct {
+	Hostname string
+}
+
+func WithHostname(hostname string) llb.RunOption {
+	return HostnameOption{Hostname: hostname}
+}
+
+func (hostname HostnameOption) SetRunOption(ei *llb.ExecInfo) {
+	llb.Hostname(hostname.Hostname).SetRunOption(ei)
+}
+
+type UlimitOption struct {
+	Name       llb.UlimitName
+	Soft, Hard int64
+}
+
+func WithUlimit(name llb.UlimitName, soft, hard int64) llb.RunOption {
+	return UlimitOption{Name: name, Soft: soft, Hard: hard}
+}
+
+func (ulimit UlimitOption) SetRunOption(ei *llb.ExecInfo) {
+	llb.AddUlimit(ulimit.Name, ulimit.Soft, ulimit.Hard).SetRunOption(ei)
+}
+
+type CgroupParentOption struct {
+	CgroupParent string
+}
+
+func WithCgroupParent(cgroupParent string) llb.RunOption {
+	return CgroupParentOption{CgroupParent: cgroupParent}
+}
+
+func (cgroupParent CgroupParentOption) SetRunOption(ei *llb.ExecInfo) {
+	llb.WithCgroupParent(cgroupParent.CgroupParent).SetRunOption(ei)
+}
+
+// StdinPath is where the stdin of a run is mounted in its container.
+const StdinPath = "/run/hlb/stdin"
+
+// StdinOption is the input written to the stdin of a run. Exec ops don't have
+// a stdin, so the input is mounted as a file and the command is run by a shell
+// that redirects the file to its stdin.
+type StdinOption struct {
+	Content string
+}
+
+func WithStdin(content string) StdinOption {
+	return StdinOption{Content: content}
+}
+
+// Mount returns a readonly mount of the input at StdinPath. The constraints
+// are applied to the file op that writes the input.
+func (s StdinOption) Mount(constraints ...llb.ConstraintsOpt) *MountRunOption {
+	return &MountRunOption{
+		Source: llb.Scratch().File(llb.Mkfile("stdin", 0o444, []byte(s.Content)), constraints...),
+		Target: StdinPath,
+		Opts: []interface{}{
+			WithReadonlyMount(),
+			WithSourcePath("stdin"),
+			llb.MountOption(llb.ForceNoOutput),
+		},
+	}
+}
+
+// Args returns the args to run args with the mounted input as its stdin.
+func (s StdinOption) Args(args []string) []string {
+	return append([]string{"/bin/sh", "-c", `exec "$@" <` + StdinPath, "sh"}, args...)
+}
+
 type SecretOption struct {
 	Dest string
 	Opts []llb.SecretOption
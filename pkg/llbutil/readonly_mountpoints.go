@@ -1,6 +1,7 @@
 package llbutil
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
@@ -24,6 +25,8 @@ import (
 //			# ^^^^^ FAIL cannot create `output` directory for mount on readonly fs
 //			secret "./secret/foo.pem" "/src/secret/foo.pem"
 //			# ^^^^^ FAIL cannot create `./secret/foo.pm` for secret on readonly fs
+//			ssh with option { target "/src/ssh/agent.sock"; }
+//			# ^^^^^ FAIL cannot create `./ssh/agent.sock` for ssh on readonly fs
 //		}
 //	}
 //	```
@@ -54,7 +57,10 @@ import (
 // So this function is effectively automatically adding the `mkdir` and `mkfile`
 // instructions when it detects that a mountpoint is required to be on a
 // readonly fs.
-func ShimReadonlyMountpoints(opts []llb.RunOption) error {
+//
+// The constraints are applied to the added file ops, so they can be given the
+// source map of the run that requires them.
+func ShimReadonlyMountpoints(opts []llb.RunOption, constraints ...llb.ConstraintsOpt) error {
 	// Short-circuit if we don't have any readonly mounts.
 	haveReadonly := false
 	for _, opt := range opts {
@@ -69,13 +75,15 @@ func ShimReadonlyMountpoints(opts []llb.RunOption) error {
 		return nil
 	}
 
-	// Collecting run options to look for targets (secrets, mounts) so we can
-	// determine if there are overlapping mounts with readonly attributes.
+	// Collecting run options to look for targets (secrets, ssh sockets, mounts)
+	// so we can determine if there are overlapping mounts with readonly
+	// attributes.
 	mountDetails := make([]struct {
 		Target string
 		Mount  *MountRunOption
 	}, len(opts))
 
+	numSSH := 0
 	for i, opt := range opts {
 		switch runOpt := opt.(type) {
 		case *MountRunOption:
@@ -89,6 +97,17 @@ func ShimReadonlyMountpoints(opts []llb.RunOption) error {
 				mountDetails[i].Target = ei.Secrets[0].Target
 				continue
 			}
+			if len(ei.SSH) > 0 {
+				// Like secrets, ssh sockets are files. BuildKit mounts sockets
+				// without a target by their index among the ssh sockets.
+				target := ei.SSH[0].Target
+				if target == "" {
+					target = fmt.Sprintf("/run/buildkit/ssh_agent.%d", numSSH)
+				}
+				mountDetails[i].Target = target
+				numSSH++
+				continue
+			}
 		}
 	}
 
@@ -143,11 +162,12 @@ func ShimReadonlyMountpoints(opts []llb.RunOption) error {
 				}
 				st = st.File(
 					llb.Mkdir(relativeDir, os.FileMode(0755), llb.WithParents(true)),
+					constraints...,
 				)
 			} else {
-				// Not a mount, so must be a `secret` which will be a path to a file, we
-				// will need to make the directory for the secret as well as an empty file
-				// to be mounted over.
+				// Not a mount, so must be a `secret` or `ssh` socket which will be a
+				// path to a file, we will need to make the directory for the file as
+				// well as an empty file to be mounted over.
 				dir := filepath.Dir(src.Target)
 				relativeDir := strings.TrimPrefix(dir, dest.Target)
 
@@ -157,6 +177,7 @@ func ShimReadonlyMountpoints(opts []llb.RunOption) error {
 
 					st = st.File(
 						llb.Mkdir(relativeDir, os.FileMode(0755), llb.WithParents(true)),
+						constraints...,
 					)
 				}
 
@@ -167,6 +188,7 @@ func ShimReadonlyMountpoints(opts []llb.RunOption) error {
 
 				st = st.File(
 					llb.Mkfile(relativeFile, os.FileMode(0644), []byte{}),
+					constraints...,
 				)
 			}
 
@@ -7,7 +7,6 @@ import (
 
 	"github.com/docker/cli/cli/config"
 	"github.com/moby/buildkit/session"
-	"github.com/moby/buildkit/session/auth/authprovider"
 	"github.com/moby/buildkit/session/filesync"
 	"github.com/moby/buildkit/session/secrets/secretsprovider"
 	"github.com/openllb/hlb/pkg/sockproxy"
@@ -15,11 +14,12 @@ import (
 )
 
 type SessionInfo struct {
-	SyncTargetDir   *string
-	SyncTarget      func(map[string]string) (io.WriteCloser, error)
-	SyncedDirs      filesync.StaticDirSource
-	FileSourceByID  map[string]secretsprovider.Source
-	AgentConfigByID map[string]sockproxy.AgentConfig
+	SyncTargetDir    *string
+	SyncTarget       func(map[string]string) (io.WriteCloser, error)
+	SyncedDirs       filesync.StaticDirSource
+	FileSourceByID   map[string]secretsprovider.Source
+	AgentConfigByID  map[string]sockproxy.AgentConfig
+	AuthSourceByHost map[string]AuthSource
 }
 
 type SessionOption func(*SessionInfo)
@@ -56,9 +56,10 @@ func WithAgentConfig(id string, cfg sockproxy.AgentConfig) SessionOption {
 
 func NewSession(ctx context.Context, opts ...SessionOption) (*session.Session, error) {
 	si := SessionInfo{
-		SyncedDirs:      make(filesync.StaticDirSource),
-		FileSourceByID:  make(map[string]secretsprovider.Source),
-		AgentConfigByID: make(map[string]sockproxy.AgentConfig),
+		SyncedDirs:       make(filesync.StaticDirSource),
+		FileSourceByID:   make(map[string]secretsprovider.Source),
+		AgentConfigByID:  make(map[string]sockproxy.AgentConfig),
+		AuthSourceByHost: make(map[string]AuthSource),
 	}
 	for _, opt := range opts {
 		opt(&si)
@@ -66,7 +67,7 @@ func NewSession(ctx context.Context, opts ...SessionOption) (*session.Session, e
 
 	// By default, forward docker authentication through the session.
 	dockerConfig := config.LoadDefaultConfigFile(os.Stderr)
-	attachables := []session.Attachable{authprovider.NewDockerAuthProvider(dockerConfig, nil)}
+	attachables := []session.Attachable{NewAuthProvider(dockerConfig, si.AuthSourceByHost)}
 
 	// Attach local directory the session can write to.
 	syncIndex := 0
@@ -5,7 +5,6 @@ import (
 	"context"
 	"errors"
 	"io"
-	"io/ioutil"
 	"log"
 
 	"github.com/chzyer/readline"
@@ -16,10 +15,30 @@ import (
 
 type Server struct {
 	dbgr codegen.Debugger
+	log  *log.Logger
 }
 
-func New(dbgr codegen.Debugger) *Server {
-	return &Server{dbgr}
+type ServerOption func(*Server)
+
+// WithLog traces the protocol messages to w, which must not be the stream the
+// server communicates over. By default, nothing is traced.
+func WithLog(w io.Writer) ServerOption {
+	return func(s *Server) {
+		if w != nil {
+			s.log = log.New(w, "", log.LstdFlags)
+		}
+	}
+}
+
+func New(dbgr codegen.Debugger, opts ...ServerOption) *Server {
+	s := &Server{
+		dbgr: dbgr,
+		log:  log.New(io.Discard, "", 0),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
 func (s *Server) Listen(ctx context.Context, output, stdin io.Reader, stdout io.Writer) error {
@@ -27,6 +46,7 @@ func (s *Server) Listen(ctx context.Context, output, stdin io.Reader, stdout io.
 	cancelableStdin := readline.NewCancelableStdin(stdin)
 	session := Session{
 		dbgr: s.dbgr,
+		log:  s.log,
 		rw: bufio.NewReadWriter(
 			bufio.NewReader(cancelableStdin),
 			bufio.NewWriter(stdout),
@@ -74,16 +94,7 @@ func (s *Server) Listen(ctx context.Context, output, stdin io.Reader, stdout io.
 		})
 	}
 
-	// f, err := os.Create("/tmp/hlb-dapserver.log")
-	// if err != nil {
-	// 	panic(err)
-	// }
-	// defer f.Close()
-	// log.SetOutput(f)
-
-	log.SetOutput(ioutil.Discard)
-
-	log.Printf("Listening on stdio")
+	s.log.Printf("Listening on stdio")
 	g.Go(func() error {
 		for {
 			select {
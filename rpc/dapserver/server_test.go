@@ -2,6 +2,7 @@ package dapserver
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
@@ -25,6 +26,45 @@ func TestServer(t *testing.T) {
 	})
 }
 
+func TestServerLog(t *testing.T) {
+	t.Parallel()
+
+	stdinReader, stdinWriter := io.Pipe()
+	stdoutReader, stdoutWriter := io.Pipe()
+
+	var log bytes.Buffer
+	done := make(chan error)
+	go func() {
+		done <- New(nil, WithLog(&log)).Listen(context.Background(), nil, stdinReader, stdoutWriter)
+	}()
+
+	err := dap.WriteProtocolMessage(stdinWriter, &dap.InitializeRequest{
+		Request: dap.Request{
+			ProtocolMessage: dap.ProtocolMessage{Seq: 1, Type: "request"},
+			Command:         "initialize",
+		},
+	})
+	require.NoError(t, err)
+
+	// Only protocol messages are written to stdout.
+	stdout := bufio.NewReader(stdoutReader)
+	msg, err := dap.ReadProtocolMessage(stdout)
+	require.NoError(t, err)
+	require.IsType(t, &dap.InitializedEvent{}, msg)
+
+	msg, err = dap.ReadProtocolMessage(stdout)
+	require.NoError(t, err)
+	require.IsType(t, &dap.InitializeResponse{}, msg)
+
+	err = stdinWriter.Close()
+	require.NoError(t, err)
+	require.NoError(t, <-done)
+	require.Zero(t, stdout.Buffered())
+
+	require.Contains(t, log.String(), `[-> to server] {"seq":1,"type":"request","command":"initialize"`)
+	require.Contains(t, log.String(), `[-> to client] {"seq":0,"type":"response"`)
+}
+
 type debugger struct {
 	codegen.Debugger
 	server *Server
@@ -411,8 +451,9 @@ func (d *debugger) setBreakpoints(bps []*codegen.Breakpoint) error {
 	var sbps []dap.SourceBreakpoint
 	for _, bp := range bps {
 		sbps = append(sbps, dap.SourceBreakpoint{
-			Line:   bp.Position().Line,
-			Column: bp.Position().Column,
+			Line:      bp.Position().Line,
+			Column:    bp.Position().Column,
+			Condition: bp.Condition,
 		})
 	}
 
@@ -479,6 +520,48 @@ func (d *debugger) ClearBreakpoint(bp *codegen.Breakpoint) error {
 	return d.setBreakpoints(newBps)
 }
 
+func (d *debugger) SetVariable(name, value string) (*ast.Object, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	err := d.send(&dap.ScopesRequest{
+		Request: d.newRequest("scopes"),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var resp dap.ScopesResponse
+	err = json.Unmarshal(<-d.msgs, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	// Arguments are in the first scope.
+	err = d.send(&dap.SetVariableRequest{
+		Request: d.newRequest("setVariable"),
+		Arguments: dap.SetVariableArguments{
+			VariablesReference: resp.Body.Scopes[0].VariablesReference,
+			Name:               name,
+			Value:              value,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = d.readSuccessResponse("setVariable")
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := d.getState()
+	if err != nil {
+		return nil, err
+	}
+	return s.Scope.Lookup(name), nil
+}
+
 func (d *debugger) Terminate() error {
 	d.mu.Lock()
 	_, err := d.getState()
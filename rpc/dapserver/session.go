@@ -8,10 +8,13 @@ import (
 	"fmt"
 	"log"
 	"path/filepath"
+	"strings"
 	"sync"
 
 	"github.com/alecthomas/participle/v2/lexer"
+	"github.com/containerd/containerd/platforms"
 	dap "github.com/google/go-dap"
+	specs "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/openllb/hlb/codegen"
 	"github.com/openllb/hlb/parser/ast"
 	"github.com/openllb/hlb/pkg/filebuffer"
@@ -20,6 +23,7 @@ import (
 type Session struct {
 	dbgr codegen.Debugger
 	rw   *bufio.ReadWriter
+	log  *log.Logger
 
 	cancel context.CancelFunc
 	err    error
@@ -59,7 +63,7 @@ func (s *Session) handleRequest(ctx context.Context) error {
 
 func (s *Session) dispatchRequest(ctx context.Context, msg dap.RequestMessage) {
 	jsonmsg, _ := json.Marshal(msg)
-	log.Printf("[-> to server] %s", string(jsonmsg))
+	s.log.Printf("[-> to server] %s", string(jsonmsg))
 
 	var err error
 	if s.dbgr == nil {
@@ -166,7 +170,7 @@ func (s *Session) dispatchRequest(ctx context.Context, msg dap.RequestMessage) {
 		err = fmt.Errorf("unable to process %#v", req)
 	}
 	if err != nil {
-		log.Printf("[-> to client] err: %s", err)
+		s.log.Printf("[-> to client] err: %s", err)
 		if errors.Is(err, codegen.ErrDebugExit) {
 			s.send(&dap.TerminatedEvent{
 				Event: newEvent("terminated"),
@@ -196,7 +200,7 @@ func (s *Session) sendFromQueue(ctx context.Context) error {
 				return err
 			}
 
-			log.Printf("[-> to client] %s", string(jsonmsg))
+			s.log.Printf("[-> to client] %s", string(jsonmsg))
 			err = dap.WriteProtocolMessage(s.rw.Writer, msg)
 			if err != nil {
 				return err
@@ -221,11 +225,11 @@ func (s *Session) sendFromQueue(ctx context.Context) error {
 // The 'initialize' request may only be sent once.
 func (s *Session) onInitializeRequest(req *dap.InitializeRequest) error {
 	if req.Arguments.SupportsVariableType {
-		log.Printf("Client supports VariableType")
+		s.log.Printf("Client supports VariableType")
 		s.caps[VariableTypeCap] = struct{}{}
 	}
 	if req.Arguments.SupportsProgressReporting {
-		log.Printf("Client supports ProgressReporting")
+		s.log.Printf("Client supports ProgressReporting")
 		s.caps[ProgressReportingCap] = struct{}{}
 	}
 
@@ -235,13 +239,13 @@ func (s *Session) onInitializeRequest(req *dap.InitializeRequest) error {
 		Response: newResponse(req),
 		Body: dap.Capabilities{
 			SupportsConfigurationDoneRequest:   true,
-			SupportsFunctionBreakpoints:        false,
-			SupportsConditionalBreakpoints:     false,
+			SupportsFunctionBreakpoints:        true,
+			SupportsConditionalBreakpoints:     true,
 			SupportsHitConditionalBreakpoints:  false,
-			SupportsEvaluateForHovers:          false,
+			SupportsEvaluateForHovers:          true,
 			ExceptionBreakpointFilters:         nil,
 			SupportsStepBack:                   true,
-			SupportsSetVariable:                false,
+			SupportsSetVariable:                true,
 			SupportsRestartFrame:               false,
 			SupportsGotoTargetsRequest:         false,
 			SupportsStepInTargetsRequest:       false,
@@ -378,6 +382,11 @@ func (s *Session) onSetBreakpointsRequest(req *dap.SetBreakpointsRequest) error
 	}
 
 	for _, bp := range bps {
+		// Function breakpoints are managed by setFunctionBreakpoints.
+		if bp.Func != nil || bp.Pending() {
+			continue
+		}
+
 		sourcePath, err := filepath.Abs(bp.Position().Filename)
 		if err != nil {
 			continue
@@ -422,7 +431,10 @@ func (s *Session) onSetBreakpointsRequest(req *dap.SetBreakpointsRequest) error
 		if match == nil {
 			err = fmt.Errorf("failed to find node matching %d:%d", want.Line, want.Column)
 		} else {
-			bp, err = s.dbgr.CreateBreakpoint(&codegen.Breakpoint{Node: match})
+			bp, err = s.dbgr.CreateBreakpoint(&codegen.Breakpoint{
+				Node:      match,
+				Condition: want.Condition,
+			})
 		}
 		if err != nil {
 			resp.Body.Breakpoints[i].Line = want.Line
@@ -455,7 +467,119 @@ func (s *Session) onSetBreakpointsRequest(req *dap.SetBreakpointsRequest) error
 // Clients should only call this request if the capability
 // 'supportsFunctionBreakpoints' is true.
 func (s *Session) onSetFunctionBreakpointsRequest(req *dap.SetFunctionBreakpointsRequest) error {
-	return fmt.Errorf("SetFunctionBreakpointsRequest is not yet supported")
+	bps, err := s.dbgr.Breakpoints()
+	if err != nil {
+		return err
+	}
+
+	// Clearing a breakpoint removes it from bps, so iterate over a copy.
+	for _, bp := range append([]*codegen.Breakpoint{}, bps...) {
+		if bp.Func == nil && !bp.Pending() {
+			continue
+		}
+
+		err = s.dbgr.ClearBreakpoint(bp)
+		if err != nil {
+			return err
+		}
+	}
+
+	state, err := s.dbgr.GetState()
+	if err != nil {
+		return err
+	}
+
+	scope := state.Scope.ByLevel(ast.ModuleScope)
+	if scope == nil {
+		return fmt.Errorf("failed to find module scope")
+	}
+
+	resp := &dap.SetFunctionBreakpointsResponse{
+		Response: newResponse(req),
+	}
+	resp.Body.Breakpoints = make([]dap.Breakpoint, len(req.Arguments.Breakpoints))
+
+	for i, want := range req.Arguments.Breakpoints {
+		fds, err := lookupFuncDecls(scope, want.Name)
+		if errors.Is(err, codegen.ErrImportNotLoaded) {
+			// Functions of imports are resolved once the import is loaded, so
+			// the breakpoint stays unverified until then.
+			_, err = s.dbgr.CreateBreakpoint(&codegen.Breakpoint{
+				FuncName:  want.Name,
+				Condition: want.Condition,
+			})
+			if err == nil {
+				err = fmt.Errorf("pending until %q is loaded", strings.Split(want.Name, ".")[0])
+			}
+		}
+		if err != nil {
+			resp.Body.Breakpoints[i].Message = err.Error()
+			continue
+		}
+
+		// Names of builtins with multiple kinds are ambiguous, so there is a
+		// breakpoint for each kind, and the first is reported back.
+		var bp *codegen.Breakpoint
+		for _, fd := range fds {
+			var created *codegen.Breakpoint
+			created, err = s.dbgr.CreateBreakpoint(&codegen.Breakpoint{
+				Func:      fd,
+				Condition: want.Condition,
+			})
+			if err != nil {
+				break
+			}
+			if bp == nil {
+				bp = created
+			}
+		}
+		if err != nil {
+			resp.Body.Breakpoints[i].Message = err.Error()
+			continue
+		}
+
+		resp.Body.Breakpoints[i].Verified = true
+		resp.Body.Breakpoints[i].Line = bp.Position().Line
+		resp.Body.Breakpoints[i].Column = bp.Position().Column
+		resp.Body.Breakpoints[i].EndLine = bp.End().Line
+		resp.Body.Breakpoints[i].EndColumn = bp.End().Column
+		resp.Body.Breakpoints[i].Source, err = s.newSource(state.Ctx, bp.Position().Filename)
+		if err != nil {
+			resp.Body.Breakpoints[i].Message = err.Error()
+		}
+	}
+
+	s.send(resp)
+	return nil
+}
+
+// lookupFuncDecls returns the functions named by name in scope, which may
+// reference a function of an imported module like `other.build`. Builtins
+// have a function for each kind they are declared with.
+func lookupFuncDecls(scope *ast.Scope, name string) ([]*ast.FuncDecl, error) {
+	obj, err := codegen.LookupExpr(scope, name)
+	if err != nil {
+		return nil, err
+	}
+	if obj == nil {
+		return nil, fmt.Errorf("failed to find function %q", name)
+	}
+
+	switch n := obj.Node.(type) {
+	case *ast.FuncDecl:
+		return []*ast.FuncDecl{n}, nil
+	case *ast.BuiltinDecl:
+		var fds []*ast.FuncDecl
+		for _, kind := range n.Kinds {
+			fd, ok := n.FuncDeclByKind[kind]
+			if ok {
+				fds = append(fds, fd)
+			}
+		}
+		return fds, nil
+	default:
+		return nil, fmt.Errorf("%q is not a function", name)
+	}
 }
 
 // SetExceptionBreakpointsRequest: The request configures the debuggers
@@ -726,24 +850,23 @@ func (s *Session) onVariablesRequest(ctx context.Context, req *dap.VariablesRequ
 		return fmt.Errorf("unknown variables reference %d", req.Arguments.VariablesReference)
 	}
 
-	objs := v.([]*ast.Object)
-	vars := make([]dap.Variable, len(objs))
-
-	for i, obj := range objs {
-		var value string
-		val, err := codegen.NewValue(ctx, obj.Data)
-		if err != nil {
-			value = fmt.Sprintf("<%s>", obj.Kind)
-		} else {
-			value, _ = val.String()
-		}
-		vars[i] = dap.Variable{
-			Name:  obj.Ident.String(),
-			Value: value,
-		}
-		if _, ok := s.caps[VariableTypeCap]; ok {
-			vars[i].Type = string(obj.Kind)
+	var vars []dap.Variable
+	switch v := v.(type) {
+	case []*ast.Object:
+		vars = make([]dap.Variable, len(v))
+		for i, obj := range v {
+			value, ref := s.renderObject(ctx, obj)
+			vars[i] = dap.Variable{
+				Name:               obj.Ident.String(),
+				Value:              value,
+				VariablesReference: ref,
+			}
+			if _, ok := s.caps[VariableTypeCap]; ok {
+				vars[i].Type = string(obj.Kind)
+			}
 		}
+	case []dap.Variable:
+		vars = v
 	}
 
 	s.send(&dap.VariablesResponse{
@@ -760,7 +883,48 @@ func (s *Session) onVariablesRequest(ctx context.Context, req *dap.VariablesRequ
 // Clients should only call this request if the capability 'supportsSetVariable'
 // is true.
 func (s *Session) onSetVariableRequest(req *dap.SetVariableRequest) error {
-	return fmt.Errorf("SetVariableRequest is not yet supported")
+	v, ok := s.variablesHandles.get(req.Arguments.VariablesReference)
+	if !ok {
+		return fmt.Errorf("unknown variables reference %d", req.Arguments.VariablesReference)
+	}
+
+	// Only the variables of scopes can be set, not the children of filesystems.
+	objs, ok := v.([]*ast.Object)
+	if !ok {
+		return fmt.Errorf("cannot set %s: only arguments can be set", req.Arguments.Name)
+	}
+	found := false
+	for _, obj := range objs {
+		if obj.Ident.String() == req.Arguments.Name {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return fmt.Errorf("undefined: %s", req.Arguments.Name)
+	}
+
+	obj, err := s.dbgr.SetVariable(req.Arguments.Name, req.Arguments.Value)
+	if err != nil {
+		return err
+	}
+
+	state, err := s.dbgr.GetState()
+	if err != nil {
+		return err
+	}
+
+	var body dap.SetVariableResponseBody
+	body.Value, body.VariablesReference = s.renderObject(state.Ctx, obj)
+	if _, ok := s.caps[VariableTypeCap]; ok {
+		body.Type = string(obj.Kind)
+	}
+
+	s.send(&dap.SetVariableResponse{
+		Response: newResponse(req),
+		Body:     body,
+	})
+	return nil
 }
 
 // SetExpressionRequest: Evaluates the given 'value' expression and assigns it
@@ -817,7 +981,139 @@ func (s *Session) onTerminateThreadsRequest(req *dap.TerminateThreadsRequest) er
 // most stack frame.
 // The expression has access to any variables and arguments that are in scope.
 func (s *Session) onEvaluateRequest(req *dap.EvaluateRequest) error {
-	return fmt.Errorf("EvaluateRequest is not yet supported")
+	state, err := s.dbgr.GetState()
+	if err != nil {
+		return err
+	}
+
+	obj, err := codegen.LookupExpr(state.Scope, req.Arguments.Expression)
+	if err != nil {
+		return err
+	}
+
+	var body dap.EvaluateResponseBody
+	switch {
+	case obj != nil:
+		body.Result, body.VariablesReference = s.renderObject(state.Ctx, obj)
+		if _, ok := s.caps[VariableTypeCap]; ok {
+			body.Type = string(obj.Kind)
+		}
+	case req.Arguments.Context == "hover":
+		// Hovering over keywords or literals shouldn't show anything.
+	default:
+		body.Result = fmt.Sprintf("undefined: %s", req.Arguments.Expression)
+	}
+
+	s.send(&dap.EvaluateResponse{
+		Response: newResponse(req),
+		Body:     body,
+	})
+	return nil
+}
+
+// renderObject returns the value of obj, and a reference to its child
+// variables if it is a filesystem.
+func (s *Session) renderObject(ctx context.Context, obj *ast.Object) (string, int) {
+	data := obj.Data
+	if reg, ok := data.(codegen.Register); ok {
+		data = reg.Value()
+	}
+
+	// Functions have no value until they are called.
+	val, err := codegen.NewValue(ctx, data)
+	if err != nil {
+		return renderDecl(obj), 0
+	}
+
+	switch val.Kind() {
+	case ast.Filesystem:
+		fs, err := val.Filesystem()
+		if err != nil {
+			return fmt.Sprintf("<%s>", obj.Kind), 0
+		}
+		summary, vars := fsVariables(ctx, fs)
+		return summary, s.variablesHandles.create(obj.Ident.String(), vars)
+	case ast.Option:
+		opts, err := val.Option()
+		if err != nil {
+			return fmt.Sprintf("<%s>", obj.Kind), 0
+		}
+		return fmt.Sprintf("%s (%d options)", obj.Kind, len(opts)), 0
+	default:
+		value, _ := val.String()
+		return value, 0
+	}
+}
+
+// renderDecl renders an object without a value by its declaration. Functions
+// are rendered by their signature, followed by the options they call if they
+// are option functions.
+func renderDecl(obj *ast.Object) string {
+	fd, ok := obj.Node.(*ast.FuncDecl)
+	if !ok || fd.Sig == nil {
+		return fmt.Sprintf("<%s>", obj.Kind)
+	}
+
+	sig := fd.Sig.String()
+	if fd.Kind().Primary() != ast.Option || fd.Body == nil {
+		return sig
+	}
+
+	var names []string
+	for _, stmt := range fd.Body.Stmts() {
+		if stmt.Call != nil && stmt.Call.Name != nil {
+			names = append(names, stmt.Call.Name.String())
+		}
+	}
+	return fmt.Sprintf("%s { %s }", sig, strings.Join(names, "; "))
+}
+
+// fsVariables returns a short summary of the filesystem, with its platform and
+// base image, and its image config as child variables.
+func fsVariables(ctx context.Context, fs codegen.Filesystem) (string, []dap.Variable) {
+	ref := "scratch"
+	if fs.State.Output() != nil {
+		dgst, err := fs.Digest(ctx)
+		if err != nil {
+			ref = fmt.Sprintf("<%s>", err)
+		} else {
+			ref = dgst.String()
+		}
+	}
+
+	var details []string
+	vars := []dap.Variable{{Name: "digest", Value: ref}}
+	if fs.Platform.OS != "" {
+		platform := platforms.Format(fs.Platform)
+		details = append(details, platform)
+		vars = append(vars, dap.Variable{Name: "platform", Value: platform})
+	}
+
+	if fs.Image != nil {
+		if base := fs.Image.Annotations[specs.AnnotationBaseImageName]; base != "" {
+			details = append(details, fmt.Sprintf("from %s", base))
+			vars = append(vars, dap.Variable{Name: "base", Value: base})
+		}
+
+		config := fs.Image.Config
+		for _, v := range []dap.Variable{
+			{Name: "env", Value: strings.Join(config.Env, " ")},
+			{Name: "workdir", Value: config.WorkingDir},
+			{Name: "user", Value: config.User},
+			{Name: "entrypoint", Value: strings.Join(config.Entrypoint, " ")},
+			{Name: "cmd", Value: strings.Join(config.Cmd, " ")},
+		} {
+			if v.Value != "" {
+				vars = append(vars, v)
+			}
+		}
+	}
+
+	summary := fmt.Sprintf("fs %s", ref)
+	if len(details) > 0 {
+		summary = fmt.Sprintf("%s (%s)", summary, strings.Join(details, ", "))
+	}
+	return summary, vars
 }
 
 // StepInTargetsRequest: This request retrieves the possible stepIn targets for
@@ -957,6 +1253,11 @@ func (s *Session) onBreakpointLocationsRequest(req *dap.BreakpointLocationsReque
 
 	var locs []dap.BreakpointLocation
 	for _, bp := range bps {
+		// Function breakpoints are managed by setFunctionBreakpoints.
+		if bp.Func != nil || bp.Pending() {
+			continue
+		}
+
 		sourcePath, err := filepath.Abs(bp.Position().Filename)
 		if err != nil {
 			continue
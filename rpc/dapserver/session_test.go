@@ -0,0 +1,260 @@
+package dapserver
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	dap "github.com/google/go-dap"
+	"github.com/moby/buildkit/client/llb"
+	specs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/openllb/hlb/builtin"
+	"github.com/openllb/hlb/checker"
+	"github.com/openllb/hlb/codegen"
+	"github.com/openllb/hlb/parser"
+	"github.com/openllb/hlb/parser/ast"
+	"github.com/openllb/hlb/pkg/filebuffer"
+	"github.com/openllb/hlb/solver"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLookupExpr(t *testing.T) {
+	t.Parallel()
+
+	scope := ast.NewScope(nil, ast.ModuleScope, nil)
+	local := &ast.Object{Kind: ast.String, Ident: ast.NewIdent("ref"), Data: "alpine"}
+	scope.Insert(local)
+	scope.Insert(&ast.Object{Ident: ast.NewIdent("lazy"), Node: &ast.ImportDecl{}})
+
+	type testCase struct {
+		name     string
+		expr     string
+		expected *ast.Object
+		hasErr   bool
+	}
+
+	for _, tc := range []testCase{{
+		"identifier",
+		" ref ",
+		local,
+		false,
+	}, {
+		"undefined identifier",
+		"missing",
+		nil,
+		false,
+	}, {
+		"selector of unresolved import",
+		"lazy.build",
+		nil,
+		true,
+	}, {
+		"selector of non-import",
+		"ref.build",
+		nil,
+		false,
+	}, {
+		"unparseable",
+		"ref + 1",
+		nil,
+		true,
+	}} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			obj, err := codegen.LookupExpr(scope, tc.expr)
+			if tc.hasErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, obj)
+		})
+	}
+}
+
+func TestLookupFuncDecls(t *testing.T) {
+	t.Parallel()
+
+	build := &ast.FuncDecl{}
+	fsShell, runShell := &ast.FuncDecl{}, &ast.FuncDecl{}
+	scope := ast.NewScope(nil, ast.ModuleScope, nil)
+	scope.Insert(&ast.Object{Kind: ast.Filesystem, Ident: ast.NewIdent("build"), Node: build})
+	scope.Insert(&ast.Object{Ident: ast.NewIdent("shell"), Node: &ast.BuiltinDecl{
+		Kinds: []ast.Kind{ast.Filesystem, "option::run"},
+		FuncDeclByKind: map[ast.Kind]*ast.FuncDecl{
+			ast.Filesystem: fsShell,
+			"option::run":  runShell,
+		},
+	}})
+	scope.Insert(&ast.Object{Kind: ast.String, Ident: ast.NewIdent("ref"), Node: &ast.Field{}})
+
+	type testCase struct {
+		name     string
+		expr     string
+		expected []*ast.FuncDecl
+		hasErr   bool
+	}
+
+	for _, tc := range []testCase{{
+		"function",
+		"build",
+		[]*ast.FuncDecl{build},
+		false,
+	}, {
+		"builtin with multiple kinds",
+		"shell",
+		[]*ast.FuncDecl{fsShell, runShell},
+		false,
+	}, {
+		"undefined function",
+		"missing",
+		nil,
+		true,
+	}, {
+		"not a function",
+		"ref",
+		nil,
+		true,
+	}} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			fds, err := lookupFuncDecls(scope, tc.expr)
+			if tc.hasErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, fds)
+		})
+	}
+}
+
+func TestLookupFuncDeclsImport(t *testing.T) {
+	t.Parallel()
+
+	ctx := filebuffer.WithBuffers(context.Background(), builtin.Buffers())
+	ctx = ast.WithModules(ctx, builtin.Modules())
+
+	other := filepath.Join(t.TempDir(), "other.hlb")
+	err := os.WriteFile(other, []byte("export build\nfs build() { scratch; }\n"), 0o644)
+	require.NoError(t, err)
+
+	mod, err := parser.Parse(ctx, strings.NewReader(fmt.Sprintf(`
+	import other from %q
+
+	fs default() {
+		other.build
+	}
+	`, other)))
+	require.NoError(t, err)
+
+	err = checker.SemanticPass(mod)
+	require.NoError(t, err)
+
+	err = checker.Check(mod)
+	require.NoError(t, err)
+
+	// Imports are loaded when they are first called, so the function can't
+	// be found until then.
+	_, err = lookupFuncDecls(mod.Scope, "other.build")
+	require.ErrorIs(t, err, codegen.ErrImportNotLoaded)
+
+	_, err = codegen.New(nil, nil).Generate(ctx, mod, []codegen.Target{{Name: "default"}})
+	require.NoError(t, err)
+
+	fds, err := lookupFuncDecls(mod.Scope, "other.build")
+	require.NoError(t, err)
+	require.Len(t, fds, 1)
+	require.Equal(t, other, fds[0].Position().Filename)
+	require.Equal(t, "build", fds[0].Sig.Name.Text)
+
+	_, err = lookupFuncDecls(mod.Scope, "other.missing")
+	require.Error(t, err)
+}
+
+func TestFSVariables(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	summary, vars := fsVariables(ctx, codegen.Filesystem{State: llb.Scratch()})
+	require.Equal(t, "fs scratch", summary)
+	require.Equal(t, []dap.Variable{{Name: "digest", Value: "scratch"}}, vars)
+
+	fs := codegen.Filesystem{
+		State:    llb.Image("alpine"),
+		Image:    &solver.ImageSpec{},
+		Platform: specs.Platform{OS: "linux", Architecture: "amd64"},
+	}
+	fs.Image.Config.WorkingDir = "/src"
+	dgst, err := fs.Digest(ctx)
+	require.NoError(t, err)
+
+	summary, vars = fsVariables(ctx, fs)
+	require.Equal(t, "fs "+dgst.String()+" (linux/amd64)", summary)
+	require.Equal(t, []dap.Variable{
+		{Name: "digest", Value: dgst.String()},
+		{Name: "platform", Value: "linux/amd64"},
+		{Name: "workdir", Value: "/src"},
+	}, vars)
+}
+
+func TestVariablesRequest(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	mod, err := parser.Parse(ctx, strings.NewReader(`
+	fs build() {
+		scratch
+	}
+
+	option::run cached() {
+		dir "/src"
+		readonlyRootfs
+	}
+	`))
+	require.NoError(t, err)
+
+	fs := codegen.Filesystem{
+		State:    llb.Image("alpine"),
+		Image:    &solver.ImageSpec{},
+		Platform: specs.Platform{OS: "linux", Architecture: "amd64"},
+	}
+	fs.Image.Annotations = map[string]string{specs.AnnotationBaseImageName: "alpine"}
+	dgst, err := fs.Digest(ctx)
+	require.NoError(t, err)
+
+	objs := []*ast.Object{
+		{Kind: ast.Filesystem, Ident: ast.NewIdent("base"), Data: fs},
+		{Kind: "option::run", Ident: ast.NewIdent("opts"), Data: codegen.Option{llb.Dir("/src"), llb.ReadonlyRootFS()}},
+		{Kind: ast.Filesystem, Ident: ast.NewIdent("build"), Node: mod.Decls[1].Func},
+		{Kind: "option::run", Ident: ast.NewIdent("cached"), Node: mod.Decls[4].Func},
+	}
+
+	s := &Session{
+		sendQueue:        make(chan dap.Message, 1),
+		caps:             make(map[Capability]struct{}),
+		variablesHandles: newHandlesMap(),
+	}
+	req := &dap.VariablesRequest{}
+	req.Arguments.VariablesReference = s.variablesHandles.create("locals", objs)
+	err = s.onVariablesRequest(ctx, req)
+	require.NoError(t, err)
+
+	rsp := (<-s.sendQueue).(*dap.VariablesResponse)
+	vars := rsp.Body.Variables
+	require.Len(t, vars, 4)
+
+	require.Equal(t, "fs "+dgst.String()+" (linux/amd64, from alpine)", vars[0].Value)
+	require.NotZero(t, vars[0].VariablesReference)
+
+	require.Equal(t, "option::run (2 options)", vars[1].Value)
+	require.Equal(t, "fs build()", vars[2].Value)
+	require.Equal(t, "option::run cached() { dir; readonlyRootfs }", vars[3].Value)
+}
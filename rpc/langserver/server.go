@@ -2,6 +2,7 @@ package langserver
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -11,6 +12,8 @@ import (
 	"sync"
 	"time"
 
+	"github.com/alecthomas/participle/v2"
+	"github.com/alecthomas/participle/v2/lexer"
 	"github.com/creachadair/jrpc2"
 	"github.com/creachadair/jrpc2/channel"
 	"github.com/creachadair/jrpc2/handler"
@@ -18,6 +21,8 @@ import (
 	"github.com/openllb/hlb/builtin"
 	"github.com/openllb/hlb/checker"
 	"github.com/openllb/hlb/codegen"
+	"github.com/openllb/hlb/diagnostic"
+	"github.com/openllb/hlb/errdefs"
 	"github.com/openllb/hlb/linter"
 	"github.com/openllb/hlb/module"
 	"github.com/openllb/hlb/parser"
@@ -106,6 +111,7 @@ func (ls *LangServer) initializeHandler(ctx context.Context, params lsp.Initiali
 		Capabilities: lsp.ServerCapabilities{
 			DefinitionProvider: true,
 			HoverProvider:      true,
+			CompletionProvider: &lsp.CompletionOptions{},
 			TextDocumentSync: &lsp.TextDocumentSyncOptionsOrKind{
 				Options: &lsp.TextDocumentSyncOptions{
 					OpenClose: true,
@@ -155,6 +161,20 @@ func (ls *LangServer) textDocumentDidOpenHandler(ctx context.Context, params lsp
 	ls.tds[uri] = td
 	ls.tmu.Unlock()
 
+	ls.publish(ctx, td)
+	return nil
+}
+
+// publish notifies the client of the diagnostics of a text document, and its
+// semantic highlighting if the client is capable.
+func (ls *LangServer) publish(ctx context.Context, td TextDocument) {
+	go func() {
+		err := ls.publishDiagnostics(ctx, td)
+		if err != nil {
+			log.Printf("err: %s", err)
+		}
+	}()
+
 	if _, ok := ls.capset[SemanticHighlightingCapability]; ok {
 		go func() {
 			err := ls.publishSemanticHighlighting(ctx, td)
@@ -163,8 +183,14 @@ func (ls *LangServer) textDocumentDidOpenHandler(ctx context.Context, params lsp
 			}
 		}()
 	}
+}
 
-	return nil
+func (ls *LangServer) publishDiagnostics(ctx context.Context, td TextDocument) error {
+	log.Printf("publishing diagnostics")
+	return ls.server.Notify(ctx, "textDocument/publishDiagnostics", lsp.PublishDiagnosticsParams{
+		URI:         td.Identifier.URI,
+		Diagnostics: td.Diagnostics(),
+	})
 }
 
 func (ls *LangServer) publishSemanticHighlighting(ctx context.Context, td TextDocument) error {
@@ -222,6 +248,22 @@ func highlightModule(lines map[int]lsp.SemanticHighlightingTokens, mod *ast.Modu
 				highlightExpr(lines, id.Expr)
 			}
 		},
+		func(id *ast.IncludeDecl) {
+			if id.Include != nil {
+				highlightNode(lines, id.Include, Keyword)
+			}
+			if id.Path != nil {
+				if id.Path.Start != nil {
+					highlightNode(lines, id.Path.Start, String)
+				}
+				for _, f := range id.Path.Fragments {
+					highlightStringFragment(lines, f)
+				}
+				if id.Path.Terminate != nil {
+					highlightNode(lines, id.Path.Terminate, String)
+				}
+			}
+		},
 		func(ed *ast.ExportDecl) {
 			if ed.Export != nil {
 				highlightNode(lines, ed.Export, Keyword)
@@ -356,6 +398,10 @@ func highlightExpr(lines map[int]lsp.SemanticHighlightingTokens, expr *ast.Expr)
 				highlightHeredocFragment(lines, f)
 			}
 		}
+	case expr.ListLit != nil:
+		for _, elem := range expr.ListLit.Elements() {
+			highlightExpr(lines, elem)
+		}
 	case expr.CallExpr != nil:
 		call := expr.CallExpr
 		if call.Name != nil {
@@ -431,15 +477,7 @@ func (ls *LangServer) textDocumentDidChangeHandler(ctx context.Context, params l
 				Value:  strings.TrimPrefix(string(uri), "file://"),
 			}
 			td := NewTextDocument(ctx, uri, r, nil)
-			if _, ok := ls.capset[SemanticHighlightingCapability]; ok {
-				go func() {
-					err := ls.publishSemanticHighlighting(ctx, td)
-					if err != nil {
-						log.Printf("err: %s", err)
-					}
-				}()
-			}
-
+			ls.publish(ctx, td)
 			ls.tds[uri] = td
 		}
 		return nil
@@ -684,32 +722,12 @@ func (ls *LangServer) textDocumentHoverHandler(ctx context.Context, params lsp.T
 				return
 			}
 
-			paramsBlock := ""
-			if len(fun.Params) > 0 {
-				var params []string
-				for _, param := range fun.Params {
-					params = append(params, fmt.Sprintf("%s %s", param.Type, param.Name))
-				}
-
-				paramsBlock = fmt.Sprintf("(%s)", strings.Join(params, ", "))
-			}
-
-			effectsBlock := ""
-			if len(fun.Effects) > 0 {
-				var effects []string
-				for _, effect := range fun.Effects {
-					effects = append(effects, fmt.Sprintf("%s %s", effect.Type, effect.Name))
-				}
-
-				effectsBlock = fmt.Sprintf(" as (%s)", strings.Join(effects, ", "))
-			}
-
 			r := newRangeFromNode(ident)
 			h.Range = &r
 			h.Contents = []lsp.MarkedString{
 				{
 					Language: "hlb",
-					Value:    fmt.Sprintf("%s%s%s", ident, paramsBlock, effectsBlock),
+					Value:    signature(ident.Text, fun),
 				},
 			}
 		},
@@ -717,8 +735,93 @@ func (ls *LangServer) textDocumentHoverHandler(ctx context.Context, params lsp.T
 	return &h, nil
 }
 
+// signature formats the parameters and effects of a builtin like its
+// declaration.
+func signature(name string, fun builtin.FuncLookup) string {
+	paramsBlock := ""
+	if len(fun.Params) > 0 {
+		var params []string
+		for _, param := range fun.Params {
+			params = append(params, fmt.Sprintf("%s %s", param.Type, param.Name))
+		}
+
+		paramsBlock = fmt.Sprintf("(%s)", strings.Join(params, ", "))
+	}
+
+	effectsBlock := ""
+	if len(fun.Effects) > 0 {
+		var effects []string
+		for _, effect := range fun.Effects {
+			effects = append(effects, fmt.Sprintf("%s %s", effect.Type, effect.Name))
+		}
+
+		effectsBlock = fmt.Sprintf(" as (%s)", strings.Join(effects, ", "))
+	}
+
+	return fmt.Sprintf("%s%s%s", name, paramsBlock, effectsBlock)
+}
+
 func (ls *LangServer) textDocumentCompletionHandler(ctx context.Context, params lsp.CompletionParams) (*lsp.CompletionList, error) {
-	return nil, nil
+	ls.tmu.RLock()
+	uri := params.TextDocument.URI
+	td, ok := ls.tds[uri]
+	if !ok {
+		ls.tmu.RUnlock()
+		return nil, fmt.Errorf("unknown uri %q", uri)
+	}
+	ls.tmu.RUnlock()
+
+	pos := params.Position
+	log.Printf("text document completion [%d:%d] %q", pos.Line, pos.Character, uri)
+
+	// The innermost block around the position decides the kind of functions
+	// that can be called, so option blocks complete their options.
+	var block *ast.BlockStmt
+	ast.Match(td.Module,
+		ast.MatchOpts{
+			Filter: func(node ast.Node) bool {
+				return isPositionWithinNode(pos, node)
+			},
+		},
+		func(bs *ast.BlockStmt) {
+			block = bs
+		},
+	)
+
+	list := &lsp.CompletionList{Items: []lsp.CompletionItem{}}
+	if block == nil || block.Kind() == ast.None {
+		return list, nil
+	}
+	kind := block.Kind()
+
+	for name, fun := range builtin.Lookup.ByKind[kind].Func {
+		list.Items = append(list.Items, lsp.CompletionItem{
+			Label:  name,
+			Kind:   lsp.CIKKeyword,
+			Detail: signature(name, fun),
+		})
+	}
+
+	var objects map[string]*ast.Object
+	if td.Module.Scope != nil {
+		objects = td.Module.Scope.Objects
+	}
+	for name, obj := range objects {
+		fd, ok := obj.Node.(*ast.FuncDecl)
+		if !ok || fd.Kind() != kind {
+			continue
+		}
+		list.Items = append(list.Items, lsp.CompletionItem{
+			Label:  name,
+			Kind:   lsp.CIKFunction,
+			Detail: fd.Sig.String(),
+		})
+	}
+
+	sort.Slice(list.Items, func(i, j int) bool {
+		return list.Items[i].Label < list.Items[j].Label
+	})
+	return list, nil
 }
 
 func isPositionWithinNode(pos lsp.Position, node ast.Node) bool {
@@ -734,15 +837,22 @@ func newLocationFromNode(uri lsp.DocumentURI, node ast.Node) *lsp.Location {
 
 func newRangeFromNode(node ast.Node) lsp.Range {
 	return lsp.Range{
-		Start: lsp.Position{Line: node.Position().Line - 1, Character: node.Position().Column - 1},
-		End:   lsp.Position{Line: node.End().Line - 1, Character: node.End().Column - 1},
+		Start: newPosition(node.Position()),
+		End:   newPosition(node.End()),
 	}
 }
 
+func newPosition(pos lexer.Position) lsp.Position {
+	return lsp.Position{Line: pos.Line - 1, Character: pos.Column - 1}
+}
+
 type TextDocument struct {
 	Identifier lsp.VersionedTextDocumentIdentifier
 	Module     *ast.Module
 	Err        error
+
+	// Lint is the error of the lint warnings and fixes of the module.
+	Lint error
 }
 
 func NewTextDocument(ctx context.Context, uri lsp.DocumentURI, r io.Reader, dir ast.Directory) TextDocument {
@@ -754,22 +864,34 @@ func NewTextDocument(ctx context.Context, uri lsp.DocumentURI, r io.Reader, dir
 		},
 	}
 
-	td.Module, td.Err = parser.Parse(ctx, r)
+	td.Module, td.Err = parser.ParsePartial(ctx, r)
 	if td.Err != nil {
 		log.Printf("failed to parse hlb: %s", td.Err)
+
+		// Build scopes for the declarations that did parse so that features
+		// like go to definition keep working on the rest of the file.
+		_ = checker.SemanticPass(td.Module)
 		return td
 	}
 	if dir != nil {
 		td.Module.Directory = dir
 	}
 
+	td.Err = parser.ResolveIncludes(ctx, td.Module)
+	if td.Err != nil {
+		log.Printf("failed to resolve includes: %s", td.Err)
+		return td
+	}
+
 	td.Err = checker.SemanticPass(td.Module)
 	if td.Err != nil {
 		log.Printf("failed to semantic pass hlb: %s", td.Err)
 		return td
 	}
 
-	_ = linter.Lint(ctx, td.Module)
+	// Functions without parameters may be run as targets, so only the unused
+	// functions that never can are reported while editing.
+	td.Lint = linter.Lint(ctx, td.Module, linter.WithUnusedNonTargets())
 
 	td.Err = checker.Check(td.Module)
 	if td.Err != nil {
@@ -777,3 +899,50 @@ func NewTextDocument(ctx context.Context, uri lsp.DocumentURI, r io.Reader, dir
 	}
 	return td
 }
+
+// Diagnostics returns the errors and lint warnings of the text document that
+// are located in it.
+func (td TextDocument) Diagnostics() []lsp.Diagnostic {
+	filename := strings.TrimPrefix(string(td.Identifier.URI), "file://")
+
+	diags := []lsp.Diagnostic{}
+	for _, err := range []error{td.Err, td.Lint} {
+		if err == nil {
+			continue
+		}
+
+		spans := diagnostic.Spans(err)
+		if len(spans) == 0 {
+			// Syntax errors are only positioned by the parser.
+			var perr participle.Error
+			if errors.As(err, &perr) && perr.Position().Filename == filename {
+				start := newPosition(perr.Position())
+				diags = append(diags, lsp.Diagnostic{
+					Range:    lsp.Range{Start: start, End: start},
+					Severity: lsp.Error,
+					Source:   "hlb",
+					Message:  perr.Message(),
+				})
+			}
+			continue
+		}
+
+		for _, span := range spans {
+			if span.Pos.Filename != filename {
+				continue
+			}
+
+			severity := lsp.Error
+			if errdefs.IsWarning(span) {
+				severity = lsp.Warning
+			}
+			diags = append(diags, lsp.Diagnostic{
+				Range:    lsp.Range{Start: newPosition(span.Pos), End: newPosition(span.End)},
+				Severity: severity,
+				Source:   "hlb",
+				Message:  span.Err.Error(),
+			})
+		}
+	}
+	return diags
+}
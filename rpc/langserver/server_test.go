@@ -0,0 +1,226 @@
+package langserver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/creachadair/jrpc2"
+	"github.com/creachadair/jrpc2/channel"
+	"github.com/lithammer/dedent"
+	"github.com/openllb/hlb"
+	lsp "github.com/sourcegraph/go-lsp"
+	"github.com/stretchr/testify/require"
+)
+
+const testURI = lsp.DocumentURI("file:///test.hlb")
+
+// newTestClient starts a language server and returns a client connected to
+// it, and the diagnostics it publishes.
+func newTestClient(t *testing.T) (*jrpc2.Client, <-chan lsp.PublishDiagnosticsParams) {
+	ctx := hlb.WithDefaultContext(context.Background(), nil)
+	ls, err := NewServer(ctx, nil)
+	require.NoError(t, err)
+
+	diags := make(chan lsp.PublishDiagnosticsParams, 1)
+	cch, sch := channel.Direct()
+	ls.server.Start(sch)
+	cli := jrpc2.NewClient(cch, &jrpc2.ClientOptions{
+		OnNotify: func(req *jrpc2.Request) {
+			if req.Method() != "textDocument/publishDiagnostics" {
+				return
+			}
+			var params lsp.PublishDiagnosticsParams
+			err := req.UnmarshalParams(&params)
+			if err == nil {
+				diags <- params
+			}
+		},
+	})
+	t.Cleanup(func() {
+		cli.Close()
+		ls.server.Stop()
+	})
+
+	_, err = cli.Call(ctx, "initialize", lsp.InitializeParams{})
+	require.NoError(t, err)
+	return cli, diags
+}
+
+// open opens a text document and waits for its diagnostics.
+func open(t *testing.T, cli *jrpc2.Client, diags <-chan lsp.PublishDiagnosticsParams, text string) []lsp.Diagnostic {
+	err := cli.Notify(context.Background(), "textDocument/didOpen", lsp.DidOpenTextDocumentParams{
+		TextDocument: lsp.TextDocumentItem{
+			URI:  testURI,
+			Text: dedent.Dedent(text),
+		},
+	})
+	require.NoError(t, err)
+
+	params := <-diags
+	require.Equal(t, testURI, params.URI)
+	return params.Diagnostics
+}
+
+func TestDiagnostics(t *testing.T) {
+	t.Parallel()
+
+	cli, diags := newTestClient(t)
+	actual := open(t, cli, diags, `
+	fs default(string tag) {
+		imag "alpine"
+	}
+	`)
+	require.Equal(t, []lsp.Diagnostic{{
+		Range: lsp.Range{
+			Start: lsp.Position{Line: 2, Character: 1},
+			End:   lsp.Position{Line: 2, Character: 5},
+		},
+		Severity: lsp.Error,
+		Source:   "hlb",
+		Message:  "`imag` is undefined or not in scope",
+	}, {
+		Range: lsp.Range{
+			Start: lsp.Position{Line: 1, Character: 18},
+			End:   lsp.Position{Line: 1, Character: 21},
+		},
+		Severity: lsp.Warning,
+		Source:   "hlb",
+		Message:  "parameter `tag` is unused",
+	}}, actual)
+
+	// Fixing the errors clears the diagnostics.
+	err := cli.Notify(context.Background(), "textDocument/didChange", lsp.DidChangeTextDocumentParams{
+		TextDocument: lsp.VersionedTextDocumentIdentifier{
+			TextDocumentIdentifier: lsp.TextDocumentIdentifier{URI: testURI},
+		},
+		ContentChanges: []lsp.TextDocumentContentChangeEvent{{
+			Text: "fs default() {\n\timage \"alpine\"\n}\n",
+		}},
+	})
+	require.NoError(t, err)
+	params := <-diags
+	require.Empty(t, params.Diagnostics)
+}
+
+func TestDiagnosticsUnusedFuncs(t *testing.T) {
+	t.Parallel()
+
+	// Functions without parameters may be run as targets, so only unused
+	// options are reported.
+	cli, diags := newTestClient(t)
+	actual := open(t, cli, diags, `
+	fs default() {
+		image "alpine"
+	}
+
+	fs build() {
+		scratch
+	}
+
+	option::image pinned() {
+		resolve
+	}
+	`)
+	require.Equal(t, []lsp.Diagnostic{{
+		Range: lsp.Range{
+			Start: lsp.Position{Line: 9, Character: 14},
+			End:   lsp.Position{Line: 9, Character: 20},
+		},
+		Severity: lsp.Warning,
+		Source:   "hlb",
+		Message:  "function `pinned` is unused",
+	}}, actual)
+}
+
+func TestCompletion(t *testing.T) {
+	t.Parallel()
+
+	cli, diags := newTestClient(t)
+	open(t, cli, diags, `
+	fs default() {
+		image "alpine" with option {
+			resolve
+		}
+		build
+	}
+
+	fs build() {
+		scratch
+	}
+	`)
+
+	for _, tc := range []struct {
+		name     string
+		pos      lsp.Position
+		contains []lsp.CompletionItem
+		excludes []string
+	}{{
+		"filesystem block",
+		lsp.Position{Line: 5, Character: 1},
+		[]lsp.CompletionItem{
+			{Label: "image", Kind: lsp.CIKKeyword, Detail: "image(string ref)"},
+			{Label: "build", Kind: lsp.CIKFunction, Detail: "fs build()"},
+		},
+		[]string{"resolve"},
+	}, {
+		"option block",
+		lsp.Position{Line: 3, Character: 2},
+		[]lsp.CompletionItem{
+			{Label: "resolve", Kind: lsp.CIKKeyword, Detail: "resolve"},
+		},
+		[]string{"image", "build"},
+	}, {
+		"outside blocks",
+		lsp.Position{Line: 0, Character: 0},
+		nil,
+		[]string{"image", "resolve"},
+	}} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			rsp, err := cli.Call(context.Background(), "textDocument/completion", lsp.CompletionParams{
+				TextDocumentPositionParams: lsp.TextDocumentPositionParams{
+					TextDocument: lsp.TextDocumentIdentifier{URI: testURI},
+					Position:     tc.pos,
+				},
+			})
+			require.NoError(t, err)
+
+			var list lsp.CompletionList
+			err = rsp.UnmarshalResult(&list)
+			require.NoError(t, err)
+
+			labels := make(map[string]lsp.CompletionItem)
+			for _, item := range list.Items {
+				labels[item.Label] = item
+			}
+			for _, item := range tc.contains {
+				require.Equal(t, item, labels[item.Label])
+			}
+			for _, label := range tc.excludes {
+				require.NotContains(t, labels, label)
+			}
+		})
+	}
+}
+
+func TestHover(t *testing.T) {
+	t.Parallel()
+
+	cli, diags := newTestClient(t)
+	open(t, cli, diags, `
+	fs default() {
+		image "alpine"
+	}
+	`)
+
+	rsp, err := cli.Call(context.Background(), "textDocument/hover", lsp.TextDocumentPositionParams{
+		TextDocument: lsp.TextDocumentIdentifier{URI: testURI},
+		Position:     lsp.Position{Line: 2, Character: 2},
+	})
+	require.NoError(t, err)
+
+	var hover lsp.Hover
+	err = rsp.UnmarshalResult(&hover)
+	require.NoError(t, err)
+	require.Equal(t, []lsp.MarkedString{{Language: "hlb", Value: "image(string ref)"}}, hover.Contents)
+}
@@ -0,0 +1,189 @@
+package solver
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/docker/buildx/util/progress"
+	"github.com/moby/buildkit/client"
+	"github.com/moby/buildkit/client/llb"
+	digest "github.com/opencontainers/go-digest"
+)
+
+// CacheStatus is whether a vertex was loaded from the cache or computed.
+type CacheStatus string
+
+const (
+	CacheStatusCached   CacheStatus = "cached"
+	CacheStatusComputed CacheStatus = "computed"
+)
+
+// SourceLocation is a position in a source file that produced an op.
+type SourceLocation struct {
+	Filename string
+	Line     int
+	Column   int
+}
+
+func (l SourceLocation) String() string {
+	return fmt.Sprintf("%s:%d:%d", l.Filename, l.Line, l.Column)
+}
+
+// CacheEntry is the cache status of a completed vertex and the source
+// location of the op that produced it.
+type CacheEntry struct {
+	Location SourceLocation
+	Digest   digest.Digest
+	Name     string
+	Status   CacheStatus
+}
+
+// CacheSummary correlates the cache status of vertices in the progress stream
+// with the source maps of the definitions that were solved, tying BuildKit
+// cache results back to source locations.
+type CacheSummary struct {
+	mu        sync.Mutex
+	locations map[digest.Digest]SourceLocation
+	statuses  map[digest.Digest]*client.Vertex
+}
+
+func NewCacheSummary() *CacheSummary {
+	return &CacheSummary{
+		locations: make(map[digest.Digest]SourceLocation),
+		statuses:  make(map[digest.Digest]*client.Vertex),
+	}
+}
+
+// AddDefinition records the source location of each op in the definition.
+// Ops with multiple locations are attributed to the first, which is the call
+// that produced the op rather than the calls leading up to it.
+func (cs *CacheSummary) AddDefinition(def *llb.Definition) {
+	if def == nil || def.Source == nil {
+		return
+	}
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	for dgst, locs := range def.Source.Locations {
+		if _, ok := cs.locations[digest.Digest(dgst)]; ok {
+			continue
+		}
+		for _, loc := range locs.Locations {
+			if int(loc.SourceIndex) >= len(def.Source.Infos) || len(loc.Ranges) == 0 {
+				continue
+			}
+			cs.locations[digest.Digest(dgst)] = SourceLocation{
+				Filename: def.Source.Infos[loc.SourceIndex].Filename,
+				Line:     int(loc.Ranges[0].Start.Line),
+				Column:   int(loc.Ranges[0].Start.Character),
+			}
+			break
+		}
+	}
+}
+
+// Write records the cache status of the vertices in the solve status.
+func (cs *CacheSummary) Write(s *client.SolveStatus) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	for _, v := range s.Vertexes {
+		vtx := *v
+		cs.statuses[v.Digest] = &vtx
+	}
+}
+
+// Entries returns the completed vertices that have a source location, sorted
+// by location. Vertices that failed are omitted.
+func (cs *CacheSummary) Entries() []CacheEntry {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	var entries []CacheEntry
+	for dgst, vtx := range cs.statuses {
+		loc, ok := cs.locations[dgst]
+		if !ok || vtx.Completed == nil || vtx.Error != "" {
+			continue
+		}
+		status := CacheStatusComputed
+		if vtx.Cached {
+			status = CacheStatusCached
+		}
+		entries = append(entries, CacheEntry{
+			Location: loc,
+			Digest:   dgst,
+			Name:     vtx.Name,
+			Status:   status,
+		})
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		switch {
+		case a.Location.Filename != b.Location.Filename:
+			return a.Location.Filename < b.Location.Filename
+		case a.Location.Line != b.Location.Line:
+			return a.Location.Line < b.Location.Line
+		case a.Location.Column != b.Location.Column:
+			return a.Location.Column < b.Location.Column
+		}
+		return a.Name < b.Name
+	})
+	return entries
+}
+
+// Print writes the entries grouped by source location.
+func (cs *CacheSummary) Print(w io.Writer) error {
+	var last *SourceLocation
+	for _, entry := range cs.Entries() {
+		entry := entry
+		if last == nil || *last != entry.Location {
+			_, err := fmt.Fprintf(w, "%s\n", entry.Location)
+			if err != nil {
+				return err
+			}
+			last = &entry.Location
+		}
+		_, err := fmt.Fprintf(w, "  %-8s %s\n", entry.Status, entry.Name)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cacheSummaryWriter records solve statuses in a cache summary before passing
+// them to the underlying progress writer, if any.
+type cacheSummaryWriter struct {
+	pw progress.Writer
+	cs *CacheSummary
+}
+
+var _ progress.Writer = (*cacheSummaryWriter)(nil)
+
+func (w *cacheSummaryWriter) Write(s *client.SolveStatus) {
+	w.cs.Write(s)
+	if w.pw != nil {
+		w.pw.Write(s)
+	}
+}
+
+func (w *cacheSummaryWriter) WriteBuildRef(target string, ref string) {
+	if w.pw != nil {
+		w.pw.WriteBuildRef(target, ref)
+	}
+}
+
+func (w *cacheSummaryWriter) ValidateLogSource(dgst digest.Digest, v interface{}) bool {
+	if w.pw == nil {
+		return true
+	}
+	return w.pw.ValidateLogSource(dgst, v)
+}
+
+func (w *cacheSummaryWriter) ClearLogSource(v interface{}) {
+	if w.pw != nil {
+		w.pw.ClearLogSource(v)
+	}
+}
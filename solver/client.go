@@ -8,8 +8,7 @@ import (
 )
 
 // BuildkitClient returns a basic buildkit client.
-func BuildkitClient(ctx context.Context, addr string) (*client.Client, error) {
-	opts := []client.ClientOpt{}
+func BuildkitClient(ctx context.Context, addr string, opts ...client.ClientOpt) (*client.Client, error) {
 	cln, err := client.New(ctx, addr, opts...)
 	if err != nil {
 		return cln, err
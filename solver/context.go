@@ -16,3 +16,16 @@ func ConcurrencyLimiter(ctx context.Context) *semaphore.Weighted {
 	limiter, _ := ctx.Value(concurrencyLimiterKey{}).(*semaphore.Weighted)
 	return limiter
 }
+
+type cacheSummaryKey struct{}
+
+// WithCacheSummary records the cache status of every solve made with the
+// context in the given summary.
+func WithCacheSummary(ctx context.Context, cs *CacheSummary) context.Context {
+	return context.WithValue(ctx, cacheSummaryKey{}, cs)
+}
+
+func GetCacheSummary(ctx context.Context) *CacheSummary {
+	cs, _ := ctx.Value(cacheSummaryKey{}).(*CacheSummary)
+	return cs
+}
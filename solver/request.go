@@ -3,9 +3,12 @@ package solver
 import (
 	"context"
 
+	"github.com/containerd/containerd/platforms"
+
 	"github.com/docker/buildx/util/progress"
 	"github.com/moby/buildkit/client"
 	"github.com/moby/buildkit/client/llb"
+	specs "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/openllb/hlb/pkg/llbutil"
 	"github.com/xlab/treeprint"
 	"golang.org/x/sync/errgroup"
@@ -82,6 +85,63 @@ func (r *singleRequest) Tree(tree treeprint.Tree) error {
 	return TreeFromDef(tree, r.params.Def, r.params.SolveOpts)
 }
 
+type multiPlatformRequest struct {
+	platforms []specs.Platform
+	params    []*Params
+}
+
+// MultiPlatform returns a solve request that solves the params of each
+// platform in a single build, so that an image pushed by their solve options
+// is a multi-platform image index instead of one image per platform.
+func MultiPlatform(platforms []specs.Platform, params []*Params) Request {
+	return &multiPlatformRequest{platforms: platforms, params: params}
+}
+
+func (r *multiPlatformRequest) Solve(ctx context.Context, cln *client.Client, mw *MultiWriter, opts ...SolveOption) error {
+	var pw progress.Writer
+	if mw != nil {
+		pw = mw.WithPrefix("", false)
+	}
+
+	var (
+		solveOpts   []SolveOption
+		sessionOpts []llbutil.SessionOption
+	)
+	for _, params := range r.params {
+		solveOpts = append(solveOpts, params.SolveOpts...)
+		sessionOpts = append(sessionOpts, params.SessionOpts...)
+	}
+
+	s, err := llbutil.NewSession(ctx, sessionOpts...)
+	if err != nil {
+		return err
+	}
+
+	g, ctx := errgroup.WithContext(ctx)
+
+	g.Go(func() error {
+		return s.Run(ctx, cln.Dialer())
+	})
+
+	g.Go(func() error {
+		defer s.Close()
+		return SolvePlatforms(ctx, cln, s, pw, r.platforms, r.params, append(solveOpts, opts...)...)
+	})
+
+	return g.Wait()
+}
+
+func (r *multiPlatformRequest) Tree(tree treeprint.Tree) error {
+	branch := tree.AddBranch("multi-platform")
+	for i, params := range r.params {
+		err := TreeFromDef(branch.AddBranch(platforms.Format(r.platforms[i])), params.Def, params.SolveOpts)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 type parallelRequest struct {
 	reqs []Request
 }
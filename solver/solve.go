@@ -3,7 +3,11 @@ package solver
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
 
+	"github.com/containerd/containerd/platforms"
 	"github.com/docker/buildx/util/progress"
 	"github.com/docker/distribution/reference"
 	"github.com/moby/buildkit/client"
@@ -12,6 +16,7 @@ import (
 	gateway "github.com/moby/buildkit/frontend/gateway/client"
 	"github.com/moby/buildkit/session"
 	"github.com/moby/buildkit/util/entitlements"
+	dockerspec "github.com/moby/docker-image-spec/specs-go/v1"
 	specs "github.com/opencontainers/image-spec/specs-go/v1"
 	"golang.org/x/sync/errgroup"
 )
@@ -25,6 +30,7 @@ type SolveInfo struct {
 	OutputMoby             bool
 	OutputDockerRef        string
 	OutputPushImage        string
+	OutputPushInsecure     bool
 	OutputLocal            string
 	OutputLocalTarball     bool
 	OutputLocalOCITarball  bool
@@ -34,18 +40,26 @@ type SolveInfo struct {
 	ImageSpec              *ImageSpec
 	ErrorHandler           ErrorHandler
 	Entitlements           []entitlements.Entitlement
+	CacheImports           []client.CacheOptionsEntry
+	CacheExports           []client.CacheOptionsEntry
+	Timeout                time.Duration
 }
 
 // ImageSpec is HLB's wrapper for the OCI specs image, allowing for backward
-// compatible features with Docker.
+// compatible features with Docker. Its config is extended with Docker's fields,
+// such as the healthcheck.
 type ImageSpec struct {
-	specs.Image
+	dockerspec.DockerOCIImage
 
 	ContainerConfig ContainerConfig `json:"container_config,omitempty"`
 
 	// Canonical is the fully qualified reference of the image with name and
 	// digest.
 	Canonical reference.Canonical `json:"-"`
+
+	// Annotations are OCI annotations added to the image manifest when it is
+	// exported. Unlike labels, they are not part of the image config.
+	Annotations map[string]string `json:"-"`
 }
 
 // ContainerConfig is the schema1-compatible configuration of the container
@@ -85,6 +99,15 @@ func WithPushImage(ref string) SolveOption {
 	}
 }
 
+// WithInsecurePush allows pushing the image to a registry over HTTP or with
+// an unverified certificate.
+func WithInsecurePush() SolveOption {
+	return func(info *SolveInfo) error {
+		info.OutputPushInsecure = true
+		return nil
+	}
+}
+
 func WithDownload(dest string) SolveOption {
 	return func(info *SolveInfo) error {
 		info.OutputLocal = dest
@@ -127,6 +150,67 @@ func WithEntitlement(e entitlements.Entitlement) SolveOption {
 	}
 }
 
+// WithCacheImport imports build cache from a cache backend, such as an image
+// previously exported with WithCacheExport.
+func WithCacheImport(entry client.CacheOptionsEntry) SolveOption {
+	return func(info *SolveInfo) error {
+		info.CacheImports = append(info.CacheImports, entry)
+		return nil
+	}
+}
+
+// WithCacheExport exports the build cache of the solve to a cache backend.
+func WithCacheExport(entry client.CacheOptionsEntry) SolveOption {
+	return func(info *SolveInfo) error {
+		info.CacheExports = append(info.CacheExports, entry)
+		return nil
+	}
+}
+
+// WithTimeout cancels the solve if it doesn't finish within the timeout. When
+// given more than once, the shortest timeout applies.
+func WithTimeout(timeout time.Duration) SolveOption {
+	return func(info *SolveInfo) error {
+		if info.Timeout == 0 || timeout < info.Timeout {
+			info.Timeout = timeout
+		}
+		return nil
+	}
+}
+
+// ErrTimeout is returned when a solve is cancelled because it exceeded the
+// timeout set by WithTimeout.
+type ErrTimeout struct {
+	Timeout time.Duration
+	Err     error
+}
+
+func (e *ErrTimeout) Unwrap() error {
+	return e.Err
+}
+
+func (e *ErrTimeout) Error() string {
+	return fmt.Sprintf("solve exceeded timeout of %s", e.Timeout)
+}
+
+// withTimeout calls fn with a context that is cancelled after the timeout, and
+// returns an ErrTimeout if fn failed because of it. A timeout of zero calls fn
+// with ctx as is.
+func withTimeout(ctx context.Context, timeout time.Duration, fn func(context.Context) error) error {
+	if timeout == 0 {
+		return fn(ctx)
+	}
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	err := fn(timeoutCtx)
+	if err != nil && ctx.Err() == nil && errors.Is(timeoutCtx.Err(), context.DeadlineExceeded) {
+		return &ErrTimeout{Timeout: timeout, Err: err}
+	}
+	return err
+}
+
 func WithEvaluate(info *SolveInfo) error {
 	info.Evaluate = true
 	return nil
@@ -158,6 +242,10 @@ func Solve(ctx context.Context, c *client.Client, s *session.Session, pw progres
 		}
 	}
 
+	if cs := GetCacheSummary(ctx); cs != nil {
+		cs.AddDefinition(def)
+	}
+
 	var errHandlerErr error
 	err := Build(ctx, c, s, pw, func(ctx context.Context, c gateway.Client) (*gateway.Result, error) {
 		res, err := c.Solve(ctx, gateway.SolveRequest{
@@ -183,7 +271,8 @@ func Solve(ctx context.Context, c *client.Client, s *session.Session, pw progres
 		return res, nil
 	}, opts...)
 
-	if errHandlerErr != nil {
+	var timeoutErr *ErrTimeout
+	if errHandlerErr != nil && !errors.As(err, &timeoutErr) {
 		// `ErrorHandler` is invoked in a separate goroutine from the main `Solve` buildkit request.
 		// Prefer `errHandlerErr` here to preserve the sentinel error. Otherwise such context is lost
 		// in the gRPC call in the main `Solve` request.
@@ -192,6 +281,95 @@ func Solve(ctx context.Context, c *client.Client, s *session.Session, pw progres
 	return err
 }
 
+// SolvePlatforms solves the definition of each platform in a single build, so
+// that they are exported together as a multi-platform image. The image config
+// of each platform is the image spec set by its own solve options, while opts
+// configure the export.
+func SolvePlatforms(ctx context.Context, c *client.Client, s *session.Session, pw progress.Writer, plats []specs.Platform, params []*Params, opts ...SolveOption) error {
+	info := &SolveInfo{}
+	for _, opt := range opts {
+		err := opt(info)
+		if err != nil {
+			return err
+		}
+	}
+
+	specsByID := make(map[string]*ImageSpec)
+	for i, p := range plats {
+		platformInfo := &SolveInfo{}
+		for _, opt := range params[i].SolveOpts {
+			err := opt(platformInfo)
+			if err != nil {
+				return err
+			}
+		}
+		specsByID[platforms.Format(p)] = platformInfo.ImageSpec
+
+		if cs := GetCacheSummary(ctx); cs != nil {
+			cs.AddDefinition(params[i].Def)
+		}
+	}
+
+	var errHandlerErr error
+	err := Build(ctx, c, s, pw, func(ctx context.Context, c gateway.Client) (*gateway.Result, error) {
+		results := make([]*gateway.Result, len(plats))
+		g, ctx := errgroup.WithContext(ctx)
+		for i := range plats {
+			i := i
+			g.Go(func() error {
+				var err error
+				results[i], err = c.Solve(ctx, gateway.SolveRequest{
+					Definition: params[i].Def.ToPB(),
+					Evaluate:   info.Evaluate,
+				})
+				return err
+			})
+		}
+		err := g.Wait()
+		if err != nil {
+			if info.ErrorHandler != nil {
+				errHandlerErr = info.ErrorHandler(ctx, c, err)
+				return nil, errHandlerErr
+			}
+			return nil, err
+		}
+
+		res := gateway.NewResult()
+		expPlatforms := exptypes.Platforms{}
+		for i, p := range plats {
+			ref, err := results[i].SingleRef()
+			if err != nil {
+				return nil, err
+			}
+
+			id := platforms.Format(p)
+			res.AddRef(id, ref)
+			expPlatforms.Platforms = append(expPlatforms.Platforms, exptypes.Platform{ID: id, Platform: p})
+
+			if spec := specsByID[id]; spec != nil {
+				config, err := json.Marshal(spec)
+				if err != nil {
+					return nil, err
+				}
+				res.AddMeta(fmt.Sprintf("%s/%s", exptypes.ExporterImageConfigKey, id), config)
+			}
+		}
+
+		dt, err := json.Marshal(expPlatforms)
+		if err != nil {
+			return nil, err
+		}
+		res.AddMeta(exptypes.ExporterPlatformsKey, dt)
+		return res, nil
+	}, opts...)
+
+	var timeoutErr *ErrTimeout
+	if errHandlerErr != nil && !errors.As(err, &timeoutErr) {
+		return errHandlerErr
+	}
+	return err
+}
+
 func Build(ctx context.Context, c *client.Client, s *session.Session, pw progress.Writer, f gateway.BuildFunc, opts ...SolveOption) error {
 	info := &SolveInfo{}
 	for _, opt := range opts {
@@ -201,12 +379,74 @@ func Build(ctx context.Context, c *client.Client, s *session.Session, pw progres
 		}
 	}
 
-	solveOpt := client.SolveOpt{
+	solveOpt := newSolveOpt(s, info)
+
+	limiter := ConcurrencyLimiter(ctx)
+	if limiter != nil {
+		if err := limiter.Acquire(ctx, 1); err != nil {
+			return err
+		}
+	}
+
+	var (
+		statusCh     chan *client.SolveStatus
+		progressDone chan struct{}
+		resp         *client.SolveResponse
+	)
+	if cs := GetCacheSummary(ctx); cs != nil {
+		pw = &cacheSummaryWriter{pw: pw, cs: cs}
+	}
+	if pw != nil {
+		pw = progress.ResetTime(pw)
+		statusCh, progressDone = progress.NewChannel(pw)
+		defer func() {
+			<-progressDone
+		}()
+	}
+
+	if err := func() error {
+		if limiter != nil {
+			defer limiter.Release(1)
+		}
+		// The timeout starts after acquiring the limiter, so time spent waiting
+		// for other solves doesn't count towards it.
+		return withTimeout(ctx, info.Timeout, func(ctx context.Context) error {
+			var err error
+			resp, err = c.Build(ctx, solveOpt, "", f, statusCh)
+			return err
+		})
+	}(); err != nil {
+		return err
+	}
+
+	g, ctx := errgroup.WithContext(ctx)
+
+	for _, fn := range info.Callbacks {
+		fn := fn
+		g.Go(func() error {
+			return fn(ctx, resp)
+		})
+	}
+
+	return g.Wait()
+}
+
+// newSolveOpt returns the options BuildKit builds with for the solve options,
+// sharing the session s if there is one.
+func newSolveOpt(s *session.Session, info *SolveInfo) client.SolveOpt {
+	return client.SolveOpt{
 		SharedSession:         s,
 		SessionPreInitialized: s != nil,
 		AllowedEntitlements:   info.Entitlements,
+		Exports:               info.ExportEntries(),
+		CacheImports:          info.CacheImports,
+		CacheExports:          info.CacheExports,
 	}
+}
 
+// ExportEntries returns the BuildKit exporters requested by the solve options.
+func (info *SolveInfo) ExportEntries() []client.ExportEntry {
+	var exports []client.ExportEntry
 	if info.OutputDockerRef != "" {
 		entry := client.ExportEntry{
 			Type: client.ExporterDocker,
@@ -216,8 +456,10 @@ func Build(ctx context.Context, c *client.Client, s *session.Session, pw progres
 		}
 		if info.OutputMoby {
 			entry.Type = "moby"
+		} else {
+			addAnnotations(entry.Attrs, info.ImageSpec)
 		}
-		solveOpt.Exports = append(solveOpt.Exports, entry)
+		exports = append(exports, entry)
 	}
 
 	if info.OutputPushImage != "" {
@@ -230,6 +472,8 @@ func Build(ctx context.Context, c *client.Client, s *session.Session, pw progres
 		}
 		if info.OutputMoby {
 			entry.Type = "moby"
+		} else {
+			addAnnotations(entry.Attrs, info.ImageSpec)
 		}
 		if info.OutputStargz {
 			entry.Attrs["compression"] = "estargz"
@@ -238,67 +482,44 @@ func Build(ctx context.Context, c *client.Client, s *session.Session, pw progres
 		if info.OutputForceCompression {
 			entry.Attrs["force-compression"] = "true"
 		}
-		solveOpt.Exports = append(solveOpt.Exports, entry)
+		if info.OutputPushInsecure {
+			entry.Attrs["registry.insecure"] = "true"
+		}
+		exports = append(exports, entry)
 	}
 
 	if info.OutputLocal != "" {
-		solveOpt.Exports = append(solveOpt.Exports, client.ExportEntry{
+		exports = append(exports, client.ExportEntry{
 			Type:      client.ExporterLocal,
 			OutputDir: info.OutputLocal,
 		})
 	}
 
 	if info.OutputLocalTarball {
-		solveOpt.Exports = append(solveOpt.Exports, client.ExportEntry{
+		exports = append(exports, client.ExportEntry{
 			Type: client.ExporterTar,
 		})
 	}
 
 	if info.OutputLocalOCITarball {
-		solveOpt.Exports = append(solveOpt.Exports, client.ExportEntry{
-			Type: client.ExporterOCI,
-		})
-	}
-
-	limiter := ConcurrencyLimiter(ctx)
-	if limiter != nil {
-		if err := limiter.Acquire(ctx, 1); err != nil {
-			return err
+		entry := client.ExportEntry{
+			Type:  client.ExporterOCI,
+			Attrs: map[string]string{},
 		}
+		addAnnotations(entry.Attrs, info.ImageSpec)
+		exports = append(exports, entry)
 	}
 
-	var (
-		statusCh     chan *client.SolveStatus
-		progressDone chan struct{}
-		resp         *client.SolveResponse
-	)
-	if pw != nil {
-		pw = progress.ResetTime(pw)
-		statusCh, progressDone = progress.NewChannel(pw)
-		defer func() {
-			<-progressDone
-		}()
-	}
+	return exports
+}
 
-	if err := func() error {
-		if limiter != nil {
-			defer limiter.Release(1)
-		}
-		var err error
-		resp, err = c.Build(ctx, solveOpt, "", f, statusCh)
-		return err
-	}(); err != nil {
-		return err
+// addAnnotations adds the image's OCI annotations to the exporter attributes,
+// which BuildKit applies to the exported image manifest.
+func addAnnotations(attrs map[string]string, spec *ImageSpec) {
+	if spec == nil {
+		return
 	}
-
-	g, ctx := errgroup.WithContext(ctx)
-
-	for _, fn := range info.Callbacks {
-		fn := fn
-		g.Go(func() error {
-			return fn(ctx, resp)
-		})
+	for key, value := range spec.Annotations {
+		attrs[fmt.Sprintf("annotation.%s", key)] = value
 	}
-
-	return g.Wait()
 }
@@ -0,0 +1,162 @@
+package solver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/moby/buildkit/client"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportEntriesAnnotations(t *testing.T) {
+	t.Parallel()
+
+	spec := &ImageSpec{
+		Annotations: map[string]string{
+			"org.opencontainers.image.source": "https://github.com/openllb/hlb",
+		},
+	}
+	spec.Config.Labels = map[string]string{"maintainer": "hlb"}
+
+	info := &SolveInfo{}
+	for _, opt := range []SolveOption{
+		WithImageSpec(spec),
+		WithPushImage("docker.io/openllb/hlb"),
+		WithDownloadOCITarball(),
+	} {
+		require.NoError(t, opt(info))
+	}
+
+	exports := info.ExportEntries()
+	require.Len(t, exports, 2)
+	require.Equal(t, client.ExporterImage, exports[0].Type)
+	require.Equal(t, map[string]string{
+		"name": "docker.io/openllb/hlb",
+		"push": "true",
+		"annotation.org.opencontainers.image.source": "https://github.com/openllb/hlb",
+	}, exports[0].Attrs)
+	require.Equal(t, client.ExporterOCI, exports[1].Type)
+	require.Equal(t, map[string]string{
+		"annotation.org.opencontainers.image.source": "https://github.com/openllb/hlb",
+	}, exports[1].Attrs)
+
+	// Annotations must not leak into the image config, and labels remain there.
+	dt, err := json.Marshal(spec)
+	require.NoError(t, err)
+
+	var config map[string]interface{}
+	require.NoError(t, json.Unmarshal(dt, &config))
+	require.NotContains(t, config, "Annotations")
+	require.Equal(t, map[string]interface{}{"maintainer": "hlb"}, config["config"].(map[string]interface{})["Labels"])
+}
+
+func TestExportEntriesInsecurePush(t *testing.T) {
+	t.Parallel()
+
+	info := &SolveInfo{}
+	for _, opt := range []SolveOption{
+		WithPushImage("localhost:5000/openllb/hlb"),
+		WithInsecurePush(),
+	} {
+		require.NoError(t, opt(info))
+	}
+
+	exports := info.ExportEntries()
+	require.Len(t, exports, 1)
+	require.Equal(t, map[string]string{
+		"name":              "localhost:5000/openllb/hlb",
+		"push":              "true",
+		"registry.insecure": "true",
+	}, exports[0].Attrs)
+}
+
+func TestSolveOptCache(t *testing.T) {
+	t.Parallel()
+
+	cache := client.CacheOptionsEntry{
+		Type:  "registry",
+		Attrs: map[string]string{"ref": "docker.io/openllb/hlb:buildcache"},
+	}
+
+	info := &SolveInfo{}
+	for _, opt := range []SolveOption{
+		WithPushImage("docker.io/openllb/hlb"),
+		WithCacheImport(cache),
+		WithCacheExport(client.CacheOptionsEntry{
+			Type:  "registry",
+			Attrs: map[string]string{"ref": "docker.io/openllb/hlb:buildcache", "mode": "max"},
+		}),
+	} {
+		require.NoError(t, opt(info))
+	}
+
+	solveOpt := newSolveOpt(nil, info)
+	require.Len(t, solveOpt.Exports, 1)
+	require.Equal(t, []client.CacheOptionsEntry{cache}, solveOpt.CacheImports)
+	require.Equal(t, []client.CacheOptionsEntry{{
+		Type:  "registry",
+		Attrs: map[string]string{"ref": "docker.io/openllb/hlb:buildcache", "mode": "max"},
+	}}, solveOpt.CacheExports)
+}
+
+func TestWithTimeout(t *testing.T) {
+	t.Parallel()
+
+	info := &SolveInfo{}
+	for _, opt := range []SolveOption{
+		WithTimeout(time.Minute),
+		WithTimeout(30 * time.Second),
+		WithTimeout(time.Hour),
+	} {
+		require.NoError(t, opt(info))
+	}
+	require.Equal(t, 30*time.Second, info.Timeout)
+}
+
+func TestWithTimeoutDeadlineExceeded(t *testing.T) {
+	t.Parallel()
+
+	// A solve still running at the deadline fails with a timeout.
+	err := withTimeout(context.Background(), time.Millisecond, func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	var timeoutErr *ErrTimeout
+	require.ErrorAs(t, err, &timeoutErr)
+	require.Equal(t, time.Millisecond, timeoutErr.Timeout)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.EqualError(t, err, "solve exceeded timeout of 1ms")
+
+	// Other failures are returned as is.
+	errSolve := errors.New("solve failed")
+	err = withTimeout(context.Background(), time.Minute, func(ctx context.Context) error {
+		return errSolve
+	})
+	require.Equal(t, errSolve, err)
+
+}
+
+func TestWithTimeoutParentDone(t *testing.T) {
+	t.Parallel()
+
+	// Cancelling the parent context is not a timeout.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := withTimeout(ctx, time.Minute, func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	require.Equal(t, context.Canceled, err)
+
+	// Neither is a parent deadline shorter than the timeout.
+	ctx, cancel = context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	err = withTimeout(ctx, time.Minute, func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	require.Equal(t, context.DeadlineExceeded, err)
+}
@@ -4,8 +4,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"sort"
+	"strings"
 
 	"github.com/kballard/go-shellquote"
+	"github.com/moby/buildkit/client"
 	"github.com/moby/buildkit/client/llb"
 	"github.com/moby/buildkit/solver/pb"
 	"github.com/opencontainers/go-digest"
@@ -87,6 +89,9 @@ func (o op) Tree(tree treeprint.Tree) error {
 		if meta.User != "" {
 			branch.AddMetaNode("user", meta.User)
 		}
+		if meta.Hostname != "" {
+			branch.AddMetaNode("hostname", meta.Hostname)
+		}
 
 		for _, input := range pbOp.Inputs {
 			reportedInputs[input.Digest] = struct{}{}
@@ -97,6 +102,9 @@ func (o op) Tree(tree treeprint.Tree) error {
 			if mnt.Readonly {
 				opts += ",ro"
 			}
+			if mnt.Selector != "" {
+				opts += fmt.Sprintf(",selector=%s", mnt.Selector)
+			}
 			if mnt.CacheOpt != nil {
 				opts += fmt.Sprintf(",cache-id=%s", mnt.CacheOpt.ID)
 				opts += fmt.Sprintf(",sharing=%s", mnt.CacheOpt.Sharing)
@@ -146,6 +154,10 @@ func (o op) Tree(tree treeprint.Tree) error {
 		initSolve()
 		solve.AddMetaNode("pushImage", o.info.OutputPushImage)
 	}
+	if o.info.OutputPushInsecure {
+		initSolve()
+		solve.AddNode("pushInsecure")
+	}
 	if o.info.OutputLocal != "" {
 		initSolve()
 		solve.AddMetaNode("download", o.info.OutputLocal)
@@ -166,6 +178,18 @@ func (o op) Tree(tree treeprint.Tree) error {
 		}
 		solve.AddMetaNode("imageSpec", string(dt))
 	}
+	if o.info.Timeout != 0 {
+		initSolve()
+		solve.AddMetaNode("timeout", o.info.Timeout.String())
+	}
+	for _, entry := range o.info.CacheImports {
+		initSolve()
+		solve.AddMetaNode("cacheImport", cacheOptionsString(entry))
+	}
+	for _, entry := range o.info.CacheExports {
+		initSolve()
+		solve.AddMetaNode("cacheExport", cacheOptionsString(entry))
+	}
 	if len(o.info.Entitlements) > 0 {
 		initSolve()
 		ent := solve.AddBranch("entitlements")
@@ -198,3 +222,19 @@ func (o op) Tree(tree treeprint.Tree) error {
 
 	return nil
 }
+
+// cacheOptionsString formats a cache backend like the spec it was parsed
+// from, with its attributes sorted by key.
+func cacheOptionsString(entry client.CacheOptionsEntry) string {
+	keys := make([]string, 0, len(entry.Attrs))
+	for key := range entry.Attrs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	fields := []string{"type=" + entry.Type}
+	for _, key := range keys {
+		fields = append(fields, fmt.Sprintf("%s=%s", key, entry.Attrs[key]))
+	}
+	return strings.Join(fields, ",")
+}